@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// AllowDestructiveOps must be set to true before DropAllSessions will run.
+// It defaults to false so a production deployment can't wipe chat data by accident.
+var AllowDestructiveOps = false
+
+// ErrDestructiveOpsDisabled is returned when a destructive operation is attempted while AllowDestructiveOps is false
+var ErrDestructiveOpsDisabled = errors.New("destructive operations are disabled; set AllowDestructiveOps to enable them")
+
+// DropAllSessions deletes every ChatSession, ChatMessage, Entity and ErrorEvent node in a single batched mutation.
+// It is intended for test/dev resets and returns the number of nodes deleted.
+func DropAllSessions(ctx context.Context) (int, error) {
+	if !AllowDestructiveOps {
+		return 0, ErrDestructiveOpsDisabled
+	}
+
+	// 1. Query for UIDs of all sessions and messages
+	query := `
+        query getAllChatUids {
+            sessions(func: type(ChatSession)) {
+                uid
+            }
+            messages(func: type(ChatMessage)) {
+                uid
+            }
+            entities(func: type(Entity)) {
+                uid
+            }
+            errorEvents(func: type(ErrorEvent)) {
+                uid
+            }
+        }
+    `
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{Query: query})
+	if err != nil {
+		return 0, fmt.Errorf("%w: dgraph.ExecuteQuery failed while listing chat data: %w", ErrStorageFailure, err)
+	}
+
+	var queryResult struct {
+		Sessions []struct {
+			UID string `json:"uid"`
+		} `json:"sessions"`
+		Messages []struct {
+			UID string `json:"uid"`
+		} `json:"messages"`
+		Entities []struct {
+			UID string `json:"uid"`
+		} `json:"entities"`
+		ErrorEvents []struct {
+			UID string `json:"uid"`
+		} `json:"errorEvents"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return 0, fmt.Errorf("%w: failed to unmarshal Dgraph response while listing chat data: %w. JSON: %s", ErrStorageFailure, err, string(resp.Json))
+	}
+
+	// 2. Collect every node and delete them in a single batched mutation
+	var uidsToDelete []string
+	for _, s := range queryResult.Sessions {
+		if s.UID != "" {
+			uidsToDelete = append(uidsToDelete, s.UID)
+		}
+	}
+	for _, m := range queryResult.Messages {
+		if m.UID != "" {
+			uidsToDelete = append(uidsToDelete, m.UID)
+		}
+	}
+	for _, e := range queryResult.Entities {
+		if e.UID != "" {
+			uidsToDelete = append(uidsToDelete, e.UID)
+		}
+	}
+	for _, e := range queryResult.ErrorEvents {
+		if e.UID != "" {
+			uidsToDelete = append(uidsToDelete, e.UID)
+		}
+	}
+
+	if err := deleteNodesByUID(uidsToDelete); err != nil {
+		return 0, err
+	}
+
+	return len(uidsToDelete), nil
+}
+
+// deleteNodesByUID removes every predicate of the given nodes in a single N-Quad mutation
+func deleteNodesByUID(uids []string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	var nquadsBuilder strings.Builder
+	for _, uid := range uids {
+		nquadsBuilder.WriteString(fmt.Sprintf("<%s> * * .\n", uid))
+	}
+	mutation := &dgraph.Mutation{
+		DelNquads: nquadsBuilder.String(),
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		return fmt.Errorf("%w: dgraph.ExecuteMutations failed to delete %d nodes: %w", ErrStorageFailure, len(uids), err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDropAllSessionsEmptiesTheGraph(t *testing.T) {
+	env := newTestEnv(t)
+	AllowDestructiveOps = true
+	for _, id := range []string{"alpha", "beta", "gamma"} {
+		env.chat(id, "hello")
+	}
+	before := env.store.totalNodes()
+	if before == 0 {
+		t.Fatal("seeding stored nothing")
+	}
+	mutationsBefore := env.store.mutationCount()
+
+	deleted, err := DropAllSessions(context.Background())
+	if err != nil {
+		t.Fatalf("DropAllSessions: %v", err)
+	}
+	if deleted != before {
+		t.Errorf("deleted = %d, want %d", deleted, before)
+	}
+	if n := env.store.totalNodes(); n != 0 {
+		t.Errorf("%d nodes left after DropAllSessions, want 0", n)
+	}
+	if n := env.store.mutationCount() - mutationsBefore; n != 1 {
+		t.Errorf("DropAllSessions sent %d mutations, want a single batched delete", n)
+	}
+}
+
+func TestDropAllSessionsRequiresAllowDestructiveOps(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("alpha", "hello")
+	before := env.store.totalNodes()
+
+	if _, err := DropAllSessions(context.Background()); !errors.Is(err, ErrDestructiveOpsDisabled) {
+		t.Fatalf("DropAllSessions error = %v, want ErrDestructiveOpsDisabled", err)
+	}
+	if n := env.store.totalNodes(); n != before {
+		t.Errorf("nodes = %d after a refused drop, want %d", n, before)
+	}
+}
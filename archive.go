@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// ArchiveSession hides a session from ListSessions without deleting anything; GetHistory still loads it
+func ArchiveSession(sessionID string) error {
+	return setSessionArchived(sessionID, true)
+}
+
+// UnarchiveSession returns an archived session to the default ListSessions results
+func UnarchiveSession(sessionID string) error {
+	return setSessionArchived(sessionID, false)
+}
+
+func setSessionArchived(sessionID string, archived bool) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return err
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	sessionUID, err := findSessionUID(sessionID)
+	if err != nil {
+		return err
+	}
+
+	// Unarchiving removes the predicate, so unarchived and never-archived sessions look the same
+	mutation := &dgraph.Mutation{}
+	if archived {
+		mutation.SetNquads = fmt.Sprintf("<%s> <ChatSession.archived> \"true\" .\n", sessionUID)
+	} else {
+		mutation.DelNquads = fmt.Sprintf("<%s> <ChatSession.archived> * .\n", sessionUID)
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		return fmt.Errorf("%w: dgraph.ExecuteMutations failed updating archived state of session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+	return nil
+}
+
+// ListSessions returns every session, most recently active first.
+// Archived sessions are left out unless includeArchived is true.
+func ListSessions(includeArchived bool) ([]SessionInfo, error) {
+	filter := "type(ChatSession)"
+	if !includeArchived {
+		filter += " AND NOT eq(ChatSession.archived, true)"
+	}
+
+	query := `
+        query listSessions {
+            sessions(func: type(ChatSession)) @filter(` + filter + `) {` + sessionInfoFields + `
+            }
+        }
+    `
+	return querySessionInfos(query, nil)
+}
+
+// ListSessionsInRange returns the sessions whose last activity falls within [from, to], most recently active first.
+// Archived sessions are included, since reporting covers everything that happened in the window.
+func ListSessionsInRange(from time.Time, to time.Time) ([]SessionInfo, error) {
+	if from.After(to) {
+		return nil, fmt.Errorf("invalid time range: from %s is after to %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	// Rooting on the indexed lastActivity range avoids scanning every session
+	query := `
+        query listSessionsInRange($from: string, $to: string) {
+            sessions(func: between(ChatSession.lastActivity, $from, $to), orderdesc: ChatSession.lastActivity) @filter(type(ChatSession)) {` + sessionInfoFields + `
+            }
+        }
+    `
+	vars := map[string]string{
+		"$from": from.UTC().Format(time.RFC3339Nano),
+		"$to":   to.UTC().Format(time.RFC3339Nano),
+	}
+	return querySessionInfos(query, vars)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// sessionIDs returns the IDs of the listed sessions, in order
+func sessionIDs(sessions []SessionInfo) []string {
+	ids := make([]string, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.SessionID
+	}
+	return ids
+}
+
+func TestArchivedSessionsAreHiddenFromListSessions(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("kept", "hello")
+	env.chat("archived", "hello")
+
+	if err := ArchiveSession("archived"); err != nil {
+		t.Fatalf("ArchiveSession: %v", err)
+	}
+
+	listed, err := ListSessions(false)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if got := sessionIDs(listed); !slices.Equal(got, []string{"kept"}) {
+		t.Errorf("ListSessions(false) = %q, want the archived session left out", got)
+	}
+	all, err := ListSessions(true)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if got := sessionIDs(all); !slices.Contains(got, "archived") || len(got) != 2 {
+		t.Errorf("ListSessions(true) = %q, want both sessions", got)
+	}
+	for _, s := range all {
+		if s.Archived != (s.SessionID == "archived") {
+			t.Errorf("%s reports Archived = %v", s.SessionID, s.Archived)
+		}
+	}
+
+	if history, err := GetHistory("archived"); err != nil || len(history) != 3 {
+		t.Errorf("GetHistory of an archived session = %d messages, %v, want it still loadable", len(history), err)
+	}
+}
+
+func TestUnarchiveSessionRestoresItToTheDefaultList(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+	if err := ArchiveSession("s1"); err != nil {
+		t.Fatalf("ArchiveSession: %v", err)
+	}
+
+	if err := UnarchiveSession("s1"); err != nil {
+		t.Fatalf("UnarchiveSession: %v", err)
+	}
+
+	listed, err := ListSessions(false)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if got := sessionIDs(listed); !slices.Equal(got, []string{"s1"}) || listed[0].Archived {
+		t.Errorf("ListSessions(false) = %+v, want s1 back and not archived", listed)
+	}
+}
+
+func TestArchiveUnknownSession(t *testing.T) {
+	newTestEnv(t)
+
+	if err := ArchiveSession("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("ArchiveSession error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestListSessionsInRangeReturnsSessionsActiveInTheWindowNewestFirst(t *testing.T) {
+	env := newTestEnv(t)
+	start := currentTime()
+	for _, id := range []string{"before", "early", "late", "after"} {
+		env.chat(id, "hello")
+		env.clock.Advance(time.Hour)
+	}
+
+	listed, err := ListSessionsInRange(start.Add(30*time.Minute), start.Add(150*time.Minute))
+	if err != nil {
+		t.Fatalf("ListSessionsInRange: %v", err)
+	}
+	if got, want := sessionIDs(listed), []string{"late", "early"}; !slices.Equal(got, want) {
+		t.Errorf("ListSessionsInRange = %q, want %q", got, want)
+	}
+}
+
+func TestListSessionsInRangeRejectsAnInvertedRange(t *testing.T) {
+	env := newTestEnv(t)
+	now := currentTime()
+
+	if _, err := ListSessionsInRange(now, now.Add(-time.Hour)); err == nil {
+		t.Error("an inverted range was accepted")
+	}
+	if n := len(env.store.callsNamed("listSessionsInRange")); n != 0 {
+		t.Errorf("store queried %d times for an inverted range", n)
+	}
+}
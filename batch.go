@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// SaveMessagesBatch persists any number of messages for a session in a single mutation,
+// linking them all to one ChatSession node and numbering them with consecutive sequence numbers.
+// It is intended for imports and bulk seeding; messages without a timestamp are stamped with the current time.
+func SaveMessagesBatch(sessionID string, messages []DgraphChatMessage) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	now := currentTime()
+	batch := make([]DgraphChatMessage, len(messages))
+	for i, msg := range messages {
+		msg.UID = "" // Always create new nodes
+		if msg.Timestamp.IsZero() {
+			msg.Timestamp = now
+		}
+		msg.DgraphType = []string{"ChatMessage"}
+		batch[i] = msg
+	}
+
+	_, err := saveNewMessagesToDgraph(context.Background(), sessionID, "", batch)
+	return err
+}
+
+// nextMessageSeq returns the sequence number to assign to the next message saved in a session.
+// Messages stored before sequence numbers existed have none, so the message count is also considered.
+func nextMessageSeq(sessionID string) (int, error) {
+	query := `
+        query getNextSeq($sessionID: string) {
+            var(func: eq(ChatMessage.sessionIDRef, $sessionID)) @filter(type(ChatMessage)) {
+                seqs as ChatMessage.seq
+            }
+            seqStats() {
+                maxSeq: max(val(seqs))
+            }
+            messages(func: eq(ChatMessage.sessionIDRef, $sessionID)) @filter(type(ChatMessage)) {
+                total: count(uid)
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: dgraph.ExecuteQuery failed reading sequence for session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		SeqStats []struct {
+			MaxSeq *int `json:"maxSeq"` // Absent when no message has a seq yet
+		} `json:"seqStats"`
+		Messages []struct {
+			Total int `json:"total"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return 0, fmt.Errorf("%w: failed to unmarshal sequence for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+
+	last := 0
+	if len(queryResult.SeqStats) > 0 && queryResult.SeqStats[0].MaxSeq != nil {
+		last = *queryResult.SeqStats[0].MaxSeq
+	}
+	if len(queryResult.Messages) > 0 {
+		last = max(last, queryResult.Messages[0].Total)
+	}
+	return last + 1, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func batchOfMessages(n int) []DgraphChatMessage {
+	messages := make([]DgraphChatMessage, n)
+	for i := range messages {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages[i] = DgraphChatMessage{Role: role, Content: fmt.Sprintf("message %d", i)}
+	}
+	return messages
+}
+
+func TestSaveMessagesBatchLinksEveryMessageToOneSessionInOneMutation(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := SaveMessagesBatch("import", batchOfMessages(300)); err != nil {
+		t.Fatalf("SaveMessagesBatch: %v", err)
+	}
+
+	if n := env.store.mutationCount(); n != 1 {
+		t.Errorf("%d mutations for one batch, want 1", n)
+	}
+	sessions := env.store.find("ChatSession", "ChatSession.sessionID", "import")
+	if len(sessions) != 1 || env.store.nodeCount("ChatSession") != 1 {
+		t.Fatalf("batch created sessions %q (out of %d), want exactly one", sessions, env.store.nodeCount("ChatSession"))
+	}
+	history := env.history("import")
+	if len(history) != 300 {
+		t.Fatalf("%d messages linked to the session, want 300", len(history))
+	}
+	for i, msg := range history {
+		if msg.Seq != i+1 || msg.Content != fmt.Sprintf("message %d", i) {
+			t.Errorf("message %d = seq %d %q, want seq %d in order", i, msg.Seq, msg.Content, i+1)
+		}
+		if msg.Timestamp.IsZero() {
+			t.Errorf("message %d has no timestamp", i)
+		}
+	}
+}
+
+func TestSaveMessagesBatchContinuesTheSequence(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+
+	if err := SaveMessagesBatch("s1", batchOfMessages(4)); err != nil {
+		t.Fatalf("SaveMessagesBatch: %v", err)
+	}
+	history := env.history("s1")
+	if len(history) != 7 || history[6].Seq != 7 {
+		t.Errorf("history has %d messages ending at seq %d, want 7 ending at seq 7", len(history), history[len(history)-1].Seq)
+	}
+	if n := env.store.nodeCount("ChatSession"); n != 1 {
+		t.Errorf("%d sessions after a batch into an existing one, want 1", n)
+	}
+}
+
+func BenchmarkSaveMessagesBatch(b *testing.B) {
+	newTestEnv(b)
+	messages := batchOfMessages(500)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := SaveMessagesBatch(fmt.Sprintf("bench-%d", i), messages); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
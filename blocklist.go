@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Blocklist modes: what happens to a user message containing a blocked keyword
+const (
+	BlocklistReject = "reject" // Fail the turn with ErrBlockedContent before the model is called
+	BlocklistMask   = "mask"   // Replace each match with asterisks and carry on
+)
+
+// BlocklistMode selects how blocked keywords in user input are handled
+var BlocklistMode = BlocklistReject
+
+// blocklistPattern matches any blocked keyword; nil means no blocklist
+var blocklistPattern *regexp.Regexp
+
+// SetBlockedKeywords installs the keyword blocklist applied to user messages. Keywords match case-insensitively
+// and only as whole words, so "class" is not caught by "ass". Passing no keywords removes the blocklist.
+func SetBlockedKeywords(keywords []string) error {
+	var quoted []string
+	for i, kw := range keywords {
+		kw = strings.TrimSpace(kw)
+		if kw == "" {
+			return fmt.Errorf("blocked keyword %d is empty", i)
+		}
+		quoted = append(quoted, regexp.QuoteMeta(kw))
+	}
+	if len(quoted) == 0 {
+		blocklistPattern = nil
+		return nil
+	}
+	// Alternation takes the first alternative that matches, so longer keywords go first: otherwise "bad"
+	// would win inside "bad word", and "ass" inside "assface" would then fail the whole-word check
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	pattern, err := regexp.Compile(`(?i)(?:` + strings.Join(quoted, "|") + `)`)
+	if err != nil {
+		return fmt.Errorf("invalid blocked keywords: %w", err)
+	}
+	blocklistPattern = pattern
+	return nil
+}
+
+// filterUserInput applies the blocklist to a user message: it returns ErrBlockedContent in reject mode,
+// or the message with every blocked word masked in mask mode
+func filterUserInput(message string) (string, error) {
+	if blocklistPattern == nil {
+		return message, nil
+	}
+	matches := wholeWordMatches(message, blocklistPattern)
+	if len(matches) == 0 {
+		return message, nil
+	}
+	if BlocklistMode != BlocklistMask {
+		return "", fmt.Errorf("%w: message contains %d blocked keyword(s)", ErrBlockedContent, len(matches))
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(message[last:m[0]])
+		sb.WriteString(strings.Repeat("*", utf8.RuneCountInString(message[m[0]:m[1]])))
+		last = m[1]
+	}
+	sb.WriteString(message[last:])
+	return sb.String(), nil
+}
+
+// wholeWordMatches returns the matches of pattern not touching a letter or digit on either side.
+// Go's \b only knows ASCII word characters, so boundaries are checked here instead.
+func wholeWordMatches(s string, pattern *regexp.Regexp) [][]int {
+	var matches [][]int
+	for _, m := range pattern.FindAllStringIndex(s, -1) {
+		before, _ := utf8.DecodeLastRuneInString(s[:m[0]])
+		after, _ := utf8.DecodeRuneInString(s[m[1]:])
+		if isWordRune(before) || isWordRune(after) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
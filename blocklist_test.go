@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRejectModeFailsBeforeTheModelIsCalled(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetBlockedKeywords([]string{"darn", "heck"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Chat("s1", "well, DARN it"); !errors.Is(err, ErrBlockedContent) {
+		t.Fatalf("error = %v, want ErrBlockedContent", err)
+	}
+	if n := env.model.callCount(); n != 0 {
+		t.Errorf("model called %d times for blocked input", n)
+	}
+	if n := env.store.totalNodes(); n != 0 {
+		t.Errorf("%d nodes stored for blocked input", n)
+	}
+}
+
+func TestMaskModeReplacesMatchesBeforeProcessing(t *testing.T) {
+	env := newTestEnv(t)
+	BlocklistMode = BlocklistMask
+	if err := SetBlockedKeywords([]string{"darn"}); err != nil {
+		t.Fatal(err)
+	}
+
+	env.chat("s1", "Darn, darn, darn!")
+
+	const masked = "****, ****, ****!"
+	if sent := env.model.lastCall(t).Messages; sent[len(sent)-1].Content != masked {
+		t.Errorf("model received %q, want %q", sent[len(sent)-1].Content, masked)
+	}
+	if stored := env.history("s1")[1].Content; stored != masked {
+		t.Errorf("stored %q, want %q", stored, masked)
+	}
+}
+
+func TestBlockedKeywordsMatchWholeWordsOnly(t *testing.T) {
+	newTestEnv(t)
+	if err := SetBlockedKeywords([]string{"ass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, message := range []string{"first class", "assumed", "pass_word", "ass2"} {
+		if _, err := Chat("s1", message); err != nil {
+			t.Errorf("Chat(%q) = %v, want a keyword inside a word to pass", message, err)
+		}
+	}
+	if _, err := Chat("s1", "what an ass."); !errors.Is(err, ErrBlockedContent) {
+		t.Errorf("error = %v, want the standalone word blocked", err)
+	}
+}
+
+func TestLongerKeywordsWinOverTheirPrefixes(t *testing.T) {
+	newTestEnv(t)
+	BlocklistMode = BlocklistMask
+	if err := SetBlockedKeywords([]string{"bad", "bad word", "ass", "assface"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := filterUserInput("a bad word here"); got != "a ******** here" {
+		t.Errorf("masked = %q, want the whole phrase masked", got)
+	}
+	if got, _ := filterUserInput("you assface"); got != "you *******" {
+		t.Errorf("masked = %q, want the longer keyword caught", got)
+	}
+}
+
+func TestSetBlockedKeywordsValidatesAndClears(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := SetBlockedKeywords([]string{"fine", " "}); err == nil {
+		t.Error("a blank keyword was accepted")
+	}
+	if err := SetBlockedKeywords([]string{"a.b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Chat("s1", "axb"); err != nil {
+		t.Errorf("Chat = %v, want keywords matched literally, not as patterns", err)
+	}
+	if err := SetBlockedKeywords(nil); err != nil {
+		t.Fatal(err)
+	}
+	if blocklistPattern != nil {
+		t.Error("no keywords left a blocklist installed")
+	}
+	env.chat("s1", "a.b")
+}
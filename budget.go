@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TurnTimeout caps the total time a Chat turn may spend, across every model fallback and retry.
+// The budget is checked before each model attempt (and while waiting for a model slot); once it is spent
+// the turn fails with ErrTurnTimeout. A model call already in flight is allowed to finish, since the SDK
+// can't cancel it. Zero or a negative value disables the budget.
+var TurnTimeout time.Duration = 0
+
+// turnContext returns the context carrying a turn's deadline under TurnTimeout
+func turnContext() (context.Context, context.CancelFunc) {
+	if TurnTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), TurnTimeout)
+}
+
+// checkTurnBudget fails with ErrTurnTimeout once ctx's deadline has passed
+func checkTurnBudget(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrTurnTimeout, err)
+	}
+	return nil
+}
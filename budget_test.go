@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestRepeatedBlankAnswersExhaustTheTurnBudget(t *testing.T) {
+	env := newTestEnv(t)
+	TurnTimeout = 30 * time.Millisecond
+	if err := SetEmptyCompletionRetries(maxEmptyCompletionRetries); err != nil {
+		t.Fatal(err)
+	}
+	env.model.respond = func(fakeModelCall) (*openai.ChatModelOutput, error) {
+		time.Sleep(20 * time.Millisecond)
+		return textOutput(" "), nil
+	}
+
+	_, err := Chat("s1", "hello")
+
+	if !errors.Is(err, ErrTurnTimeout) {
+		t.Fatalf("error = %v, want ErrTurnTimeout", err)
+	}
+	if n := env.model.callCount(); n >= 1+maxEmptyCompletionRetries {
+		t.Errorf("model called %d times, want the budget to cut the retries short", n)
+	}
+	if n := env.store.totalNodes(); n != 0 {
+		t.Errorf("%d nodes stored for a timed-out turn", n)
+	}
+}
+
+func TestTheTurnBudgetSpansTheWholeModelChain(t *testing.T) {
+	env := newTestEnv(t)
+	TurnTimeout = 30 * time.Millisecond
+	if err := SetModelChain([]string{"a", "b", "c", "d"}); err != nil {
+		t.Fatal(err)
+	}
+	env.model.respond = func(fakeModelCall) (*openai.ChatModelOutput, error) {
+		time.Sleep(20 * time.Millisecond)
+		return nil, errors.New("503 service unavailable")
+	}
+
+	if _, err := Chat("s1", "hello"); !errors.Is(err, ErrTurnTimeout) {
+		t.Fatalf("error = %v, want ErrTurnTimeout rather than ErrModelUnavailable", err)
+	}
+	if n := env.model.callCount(); n >= 4 {
+		t.Errorf("model called %d times, want the chain abandoned once the budget ran out", n)
+	}
+}
+
+func TestNoTurnTimeoutLetsEveryRetryRun(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetEmptyCompletionRetries(3); err != nil {
+		t.Fatal(err)
+	}
+	env.model.reply(" ")
+
+	if _, err := Chat("s1", "hello"); !errors.Is(err, ErrNoCompletion) {
+		t.Fatalf("error = %v, want ErrNoCompletion", err)
+	}
+	if n := env.model.callCount(); n != 4 {
+		t.Errorf("model called %d times, want every retry", n)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// EnableResponseCache lets Chat reuse a previous completion when the model chain, the full message history
+// and the generation options are identical. Hits are still saved as normal turns, marked ChatMessage.cached.
+var EnableResponseCache = false
+
+// ResponseCacheTTL is how long a cached completion stays usable
+var ResponseCacheTTL = 10 * time.Minute
+
+// ResponseCacheMaxSize bounds the number of cached completions; the least recently used is evicted first
+var ResponseCacheMaxSize = 256
+
+// cachedResponse is the part of a completion Chat needs to rebuild a turn
+type cachedResponse struct {
+	content    string
+	toolCalls  []ToolCall
+	candidates []string
+	model      string
+}
+
+type responseCacheEntry struct {
+	key      string
+	response cachedResponse
+	expires  time.Time
+}
+
+// responseCache is an LRU of completions, safe for concurrent use
+var responseCache = struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is most recently used
+}{entries: map[string]*list.Element{}, order: list.New()}
+
+// responseCacheKey hashes everything that determines the model's answer
+func responseCacheKey(chain []string, messages []openai.RequestMessage, opts ChatOptions) (string, error) {
+	messagesJson, err := json.Marshal(messages)
+	if err != nil {
+		return "", err
+	}
+	optionsJson, err := json.Marshal(struct {
+		Tools            []ToolDefinition
+		N                int
+		PersistIndex     int
+		Stop             []string
+		ResponseFormat   string
+		Seed             int
+		PresencePenalty  float64
+		FrequencyPenalty float64
+		Temperature      float64 // The resolved default, which SetDefaultTemperature can change between turns
+		User             string
+	}{opts.Tools, opts.N, opts.PersistIndex, opts.Stop, opts.ResponseFormat, opts.Seed, opts.PresencePenalty, opts.FrequencyPenalty, defaultTemperature, opts.User})
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(strings.Join(chain, ",")))
+	h.Write([]byte{0})
+	h.Write(messagesJson)
+	h.Write([]byte{0})
+	h.Write(optionsJson)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// getCachedResponse returns the live entry for key, dropping it if it has expired
+func getCachedResponse(key string, now time.Time) (cachedResponse, bool) {
+	responseCache.mu.Lock()
+	defer responseCache.mu.Unlock()
+
+	element, ok := responseCache.entries[key]
+	if !ok {
+		return cachedResponse{}, false
+	}
+	entry := element.Value.(*responseCacheEntry)
+	if now.After(entry.expires) {
+		responseCache.order.Remove(element)
+		delete(responseCache.entries, key)
+		return cachedResponse{}, false
+	}
+	responseCache.order.MoveToFront(element)
+	return entry.response, true
+}
+
+// putCachedResponse stores a completion, evicting the least recently used entries beyond ResponseCacheMaxSize
+func putCachedResponse(key string, response cachedResponse, now time.Time) {
+	if ResponseCacheMaxSize <= 0 || ResponseCacheTTL <= 0 {
+		return
+	}
+	responseCache.mu.Lock()
+	defer responseCache.mu.Unlock()
+
+	if element, ok := responseCache.entries[key]; ok {
+		responseCache.order.Remove(element)
+	}
+	responseCache.entries[key] = responseCache.order.PushFront(&responseCacheEntry{key: key, response: response, expires: now.Add(ResponseCacheTTL)})
+
+	for responseCache.order.Len() > ResponseCacheMaxSize {
+		oldest := responseCache.order.Back()
+		responseCache.order.Remove(oldest)
+		delete(responseCache.entries, oldest.Value.(*responseCacheEntry).key)
+	}
+}
+
+// ClearResponseCache empties the response cache
+func ClearResponseCache() {
+	responseCache.mu.Lock()
+	defer responseCache.mu.Unlock()
+	responseCache.entries = map[string]*list.Element{}
+	responseCache.order.Init()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheServesAnIdenticalTurnWithoutTheModel(t *testing.T) {
+	env := newTestEnv(t)
+	EnableResponseCache = true
+	env.model.reply("first answer", "second answer")
+
+	first := env.chat("s1", "what is dgraph?")
+	second := env.chat("s2", "what is dgraph?") // Same system prompt and message, so the same model input
+
+	if n := env.model.callCount(); n != 1 {
+		t.Fatalf("model called %d times, want the second turn served from cache", n)
+	}
+	if second.Content != first.Content || second.LatencyMs != 0 {
+		t.Errorf("responses = %+v / %+v, want the second to repeat the first with no model latency", first, second)
+	}
+	if !second.Persisted {
+		t.Error("the cached turn was not persisted")
+	}
+	stored := env.history("s2")[2]
+	if stored.Content != "first answer" || !stored.Cached {
+		t.Errorf("stored cached turn = %+v, want it saved with ChatMessage.cached", stored)
+	}
+	if env.history("s1")[2].Cached {
+		t.Error("the original turn is marked cached")
+	}
+}
+
+func TestResponseCacheIsDisabledByDefault(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.chat("s1", "hello")
+	env.chat("s2", "hello")
+
+	if n := env.model.callCount(); n != 2 {
+		t.Errorf("model called %d times, want every turn to reach it", n)
+	}
+}
+
+func TestResponseCacheEntriesExpire(t *testing.T) {
+	env := newTestEnv(t)
+	EnableResponseCache = true
+	ResponseCacheTTL = time.Minute
+
+	env.chat("s1", "hello")
+	env.clock.Advance(2 * time.Minute)
+	env.chat("s2", "hello")
+	if n := env.model.callCount(); n != 2 {
+		t.Errorf("model called %d times, want the expired entry to miss", n)
+	}
+}
+
+func TestResponseCacheEvictsTheLeastRecentlyUsed(t *testing.T) {
+	env := newTestEnv(t)
+	ResponseCacheMaxSize = 2
+	now := env.clock.Now()
+
+	putCachedResponse("a", cachedResponse{content: "A"}, now)
+	putCachedResponse("b", cachedResponse{content: "B"}, now)
+	getCachedResponse("a", now) // a is now more recent than b
+	putCachedResponse("c", cachedResponse{content: "C"}, now)
+
+	if _, ok := getCachedResponse("b", now); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := getCachedResponse(key, now); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+}
+
+func TestResponseCacheIsSafeForConcurrentUse(t *testing.T) {
+	env := newTestEnv(t)
+	ResponseCacheMaxSize = 8
+	now := env.clock.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprint((i + j) % 12)
+				putCachedResponse(key, cachedResponse{content: key}, now)
+				getCachedResponse(key, now)
+			}
+		}()
+	}
+	wg.Wait()
+
+	responseCache.mu.Lock()
+	defer responseCache.mu.Unlock()
+	if n := responseCache.order.Len(); n > 8 || n != len(responseCache.entries) {
+		t.Errorf("cache holds %d entries (%d indexed), want at most 8, consistently", n, len(responseCache.entries))
+	}
+}
+
+func TestResponseCacheKeyDependsOnThePenalties(t *testing.T) {
+	env := newTestEnv(t)
+	EnableResponseCache = true
+
+	env.chatWith("s1", "hello", ChatOptions{})
+	env.chatWith("s2", "hello", ChatOptions{PresencePenalty: 1})
+	env.chatWith("s3", "hello", ChatOptions{FrequencyPenalty: 1})
+
+	if n := env.model.callCount(); n != 3 {
+		t.Errorf("model called %d times, want requests with different penalties not to share a cached answer", n)
+	}
+}
+
+func TestResponseCacheKeyDependsOnTheTemperatureAndUser(t *testing.T) {
+	env := newTestEnv(t)
+	EnableResponseCache = true
+
+	env.chatWith("s1", "hello", ChatOptions{})
+	if err := SetDefaultTemperature(0.2); err != nil {
+		t.Fatal(err)
+	}
+	env.chatWith("s2", "hello", ChatOptions{})
+	env.chatWith("s3", "hello", ChatOptions{User: "end-user-1"})
+
+	if n := env.model.callCount(); n != 3 {
+		t.Errorf("model called %d times, want a changed temperature or user not to share a cached answer", n)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// CleanupExpiredSessions deletes sessions (and their messages, entities and error events) whose ChatSession.lastActivity is older than olderThan.
+// Sessions saved before lastActivity existed have no such predicate and are never expired.
+// It returns the number of sessions removed and is meant to be driven by an external scheduler.
+func CleanupExpiredSessions(olderThan time.Duration) (int, error) {
+	if olderThan <= 0 {
+		return 0, fmt.Errorf("olderThan must be positive, got %s", olderThan)
+	}
+	cutoff := currentTime().Add(-olderThan)
+
+	// 1. Find expired sessions and, through their sessionIDs, the messages, entities and error events that belong to them
+	query := `
+        query getExpiredSessions($cutoff: string) {
+            expired as var(func: lt(ChatSession.lastActivity, $cutoff)) @filter(type(ChatSession)) {
+                expiredIDs as ChatSession.sessionID
+            }
+            sessions(func: uid(expired)) {
+                uid
+                sessionID: ChatSession.sessionID
+            }
+            messages(func: eq(ChatMessage.sessionIDRef, val(expiredIDs))) @filter(type(ChatMessage)) {
+                uid
+            }
+            entities(func: eq(Entity.sessionIDRef, val(expiredIDs))) @filter(type(Entity)) {
+                uid
+            }
+            errorEvents(func: eq(ErrorEvent.sessionIDRef, val(expiredIDs))) @filter(type(ErrorEvent)) {
+                uid
+            }
+        }
+    `
+	vars := map[string]string{"$cutoff": cutoff.Format(time.RFC3339Nano)}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: dgraph.ExecuteQuery failed while finding expired sessions: %w", ErrStorageFailure, err)
+	}
+
+	var queryResult struct {
+		Sessions []struct {
+			UID       string `json:"uid"`
+			SessionID string `json:"sessionID"`
+		} `json:"sessions"`
+		Messages []struct {
+			UID string `json:"uid"`
+		} `json:"messages"`
+		Entities []struct {
+			UID string `json:"uid"`
+		} `json:"entities"`
+		ErrorEvents []struct {
+			UID string `json:"uid"`
+		} `json:"errorEvents"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return 0, fmt.Errorf("%w: failed to unmarshal expired sessions: %w. JSON: %s", ErrStorageFailure, err, string(resp.Json))
+	}
+
+	if len(queryResult.Sessions) == 0 {
+		return 0, nil
+	}
+
+	// 2. Delete sessions, messages, entities and error events together
+	var uidsToDelete []string
+	for _, s := range queryResult.Sessions {
+		uidsToDelete = append(uidsToDelete, s.UID)
+	}
+	for _, m := range queryResult.Messages {
+		uidsToDelete = append(uidsToDelete, m.UID)
+	}
+	for _, e := range queryResult.Entities {
+		uidsToDelete = append(uidsToDelete, e.UID)
+	}
+	for _, e := range queryResult.ErrorEvents {
+		uidsToDelete = append(uidsToDelete, e.UID)
+	}
+	if err := deleteNodesByUID(uidsToDelete); err != nil {
+		return 0, err
+	}
+
+	logger.Info("expired sessions cleaned up", "sessions", len(queryResult.Sessions), "messages", len(queryResult.Messages), "entities", len(queryResult.Entities), "errorEvents", len(queryResult.ErrorEvents), "cutoff", cutoff)
+	return len(queryResult.Sessions), nil
+}
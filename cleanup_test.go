@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanupExpiredSessionsRemovesOnlyOldSessions(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("old-1", "hello")
+	env.chat("old-2", "hello")
+	env.clock.Advance(48 * time.Hour)
+	env.chat("recent", "hello")
+
+	removed, err := CleanupExpiredSessions(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("CleanupExpiredSessions: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+	for _, id := range []string{"old-1", "old-2"} {
+		if len(env.store.find("ChatSession", "ChatSession.sessionID", id)) != 0 || len(env.store.find("ChatMessage", "ChatMessage.sessionIDRef", id)) != 0 {
+			t.Errorf("session %s or its messages survived the cleanup", id)
+		}
+	}
+	if n := len(env.history("recent")); n != 3 {
+		t.Errorf("recent session has %d messages after the cleanup, want 3", n)
+	}
+}
+
+func TestEveryTurnRefreshesLastActivity(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+	env.clock.Advance(48 * time.Hour)
+	env.chat("s1", "still here")
+
+	if removed, err := CleanupExpiredSessions(24 * time.Hour); err != nil || removed != 0 {
+		t.Errorf("CleanupExpiredSessions = %d, %v; want an active session kept", removed, err)
+	}
+	if n := len(env.history("s1")); n != 5 {
+		t.Errorf("session has %d messages, want 5", n)
+	}
+}
+
+func TestCleanupExpiredSessionsRejectsNonPositiveAge(t *testing.T) {
+	env := newTestEnv(t)
+	if _, err := CleanupExpiredSessions(0); err == nil {
+		t.Error("CleanupExpiredSessions(0) succeeded")
+	}
+	if n := env.store.callCount(); n != 0 {
+		t.Errorf("a rejected cleanup reached the store %d times", n)
+	}
+}
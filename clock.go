@@ -0,0 +1,20 @@
+package main
+
+import "time"
+
+// clock is the source of every timestamp this package generates (message and session times, rate limits, cache expiry)
+var clock = time.Now
+
+// SetClock replaces the time source, e.g. with a fixed or manually advanced clock in tests.
+// Passing nil restores time.Now.
+func SetClock(c func() time.Time) {
+	if c == nil {
+		c = time.Now
+	}
+	clock = c
+}
+
+// currentTime returns the clock's current time in UTC
+func currentTime() time.Time {
+	return clock().UTC()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStoredTimestampsComeFromTheInjectedClock(t *testing.T) {
+	env := newTestEnv(t)
+	fixed := time.Date(2024, 6, 1, 12, 30, 0, 0, time.FixedZone("UTC-3", -3*60*60))
+	SetClock(func() time.Time { return fixed })
+	env.model.reply("a1", "a2")
+
+	env.chat("s1", "q1")
+	env.chat("s1", "q2")
+
+	history := env.history("s1")
+	for _, msg := range history {
+		if !msg.Timestamp.Equal(fixed) || msg.Timestamp.Location() != time.UTC {
+			t.Errorf("%q stored at %s, want the clock's time %s in UTC", msg.Content, msg.Timestamp, fixed.UTC())
+		}
+	}
+	// Identical timestamps still replay in the order they were written
+	if got := messageContents(history); !slices.Equal(got, []string{defaultSystemPrompt, "q1", "a1", "q2", "a2"}) {
+		t.Errorf("history = %q, want sequence order", got)
+	}
+	sessionUID := env.store.find("ChatSession", "ChatSession.sessionID", "s1")[0]
+	for _, predicate := range []string{"ChatSession.createdAt", "ChatSession.lastActivity"} {
+		if got, _ := env.store.value(sessionUID, predicate).(time.Time); !got.Equal(fixed) {
+			t.Errorf("%s = %s, want %s", predicate, got, fixed)
+		}
+	}
+}
+
+func TestSetClockNilRestoresTheSystemClock(t *testing.T) {
+	newTestEnv(t)
+	SetClock(func() time.Time { return time.Time{} })
+
+	SetClock(nil)
+
+	if d := time.Since(currentTime()); d < 0 || d > time.Minute {
+		t.Errorf("currentTime is %s away from now, want the system clock", d)
+	}
+}
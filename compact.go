@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+const compactionPrompt = `Summarize the conversation below so it can replace the original messages as context for later turns.
+Keep names, facts, decisions, open questions and anything the user asked to be remembered; drop greetings and small talk.
+Write plain prose in the third person, without a preamble.`
+
+// summaryPrefix introduces the stored summary so the model reads it as context rather than an instruction
+const summaryPrefix = "Summary of the earlier conversation: "
+
+// CompactHistory replaces all but the most recent keepRecent messages of a session with one model-written
+// summary, stored as a system message marked ChatMessage.summary, and deletes the messages it summarizes.
+// The session's own system prompt(s) and pinned messages are kept as they are; an earlier summary is folded into the new one.
+func CompactHistory(sessionID string, keepRecent int) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return err
+	}
+	if keepRecent < 0 {
+		return fmt.Errorf("keepRecent must not be negative, got %d", keepRecent)
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	// 1. Pick the messages to summarize: the oldest ones, excluding system prompts and pinned messages
+	history, err := loadHistoryFromDgraph(context.Background(), sessionID)
+	if err != nil {
+		return err
+	}
+	var compactable []DgraphChatMessage
+	for _, msg := range history {
+		if (msg.Role != "system" || msg.Summary) && !msg.Pinned {
+			compactable = append(compactable, msg)
+		}
+	}
+	if len(compactable) <= keepRecent {
+		return nil // Nothing old enough to compact
+	}
+	cut := len(compactable) - keepRecent
+	for cut < len(compactable) && isOrphanToolResult(compactable[cut]) {
+		cut++ // A tool result goes with the call that produced it
+	}
+	toCompact := compactable[:cut]
+
+	// 2. Ask the model for the summary
+	summary, answeringModel, err := summarizeMessages(context.Background(), toCompact)
+	if err != nil {
+		return err
+	}
+
+	// 3. Store the summary where the last summarized message was, and delete the originals, in one mutation.
+	// Taking over the last message's timestamp and seq keeps the summary ahead of everything that was kept.
+	last := toCompact[len(toCompact)-1]
+	summaryObject := map[string]interface{}{
+		"uid":                      "_:summary",
+		"dgraph.type":              "ChatMessage",
+		"ChatMessage.role":         "system",
+		"ChatMessage.content":      summaryPrefix + summary,
+		"ChatMessage.timestamp":    last.Timestamp.Format(time.RFC3339Nano),
+		"ChatMessage.sessionIDRef": sessionID,
+		"ChatMessage.seq":          last.Seq,
+		"ChatMessage.summary":      true,
+		"ChatMessage.source":       SourceModel,
+	}
+	if answeringModel != "" {
+		summaryObject["ChatMessage.model"] = answeringModel
+	}
+	setJsonPayload, err := json.Marshal(summaryObject)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Dgraph SetJson: %w", err)
+	}
+	var nquadsBuilder strings.Builder
+	for _, msg := range toCompact {
+		nquadsBuilder.WriteString(fmt.Sprintf("<%s> * * .\n", msg.UID))
+	}
+	mutation := &dgraph.Mutation{
+		SetJson:   string(setJsonPayload),
+		DelNquads: nquadsBuilder.String(),
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		return fmt.Errorf("%w: dgraph.ExecuteMutations failed compacting session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	logger.Info("compacted session history", "sessionID", sessionID, "summarized", len(toCompact), "kept", len(compactable)-len(toCompact))
+	return nil
+}
+
+// summarizeMessages has the model summarize messages for later use as context, returning the summary
+// (redacted when EnableRedaction is on) and the model that wrote it. Earlier summaries are labelled as such.
+func summarizeMessages(ctx context.Context, messages []DgraphChatMessage) (string, string, error) {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		role := msg.Role
+		if msg.Summary {
+			role = "earlier summary"
+		}
+		transcript.WriteString(fmt.Sprintf("%s: %s\n", role, msg.Content))
+	}
+	requestMessages := []openai.RequestMessage{
+		openai.NewSystemMessage(compactionPrompt),
+		openai.NewUserMessage(transcript.String()),
+	}
+	configure := func(input *openai.ChatModelInput) {
+		input.Temperature = 0
+	}
+	output, answeringModel, err := completeWithFallback(ctx, modelChain, requestMessages, configure, 0)
+	if err != nil {
+		return "", "", err
+	}
+	summary := strings.TrimSpace(output.Choices[0].Message.Content)
+	if EnableRedaction {
+		summary = redactPII(summary) // Never persist raw PII
+	}
+	return summary, answeringModel, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompactHistoryReplacesOldMessagesWithASummary(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("a1", "a2", "a3", "the summary")
+	env.chat("s1", "u1")
+	env.chat("s1", "u2")
+	env.chat("s1", "u3")
+	before := env.store.nodeCount("ChatMessage")
+
+	if err := CompactHistory("s1", 2); err != nil {
+		t.Fatalf("CompactHistory: %v", err)
+	}
+
+	if after := env.store.nodeCount("ChatMessage"); after != before-3 {
+		t.Errorf("ChatMessage nodes = %d, want %d: four summarized messages replaced by one summary", after, before-3)
+	}
+	history := env.history("s1")
+	if got, want := messageContents(history), []string{defaultSystemPrompt, summaryPrefix + "the summary", "u3", "a3"}; !slices.Equal(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+	if !history[1].Summary || history[1].Role != "system" {
+		t.Errorf("summary message = %+v, want a system message with ChatMessage.summary set", history[1])
+	}
+	if summaries := env.store.find("ChatMessage", "ChatMessage.summary", true); len(summaries) != 1 {
+		t.Errorf("%d nodes carry ChatMessage.summary, want 1", len(summaries))
+	}
+	transcript := env.model.lastCall(t).Messages[1].Content
+	for _, content := range []string{"u1", "a1", "u2", "a2"} {
+		if !containsLine(transcript, content) {
+			t.Errorf("summarized transcript %q is missing %q", transcript, content)
+		}
+	}
+}
+
+func TestCompactHistoryKeepsPinnedMessages(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("a1", "a2", "the summary")
+	pinned := env.chat("s1", "u1")
+	env.chat("s1", "u2")
+	if err := PinMessage("s1", pinned.MessageUID); err != nil {
+		t.Fatalf("PinMessage: %v", err)
+	}
+
+	if err := CompactHistory("s1", 1); err != nil {
+		t.Fatalf("CompactHistory: %v", err)
+	}
+
+	if got := messageContents(env.history("s1")); !slices.Contains(got, "a1") {
+		t.Errorf("history = %q, want the pinned reply kept", got)
+	}
+}
+
+func TestCompactHistoryLeavesShortSessionsAlone(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+	calls := env.model.callCount()
+
+	if err := CompactHistory("s1", 5); err != nil {
+		t.Fatalf("CompactHistory: %v", err)
+	}
+	if n := env.model.callCount(); n != calls {
+		t.Errorf("model called %d more times for a session with nothing to compact", n-calls)
+	}
+	if n := len(env.history("s1")); n != 3 {
+		t.Errorf("history has %d messages, want all 3 kept", n)
+	}
+}
+
+func TestCompactHistoryKeepsEverythingWhenTheSummaryFails(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "u1")
+	env.chat("s1", "u2")
+	env.model.respond = downModel
+
+	if err := CompactHistory("s1", 1); !errors.Is(err, ErrModelUnavailable) {
+		t.Fatalf("error = %v, want ErrModelUnavailable", err)
+	}
+	if n := len(env.history("s1")); n != 5 {
+		t.Errorf("history has %d messages after a failed compaction, want all 5", n)
+	}
+}
+
+func TestCompactHistoryRejectsANegativeKeepRecent(t *testing.T) {
+	newTestEnv(t)
+
+	if err := CompactHistory("s1", -1); err == nil {
+		t.Error("a negative keepRecent was accepted")
+	}
+}
+
+// containsLine reports whether text has a "role: content" line ending in content
+func containsLine(text string, content string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasSuffix(line, ": "+content) {
+			return true
+		}
+	}
+	return false
+}
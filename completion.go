@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// emptyCompletionRetries is how many extra attempts are made when the model answers with blank content.
+// Retries happen before anything is persisted, so the user message is never stored twice.
+var emptyCompletionRetries = 1
+
+// maxEmptyCompletionRetries bounds SetEmptyCompletionRetries so a misbehaving model can't stall a turn indefinitely
+const maxEmptyCompletionRetries = 5
+
+// SetEmptyCompletionRetries sets how many times a blank model response is retried before Chat fails with ErrNoCompletion.
+// Zero disables retrying.
+func SetEmptyCompletionRetries(retries int) error {
+	if retries < 0 || retries > maxEmptyCompletionRetries {
+		return fmt.Errorf("empty completion retries must be between 0 and %d, got %d", maxEmptyCompletionRetries, retries)
+	}
+	emptyCompletionRetries = retries
+	return nil
+}
+
+// requestCompletion invokes the model and guarantees the returned output has a usable choice at choiceIndex:
+// either non-blank content or at least one tool call, judged after any post-processing (see withPostProcessing).
+// Otherwise it fails with ErrNoCompletion.
+func requestCompletion(ctx context.Context, model *openai.ChatModel, input *openai.ChatModelInput, choiceIndex int) (*openai.ChatModelOutput, error) {
+	for attempt := 0; ; attempt++ {
+		output, err := invokeModel(ctx, model, input)
+		if errors.Is(err, ErrTurnTimeout) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: error invoking model: %w", ErrModelUnavailable, err)
+		}
+		if len(output.Choices) == 0 {
+			return nil, fmt.Errorf("%w: model returned no choices", ErrNoCompletion)
+		}
+		if choiceIndex >= len(output.Choices) {
+			return nil, fmt.Errorf("%w: model returned %d choices, wanted index %d", ErrNoCompletion, len(output.Choices), choiceIndex)
+		}
+		postProcess(ctx, output)
+
+		message := output.Choices[choiceIndex].Message
+		if strings.TrimSpace(message.Content) != "" || len(message.ToolCalls) > 0 {
+			return output, nil
+		}
+		if attempt >= emptyCompletionRetries {
+			return nil, fmt.Errorf("%w: model returned empty content after %d attempts", ErrNoCompletion, attempt+1)
+		}
+		logger.Info("model returned empty content, retrying", "attempt", attempt+1)
+	}
+}
+
+// invokeModel calls the model once it holds a slot under SetMaxConcurrentModelCalls, unless the turn budget runs out first
+func invokeModel(ctx context.Context, model *openai.ChatModel, input *openai.ChatModelInput) (*openai.ChatModelOutput, error) {
+	if err := checkTurnBudget(ctx); err != nil {
+		return nil, err
+	}
+	slotCtx, cancel := modelSlotContext(ctx)
+	defer cancel()
+	release, err := acquireModelSlot(slotCtx)
+	if err != nil {
+		if budgetErr := checkTurnBudget(ctx); budgetErr != nil {
+			return nil, budgetErr
+		}
+		return nil, err
+	}
+	defer release()
+	return invokeChatModel(model, input)
+}
+
+// invokeChatModel sends one request to the host model; invokeModel is its only caller
+var invokeChatModel = func(model *openai.ChatModel, input *openai.ChatModelInput) (*openai.ChatModelOutput, error) {
+	return model.Invoke(input)
+}
+
+// completionCandidates returns the trimmed content of every choice, in the order the model returned them
+func completionCandidates(output *openai.ChatModelOutput) []string {
+	candidates := make([]string, len(output.Choices))
+	for i, choice := range output.Choices {
+		candidates[i] = strings.TrimSpace(choice.Message.Content)
+	}
+	return candidates
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestChatWithZeroChoicesFailsWithoutPersisting(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.replies = []*openai.ChatModelOutput{{}}
+
+	_, err := Chat("s1", "hello")
+	if !errors.Is(err, ErrNoCompletion) {
+		t.Fatalf("Chat error = %v, want ErrNoCompletion", err)
+	}
+	if n := env.store.totalNodes(); n != 0 {
+		t.Errorf("%d nodes stored for a turn with no completion", n)
+	}
+}
+
+func TestBlankCompletionIsRetriedOnce(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("   \n", "second try")
+
+	resp := env.chat("s1", "hello")
+	if resp.Content != "second try" {
+		t.Errorf("Content = %q, want the retried answer", resp.Content)
+	}
+	if n := env.model.callCount(); n != 2 {
+		t.Errorf("model called %d times, want 2", n)
+	}
+}
+
+func TestPersistentlyBlankCompletionFailsWithoutPersisting(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply(" ")
+
+	_, err := Chat("s1", "hello")
+	if !errors.Is(err, ErrNoCompletion) {
+		t.Fatalf("Chat error = %v, want ErrNoCompletion", err)
+	}
+	if n := env.model.callCount(); n != 1+emptyCompletionRetries {
+		t.Errorf("model called %d times, want %d", n, 1+emptyCompletionRetries)
+	}
+	if n := env.store.totalNodes(); n != 0 {
+		t.Errorf("%d nodes stored for a blank completion", n)
+	}
+}
+
+func TestBlankCompletionsAreRetriedWithoutDuplicatingTheUserMessage(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetEmptyCompletionRetries(2); err != nil {
+		t.Fatalf("SetEmptyCompletionRetries: %v", err)
+	}
+	env.model.reply("", "  ", "finally")
+
+	env.chat("s1", "hello")
+
+	var users, assistants []DgraphChatMessage
+	for _, msg := range env.history("s1") {
+		switch msg.Role {
+		case "user":
+			users = append(users, msg)
+		case "assistant":
+			assistants = append(assistants, msg)
+		}
+	}
+	if len(users) != 1 || users[0].Content != "hello" {
+		t.Errorf("stored user messages = %+v, want exactly one", users)
+	}
+	if len(assistants) != 1 || assistants[0].Content != "finally" {
+		t.Errorf("stored assistant messages = %+v, want the one non-empty answer", assistants)
+	}
+	if n := env.model.callCount(); n != 3 {
+		t.Errorf("model called %d times, want 3", n)
+	}
+}
+
+func TestSetEmptyCompletionRetriesValidates(t *testing.T) {
+	newTestEnv(t)
+
+	for _, retries := range []int{-1, maxEmptyCompletionRetries + 1} {
+		if err := SetEmptyCompletionRetries(retries); err == nil {
+			t.Errorf("SetEmptyCompletionRetries(%d) accepted", retries)
+		}
+	}
+	if emptyCompletionRetries != 1 {
+		t.Errorf("emptyCompletionRetries = %d, want rejected values to leave the default", emptyCompletionRetries)
+	}
+}
+
+func TestZeroEmptyCompletionRetriesFailsOnTheFirstBlankAnswer(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetEmptyCompletionRetries(0); err != nil {
+		t.Fatal(err)
+	}
+	env.model.reply("", "never reached")
+
+	if _, err := Chat("s1", "hello"); !errors.Is(err, ErrNoCompletion) {
+		t.Fatalf("Chat error = %v, want ErrNoCompletion", err)
+	}
+	if n := env.model.callCount(); n != 1 {
+		t.Errorf("model called %d times, want no retry", n)
+	}
+}
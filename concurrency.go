@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ModelSlotTimeout bounds how long a model call waits for a free slot when SetMaxConcurrentModelCalls
+// is in effect; the call then fails with ErrModelUnavailable. Zero or a negative value waits indefinitely.
+var ModelSlotTimeout = 30 * time.Second
+
+// modelSlots limits concurrent model invocations; a nil channel means unbounded
+var modelSlots = struct {
+	mu    sync.Mutex
+	slots chan struct{}
+}{}
+
+// SetMaxConcurrentModelCalls caps how many model invocations may run at once across all sessions.
+// Calls beyond the cap wait for a slot. Zero removes the cap. Calls already holding a slot are not affected.
+func SetMaxConcurrentModelCalls(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("max concurrent model calls must not be negative, got %d", limit)
+	}
+	modelSlots.mu.Lock()
+	defer modelSlots.mu.Unlock()
+	if limit == 0 {
+		modelSlots.slots = nil
+	} else {
+		modelSlots.slots = make(chan struct{}, limit)
+	}
+	return nil
+}
+
+// acquireModelSlot blocks until a model call may proceed or ctx is done, and returns the function that frees the slot
+func acquireModelSlot(ctx context.Context) (func(), error) {
+	modelSlots.mu.Lock()
+	slots := modelSlots.slots // Released to the same channel even if the limit changes meanwhile
+	modelSlots.mu.Unlock()
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no model slot free (limit %d): %w", cap(slots), ctx.Err())
+	}
+}
+
+// modelSlotContext returns the context a model call waits for its slot under, honoring ModelSlotTimeout
+func modelSlotContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if ModelSlotTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, ModelSlotTimeout)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// blockingModel holds every model call until release is closed, signalling entered as each call starts
+type blockingModel struct {
+	entered chan string
+	release chan struct{}
+}
+
+func newBlockingModel() *blockingModel {
+	return &blockingModel{entered: make(chan string, 8), release: make(chan struct{})}
+}
+
+func (m *blockingModel) respond(call fakeModelCall) (*openai.ChatModelOutput, error) {
+	m.entered <- call.Messages[len(call.Messages)-1].Content
+	<-m.release
+	return textOutput("done"), nil
+}
+
+func TestAModelCallWaitsForAFreeSlot(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetMaxConcurrentModelCalls(1); err != nil {
+		t.Fatal(err)
+	}
+	model := newBlockingModel()
+	env.model.respond = model.respond
+
+	results := make(chan error, 2)
+	go func() { _, err := Chat("s1", "first"); results <- err }()
+	if got := <-model.entered; got != "first" {
+		t.Fatalf("first call = %q", got)
+	}
+	go func() { _, err := Chat("s2", "second"); results <- err }()
+
+	select {
+	case got := <-model.entered:
+		t.Fatalf("%q reached the model while the only slot was taken", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(model.release)
+	if got := <-model.entered; got != "second" {
+		t.Errorf("second call = %q", got)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("Chat: %v", err)
+		}
+	}
+}
+
+func TestAModelCallGivesUpAfterModelSlotTimeout(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetMaxConcurrentModelCalls(1); err != nil {
+		t.Fatal(err)
+	}
+	ModelSlotTimeout = 20 * time.Millisecond
+	model := newBlockingModel()
+	env.model.respond = model.respond
+
+	first := make(chan error, 1)
+	go func() { _, err := Chat("s1", "first"); first <- err }()
+	<-model.entered
+
+	_, err := Chat("s2", "second")
+	close(model.release)
+
+	if !errors.Is(err, ErrModelUnavailable) {
+		t.Errorf("error = %v, want ErrModelUnavailable once the slot wait times out", err)
+	}
+	if err := <-first; err != nil {
+		t.Errorf("first Chat: %v", err)
+	}
+	if n := len(env.history("s2")); n != 0 {
+		t.Errorf("%d messages stored for the timed-out turn", n)
+	}
+}
+
+func TestNoLimitLetsCallsRunConcurrently(t *testing.T) {
+	env := newTestEnv(t)
+	model := newBlockingModel()
+	env.model.respond = model.respond
+
+	results := make(chan error, 2)
+	go func() { _, err := Chat("s1", "first"); results <- err }()
+	go func() { _, err := Chat("s2", "second"); results <- err }()
+	<-model.entered
+	<-model.entered // Both are in the model at once
+
+	close(model.release)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("Chat: %v", err)
+		}
+	}
+}
+
+func TestSetMaxConcurrentModelCallsRejectsANegativeLimit(t *testing.T) {
+	newTestEnv(t)
+
+	if err := SetMaxConcurrentModelCalls(-1); err == nil {
+		t.Error("a negative limit was accepted")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// ErrNothingToContinue is returned by ContinueLastResponse when the session's last message wasn't cut off
+var ErrNothingToContinue = errors.New("last message was not cut off by the length limit")
+
+// finishReasonLength is the finish reason the model reports when it stopped at the token limit
+const finishReasonLength = "length"
+
+const continueInstruction = "Continue your previous response exactly where it stopped. Do not repeat any of it and do not add a preamble."
+
+// ContinueLastResponse extends an assistant reply that was cut off at the token limit (finish reason "length").
+// The continuation is appended to the stored message in place, so no new message is created; the response
+// carries the combined content. Any other last message yields ErrNothingToContinue.
+// Like a Chat turn, it uses the session's model, runs the post-processors and is bounded by TurnTimeout.
+func ContinueLastResponse(sessionID string) (*ChatResponse, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := turnContext()
+	defer cancel()
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	// 1. The last message must be an assistant reply that hit the length limit
+	history, err := loadHistoryFromDgraph(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	last := history[len(history)-1]
+	if last.Role != "assistant" || last.FinishReason != finishReasonLength {
+		return nil, fmt.Errorf("%w: session %s", ErrNothingToContinue, sessionID)
+	}
+
+	// A reply MaxResponseChars cut short continues from its full text, when StoreUntruncatedResponse kept it
+	base := last.Content
+	if last.Truncated {
+		fullContent, err := getFullContent(last.UID)
+		if err != nil {
+			return nil, err
+		}
+		if fullContent != "" {
+			base = fullContent
+		}
+	}
+
+	// 2. Ask the session's model to pick up where the partial reply ends
+	sessionModel, err := getSessionModel(sessionID)
+	if err != nil {
+		logger.Error("error loading session model, using the default chain", "sessionID", sessionID, "error", err)
+	}
+	chain := resolveModelChain(ChatOptions{}, sessionModel)
+
+	promptHistory := append([]DgraphChatMessage(nil), history...)
+	promptHistory[len(promptHistory)-1].Content = base
+	modelMessages := append(toModelMessages(promptHistory), openai.NewUserMessage(continueInstruction))
+	configureInput := func(input *openai.ChatModelInput) {
+		input.Temperature = defaultTemperature
+	}
+	complete := withPostProcessing(completeWithFallback) // No-op unless post-processors are registered
+	invokeStart := currentTime()
+	output, answeringModel, err := complete(ctx, chain, modelMessages, configureInput, 0)
+	if err != nil {
+		return nil, err
+	}
+	latencyMs := currentTime().Sub(invokeStart).Milliseconds()
+	chosen := output.Choices[0]
+
+	content := base + strings.TrimRightFunc(chosen.Message.Content, unicode.IsSpace)
+	content, moderationReason := moderateContent(content)
+	fullContent := content
+	content, truncated := truncateResponse(content, MaxResponseChars)
+	storedContent := content
+	if EnableRedaction {
+		// Never persist raw PII
+		storedContent = redactPII(storedContent)
+		fullContent = redactPII(fullContent)
+	}
+
+	// 3. Rewrite the stored message in place
+	update := map[string]interface{}{
+		"uid":                          last.UID,
+		"ChatMessage.content":          storedContent,
+		"ChatMessage.finishReason":     chosen.FinishReason,
+		"ChatMessage.completionTokens": last.CompletionTokens + output.Usage.CompletionTokens,
+		"ChatMessage.latencyMs":        last.LatencyMs + latencyMs,
+	}
+	if moderationReason != "" {
+		update["ChatMessage.moderationReason"] = moderationReason
+	}
+	if truncated {
+		update["ChatMessage.truncated"] = true
+		if StoreUntruncatedResponse {
+			update["ChatMessage.fullContent"] = fullContent
+		}
+	} else if last.Truncated {
+		update["ChatMessage.truncated"] = false // A raised MaxResponseChars now fits the whole reply
+	}
+	setJsonPayload, err := json.Marshal(update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Dgraph SetJson: %w", err)
+	}
+	mutation := &dgraph.Mutation{
+		SetJson: string(setJsonPayload),
+	}
+
+	persisted := true
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		// As with Chat, the content is still returned and Persisted=false reports the gap
+		logger.Error("error saving continued response", "sessionID", sessionID, "uid", last.UID, "error", fmt.Errorf("%w: %w", ErrStorageFailure, err))
+		persisted = false
+	}
+
+	return &ChatResponse{
+		Content:      content,
+		MessageUID:   last.UID,
+		Persisted:    persisted,
+		Truncated:    truncated,
+		ModelUsed:    answeringModel,
+		LatencyMs:    latencyMs,
+		FinishReason: chosen.FinishReason,
+	}, nil
+}
+
+// getFullContent returns the untruncated content stored for a message, or "" when none was kept
+func getFullContent(messageUID string) (string, error) {
+	query := `
+        query getFullContent($uid: string) {
+            message(func: uid($uid)) @filter(type(ChatMessage)) {
+                uid
+                fullContent: ChatMessage.fullContent
+            }
+        }
+    `
+	vars := map[string]string{"$uid": messageUID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: dgraph.ExecuteQuery failed loading full content of message %s: %w", ErrStorageFailure, messageUID, err)
+	}
+
+	var queryResult struct {
+		Message []struct {
+			FullContent string `json:"fullContent"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return "", fmt.Errorf("%w: failed to unmarshal full content of message %s: %w. JSON: %s", ErrStorageFailure, messageUID, err, string(resp.Json))
+	}
+	if len(queryResult.Message) == 0 {
+		return "", nil
+	}
+	return queryResult.Message[0].FullContent, nil
+}
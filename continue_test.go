@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// cutOffTurn stores a turn whose reply stopped at the token limit, then queues the continuation
+func cutOffTurn(env *testEnv, partial string, continuation string) *ChatResponse {
+	env.t.Helper()
+	env.model.replies = []*openai.ChatModelOutput{outputWithChoices(finishReasonLength, partial), textOutput(continuation)}
+	return env.chat("s1", "tell me a story")
+}
+
+func TestContinueLastResponseExtendsTheMessageInPlace(t *testing.T) {
+	env := newTestEnv(t)
+	first := cutOffTurn(env, "Once upon a", " time, the end.")
+	if first.FinishReason != finishReasonLength {
+		t.Fatalf("FinishReason = %q, want %q", first.FinishReason, finishReasonLength)
+	}
+
+	resp, err := ContinueLastResponse("s1")
+	if err != nil {
+		t.Fatalf("ContinueLastResponse: %v", err)
+	}
+
+	if resp.Content != "Once upon a time, the end." || resp.MessageUID != first.MessageUID || resp.FinishReason != "stop" || !resp.Persisted {
+		t.Errorf("response = %+v, want the combined content on message %s", resp, first.MessageUID)
+	}
+	last := env.model.lastCall(t).Messages
+	if last[len(last)-2] != (fakeMessage{Role: "assistant", Content: "Once upon a"}) || last[len(last)-1].Content != continueInstruction {
+		t.Errorf("continuation request ended with %+v, want the partial reply and the instruction", last[len(last)-2:])
+	}
+	history := env.history("s1")
+	if len(history) != 3 || history[2].Content != "Once upon a time, the end." || history[2].FinishReason != "stop" {
+		t.Errorf("history = %+v, want the reply rewritten in place", history)
+	}
+	if history[2].CompletionTokens != 10 {
+		t.Errorf("completion tokens = %d, want both calls' usage summed", history[2].CompletionTokens)
+	}
+}
+
+func TestContinueLastResponseNeedsALengthCutReply(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+
+	if _, err := ContinueLastResponse("s1"); !errors.Is(err, ErrNothingToContinue) {
+		t.Errorf("error = %v, want ErrNothingToContinue", err)
+	}
+	if _, err := ContinueLastResponse("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("error for a missing session = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestContinueLastResponseUsesTheSessionModelAndPostProcessors(t *testing.T) {
+	env := newTestEnv(t)
+	AllowedModels = []string{modelName, "other-model"}
+	cutOffTurn(env, "Once upon a", " time")
+	if err := SetSessionModel("s1", "other-model"); err != nil {
+		t.Fatal(err)
+	}
+	AddPostProcessor(strings.ToUpper)
+
+	resp, err := ContinueLastResponse("s1")
+	if err != nil {
+		t.Fatalf("ContinueLastResponse: %v", err)
+	}
+
+	if call := env.model.lastCall(t); call.Model != "other-model" || resp.ModelUsed != "other-model" {
+		t.Errorf("continued with %q (reported %q), want the session's model", call.Model, resp.ModelUsed)
+	}
+	if resp.Content != "Once upon a TIME" {
+		t.Errorf("Content = %q, want the post-processed continuation appended", resp.Content)
+	}
+}
+
+func TestContinueLastResponseIsBoundedByTheTurnTimeout(t *testing.T) {
+	env := newTestEnv(t)
+	cutOffTurn(env, "Once upon a", " time")
+	TurnTimeout = time.Nanosecond
+	calls := env.model.callCount()
+
+	if _, err := ContinueLastResponse("s1"); !errors.Is(err, ErrTurnTimeout) {
+		t.Errorf("error = %v, want ErrTurnTimeout", err)
+	}
+	if n := env.model.callCount(); n != calls {
+		t.Errorf("the model was called after the budget ran out")
+	}
+}
+
+func TestContinueLastResponseStartsFromTheUntruncatedContent(t *testing.T) {
+	env := newTestEnv(t)
+	MaxResponseChars = 12
+	StoreUntruncatedResponse = true
+	first := cutOffTurn(env, "Once upon a time there was", " a dragon.")
+	if !first.Truncated {
+		t.Fatalf("the first reply was not truncated: %+v", first)
+	}
+
+	resp, err := ContinueLastResponse("s1")
+	if err != nil {
+		t.Fatalf("ContinueLastResponse: %v", err)
+	}
+
+	sent := env.model.lastCall(t).Messages
+	if got := sent[len(sent)-2].Content; got != "Once upon a time there was" {
+		t.Errorf("continuation request showed the model %q, want the full reply", got)
+	}
+	const full = "Once upon a time there was a dragon."
+	if want, _ := truncateResponse(full, 12); resp.Content != want || !resp.Truncated {
+		t.Errorf("response = %q (truncated %v), want %q", resp.Content, resp.Truncated, want)
+	}
+	if stored := env.store.value(first.MessageUID, "ChatMessage.fullContent"); stored != full {
+		t.Errorf("ChatMessage.fullContent = %v, want %q", stored, full)
+	}
+}
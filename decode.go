@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// decodeDgraphResponse unmarshals a Dgraph query response into v, which must point to a struct of query blocks.
+// An empty or null body means nothing matched and leaves v untouched. Anything else that isn't a well-formed
+// JSON object whose blocks fit v fails with ErrMalformedResponse, so callers can tell it apart from no results.
+func decodeDgraphResponse(raw string, v any) error {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" || trimmed == "null" {
+		return nil
+	}
+	if !json.Valid([]byte(trimmed)) {
+		return fmt.Errorf("%w: body is not valid JSON", ErrMalformedResponse)
+	}
+	if !strings.HasPrefix(trimmed, "{") {
+		return fmt.Errorf("%w: body is not a JSON object", ErrMalformedResponse)
+	}
+	if err := json.Unmarshal([]byte(trimmed), v); err != nil {
+		return fmt.Errorf("%w: %w", ErrMalformedResponse, err)
+	}
+	return nil
+}
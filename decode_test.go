@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestLoadHistoryTreatsEmptyResponsesAsAnEmptySession(t *testing.T) {
+	for name, body := range map[string]string{
+		"empty body":    "",
+		"null body":     "null",
+		"empty object":  "{}",
+		"null messages": `{"messages": null}`,
+		"no messages":   `{"messages": []}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.store.responses["getSessionMessages"] = body
+
+			messages, err := loadHistoryFromDgraph(context.Background(), "s1")
+			if err != nil || messages == nil || len(messages) != 0 {
+				t.Errorf("loadHistoryFromDgraph = %v, %v, want an empty slice and no error", messages, err)
+			}
+		})
+	}
+}
+
+func TestLoadHistoryRejectsMalformedResponses(t *testing.T) {
+	for name, body := range map[string]string{
+		"truncated":       `{"messages": [{"uid": "0x1"`,
+		"not an object":   `[{"uid": "0x1"}]`,
+		"wrong shape":     `{"messages": "0x1"}`,
+		"wrong timestamp": `{"messages": [{"uid": "0x1", "timestamp": "yesterday"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.store.responses["getSessionMessages"] = body
+
+			_, err := loadHistoryFromDgraph(context.Background(), "s1")
+			if !errors.Is(err, ErrMalformedResponse) || !errors.Is(err, ErrStorageFailure) {
+				t.Errorf("error = %v, want ErrMalformedResponse wrapped in ErrStorageFailure", err)
+			}
+		})
+	}
+}
+
+func TestLoadHistoryQueryErrorsAreNotMalformedResponses(t *testing.T) {
+	env := newTestEnv(t)
+	env.store.fail = func(fakeStoreCall) error { return errors.New("connection refused") }
+
+	_, err := loadHistoryFromDgraph(context.Background(), "s1")
+	if !errors.Is(err, ErrStorageFailure) || errors.Is(err, ErrMalformedResponse) {
+		t.Errorf("error = %v, want ErrStorageFailure without ErrMalformedResponse", err)
+	}
+}
+
+func TestLoadHistoryReordersAndWarnsAboutMisorderedResults(t *testing.T) {
+	env := newTestEnv(t)
+	recorder := &recordingLogger{}
+	SetLogger(recorder)
+	env.store.responses["getSessionMessages"] = `{"messages": [
+		{"uid": "0x3", "role": "assistant", "content": "third", "timestamp": "2025-01-01T10:02:00Z", "seq": 3},
+		{"uid": "0x1", "role": "system", "content": "first", "timestamp": "2025-01-01T10:00:00Z", "seq": 1},
+		{"uid": "0x2", "role": "user", "content": "second", "timestamp": "2025-01-01T10:01:00Z", "seq": 2}
+	]}`
+
+	messages, err := loadHistoryFromDgraph(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("loadHistoryFromDgraph: %v", err)
+	}
+
+	if got := messageContents(messages); !slices.Equal(got, []string{"first", "second", "third"}) {
+		t.Errorf("history = %q, want the sorted order", got)
+	}
+	if !recorder.has("WARN stored messages came back out of timestamp order") {
+		t.Errorf("log = %q, want a warning about the misordered result", recorder.entries)
+	}
+}
+
+func TestLoadHistoryDoesNotWarnAboutTiesOrderedBySeq(t *testing.T) {
+	env := newTestEnv(t)
+	recorder := &recordingLogger{}
+	SetLogger(recorder)
+	// The two halves of a turn share a timestamp; Dgraph doesn't order those by seq, so this is expected
+	env.store.responses["getSessionMessages"] = `{"messages": [
+		{"uid": "0x2", "role": "assistant", "content": "reply", "timestamp": "2025-01-01T10:00:00Z", "seq": 2},
+		{"uid": "0x1", "role": "user", "content": "question", "timestamp": "2025-01-01T10:00:00Z", "seq": 1}
+	]}`
+
+	messages, err := loadHistoryFromDgraph(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("loadHistoryFromDgraph: %v", err)
+	}
+
+	if got := messageContents(messages); !slices.Equal(got, []string{"question", "reply"}) {
+		t.Errorf("history = %q, want seq to order the tie", got)
+	}
+	if recorder.has("WARN") {
+		t.Errorf("log = %q, want no warning for same-timestamp messages", recorder.entries)
+	}
+}
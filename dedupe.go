@@ -0,0 +1,40 @@
+package main
+
+import "time"
+
+// DuplicateMessageWindow enables de-duplication of double-submitted messages: a user message identical to the
+// session's last stored user message, arriving within this window of it, returns the reply already stored for
+// that message instead of running a new turn. Zero or a negative value disables de-duplication.
+var DuplicateMessageWindow time.Duration = 0
+
+// findDuplicateTurn checks whether userMessage repeats the last turn of history within DuplicateMessageWindow
+// and, if so, returns that turn's stored reply
+func findDuplicateTurn(history []DgraphChatMessage, userMessage string, now time.Time) (*ChatResponse, bool) {
+	if DuplicateMessageWindow <= 0 || len(history) < 2 {
+		return nil, false
+	}
+	reply := history[len(history)-1]
+	previous := history[len(history)-2]
+	if (reply.Role != "assistant" && reply.Role != "tool") || previous.Role != "user" {
+		return nil, false
+	}
+
+	if EnableRedaction {
+		userMessage = redactPII(userMessage) // Stored content is redacted, so compare like with like
+	}
+	if previous.Content != userMessage || now.Sub(previous.Timestamp) > DuplicateMessageWindow {
+		return nil, false
+	}
+
+	return &ChatResponse{
+		Content:      reply.Content,
+		ToolCalls:    reply.ToolCalls,
+		MessageUID:   reply.UID,
+		Persisted:    true,
+		Fallback:     reply.Fallback,
+		Truncated:    reply.Truncated,
+		ModelUsed:    reply.Model,
+		FinishReason: reply.FinishReason,
+		Warnings:     []string{warning(WarningDuplicateMessage, "same message as %s ago; returning the stored reply", now.Sub(previous.Timestamp).Round(time.Millisecond))},
+	}, true
+}
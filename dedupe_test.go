@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestADoubleSubmittedMessageReturnsTheStoredReply(t *testing.T) {
+	env := newTestEnv(t)
+	DuplicateMessageWindow = 5 * time.Second
+	env.model.reply("first answer", "second answer")
+
+	first := env.chat("s1", "hello")
+	env.clock.Advance(time.Second)
+	second := env.chat("s1", "hello")
+
+	if n := env.model.callCount(); n != 1 {
+		t.Errorf("model called %d times, want the repeat not to run a turn", n)
+	}
+	if second.Content != "first answer" || second.MessageUID != first.MessageUID {
+		t.Errorf("repeat response = %+v, want the stored reply %q", second, first.Content)
+	}
+	if !hasWarning(second.Warnings, WarningDuplicateMessage) {
+		t.Errorf("Warnings = %q, want a %s warning", second.Warnings, WarningDuplicateMessage)
+	}
+	if n := len(env.history("s1")); n != 3 {
+		t.Errorf("history has %d messages, want a single stored turn", n)
+	}
+}
+
+func TestARepeatOutsideTheWindowRunsANewTurn(t *testing.T) {
+	env := newTestEnv(t)
+	DuplicateMessageWindow = 5 * time.Second
+	env.model.reply("first answer", "second answer")
+
+	env.chat("s1", "hello")
+	env.clock.Advance(10 * time.Second)
+	resp := env.chat("s1", "hello")
+
+	if resp.Content != "second answer" || len(env.history("s1")) != 5 {
+		t.Errorf("response = %q with %d stored messages, want a second turn", resp.Content, len(env.history("s1")))
+	}
+}
+
+func TestDeDuplicationIsOffByDefault(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.chat("s1", "hello")
+	env.chat("s1", "hello")
+
+	if n := env.model.callCount(); n != 2 {
+		t.Errorf("model called %d times, want both submissions answered", n)
+	}
+}
+
+func TestADifferentMessageIsNotADuplicate(t *testing.T) {
+	env := newTestEnv(t)
+	DuplicateMessageWindow = time.Minute
+
+	env.chat("s1", "hello")
+	env.chat("s1", "hello again")
+
+	if n := env.model.callCount(); n != 2 {
+		t.Errorf("model called %d times, want both messages answered", n)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxContextDocuments bounds how many documents a single turn may attach
+const maxContextDocuments = 20
+
+// Document is a retrieved passage given to the model as grounding for one turn
+type Document struct {
+	ID    string `json:"id,omitempty"` // Stable identifier stored as the reference; the title is stored when empty
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// ContextDocumentTemplate formats each document; {{id}}, {{title}} and {{text}} are filled in
+var ContextDocumentTemplate = "## {{title}}\n{{text}}"
+
+// ContextDocumentsPreamble introduces the documents in the context message
+var ContextDocumentsPreamble = "Use the following documents to answer the user's next message. If they don't contain the answer, say so."
+
+// contextDocumentsMessage builds the system message carrying the documents. Only references are ever stored,
+// so the message lives in the model input alone.
+func contextDocumentsMessage(documents []Document) (DgraphChatMessage, error) {
+	sections := make([]string, 0, len(documents)+1)
+	if ContextDocumentsPreamble != "" {
+		sections = append(sections, ContextDocumentsPreamble)
+	}
+	for _, doc := range documents {
+		vars := map[string]string{"id": doc.ID, "title": doc.Title, "text": doc.Text}
+		section, err := renderTemplate(ContextDocumentTemplate, vars, false)
+		if err != nil {
+			return DgraphChatMessage{}, err
+		}
+		sections = append(sections, section)
+	}
+	return DgraphChatMessage{Role: "system", Content: strings.Join(sections, "\n\n")}, nil
+}
+
+// documentRefs returns what is persisted for each document: its ID, or its title when it has none
+func documentRefs(documents []Document) []string {
+	refs := make([]string, len(documents))
+	for i, doc := range documents {
+		refs[i] = doc.ID
+		if refs[i] == "" {
+			refs[i] = doc.Title
+		}
+	}
+	return refs
+}
+
+func validateContextDocuments(documents []Document) error {
+	if len(documents) > maxContextDocuments {
+		return fmt.Errorf("%w: %d context documents exceeds the maximum of %d", ErrInvalidOptions, len(documents), maxContextDocuments)
+	}
+	for i, doc := range documents {
+		if strings.TrimSpace(doc.Text) == "" {
+			return fmt.Errorf("%w: context document %d has no text", ErrInvalidOptions, i)
+		}
+		if strings.TrimSpace(doc.ID) == "" && strings.TrimSpace(doc.Title) == "" {
+			return fmt.Errorf("%w: context document %d needs an id or a title", ErrInvalidOptions, i)
+		}
+	}
+	return nil
+}
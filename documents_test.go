@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestContextDocumentsReachTheModelAndOnlyReferencesAreStored(t *testing.T) {
+	env := newTestEnv(t)
+	docs := []Document{
+		{ID: "kb-1", Title: "Refunds", Text: "Refunds take 5 days."},
+		{Title: "Shipping", Text: "Shipping is free over $50."},
+	}
+
+	env.chatWith("s1", "how long do refunds take?", ChatOptions{ContextDocuments: docs})
+
+	sent := env.model.lastCall(t).Messages
+	docsMessage := sent[len(sent)-2]
+	if docsMessage.Role != "system" || !strings.HasPrefix(docsMessage.Content, ContextDocumentsPreamble) {
+		t.Fatalf("message before the user's = %+v, want the documents' system message", docsMessage)
+	}
+	for _, want := range []string{"## Refunds\nRefunds take 5 days.", "## Shipping\nShipping is free over $50."} {
+		if !strings.Contains(docsMessage.Content, want) {
+			t.Errorf("context message %q is missing %q", docsMessage.Content, want)
+		}
+	}
+	if sent[len(sent)-1].Content != "how long do refunds take?" {
+		t.Errorf("last message = %+v, want the user's", sent[len(sent)-1])
+	}
+
+	history := env.history("s1")
+	user := history[len(history)-2]
+	if !slices.Equal(user.DocumentRefs, []string{"kb-1", "Shipping"}) {
+		t.Errorf("stored DocumentRefs = %q, want the ID, or the title when there is none", user.DocumentRefs)
+	}
+	for _, msg := range history {
+		if strings.Contains(msg.Content, "Refunds take 5 days.") {
+			t.Errorf("document text was stored in %+v", msg)
+		}
+	}
+}
+
+func TestContextDocumentTemplateIsConfigurable(t *testing.T) {
+	env := newTestEnv(t)
+	ContextDocumentTemplate = "[{{id}}] {{text}}"
+	ContextDocumentsPreamble = ""
+
+	env.chatWith("s1", "hi", ChatOptions{ContextDocuments: []Document{{ID: "a", Text: "alpha"}, {ID: "b", Text: "beta"}}})
+
+	sent := env.model.lastCall(t).Messages
+	if got := sent[len(sent)-2].Content; got != "[a] alpha\n\n[b] beta" {
+		t.Errorf("context message = %q, want each document in the template, no preamble", got)
+	}
+}
+
+func TestContextDocumentsAreSentOnlyWithTheirTurn(t *testing.T) {
+	env := newTestEnv(t)
+	env.chatWith("s1", "first", ChatOptions{ContextDocuments: []Document{{Title: "Doc", Text: "secret text"}}})
+
+	env.chat("s1", "second")
+
+	for _, msg := range env.model.lastCall(t).Messages {
+		if strings.Contains(msg.Content, "secret text") {
+			t.Errorf("a later turn was sent the earlier document: %+v", msg)
+		}
+	}
+}
+
+func TestInvalidContextDocumentsAreRejected(t *testing.T) {
+	env := newTestEnv(t)
+	tooMany := make([]Document, maxContextDocuments+1)
+	for i := range tooMany {
+		tooMany[i] = Document{Title: "t", Text: "x"}
+	}
+
+	for name, docs := range map[string][]Document{
+		"no text":       {{Title: "Empty", Text: "  "}},
+		"no id or name": {{Text: "orphan"}},
+		"too many":      tooMany,
+	} {
+		if _, err := ChatWithOptions("s1", "hi", ChatOptions{ContextDocuments: docs}); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: error = %v, want ErrInvalidOptions", name, err)
+		}
+	}
+	if n := env.model.callCount(); n != 0 {
+		t.Errorf("model called %d times for invalid documents", n)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// EnableEntityExtraction turns on extracting (subject, predicate, object) facts from every Chat turn.
+// Facts are stored as Entity nodes referencing their session by ID, like messages do.
+var EnableEntityExtraction = false
+
+// maxTriplesPerTurn bounds how many facts a single turn may add
+const maxTriplesPerTurn = 20
+
+// Triple is one extracted fact, such as ("Alice", "works at", "Acme")
+type Triple struct {
+	Subject   string `json:"subject"`
+	Predicate string `json:"predicate"`
+	Object    string `json:"object"`
+}
+
+// Entity is a stored Triple
+type Entity struct {
+	UID       string    `json:"uid,omitempty"`
+	Subject   string    `json:"subject"`   // Dgraph predicate: Entity.subject
+	Predicate string    `json:"predicate"` // Dgraph predicate: Entity.predicate
+	Object    string    `json:"object"`    // Dgraph predicate: Entity.object
+	CreatedAt time.Time `json:"createdAt"` // Dgraph predicate: Entity.createdAt
+}
+
+// EntityExtractor pulls facts out of one exchange
+type EntityExtractor interface {
+	Extract(userMessage string, assistantMessage string) ([]Triple, error)
+}
+
+const entityExtractionPrompt = `Extract the durable facts stated in the conversation below as subject-predicate-object triples.
+Only include facts about people, places, organizations, things and their relationships; skip small talk.
+Reply with JSON of the form {"triples":[{"subject":"...","predicate":"...","object":"..."}]}, using an empty list when there are none.`
+
+// modelEntityExtractor asks the chat model chain to extract triples in JSON mode
+type modelEntityExtractor struct{}
+
+func (modelEntityExtractor) Extract(userMessage string, assistantMessage string) ([]Triple, error) {
+	messages := []openai.RequestMessage{
+		openai.NewSystemMessage(entityExtractionPrompt),
+		openai.NewUserMessage(fmt.Sprintf("User: %s\nAssistant: %s", userMessage, assistantMessage)),
+	}
+	configure := func(input *openai.ChatModelInput) {
+		input.Temperature = 0
+		input.ResponseFormat = openai.ResponseFormatJson
+	}
+	output, _, err := completeJSON(context.Background(), modelChain, messages, configure, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var extracted struct {
+		Triples []Triple `json:"triples"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output.Choices[0].Message.Content)), &extracted); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal extracted triples: %w", ErrInvalidJSONResponse, err)
+	}
+	return extracted.Triples, nil
+}
+
+var entityExtractor EntityExtractor = modelEntityExtractor{}
+
+// SetEntityExtractor replaces the extractor used when EnableEntityExtraction is on.
+// Passing nil restores the model-backed default.
+func SetEntityExtractor(e EntityExtractor) {
+	if e == nil {
+		e = modelEntityExtractor{}
+	}
+	entityExtractor = e
+}
+
+// extractAndSaveEntities extracts facts from one exchange and stores them, returning how many were saved
+func extractAndSaveEntities(sessionID string, userMessage string, assistantMessage string, now time.Time) (int, error) {
+	triples, err := entityExtractor.Extract(userMessage, assistantMessage)
+	if err != nil {
+		return 0, err
+	}
+
+	var entityObjects []interface{}
+	for _, t := range triples {
+		t.Subject, t.Predicate, t.Object = strings.TrimSpace(t.Subject), strings.TrimSpace(t.Predicate), strings.TrimSpace(t.Object)
+		if t.Subject == "" || t.Predicate == "" || t.Object == "" {
+			continue // Incomplete facts aren't worth keeping
+		}
+		entityObjects = append(entityObjects, map[string]interface{}{
+			"uid":                 fmt.Sprintf("_:entity%d", len(entityObjects)),
+			"dgraph.type":         "Entity",
+			"Entity.subject":      t.Subject,
+			"Entity.predicate":    t.Predicate,
+			"Entity.object":       t.Object,
+			"Entity.sessionIDRef": sessionID,
+			"Entity.createdAt":    now.UTC().Format(time.RFC3339Nano),
+		})
+		if len(entityObjects) == maxTriplesPerTurn {
+			break
+		}
+	}
+	if len(entityObjects) == 0 {
+		return 0, nil
+	}
+
+	setJsonPayload, err := json.Marshal(entityObjects)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal entities: %w", err)
+	}
+	mutation := &dgraph.Mutation{
+		SetJson: string(setJsonPayload),
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		return 0, fmt.Errorf("%w: dgraph.ExecuteMutations failed saving entities for session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+	return len(entityObjects), nil
+}
+
+// RetrieveEntities returns the facts extracted from a session, oldest first
+func RetrieveEntities(sessionID string) ([]Entity, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+
+	query := `
+        query getSessionEntities($sessionID: string) {
+            entities(func: eq(Entity.sessionIDRef, $sessionID), orderasc: Entity.createdAt) @filter(type(Entity)) {
+                uid
+                subject: Entity.subject
+                predicate: Entity.predicate
+                object: Entity.object
+                createdAt: Entity.createdAt
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: dgraph.ExecuteQuery failed loading entities for session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Entities []Entity `json:"entities"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal entities for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	if queryResult.Entities == nil {
+		return []Entity{}, nil
+	}
+	return queryResult.Entities, nil
+}
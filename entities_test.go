@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedExtractor returns the same triples for every exchange and records what it was given
+type fixedExtractor struct {
+	triples []Triple
+	inputs  [][2]string
+}
+
+func (e *fixedExtractor) Extract(userMessage string, assistantMessage string) ([]Triple, error) {
+	e.inputs = append(e.inputs, [2]string{userMessage, assistantMessage})
+	return e.triples, nil
+}
+
+// newEntityEnv is a test env with entity extraction on, backed by a fixedExtractor of two facts
+func newEntityEnv(t *testing.T) (*testEnv, *fixedExtractor) {
+	env := newTestEnv(t)
+	EnableEntityExtraction = true
+	extractor := &fixedExtractor{triples: []Triple{
+		{Subject: " Alice ", Predicate: "works at", Object: "Acme"},
+		{Subject: "Acme", Predicate: "is in", Object: "Lisbon"},
+		{Subject: "Alice", Predicate: "", Object: "incomplete"},
+	}}
+	SetEntityExtractor(extractor)
+	return env, extractor
+}
+
+// entityTriples returns the stored entities as triples, in order
+func entityTriples(entities []Entity) []Triple {
+	triples := make([]Triple, len(entities))
+	for i, e := range entities {
+		triples[i] = Triple{Subject: e.Subject, Predicate: e.Predicate, Object: e.Object}
+	}
+	return triples
+}
+
+func TestExtractedEntitiesAreStoredAndRetrievable(t *testing.T) {
+	env, extractor := newEntityEnv(t)
+	env.model.reply("Acme sounds nice")
+
+	env.chat("s1", "Alice works at Acme in Lisbon")
+
+	if want := [][2]string{{"Alice works at Acme in Lisbon", "Acme sounds nice"}}; !reflect.DeepEqual(extractor.inputs, want) {
+		t.Errorf("extractor got %q, want the exchange %q", extractor.inputs, want)
+	}
+	entities, err := RetrieveEntities("s1")
+	if err != nil {
+		t.Fatalf("RetrieveEntities: %v", err)
+	}
+	want := []Triple{{"Alice", "works at", "Acme"}, {"Acme", "is in", "Lisbon"}}
+	if got := entityTriples(entities); !reflect.DeepEqual(got, want) {
+		t.Errorf("RetrieveEntities = %+v, want the trimmed complete facts %+v", got, want)
+	}
+	if n := len(env.history("s1")); n != 3 {
+		t.Errorf("history has %d messages, want entities kept out of it", n)
+	}
+}
+
+func TestEntityExtractionIsOptIn(t *testing.T) {
+	env, extractor := newEntityEnv(t)
+	EnableEntityExtraction = false
+
+	env.chat("s1", "Alice works at Acme")
+
+	if len(extractor.inputs) != 0 || env.store.nodeCount("Entity") != 0 {
+		t.Errorf("extraction ran with EnableEntityExtraction off")
+	}
+}
+
+func TestEntityExtractionSeesRedactedContent(t *testing.T) {
+	env, extractor := newEntityEnv(t)
+	EnableRedaction = true
+	RedactLLMInput = false
+	env.model.reply("I'll write to alice@example.com")
+
+	env.chat("s1", "Alice is alice@example.com")
+
+	if len(extractor.inputs) != 1 {
+		t.Fatalf("extractor called %d times", len(extractor.inputs))
+	}
+	for _, text := range extractor.inputs[0] {
+		if strings.Contains(text, "alice@example.com") {
+			t.Errorf("extractor input %q carries PII the stored messages don't", text)
+		}
+	}
+}
+
+func TestEntitiesFollowTheirSessionThroughRenameAndCleanup(t *testing.T) {
+	env, _ := newEntityEnv(t)
+	env.chat("old-name", "Alice works at Acme")
+	EnableEntityExtraction = false
+	env.chat("no-entities", "hello")
+
+	if err := RenameSession("old-name", "new-name"); err != nil {
+		t.Fatalf("RenameSession: %v", err)
+	}
+	if err := RenameSession("no-entities", "still-none"); err != nil {
+		t.Fatalf("RenameSession: %v", err)
+	}
+	if entities, err := RetrieveEntities("new-name"); err != nil || len(entities) != 2 {
+		t.Errorf("RetrieveEntities after rename = %d entities, %v, want both moved", len(entities), err)
+	}
+	if n := env.store.nodeCount("Entity"); n != 2 {
+		t.Errorf("%d Entity nodes after the renames, want 2 (no empty entity created)", n)
+	}
+
+	env.clock.Advance(48 * time.Hour)
+	if _, err := CleanupExpiredSessions(24 * time.Hour); err != nil {
+		t.Fatalf("CleanupExpiredSessions: %v", err)
+	}
+	if n := env.store.nodeCount("Entity"); n != 0 {
+		t.Errorf("%d Entity nodes survived the cleanup of their session", n)
+	}
+}
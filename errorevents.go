@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// PersistTurnErrors stores an ErrorEvent whenever a Chat turn fails at the model stage (after the user message
+// was accepted), so failure patterns can be inspected per session with ListErrorEvents.
+// ErrorEvents are separate nodes, never part of the history sent to the model.
+var PersistTurnErrors = false
+
+// ErrorEvent is a recorded Chat failure
+type ErrorEvent struct {
+	UID       string    `json:"uid,omitempty"`
+	Kind      string    `json:"kind"`      // Dgraph predicate: ErrorEvent.kind, the metrics error kind ("model_unavailable", "timeout", ...)
+	Message   string    `json:"message"`   // Dgraph predicate: ErrorEvent.message
+	CreatedAt time.Time `json:"createdAt"` // Dgraph predicate: ErrorEvent.createdAt
+}
+
+// recordErrorEvent stores turnErr for the session when PersistTurnErrors is on.
+// It is best-effort: a failure to store is logged and never replaces the turn's own error.
+func recordErrorEvent(sessionID string, turnErr error) {
+	if !PersistTurnErrors {
+		return
+	}
+	message := turnErr.Error()
+	if EnableRedaction {
+		message = redactPII(message) // Error text can quote the user's input
+	}
+
+	setJsonPayload, err := json.Marshal(map[string]interface{}{
+		"uid":                     "_:errorEvent",
+		"dgraph.type":             "ErrorEvent",
+		"ErrorEvent.kind":         errorKind(turnErr),
+		"ErrorEvent.message":      message,
+		"ErrorEvent.sessionIDRef": sessionID,
+		"ErrorEvent.createdAt":    currentTime().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		logger.Error("error marshaling error event", "sessionID", sessionID, "error", err)
+		return
+	}
+	mutation := &dgraph.Mutation{
+		SetJson: string(setJsonPayload),
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		logger.Error("error saving error event", "sessionID", sessionID, "error", err)
+	}
+}
+
+// ListErrorEvents returns the failures recorded for a session, oldest first
+func ListErrorEvents(sessionID string) ([]ErrorEvent, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+
+	query := `
+        query getErrorEvents($sessionID: string) {
+            events(func: eq(ErrorEvent.sessionIDRef, $sessionID), orderasc: ErrorEvent.createdAt) @filter(type(ErrorEvent)) {
+                uid
+                kind: ErrorEvent.kind
+                message: ErrorEvent.message
+                createdAt: ErrorEvent.createdAt
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: dgraph.ExecuteQuery failed loading error events for session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Events []ErrorEvent `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal error events for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	if queryResult.Events == nil {
+		return []ErrorEvent{}, nil
+	}
+	return queryResult.Events, nil
+}
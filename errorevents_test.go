@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// failTurn runs a Chat turn against a down model, which PersistTurnErrors records as an ErrorEvent
+func failTurn(env *testEnv, sessionID string) {
+	env.t.Helper()
+	respond := env.model.respond
+	env.model.respond = downModel
+	defer func() { env.model.respond = respond }()
+	if _, err := Chat(sessionID, "hello?"); err == nil {
+		env.t.Fatalf("Chat(%q) succeeded against a down model", sessionID)
+	}
+}
+
+// errorEventCount lists a session's error events and returns how many there are
+func errorEventCount(env *testEnv, sessionID string) int {
+	env.t.Helper()
+	events, err := ListErrorEvents(sessionID)
+	if err != nil {
+		env.t.Fatalf("ListErrorEvents(%s): %v", sessionID, err)
+	}
+	return len(events)
+}
+
+func TestFailedTurnsAreRecordedAsErrorEvents(t *testing.T) {
+	env := newTestEnv(t)
+	PersistTurnErrors = true
+	env.chat("s1", "hi")
+
+	failTurn(env, "s1")
+
+	events, err := ListErrorEvents("s1")
+	if err != nil {
+		t.Fatalf("ListErrorEvents: %v", err)
+	}
+	if len(events) != 1 || events[0].Kind != "model_unavailable" || events[0].Message == "" || events[0].CreatedAt.IsZero() {
+		t.Fatalf("events = %+v, want one model_unavailable event with a message and time", events)
+	}
+
+	env.chat("s1", "again")
+	for _, m := range env.model.lastCall(t).Messages {
+		if m.Content == events[0].Message {
+			t.Errorf("the error event reached the model input: %q", m.Content)
+		}
+	}
+	if n := len(env.history("s1")); n != 5 {
+		t.Errorf("history has %d messages, want the error kept out of it", n)
+	}
+}
+
+func TestFailedTurnsAreNotRecordedByDefault(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hi")
+
+	failTurn(env, "s1")
+
+	if n := env.store.nodeCount("ErrorEvent"); n != 0 {
+		t.Errorf("%d ErrorEvent nodes stored with PersistTurnErrors off", n)
+	}
+}
+
+func TestCleanupExpiredSessionsDeletesTheirErrorEvents(t *testing.T) {
+	env := newTestEnv(t)
+	PersistTurnErrors = true
+	env.chat("old", "hi")
+	failTurn(env, "old")
+	env.clock.Advance(48 * time.Hour)
+	env.chat("recent", "hi")
+	failTurn(env, "recent")
+
+	if _, err := CleanupExpiredSessions(24 * time.Hour); err != nil {
+		t.Fatalf("CleanupExpiredSessions: %v", err)
+	}
+
+	if n := errorEventCount(env, "old"); n != 0 {
+		t.Errorf("expired session kept %d error events", n)
+	}
+	if n := errorEventCount(env, "recent"); n != 1 {
+		t.Errorf("recent session has %d error events, want 1", n)
+	}
+}
+
+func TestRenameSessionMovesItsErrorEvents(t *testing.T) {
+	env := newTestEnv(t)
+	PersistTurnErrors = true
+	env.chat("before", "hi")
+	failTurn(env, "before")
+
+	if err := RenameSession("before", "after"); err != nil {
+		t.Fatalf("RenameSession: %v", err)
+	}
+
+	if old, renamed := errorEventCount(env, "before"), errorEventCount(env, "after"); old != 0 || renamed != 1 {
+		t.Errorf("error events: %d under the old ID and %d under the new, want 0 and 1", old, renamed)
+	}
+}
+
+func TestMergeSessionsMovesTheSecondarysErrorEvents(t *testing.T) {
+	env := newTestEnv(t)
+	PersistTurnErrors = true
+	env.chat("primary", "hi")
+	failTurn(env, "primary")
+	env.chat("secondary", "hi")
+	failTurn(env, "secondary")
+
+	if err := MergeSessions("primary", "secondary"); err != nil {
+		t.Fatalf("MergeSessions: %v", err)
+	}
+
+	if primary, secondary := errorEventCount(env, "primary"), errorEventCount(env, "secondary"); primary != 2 || secondary != 0 {
+		t.Errorf("error events: %d on the primary and %d on the secondary, want 2 and 0", primary, secondary)
+	}
+	if n := env.store.nodeCount("ErrorEvent"); n != 2 {
+		t.Errorf("%d ErrorEvent nodes, want the 2 recorded ones and no new node", n)
+	}
+}
+
+func TestSessionsWithoutErrorEventsMergeAndRenameWithoutCreatingAny(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("a", "hi")
+	env.chat("b", "hi")
+
+	if err := MergeSessions("a", "b"); err != nil {
+		t.Fatalf("MergeSessions: %v", err)
+	}
+	if err := RenameSession("a", "c"); err != nil {
+		t.Fatalf("RenameSession: %v", err)
+	}
+	if n := env.store.nodeCount("ErrorEvent"); n != 0 {
+		t.Errorf("%d ErrorEvent nodes created", n)
+	}
+	if n := env.store.totalNodes(); n != 1+len(env.history("c")) {
+		t.Errorf("%d nodes in the store, want only the session and its messages", n)
+	}
+}
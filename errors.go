@@ -0,0 +1,44 @@
+package main
+
+import "errors"
+
+// Input validation errors returned by Chat before any model or Dgraph work is done
+var (
+	ErrEmptySessionID = errors.New("sessionID must not be empty")
+	ErrEmptyMessage   = errors.New("userMessage must not be empty")
+	ErrMessageTooLong = errors.New("userMessage exceeds the maximum allowed length")
+	ErrEmptyUserID    = errors.New("userID must not be empty")
+)
+
+// Failure-mode errors. Underlying errors are wrapped with these via %w,
+// so callers (e.g. HTTP handlers) can map them to status codes with errors.Is.
+var (
+	ErrModelUnavailable = errors.New("model unavailable")
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrStorageFailure   = errors.New("storage failure")
+)
+
+// ErrInvalidOptions is wrapped by every ChatOptions validation failure
+var ErrInvalidOptions = errors.New("invalid chat options")
+
+// ErrNoCompletion is returned when the model produced no usable choice (no choices, or only blank content)
+var ErrNoCompletion = errors.New("model returned no completion")
+
+// ErrInvalidJSONResponse is returned when JSON mode was requested but the model's reply didn't parse, even after a retry
+var ErrInvalidJSONResponse = errors.New("model returned invalid JSON")
+
+// ErrRateLimited is returned when a session has used up its RateLimit allowance for the current window
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// ErrAccessDenied is returned when a user tries to use a session that belongs to someone else
+var ErrAccessDenied = errors.New("access denied")
+
+// ErrMalformedResponse is wrapped (alongside ErrStorageFailure) when Dgraph returns a body that can't be decoded,
+// as opposed to a well-formed response with no results
+var ErrMalformedResponse = errors.New("malformed Dgraph response")
+
+// ErrTurnTimeout is returned when a Chat turn ran out of its TurnTimeout budget before the model answered
+var ErrTurnTimeout = errors.New("chat turn exceeded its time budget")
+
+// ErrBlockedContent is returned when a user message contains a blocked keyword and BlocklistMode is BlocklistReject
+var ErrBlockedContent = errors.New("message contains blocked content")
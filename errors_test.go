@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestChatWrapsModelLookupFailureWithErrModelUnavailable(t *testing.T) {
+	newTestEnv(t)
+	missing := errors.New("model not found")
+	loadChatModel = func(string) (*openai.ChatModel, error) { return nil, missing }
+
+	_, err := Chat("s1", "hello")
+	if !errors.Is(err, ErrModelUnavailable) || !errors.Is(err, missing) {
+		t.Fatalf("Chat error = %v, want ErrModelUnavailable wrapping the lookup error", err)
+	}
+}
+
+func TestChatWrapsInvokeFailureWithErrModelUnavailable(t *testing.T) {
+	env := newTestEnv(t)
+	down := errors.New("upstream 503")
+	env.model.respond = func(fakeModelCall) (*openai.ChatModelOutput, error) { return nil, down }
+
+	_, err := Chat("s1", "hello")
+	if !errors.Is(err, ErrModelUnavailable) || !errors.Is(err, down) {
+		t.Fatalf("Chat error = %v, want ErrModelUnavailable wrapping the invoke error", err)
+	}
+}
+
+func TestGetHistoryWrapsStoreFailureWithErrStorageFailure(t *testing.T) {
+	env := newTestEnv(t)
+	unreachable := errors.New("connection refused")
+	env.store.fail = func(fakeStoreCall) error { return unreachable }
+
+	_, err := GetHistory("s1")
+	if !errors.Is(err, ErrStorageFailure) || !errors.Is(err, unreachable) {
+		t.Fatalf("GetHistory error = %v, want ErrStorageFailure wrapping the store error", err)
+	}
+}
+
+func TestChatReportsSaveFailureAsNotPersisted(t *testing.T) {
+	env := newTestEnv(t)
+	rejected := errors.New("transaction aborted")
+	env.store.fail = func(call fakeStoreCall) error {
+		if len(call.Request.Mutations) > 0 {
+			return rejected
+		}
+		return nil
+	}
+
+	resp := env.chat("s1", "hello")
+	if resp.Persisted {
+		t.Error("Persisted = true for a turn whose save failed")
+	}
+	if len(resp.Warnings) != 1 || !strings.HasPrefix(resp.Warnings[0], WarningNotPersisted) || !strings.Contains(resp.Warnings[0], rejected.Error()) {
+		t.Errorf("Warnings = %q, want one %s warning naming the store error", resp.Warnings, WarningNotPersisted)
+	}
+}
+
+func TestGetHistoryOfUnknownSessionReturnsErrSessionNotFound(t *testing.T) {
+	newTestEnv(t)
+
+	if _, err := GetHistory("nobody"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("GetHistory error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestWriteAheadKeepsTheUserMessageWhenTheReplySaveFails(t *testing.T) {
+	env := newTestEnv(t)
+	WriteAheadUserMessage = true
+	env.model.reply("hi there")
+	saves := 0
+	env.store.fail = func(call fakeStoreCall) error {
+		if len(call.Request.Mutations) > 0 {
+			if saves++; saves > 1 {
+				return errors.New("transaction aborted")
+			}
+		}
+		return nil
+	}
+
+	resp := env.chat("s1", "hello")
+	if resp.Content != "hi there" || resp.Persisted {
+		t.Errorf("response = %q, Persisted %v, want the reply with Persisted false", resp.Content, resp.Persisted)
+	}
+	env.store.fail = nil
+	if got, want := messageContents(env.history("s1")), []string{defaultSystemPrompt, "hello"}; !slices.Equal(got, want) {
+		t.Errorf("history = %q, want the written-ahead %q", got, want)
+	}
+}
+
+func TestWriteAheadFailureStopsTheTurnBeforeTheModel(t *testing.T) {
+	env := newTestEnv(t)
+	WriteAheadUserMessage = true
+	env.store.fail = func(call fakeStoreCall) error {
+		if len(call.Request.Mutations) > 0 {
+			return errors.New("transaction aborted")
+		}
+		return nil
+	}
+
+	if _, err := Chat("s1", "hello"); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("Chat error = %v, want ErrStorageFailure", err)
+	}
+	if n := env.model.callCount(); n != 0 {
+		t.Errorf("the model was called %d times after the write-ahead failed", n)
+	}
+}
+
+func TestChatReportsASuccessfulSaveAsPersisted(t *testing.T) {
+	env := newTestEnv(t)
+
+	if resp := env.chat("s1", "hello"); !resp.Persisted || len(resp.Warnings) != 0 {
+		t.Errorf("response = %+v, want Persisted with no warnings", resp)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// MessageEvent describes a message that has just been persisted
+type MessageEvent struct {
+	SessionID string    `json:"sessionID"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	UID       string    `json:"uid"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// MessageSubscriber receives a MessageEvent for every persisted message
+type MessageSubscriber func(event MessageEvent)
+
+var (
+	messageSubscribersMu sync.RWMutex
+	messageSubscribers   []MessageSubscriber
+)
+
+// AddMessageSubscriber registers fn to be called after each Chat turn's messages are persisted.
+// Subscribers run asynchronously, each in its own goroutine, so they never delay the response;
+// a subscriber that panics is recovered and logged. Passing nil is a no-op.
+func AddMessageSubscriber(fn MessageSubscriber) {
+	if fn == nil {
+		return
+	}
+	messageSubscribersMu.Lock()
+	defer messageSubscribersMu.Unlock()
+	messageSubscribers = append(messageSubscribers, fn)
+}
+
+// ClearMessageSubscribers removes every registered subscriber
+func ClearMessageSubscribers() {
+	messageSubscribersMu.Lock()
+	defer messageSubscribersMu.Unlock()
+	messageSubscribers = nil
+}
+
+// publishMessageEvents dispatches one event per saved message to every subscriber without waiting for them.
+// Events carry the content as stored, so subscribers never see PII that redaction kept out of Dgraph.
+func publishMessageEvents(sessionID string, saved *savedMessages) {
+	messageSubscribersMu.RLock()
+	subscribers := append([]MessageSubscriber(nil), messageSubscribers...)
+	messageSubscribersMu.RUnlock()
+	if len(subscribers) == 0 {
+		return
+	}
+
+	for i, msg := range saved.Messages {
+		event := MessageEvent{
+			SessionID: sessionID,
+			Role:      msg.Role,
+			Content:   msg.Content,
+			Timestamp: msg.Timestamp,
+		}
+		if i < len(saved.MessageUIDs) {
+			event.UID = saved.MessageUIDs[i]
+		}
+		for _, fn := range subscribers {
+			go deliverMessageEvent(fn, event)
+		}
+	}
+}
+
+func deliverMessageEvent(fn MessageSubscriber, event MessageEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("message subscriber panicked", "sessionID", event.SessionID, "uid", event.UID, "panic", r)
+		}
+	}()
+	fn(event)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// collectEvents registers a subscriber and returns a function waiting for the next n events
+func collectEvents(t *testing.T) func(n int) []MessageEvent {
+	events := make(chan MessageEvent, 16)
+	AddMessageSubscriber(func(event MessageEvent) { events <- event })
+	return func(n int) []MessageEvent {
+		t.Helper()
+		var got []MessageEvent
+		for len(got) < n {
+			select {
+			case event := <-events:
+				got = append(got, event)
+			case <-time.After(2 * time.Second):
+				t.Fatalf("received %d of %d events", len(got), n)
+			}
+		}
+		return got
+	}
+}
+
+func TestMessageSubscriberReceivesTheAssistantEvent(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("hi there")
+	next := collectEvents(t)
+
+	resp := env.chat("s1", "hello")
+
+	events := map[string]MessageEvent{}
+	for _, event := range next(3) { // System prompt, user message and reply, in any order
+		events[event.Role] = event
+	}
+	assistant, ok := events["assistant"]
+	if !ok {
+		t.Fatalf("events = %+v, want one for the assistant message", events)
+	}
+	if assistant.SessionID != "s1" || assistant.Content != "hi there" || assistant.UID != resp.MessageUID {
+		t.Errorf("assistant event = %+v, want session s1, the reply, and UID %s", assistant, resp.MessageUID)
+	}
+	if events["user"].Content != "hello" {
+		t.Errorf("user event = %+v", events["user"])
+	}
+}
+
+func TestMessageEventsCarryTheRedactedContent(t *testing.T) {
+	env := newTestEnv(t)
+	EnableRedaction = true
+	RedactLLMInput = false
+	env.model.reply("noted jane@example.com")
+	next := collectEvents(t)
+
+	env.chat("s1", "mail jane@example.com")
+
+	for _, event := range next(3) {
+		if event.Role == "system" {
+			continue
+		}
+		if want := map[string]string{"user": "mail [EMAIL]", "assistant": "noted [EMAIL]"}[event.Role]; event.Content != want {
+			t.Errorf("%s event content = %q, want the stored %q", event.Role, event.Content, want)
+		}
+	}
+}
+
+func TestPanickingSubscriberDoesNotBreakChatOrOtherSubscribers(t *testing.T) {
+	env := newTestEnv(t)
+	recorder := &recordingLogger{}
+	SetLogger(recorder)
+	AddMessageSubscriber(func(MessageEvent) { panic("subscriber bug") })
+	next := collectEvents(t)
+
+	env.chat("s1", "hello")
+
+	next(3)
+	// Wait for the three panicking deliveries to be recovered and logged before the test's cleanup runs
+	for deadline := time.Now().Add(2 * time.Second); recorder.count("ERROR message subscriber panicked") < 3; {
+		if time.Now().After(deadline) {
+			t.Fatalf("log entries = %q, want each panic recovered and logged", recorder.entries)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSlowSubscriberDoesNotDelayChat(t *testing.T) {
+	newTestEnv(t)
+	release := make(chan struct{})
+	defer close(release)
+	AddMessageSubscriber(func(MessageEvent) { <-release })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := Chat("s1", "hello"); err != nil {
+			t.Errorf("Chat: %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Chat waited for a blocked subscriber")
+	}
+}
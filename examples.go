@@ -0,0 +1,30 @@
+package main
+
+// Example is a few-shot user/assistant exchange shown to the model ahead of the real conversation
+type Example struct {
+	User      string `json:"user"`
+	Assistant string `json:"assistant"`
+}
+
+// withExamples returns history with the examples inserted after its leading system messages.
+// Examples only ever live in the model input: they are never saved and take no sequence numbers.
+// The input slice is not modified.
+func withExamples(history []DgraphChatMessage, examples []Example) []DgraphChatMessage {
+	if len(examples) == 0 {
+		return history
+	}
+	insertAt := 0
+	for insertAt < len(history) && history[insertAt].Role == "system" {
+		insertAt++
+	}
+
+	withExamples := make([]DgraphChatMessage, 0, len(history)+2*len(examples))
+	withExamples = append(withExamples, history[:insertAt]...)
+	for _, ex := range examples {
+		withExamples = append(withExamples,
+			DgraphChatMessage{Role: "user", Content: ex.User},
+			DgraphChatMessage{Role: "assistant", Content: ex.Assistant},
+		)
+	}
+	return append(withExamples, history[insertAt:]...)
+}
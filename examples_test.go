@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestExamplesReachTheModelButAreNeverStored(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("a1", "a2")
+	examples := []Example{{User: "2+2?", Assistant: "4"}, {User: "3+3?", Assistant: "6"}}
+
+	env.chatWith("s1", "q1", ChatOptions{Examples: examples})
+	env.chatWith("s1", "q2", ChatOptions{Examples: examples})
+
+	want := []fakeMessage{
+		{Role: "system", Content: defaultSystemPrompt},
+		{Role: "user", Content: "2+2?"},
+		{Role: "assistant", Content: "4"},
+		{Role: "user", Content: "3+3?"},
+		{Role: "assistant", Content: "6"},
+		{Role: "user", Content: "q1"},
+		{Role: "assistant", Content: "a1"},
+		{Role: "user", Content: "q2"},
+	}
+	if got := env.model.lastCall(t).Messages; !reflect.DeepEqual(got, want) {
+		t.Errorf("model input = %+v, want the examples between the system prompt and the history %+v", got, want)
+	}
+
+	history := env.history("s1")
+	if got := messageContents(history); !slices.Equal(got, []string{defaultSystemPrompt, "q1", "a1", "q2", "a2"}) {
+		t.Errorf("stored history = %q, want no examples", got)
+	}
+	for i, msg := range history {
+		if msg.Seq != i+1 {
+			t.Errorf("%q has seq %d, want %d: examples must not take sequence numbers", msg.Content, msg.Seq, i+1)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// SessionExport is a self-contained copy of one session: its ChatSession predicates and every message.
+// Dgraph UIDs are left out, since they mean nothing outside the graph the session was exported from.
+type SessionExport struct {
+	SessionInfo
+	SystemPrompt string              `json:"systemPrompt,omitempty"`
+	Model        string              `json:"model,omitempty"`
+	Messages     []DgraphChatMessage `json:"messages"`
+}
+
+// ExportSession returns a copy of the session and its messages in chronological order.
+// It returns ErrSessionNotFound when there is no ChatSession with that ID.
+func ExportSession(sessionID string) (*SessionExport, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+
+	query := `
+        query exportSession($sessionID: string) {
+            sessions(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession)) {` + sessionInfoFields + `
+                systemPrompt: ChatSession.systemPrompt
+                model: ChatSession.model
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: dgraph.ExecuteQuery failed exporting session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Sessions []SessionExport `json:"sessions"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal export of session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	if len(queryResult.Sessions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	export := queryResult.Sessions[0]
+
+	messages, err := loadHistoryFromDgraph(context.Background(), sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i].UID = ""
+		messages[i].DgraphType = nil
+	}
+	export.Messages = messages
+	if export.Messages == nil {
+		export.Messages = []DgraphChatMessage{}
+	}
+	return &export, nil
+}
+
+// ExportAllSessions writes every session, archived ones included, to w as newline-delimited JSON: one
+// SessionExport per line. Sessions are read a page at a time and written as they are loaded, so the
+// dataset is never held in memory at once. It returns the number of sessions written; on error, the
+// lines already written are complete. Sessions deleted while the export runs are skipped.
+func ExportAllSessions(ctx context.Context, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	exported := 0
+	err := IterateSessions(defaultSessionPageSize, func(sessionIDs []string) error {
+		for _, sessionID := range sessionIDs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			export, err := ExportSession(sessionID)
+			if errors.Is(err, ErrSessionNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := encoder.Encode(export); err != nil {
+				return fmt.Errorf("failed to write export of session %s: %w", sessionID, err)
+			}
+			exported++
+		}
+		return nil
+	})
+	return exported, err
+}
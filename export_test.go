@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestExportSessionCopiesTheSessionWithoutUIDs(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("hello back")
+	env.chat("s1", "hello")
+	if err := AddSessionTag("s1", "vip"); err != nil {
+		t.Fatalf("AddSessionTag: %v", err)
+	}
+
+	export, err := ExportSession("s1")
+	if err != nil {
+		t.Fatalf("ExportSession: %v", err)
+	}
+	if export.SessionID != "s1" || !reflect.DeepEqual(export.Tags, []string{"vip"}) {
+		t.Errorf("export = %+v, want session s1 tagged vip", export.SessionInfo)
+	}
+	if got := messageContents(export.Messages); len(got) != 3 || got[1] != "hello" || got[2] != "hello back" {
+		t.Errorf("exported messages = %q, want the system prompt and the turn", got)
+	}
+	for _, msg := range export.Messages {
+		if msg.UID != "" || msg.DgraphType != nil {
+			t.Errorf("exported message %+v still carries graph identifiers", msg)
+		}
+	}
+}
+
+func TestExportSessionOfUnknownSession(t *testing.T) {
+	newTestEnv(t)
+
+	if _, err := ExportSession("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestExportAllSessionsWritesOneParsableLinePerSession(t *testing.T) {
+	env := newTestEnv(t)
+	seeded := []string{"alpha", "beta", "gamma"}
+	for _, id := range seeded {
+		env.chat(id, "hello from "+id)
+	}
+	if err := ArchiveSession("gamma"); err != nil {
+		t.Fatalf("ArchiveSession: %v", err)
+	}
+
+	var out bytes.Buffer
+	count, err := ExportAllSessions(context.Background(), &out)
+	if err != nil {
+		t.Fatalf("ExportAllSessions: %v", err)
+	}
+
+	var exported []string
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var export SessionExport
+		if err := json.Unmarshal(scanner.Bytes(), &export); err != nil {
+			t.Fatalf("line %q does not parse: %v", scanner.Text(), err)
+		}
+		if len(export.Messages) != 3 || export.Messages[1].Content != "hello from "+export.SessionID {
+			t.Errorf("session %s exported messages %q", export.SessionID, messageContents(export.Messages))
+		}
+		exported = append(exported, export.SessionID)
+	}
+	sort.Strings(exported)
+	if count != len(seeded) || !reflect.DeepEqual(exported, seeded) {
+		t.Errorf("exported %d sessions %v, want %d: %v (archived ones included)", count, exported, len(seeded), seeded)
+	}
+}
+
+func TestExportAllSessionsStopsWhenTheContextIsCancelled(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out bytes.Buffer
+	count, err := ExportAllSessions(ctx, &out)
+	if !errors.Is(err, context.Canceled) || count != 0 || out.Len() != 0 {
+		t.Errorf("ExportAllSessions = %d, %v with %d bytes written, want nothing exported and context.Canceled", count, err, out.Len())
+	}
+}
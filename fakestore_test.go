@@ -0,0 +1,1680 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// fakeStore is an in-memory stand-in for Dgraph, installed with newTestEnv. It interprets the subset of DQL
+// this package sends (root functions, @filter, ordering and paging, uid and value variables, count and
+// aggregates, @recurse, upsert blocks with @if conditions, SetJson and N-Quad mutations), typing values by
+// dgraphSchema. Anything outside that subset fails the test, so a new query shape can't pass unnoticed.
+type fakeStore struct {
+	t testing.TB
+
+	mu        sync.Mutex
+	schema    map[string]schemaPredicate // Used to type stored values
+	deployed  map[string]schemaPredicate // What a schema query reports; filled by alterDgraphSchema
+	nodes     map[uint64]*fakeNode
+	lastUID   uint64
+	calls     []fakeStoreCall
+	alters    []string
+	fail      func(call fakeStoreCall) error // Returning an error makes the call fail without touching the data
+	responses map[string]string              // Raw JSON returned for a query name instead of evaluating it
+}
+
+// fakeStoreCall is one request the package sent to the store
+type fakeStoreCall struct {
+	Connection string
+	Name       string // The query's name ("schema" for schema queries), empty for plain mutations
+	Request    *dgraph.Request
+}
+
+type fakeNode struct {
+	types map[string]bool
+	preds map[string]any // string, time.Time, int64, float64, bool, []float32, uid ([]uint64) or list ([]any)
+}
+
+func newFakeStore(t testing.TB) *fakeStore {
+	schema, err := parseSchema(dgraphSchema)
+	if err != nil {
+		t.Fatalf("parsing dgraphSchema: %v", err)
+	}
+	return &fakeStore{
+		t:         t,
+		schema:    schema,
+		deployed:  map[string]schemaPredicate{},
+		nodes:     map[uint64]*fakeNode{},
+		responses: map[string]string{},
+	}
+}
+
+// execute implements executeDgraph
+func (s *fakeStore) execute(connection string, request *dgraph.Request) (*dgraph.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	call := fakeStoreCall{Connection: connection, Request: request}
+	if request.Query != nil {
+		call.Name = dqlQueryName(request.Query.Query)
+	}
+	s.calls = append(s.calls, call)
+	if s.fail != nil {
+		if err := s.fail(call); err != nil {
+			return nil, err
+		}
+	}
+	if raw, ok := s.responses[call.Name]; ok && call.Name != "" {
+		return &dgraph.Response{Json: raw, Uids: map[string]string{}}, nil
+	}
+
+	resp, err := s.run(request)
+	if err != nil {
+		s.t.Errorf("fake store: %v", err)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// alter implements alterDgraphSchema
+func (s *fakeStore) alter(connection string, schema string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, fakeStoreCall{Connection: connection, Name: "alter"})
+	if s.fail != nil {
+		if err := s.fail(fakeStoreCall{Connection: connection, Name: "alter"}); err != nil {
+			return err
+		}
+	}
+	predicates, err := parseSchema(schema)
+	if err != nil {
+		s.t.Errorf("fake store: %v", err)
+		return err
+	}
+	for name, p := range predicates {
+		s.deployed[name] = p
+	}
+	s.alters = append(s.alters, schema)
+	return nil
+}
+
+// deployDesiredSchema marks the whole of dgraphSchema as deployed
+func (s *fakeStore) deployDesiredSchema() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, p := range s.schema {
+		s.deployed[name] = p
+	}
+}
+
+// lastUpsert returns the query of the last recorded upsert of one query name and each mutation's condition,
+// keyed by the uid() variable its SetNquads writes to ("" for SetJson mutations and literal UIDs)
+func (s *fakeStore) lastUpsert(name string) (string, map[string]string) {
+	s.t.Helper()
+	calls := s.callsNamed(name)
+	if len(calls) == 0 {
+		s.t.Fatalf("no %s upsert was recorded", name)
+	}
+	request := calls[len(calls)-1].Request
+	conditions := map[string]string{}
+	for _, m := range request.Mutations {
+		subject, _, _ := strings.Cut(strings.TrimSpace(m.SetNquads), " ")
+		if !strings.HasPrefix(subject, "uid(") {
+			subject = ""
+		}
+		conditions[subject] = m.Condition
+	}
+	return request.Query.Query, conditions
+}
+
+// callsNamed returns the recorded calls of one query name ("" for plain mutations)
+func (s *fakeStore) callsNamed(name string) []fakeStoreCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []fakeStoreCall
+	for _, c := range s.calls {
+		if c.Name == name {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// callCount returns how many requests reached the store
+func (s *fakeStore) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.calls)
+}
+
+// mutationCount returns how many recorded requests carried mutations
+func (s *fakeStore) mutationCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.calls {
+		if c.Request != nil && len(c.Request.Mutations) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// nodeCount returns the number of stored nodes of a type
+func (s *fakeStore) nodeCount(typ string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, node := range s.nodes {
+		if node.types[typ] {
+			n++
+		}
+	}
+	return n
+}
+
+// totalNodes returns the number of stored nodes
+func (s *fakeStore) totalNodes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.nodes)
+}
+
+// find returns the UIDs of typ nodes whose predicate equals value, in UID order
+func (s *fakeStore) find(typ string, predicate string, value any) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var uids []string
+	for _, uid := range s.sortedUIDs() {
+		node := s.nodes[uid]
+		if !node.types[typ] {
+			continue
+		}
+		for _, v := range listValues(node.preds[predicate]) {
+			if fmt.Sprint(v) == fmt.Sprint(value) {
+				uids = append(uids, formatUID(uid))
+				break
+			}
+		}
+	}
+	return uids
+}
+
+// value returns a stored predicate of a node, or nil
+func (s *fakeStore) value(uid string, predicate string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := parseUID(uid)
+	if err != nil {
+		s.t.Fatalf("fake store: %v", err)
+	}
+	node, ok := s.nodes[n]
+	if !ok {
+		return nil
+	}
+	return node.preds[predicate]
+}
+
+// set stores a predicate on an existing node directly, bypassing mutations (for seeding corrupt data)
+func (s *fakeStore) set(uid string, predicate string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := parseUID(uid)
+	if err != nil {
+		s.t.Fatalf("fake store: %v", err)
+	}
+	node, ok := s.nodes[n]
+	if !ok {
+		s.t.Fatalf("fake store: no node %s", uid)
+	}
+	if value == nil {
+		delete(node.preds, predicate)
+		return
+	}
+	typed, err := s.coerce(predicate, value)
+	if err != nil {
+		s.t.Fatalf("fake store: %v", err)
+	}
+	node.preds[predicate] = typed
+}
+
+func (s *fakeStore) sortedUIDs() []uint64 {
+	uids := make([]uint64, 0, len(s.nodes))
+	for uid := range s.nodes {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids
+}
+
+func (s *fakeStore) newNode() uint64 {
+	s.lastUID++
+	s.nodes[s.lastUID] = &fakeNode{types: map[string]bool{}, preds: map[string]any{}}
+	return s.lastUID
+}
+
+func formatUID(uid uint64) string { return fmt.Sprintf("0x%x", uid) }
+
+func parseUID(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("invalid uid %q", s)
+	}
+	return strconv.ParseUint(s[2:], 16, 64)
+}
+
+// run evaluates a request: the query first, then each mutation whose condition holds.
+// A failing mutation leaves the data as it was before the request.
+func (s *fakeStore) run(request *dgraph.Request) (*dgraph.Response, error) {
+	ev := &dqlEval{store: s, uidVars: map[string][]uint64{}, valVars: map[string]map[uint64]any{}}
+	result := map[string]any{}
+	if request.Query != nil {
+		if strings.HasPrefix(strings.TrimSpace(request.Query.Query), "schema") {
+			return s.schemaResponse()
+		}
+		q, err := parseDQL(request.Query.Query)
+		if err != nil {
+			return nil, err
+		}
+		ev.vars = request.Query.Variables
+		for _, b := range q.blocks {
+			out, err := ev.block(b)
+			if err != nil {
+				return nil, fmt.Errorf("query %s, block %s: %w", q.name, b.alias, err)
+			}
+			if b.alias != "var" {
+				result[b.alias] = out
+			}
+		}
+	}
+
+	uids := map[string]string{}
+	if len(request.Mutations) > 0 {
+		backup := s.snapshot()
+		lastUID := s.lastUID
+		for i, m := range request.Mutations {
+			if err := ev.mutate(m, uids); err != nil {
+				s.nodes, s.lastUID = backup, lastUID
+				return nil, fmt.Errorf("mutation %d: %w", i, err)
+			}
+		}
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return &dgraph.Response{Json: string(raw), Uids: uids}, nil
+}
+
+func (s *fakeStore) snapshot() map[uint64]*fakeNode {
+	copied := make(map[uint64]*fakeNode, len(s.nodes))
+	for uid, node := range s.nodes {
+		c := &fakeNode{types: map[string]bool{}, preds: map[string]any{}}
+		for t := range node.types {
+			c.types[t] = true
+		}
+		for p, v := range node.preds {
+			switch v := v.(type) {
+			case []any:
+				c.preds[p] = append([]any(nil), v...)
+			case []uint64:
+				c.preds[p] = append([]uint64(nil), v...)
+			default:
+				c.preds[p] = v
+			}
+		}
+		copied[uid] = c
+	}
+	return copied
+}
+
+func (s *fakeStore) schemaResponse() (*dgraph.Response, error) {
+	names := make([]string, 0, len(s.deployed))
+	for name := range s.deployed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := []map[string]any{{"predicate": "dgraph.type", "type": "string", "index": true, "tokenizer": []string{"exact"}, "list": true}}
+	for _, name := range names {
+		p := s.deployed[name]
+		entry := map[string]any{"predicate": name, "type": p.Type}
+		if len(p.Tokenizers) > 0 {
+			entry["index"] = true
+			entry["tokenizer"] = p.Tokenizers
+		}
+		for key, set := range map[string]bool{"list": p.List, "count": p.Count, "upsert": p.Upsert, "reverse": p.Reverse, "lang": p.Lang} {
+			if set {
+				entry[key] = true
+			}
+		}
+		entries = append(entries, entry)
+	}
+	raw, err := json.Marshal(map[string]any{"schema": entries})
+	if err != nil {
+		return nil, err
+	}
+	return &dgraph.Response{Json: string(raw), Uids: map[string]string{}}, nil
+}
+
+// coerce converts a raw value (from JSON or an N-Quad literal) to the predicate's schema type.
+// List predicates return a single element; the caller adds it to the set.
+func (s *fakeStore) coerce(predicate string, raw any) (any, error) {
+	p, ok := s.schema[predicate]
+	if !ok {
+		return nil, fmt.Errorf("predicate %s is not in dgraphSchema", predicate)
+	}
+	if n, ok := raw.(json.Number); ok {
+		raw = n.String()
+	}
+	text := fmt.Sprint(raw)
+	switch p.Type {
+	case "string":
+		return text, nil
+	case "datetime":
+		if t, ok := raw.(time.Time); ok {
+			return t, nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, fmt.Errorf("predicate %s: %w", predicate, err)
+		}
+		return t, nil
+	case "int":
+		switch v := raw.(type) {
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		}
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("predicate %s: %w", predicate, err)
+		}
+		return n, nil
+	case "float":
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("predicate %s: %w", predicate, err)
+		}
+		return n, nil
+	case "bool":
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("predicate %s: %w", predicate, err)
+		}
+		return b, nil
+	case "float32vector":
+		var vector []float32
+		if err := json.Unmarshal([]byte(text), &vector); err != nil {
+			return nil, fmt.Errorf("predicate %s: %w", predicate, err)
+		}
+		return vector, nil
+	default:
+		return nil, fmt.Errorf("predicate %s has unsupported type %s", predicate, p.Type)
+	}
+}
+
+// store sets a value on a node, adding to the set for list predicates
+func (s *fakeStore) store(node *fakeNode, predicate string, raw any) error {
+	if predicate == "dgraph.type" {
+		for _, t := range listValues(raw) {
+			node.types[fmt.Sprint(t)] = true
+		}
+		return nil
+	}
+	p, ok := s.schema[predicate]
+	if !ok {
+		return fmt.Errorf("predicate %s is not in dgraphSchema", predicate)
+	}
+	if p.List {
+		existing, _ := node.preds[predicate].([]any)
+		for _, element := range listValues(raw) {
+			v, err := s.coerce(predicate, element)
+			if err != nil {
+				return err
+			}
+			if !containsValue(existing, v) {
+				existing = append(existing, v)
+			}
+		}
+		node.preds[predicate] = existing
+		return nil
+	}
+	v, err := s.coerce(predicate, raw)
+	if err != nil {
+		return err
+	}
+	node.preds[predicate] = v
+	return nil
+}
+
+func listValues(v any) []any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return v
+	case []string:
+		out := make([]any, len(v))
+		for i, s := range v {
+			out[i] = s
+		}
+		return out
+	default:
+		return []any{v}
+	}
+}
+
+func containsValue(values []any, v any) bool {
+	for _, existing := range values {
+		if c, ok := compareValues(existing, v); ok && c == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compareValues orders two typed values of the same kind
+func compareValues(a any, b any) (int, bool) {
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return strings.Compare(a, b), ok
+	case time.Time:
+		b, ok := b.(time.Time)
+		return a.Compare(b), ok
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return cmpOrdered(a, b), true
+		case float64:
+			return cmpOrdered(float64(a), b), true
+		}
+	case float64:
+		switch b := b.(type) {
+		case float64:
+			return cmpOrdered(a, b), true
+		case int64:
+			return cmpOrdered(a, float64(b)), true
+		}
+	case bool:
+		b, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		if a == b {
+			return 0, true
+		}
+		if !a {
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func cmpOrdered[T int64 | float64](a T, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// outputValue renders a stored value the way Dgraph's JSON does
+func outputValue(v any) any {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []any:
+		out := make([]any, len(v))
+		for i, element := range v {
+			out[i] = outputValue(element)
+		}
+		return out
+	}
+	return v
+}
+
+// ---- DQL parsing ----
+
+type dqlQuery struct {
+	name   string
+	blocks []*dqlBlock
+}
+
+type dqlBlock struct {
+	uidVar     string // "x as alias(...)"
+	alias      string // "var" for variable blocks
+	root       *dqlFunc
+	orders     []dqlOrder
+	first      string
+	after      string
+	filter     *dqlExpr
+	recurse    int // Depth; zero without @recurse
+	selections []dqlSelection
+}
+
+type dqlOrder struct {
+	predicate string
+	desc      bool
+}
+
+type dqlSelection struct {
+	alias     string   // Output key
+	predicate string   // "uid", a predicate or "~predicate"
+	valVar    string   // "x as predicate"
+	function  *dqlFunc // count(uid), max(val(x)), ...
+}
+
+type dqlFunc struct {
+	name string
+	args []dqlArg
+}
+
+type dqlArg struct {
+	text   string   // Identifier, $variable or number
+	quoted bool     // text came from a string literal
+	call   *dqlFunc // val(x), len(x)
+}
+
+type dqlExpr struct {
+	op    string // "and", "or", "not" or "func"
+	left  *dqlExpr
+	right *dqlExpr
+	fn    *dqlFunc
+}
+
+type dqlToken struct {
+	text   string
+	quoted bool
+}
+
+// dqlQueryName returns the name after "query", "schema" for schema queries, or "" when there is none
+func dqlQueryName(query string) string {
+	trimmed := strings.TrimSpace(query)
+	if strings.HasPrefix(trimmed, "schema") {
+		return "schema"
+	}
+	if !strings.HasPrefix(trimmed, "query") {
+		return ""
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(trimmed, "query"))
+	end := strings.IndexFunc(rest, func(r rune) bool { return r == '(' || r == '{' || unicode.IsSpace(r) })
+	if end < 0 {
+		return rest
+	}
+	return rest[:end]
+}
+
+func tokenizeDQL(src string) ([]dqlToken, error) {
+	var tokens []dqlToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.IndexByte("(){}:,@", c) >= 0:
+			tokens = append(tokens, dqlToken{text: string(c)})
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string in DQL")
+			}
+			text, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, dqlToken{text: text, quoted: true})
+			i = j + 1
+		case isDQLIdentByte(c):
+			j := i
+			for j < len(src) && isDQLIdentByte(src[j]) {
+				j++
+			}
+			tokens = append(tokens, dqlToken{text: src[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q in DQL", c)
+		}
+	}
+	return tokens, nil
+}
+
+func isDQLIdentByte(c byte) bool {
+	return c == '_' || c == '.' || c == '~' || c == '$' || c == '-' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type dqlParser struct {
+	tokens []dqlToken
+	pos    int
+}
+
+func (p *dqlParser) peek(offset int) dqlToken {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return dqlToken{}
+}
+
+func (p *dqlParser) next() dqlToken {
+	t := p.peek(0)
+	p.pos++
+	return t
+}
+
+func (p *dqlParser) expect(text string) error {
+	if t := p.next(); t.text != text || t.quoted {
+		return fmt.Errorf("expected %q, got %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *dqlParser) is(text string) bool {
+	t := p.peek(0)
+	return !t.quoted && t.text == text
+}
+
+func parseDQL(src string) (*dqlQuery, error) {
+	tokens, err := tokenizeDQL(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &dqlParser{tokens: tokens}
+	q := &dqlQuery{}
+	if p.is("query") {
+		p.next()
+		if !p.is("(") && !p.is("{") {
+			q.name = p.next().text
+		}
+		if p.is("(") {
+			for !p.is(")") {
+				if p.pos >= len(p.tokens) {
+					return nil, fmt.Errorf("unterminated variable list")
+				}
+				p.next()
+			}
+			p.next()
+		}
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for !p.is("}") {
+		if p.pos >= len(p.tokens) {
+			return nil, fmt.Errorf("unterminated query")
+		}
+		b, err := p.block()
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", q.name, err)
+		}
+		q.blocks = append(q.blocks, b)
+	}
+	return q, nil
+}
+
+func (p *dqlParser) block() (*dqlBlock, error) {
+	b := &dqlBlock{}
+	if p.peek(1).text == "as" {
+		b.uidVar = p.next().text
+		p.next()
+	}
+	b.alias = p.next().text
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.is(")") {
+		key := p.next().text
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		switch key {
+		case "func":
+			fn, err := p.function()
+			if err != nil {
+				return nil, err
+			}
+			b.root = fn
+		case "orderasc", "orderdesc":
+			b.orders = append(b.orders, dqlOrder{predicate: p.next().text, desc: key == "orderdesc"})
+		case "first":
+			b.first = p.next().text
+		case "after":
+			b.after = p.next().text
+		default:
+			return nil, fmt.Errorf("unsupported block argument %s", key)
+		}
+		if p.is(",") {
+			p.next()
+		}
+	}
+	p.next()
+
+	for p.is("@") {
+		p.next()
+		directive := p.next().text
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		switch directive {
+		case "filter":
+			expr, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			b.filter = expr
+		case "recurse":
+			for !p.is(")") {
+				key := p.next().text
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				value := p.next().text
+				if key == "depth" {
+					depth, err := strconv.Atoi(value)
+					if err != nil {
+						return nil, err
+					}
+					b.recurse = depth
+				} else if key == "loop" && value != "false" {
+					return nil, fmt.Errorf("only @recurse(loop: false) is supported")
+				}
+				if p.is(",") {
+					p.next()
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported directive @%s", directive)
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.is("{") {
+		return b, nil // A variable block may have no selection
+	}
+	p.next()
+	for !p.is("}") {
+		if p.pos >= len(p.tokens) {
+			return nil, fmt.Errorf("unterminated block %s", b.alias)
+		}
+		sel := dqlSelection{}
+		switch {
+		case p.peek(1).text == "as":
+			sel.valVar = p.next().text
+			p.next()
+			sel.predicate = p.next().text
+			sel.alias = sel.predicate
+		case p.peek(1).text == ":":
+			sel.alias = p.next().text
+			p.next()
+			if p.peek(1).text == "(" {
+				fn, err := p.function()
+				if err != nil {
+					return nil, err
+				}
+				sel.function = fn
+			} else {
+				sel.predicate = p.next().text
+			}
+		default:
+			sel.predicate = p.next().text
+			sel.alias = sel.predicate
+		}
+		if p.is("{") {
+			return nil, fmt.Errorf("nested selection blocks are not supported (%s)", sel.predicate)
+		}
+		b.selections = append(b.selections, sel)
+	}
+	p.next()
+	return b, nil
+}
+
+func (p *dqlParser) function() (*dqlFunc, error) {
+	fn := &dqlFunc{name: p.next().text}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.is(")") {
+		if p.pos >= len(p.tokens) {
+			return nil, fmt.Errorf("unterminated call to %s", fn.name)
+		}
+		t := p.peek(0)
+		if !t.quoted && p.peek(1).text == "(" {
+			inner, err := p.function()
+			if err != nil {
+				return nil, err
+			}
+			fn.args = append(fn.args, dqlArg{call: inner})
+		} else {
+			p.next()
+			fn.args = append(fn.args, dqlArg{text: t.text, quoted: t.quoted})
+		}
+		if p.is(",") {
+			p.next()
+		}
+	}
+	p.next()
+	return fn, nil
+}
+
+func (p *dqlParser) expr() (*dqlExpr, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("OR") {
+		p.next()
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &dqlExpr{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *dqlParser) andExpr() (*dqlExpr, error) {
+	left, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("AND") {
+		p.next()
+		right, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &dqlExpr{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *dqlParser) unaryExpr() (*dqlExpr, error) {
+	if p.is("NOT") {
+		p.next()
+		inner, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &dqlExpr{op: "not", left: inner}, nil
+	}
+	if p.is("(") {
+		p.next()
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+	fn, err := p.function()
+	if err != nil {
+		return nil, err
+	}
+	return &dqlExpr{op: "func", fn: fn}, nil
+}
+
+// ---- Evaluation ----
+
+type dqlEval struct {
+	store   *fakeStore
+	vars    map[string]string
+	uidVars map[string][]uint64
+	valVars map[string]map[uint64]any
+}
+
+// text resolves an argument to its literal text, substituting $variables
+func (ev *dqlEval) text(arg dqlArg) (string, error) {
+	if arg.call != nil {
+		return "", fmt.Errorf("unexpected function argument %s", arg.call.name)
+	}
+	if !arg.quoted && strings.HasPrefix(arg.text, "$") {
+		v, ok := ev.vars[arg.text]
+		if !ok {
+			return "", fmt.Errorf("variable %s is not set", arg.text)
+		}
+		return v, nil
+	}
+	return arg.text, nil
+}
+
+func (ev *dqlEval) block(b *dqlBlock) (any, error) {
+	var matched []uint64
+	switch {
+	case b.root == nil:
+		// An aggregation block: name() { alias: max(val(x)) }
+		return ev.aggregates(b)
+	case b.root.name == "similar_to":
+		ranked, err := ev.similarTo(b.root)
+		if err != nil {
+			return nil, err
+		}
+		matched = ranked
+	default:
+		for _, uid := range ev.store.sortedUIDs() {
+			ok, err := ev.matches(uid, b.root)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matched = append(matched, uid)
+			}
+		}
+	}
+
+	if b.filter != nil {
+		var kept []uint64
+		for _, uid := range matched {
+			ok, err := ev.filter(uid, b.filter)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				kept = append(kept, uid)
+			}
+		}
+		matched = kept
+	}
+
+	if len(b.orders) > 0 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			for _, o := range b.orders {
+				a, aok := ev.store.nodes[matched[i]].preds[o.predicate]
+				c, cok := ev.store.nodes[matched[j]].preds[o.predicate]
+				if !aok || !cok {
+					if aok != cok {
+						return aok // Nodes without the predicate come last
+					}
+					continue
+				}
+				cmp, _ := compareValues(a, c)
+				if cmp != 0 {
+					return (cmp < 0) != o.desc
+				}
+			}
+			return false
+		})
+	}
+	if b.after != "" {
+		text, err := ev.text(dqlArg{text: b.after})
+		if err != nil {
+			return nil, err
+		}
+		after, err := parseUID(text)
+		if err != nil {
+			return nil, err
+		}
+		var kept []uint64
+		for _, uid := range matched {
+			if uid > after {
+				kept = append(kept, uid)
+			}
+		}
+		matched = kept
+	}
+	if b.first != "" {
+		text, err := ev.text(dqlArg{text: b.first})
+		if err != nil {
+			return nil, err
+		}
+		first, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, err
+		}
+		if first < len(matched) {
+			matched = matched[:first]
+		}
+	}
+
+	if b.uidVar != "" {
+		ev.uidVars[b.uidVar] = matched
+	}
+	for _, sel := range b.selections {
+		if sel.valVar == "" {
+			continue
+		}
+		values := map[uint64]any{}
+		for _, uid := range matched {
+			if v, ok := ev.store.nodes[uid].preds[sel.predicate]; ok {
+				values[uid] = v
+			}
+		}
+		ev.valVars[sel.valVar] = values
+	}
+
+	if len(b.selections) == 1 && b.selections[0].function != nil && b.selections[0].function.name == "count" {
+		return []map[string]any{{b.selections[0].alias: len(matched)}}, nil
+	}
+	results := []map[string]any{}
+	for _, uid := range matched {
+		object, err := ev.object(uid, b.selections, b.recurse, map[uint64]bool{})
+		if err != nil {
+			return nil, err
+		}
+		if len(object) > 0 {
+			results = append(results, object)
+		}
+	}
+	return results, nil
+}
+
+// object renders one node's selections; with depth > 0 (@recurse), uid and reverse edges are followed
+func (ev *dqlEval) object(uid uint64, selections []dqlSelection, depth int, visited map[uint64]bool) (map[string]any, error) {
+	node := ev.store.nodes[uid]
+	object := map[string]any{}
+	visited[uid] = true
+	defer delete(visited, uid)
+	for _, sel := range selections {
+		switch {
+		case sel.function != nil:
+			return nil, fmt.Errorf("function %s is only supported alone at the root", sel.function.name)
+		case sel.predicate == "uid":
+			object[sel.alias] = formatUID(uid)
+		case strings.HasPrefix(sel.predicate, "~"):
+			if depth <= 1 {
+				continue
+			}
+			var children []map[string]any
+			for _, other := range ev.store.sortedUIDs() {
+				edges, _ := ev.store.nodes[other].preds[sel.predicate[1:]].([]uint64)
+				for _, target := range edges {
+					if target == uid && !visited[other] {
+						child, err := ev.object(other, selections, depth-1, visited)
+						if err != nil {
+							return nil, err
+						}
+						if len(child) > 0 {
+							children = append(children, child)
+						}
+					}
+				}
+			}
+			if len(children) > 0 {
+				object[sel.alias] = children
+			}
+		default:
+			v, ok := node.preds[sel.predicate]
+			if !ok {
+				continue
+			}
+			if edges, isEdge := v.([]uint64); isEdge {
+				if depth <= 1 {
+					continue
+				}
+				var children []map[string]any
+				for _, target := range edges {
+					if visited[target] {
+						continue
+					}
+					child, err := ev.object(target, selections, depth-1, visited)
+					if err != nil {
+						return nil, err
+					}
+					if len(child) > 0 {
+						children = append(children, child)
+					}
+				}
+				if len(children) > 0 {
+					object[sel.alias] = children
+				}
+				continue
+			}
+			if _, isVector := v.([]float32); isVector {
+				continue
+			}
+			object[sel.alias] = outputValue(v)
+		}
+	}
+	return object, nil
+}
+
+// aggregates evaluates a block of max/min/sum/avg over value variables; each aggregate is its own element
+// and is left out when the variable holds no values
+func (ev *dqlEval) aggregates(b *dqlBlock) (any, error) {
+	results := []map[string]any{}
+	for _, sel := range b.selections {
+		fn := sel.function
+		if fn == nil || len(fn.args) != 1 || fn.args[0].call == nil || fn.args[0].call.name != "val" {
+			return nil, fmt.Errorf("unsupported aggregate in block %s", b.alias)
+		}
+		values := ev.valVars[fn.args[0].call.args[0].text]
+		if len(values) == 0 {
+			continue
+		}
+		var all []any
+		for _, uid := range ev.store.sortedUIDs() {
+			if v, ok := values[uid]; ok {
+				all = append(all, v)
+			}
+		}
+		var out any
+		switch fn.name {
+		case "max", "min":
+			best := all[0]
+			for _, v := range all[1:] {
+				c, _ := compareValues(v, best)
+				if (fn.name == "max" && c > 0) || (fn.name == "min" && c < 0) {
+					best = v
+				}
+			}
+			out = outputValue(best)
+		case "sum", "avg":
+			var sum float64
+			allInts := true
+			for _, v := range all {
+				switch v := v.(type) {
+				case int64:
+					sum += float64(v)
+				case float64:
+					sum += v
+					allInts = false
+				default:
+					return nil, fmt.Errorf("%s over non-numeric values", fn.name)
+				}
+			}
+			if fn.name == "avg" {
+				out = sum / float64(len(all))
+			} else if allInts {
+				out = int64(sum)
+			} else {
+				out = sum
+			}
+		default:
+			return nil, fmt.Errorf("unsupported aggregate %s", fn.name)
+		}
+		results = append(results, map[string]any{sel.alias: out})
+	}
+	return results, nil
+}
+
+func (ev *dqlEval) similarTo(fn *dqlFunc) ([]uint64, error) {
+	if len(fn.args) != 3 {
+		return nil, fmt.Errorf("similar_to takes three arguments")
+	}
+	predicate := fn.args[0].text
+	kText, err := ev.text(fn.args[1])
+	if err != nil {
+		return nil, err
+	}
+	k, err := strconv.Atoi(kText)
+	if err != nil {
+		return nil, err
+	}
+	vectorText, err := ev.text(fn.args[2])
+	if err != nil {
+		return nil, err
+	}
+	var query []float32
+	if err := json.Unmarshal([]byte(vectorText), &query); err != nil {
+		return nil, err
+	}
+
+	type scored struct {
+		uid   uint64
+		score float64
+	}
+	var candidates []scored
+	for _, uid := range ev.store.sortedUIDs() {
+		vector, ok := ev.store.nodes[uid].preds[predicate].([]float32)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, scored{uid, cosineSimilarity(query, vector)})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+	var ranked []uint64
+	for i := 0; i < len(candidates) && i < k; i++ {
+		ranked = append(ranked, candidates[i].uid)
+	}
+	return ranked, nil
+}
+
+func cosineSimilarity(a []float32, b []float32) float64 {
+	var dot, na, nb float64
+	for i := 0; i < len(a) && i < len(b); i++ {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+func (ev *dqlEval) filter(uid uint64, expr *dqlExpr) (bool, error) {
+	switch expr.op {
+	case "and":
+		l, err := ev.filter(uid, expr.left)
+		if err != nil || !l {
+			return false, err
+		}
+		return ev.filter(uid, expr.right)
+	case "or":
+		l, err := ev.filter(uid, expr.left)
+		if err != nil || l {
+			return l, err
+		}
+		return ev.filter(uid, expr.right)
+	case "not":
+		l, err := ev.filter(uid, expr.left)
+		return !l, err
+	default:
+		return ev.matches(uid, expr.fn)
+	}
+}
+
+// matches evaluates a root or filter function against one node
+func (ev *dqlEval) matches(uid uint64, fn *dqlFunc) (bool, error) {
+	node := ev.store.nodes[uid]
+	switch fn.name {
+	case "type":
+		return node.types[fn.args[0].text], nil
+	case "has":
+		if fn.args[0].text == "dgraph.type" {
+			return len(node.types) > 0, nil
+		}
+		_, ok := node.preds[fn.args[0].text]
+		return ok, nil
+	case "uid":
+		for _, arg := range fn.args {
+			if !arg.quoted && strings.HasPrefix(arg.text, "$") {
+				text, err := ev.text(arg)
+				if err != nil {
+					return false, err
+				}
+				want, err := parseUID(text)
+				if err != nil {
+					return false, err
+				}
+				if want == uid {
+					return true, nil
+				}
+				continue
+			}
+			uids, ok := ev.uidVars[arg.text]
+			if !ok {
+				return false, fmt.Errorf("uid variable %s is not defined", arg.text)
+			}
+			for _, u := range uids {
+				if u == uid {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "eq", "lt", "le", "gt", "ge", "between":
+		predicate := fn.args[0].text
+		stored := listValues(node.preds[predicate])
+		if len(stored) == 0 {
+			return false, nil
+		}
+		var wants []any
+		for _, arg := range fn.args[1:] {
+			if arg.call != nil && arg.call.name == "val" {
+				for _, v := range ev.valVars[arg.call.args[0].text] {
+					wants = append(wants, v)
+				}
+				continue
+			}
+			text, err := ev.text(arg)
+			if err != nil {
+				return false, err
+			}
+			want, err := ev.store.coerce(predicate, text)
+			if err != nil {
+				return false, err
+			}
+			wants = append(wants, want)
+		}
+		for _, have := range stored {
+			if fn.name == "between" {
+				lo, _ := compareValues(have, wants[0])
+				hi, _ := compareValues(have, wants[1])
+				if lo >= 0 && hi <= 0 {
+					return true, nil
+				}
+				continue
+			}
+			for _, want := range wants {
+				c, ok := compareValues(have, want)
+				if !ok {
+					return false, fmt.Errorf("%s(%s) compares %T with %T", fn.name, predicate, have, want)
+				}
+				if (fn.name == "eq" && c == 0) || (fn.name == "lt" && c < 0) || (fn.name == "le" && c <= 0) ||
+					(fn.name == "gt" && c > 0) || (fn.name == "ge" && c >= 0) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsupported function %s", fn.name)
+	}
+}
+
+// ---- Mutations ----
+
+func (ev *dqlEval) mutate(m *dgraph.Mutation, uids map[string]string) error {
+	if m.Condition != "" {
+		ok, err := ev.condition(m.Condition)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+	if m.DelJson != "" {
+		return errors.New("DelJson is not supported")
+	}
+	if m.DelNquads != "" {
+		if err := ev.nquads(m.DelNquads, true, uids); err != nil {
+			return err
+		}
+	}
+	if m.SetNquads != "" {
+		if err := ev.nquads(m.SetNquads, false, uids); err != nil {
+			return err
+		}
+	}
+	if m.SetJson != "" {
+		decoder := json.NewDecoder(strings.NewReader(m.SetJson))
+		decoder.UseNumber()
+		var payload any
+		if err := decoder.Decode(&payload); err != nil {
+			return fmt.Errorf("SetJson: %w", err)
+		}
+		objects := listValues(payload)
+		blank := map[string]uint64{}
+		for _, o := range objects {
+			object, ok := o.(map[string]any)
+			if !ok {
+				return fmt.Errorf("SetJson element is %T, not an object", o)
+			}
+			if err := ev.setObject(object, blank, uids); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ev *dqlEval) condition(condition string) (bool, error) {
+	condition = strings.TrimSpace(condition)
+	if !strings.HasPrefix(condition, "@if(") || !strings.HasSuffix(condition, ")") {
+		return false, fmt.Errorf("unsupported condition %q", condition)
+	}
+	tokens, err := tokenizeDQL(condition[len("@if(") : len(condition)-1])
+	if err != nil {
+		return false, err
+	}
+	p := &dqlParser{tokens: tokens}
+	expr, err := p.expr()
+	if err != nil {
+		return false, err
+	}
+	return ev.conditionExpr(expr)
+}
+
+func (ev *dqlEval) conditionExpr(expr *dqlExpr) (bool, error) {
+	switch expr.op {
+	case "and", "or":
+		l, err := ev.conditionExpr(expr.left)
+		if err != nil {
+			return false, err
+		}
+		r, err := ev.conditionExpr(expr.right)
+		if err != nil {
+			return false, err
+		}
+		if expr.op == "and" {
+			return l && r, nil
+		}
+		return l || r, nil
+	case "not":
+		l, err := ev.conditionExpr(expr.left)
+		return !l, err
+	}
+	fn := expr.fn
+	if len(fn.args) != 2 || fn.args[0].call == nil || fn.args[0].call.name != "len" {
+		return false, fmt.Errorf("unsupported condition function %s", fn.name)
+	}
+	n := int64(len(ev.uidVars[fn.args[0].call.args[0].text]))
+	want, err := strconv.ParseInt(fn.args[1].text, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	c := cmpOrdered(n, want)
+	switch fn.name {
+	case "eq":
+		return c == 0, nil
+	case "gt":
+		return c > 0, nil
+	case "ge":
+		return c >= 0, nil
+	case "lt":
+		return c < 0, nil
+	case "le":
+		return c <= 0, nil
+	}
+	return false, fmt.Errorf("unsupported condition function %s", fn.name)
+}
+
+// subjects resolves a mutation subject (<0x1>, _:name, uid(var) or a JSON uid) to nodes. An empty uid
+// variable creates a node, as Dgraph does; the new UID is reported under "uid(var)".
+func (ev *dqlEval) subjects(ref string, blank map[string]uint64, uids map[string]string, create bool) ([]uint64, error) {
+	ref = strings.TrimSpace(ref)
+	switch {
+	case strings.HasPrefix(ref, "<") && strings.HasSuffix(ref, ">"):
+		ref = ref[1 : len(ref)-1]
+		fallthrough
+	case strings.HasPrefix(ref, "0x"):
+		uid, err := parseUID(ref)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := ev.store.nodes[uid]; !ok {
+			if !create {
+				return nil, nil
+			}
+			ev.store.nodes[uid] = &fakeNode{types: map[string]bool{}, preds: map[string]any{}}
+			ev.store.lastUID = max(ev.store.lastUID, uid)
+		}
+		return []uint64{uid}, nil
+	case strings.HasPrefix(ref, "_:"):
+		name := ref[2:]
+		if uid, ok := blank[name]; ok {
+			return []uint64{uid}, nil
+		}
+		if !create {
+			return nil, nil
+		}
+		uid := ev.store.newNode()
+		blank[name] = uid
+		uids[name] = formatUID(uid)
+		return []uint64{uid}, nil
+	case strings.HasPrefix(ref, "uid(") && strings.HasSuffix(ref, ")"):
+		name := ref[4 : len(ref)-1]
+		vars, ok := ev.uidVars[name]
+		if !ok {
+			return nil, fmt.Errorf("uid variable %s is not defined", name)
+		}
+		if len(vars) > 0 || !create {
+			return vars, nil
+		}
+		uid := ev.store.newNode()
+		ev.uidVars[name] = []uint64{uid}
+		uids[ref] = formatUID(uid)
+		return []uint64{uid}, nil
+	}
+	return nil, fmt.Errorf("unsupported subject %q", ref)
+}
+
+func (ev *dqlEval) setObject(object map[string]any, blank map[string]uint64, uids map[string]string) error {
+	ref, _ := object["uid"].(string)
+	if ref == "" {
+		ref = fmt.Sprintf("_:fake%d", len(blank))
+	}
+	targets, err := ev.subjects(ref, blank, uids, true)
+	if err != nil {
+		return err
+	}
+	for _, uid := range targets {
+		node := ev.store.nodes[uid]
+		for key, value := range object {
+			if key == "uid" {
+				continue
+			}
+			if err := ev.store.store(node, key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ev *dqlEval) nquads(payload string, del bool, uids map[string]string) error {
+	blank := map[string]uint64{}
+	for _, line := range strings.Split(payload, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, ".") {
+			return fmt.Errorf("N-Quad %q does not end with '.'", line)
+		}
+		parts, err := splitNquad(strings.TrimSpace(strings.TrimSuffix(line, ".")))
+		if err != nil {
+			return err
+		}
+		subject, predicate, object := parts[0], parts[1], parts[2]
+		targets, err := ev.subjects(subject, blank, uids, !del)
+		if err != nil {
+			return err
+		}
+		if predicate != "*" {
+			predicate = strings.TrimSuffix(strings.TrimPrefix(predicate, "<"), ">")
+		}
+
+		for _, uid := range targets {
+			node, ok := ev.store.nodes[uid]
+			if !ok {
+				continue
+			}
+			switch {
+			case del && predicate == "*":
+				delete(ev.store.nodes, uid)
+			case del && object == "*":
+				if predicate == "dgraph.type" {
+					node.types = map[string]bool{}
+				}
+				delete(node.preds, predicate)
+			case del:
+				value, err := unquoteNquadObject(object)
+				if err != nil {
+					return err
+				}
+				typed, err := ev.store.coerce(predicate, value)
+				if err != nil {
+					return err
+				}
+				if list, isList := node.preds[predicate].([]any); isList {
+					var kept []any
+					for _, v := range list {
+						if c, ok := compareValues(v, typed); !ok || c != 0 {
+							kept = append(kept, v)
+						}
+					}
+					if len(kept) == 0 {
+						delete(node.preds, predicate)
+					} else {
+						node.preds[predicate] = kept
+					}
+				} else if c, ok := compareValues(node.preds[predicate], typed); ok && c == 0 {
+					delete(node.preds, predicate)
+				}
+			case strings.HasPrefix(object, "uid(") || strings.HasPrefix(object, "<"):
+				if p, ok := ev.store.schema[predicate]; !ok || p.Type != "uid" {
+					return fmt.Errorf("predicate %s is not a uid predicate", predicate)
+				}
+				objects, err := ev.subjects(object, blank, uids, false)
+				if err != nil {
+					return err
+				}
+				node.preds[predicate] = append([]uint64(nil), objects...)
+			default:
+				value, err := unquoteNquadObject(object)
+				if err != nil {
+					return err
+				}
+				if predicate == "dgraph.type" {
+					node.types[value] = true
+					continue
+				}
+				if err := ev.store.store(node, predicate, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// splitNquad splits "subject predicate object" where the object may be a quoted literal containing spaces
+func splitNquad(line string) ([3]string, error) {
+	var parts [3]string
+	rest := line
+	for i := 0; i < 2; i++ {
+		rest = strings.TrimSpace(rest)
+		end := strings.IndexByte(rest, ' ')
+		if end < 0 {
+			return parts, fmt.Errorf("malformed N-Quad %q", line)
+		}
+		parts[i] = rest[:end]
+		rest = rest[end:]
+	}
+	parts[2] = strings.TrimSpace(rest)
+	if parts[2] == "" {
+		return parts, fmt.Errorf("malformed N-Quad %q", line)
+	}
+	return parts, nil
+}
+
+func unquoteNquadObject(object string) (string, error) {
+	if !strings.HasPrefix(object, `"`) {
+		return "", fmt.Errorf("unsupported N-Quad object %q", object)
+	}
+	if i := strings.LastIndex(object, `"^^`); i > 0 {
+		object = object[:i+1] // Typed literals are typed by the schema instead
+	}
+	return strconv.Unquote(object)
+}
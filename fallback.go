@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// EnableFallback makes Chat answer with FallbackResponse, rather than failing, when no model in the chain is available.
+// The fallback turn is persisted like any other, with ChatMessage.fallback set on the assistant message.
+var EnableFallback = false
+
+// FallbackResponse is the canned assistant reply used when EnableFallback is on and every model is unavailable
+var FallbackResponse = "I'm having trouble responding right now. Please try again in a moment."
+
+// modelChain is the ordered list of chat models Chat tries; names must match models in modus.json
+var modelChain = []string{modelName}
+
+// SetModelChain sets the package-wide ordered fallback list of chat models.
+// An empty list restores the default of just the primary model.
+func SetModelChain(names []string) error {
+	if len(names) == 0 {
+		modelChain = []string{modelName}
+		return nil
+	}
+	chain := make([]string, 0, len(names))
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("model name %d in chain is empty", i)
+		}
+		chain = append(chain, name)
+	}
+	modelChain = chain
+	return nil
+}
+
+// AllowedModels lists the models per-request chains (ChatOptions.Models) and SetSessionModel may name.
+// When empty, per-request chains are unrestricted and session models must come from the package model chain.
+var AllowedModels []string
+
+// isAllowedModel reports whether name may be selected as a session's model
+func isAllowedModel(name string) bool {
+	if len(AllowedModels) > 0 {
+		return slices.Contains(AllowedModels, name)
+	}
+	return slices.Contains(modelChain, name)
+}
+
+// resolveModelChain picks the per-request chain when given, else the session's model ahead of the package chain
+func resolveModelChain(opts ChatOptions, sessionModel string) []string {
+	if len(opts.Models) > 0 {
+		return opts.Models
+	}
+	if sessionModel == "" {
+		return modelChain
+	}
+	chain := []string{sessionModel}
+	for _, name := range modelChain {
+		if name != sessionModel {
+			chain = append(chain, name) // The rest of the package chain remains the fallback
+		}
+	}
+	return chain
+}
+
+// completeWithFallback tries each model in chain until one produces a completion and reports which one answered.
+// Only availability failures (ErrModelUnavailable) fall through to the next model; input or completion
+// problems are returned immediately since another model wouldn't fix them, as is an exhausted turn budget.
+func completeWithFallback(ctx context.Context, chain []string, messages []openai.RequestMessage, configure func(*openai.ChatModelInput), choiceIndex int) (*openai.ChatModelOutput, string, error) {
+	var lastErr error
+	for _, name := range chain {
+		if err := checkTurnBudget(ctx); err != nil {
+			return nil, "", err
+		}
+		model, err := getChatModel(name)
+		if err != nil {
+			lastErr = fmt.Errorf("%w: error getting model %s: %w", ErrModelUnavailable, name, err)
+			logger.Error("model unavailable, trying next in chain", "model", name, "error", err)
+			continue
+		}
+
+		input, err := model.CreateInput(messages...)
+		if err != nil {
+			return nil, "", fmt.Errorf("error creating model input: %w", err)
+		}
+		configure(input)
+
+		output, err := requestCompletion(ctx, model, input, choiceIndex)
+		if err != nil {
+			if errors.Is(err, ErrModelUnavailable) {
+				lastErr = err
+				logger.Error("model invocation failed, trying next in chain", "model", name, "error", err)
+				continue
+			}
+			return nil, "", err
+		}
+		return output, name, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("%w: no models configured", ErrModelUnavailable)
+	}
+	return nil, "", lastErr
+}
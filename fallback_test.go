@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestChatFallsThroughToTheNextModelWhenOneIsDown(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetModelChain([]string{"primary", "backup"}); err != nil {
+		t.Fatal(err)
+	}
+	env.model.respond = func(call fakeModelCall) (*openai.ChatModelOutput, error) {
+		if call.Model == "primary" {
+			return nil, errors.New("503 service unavailable")
+		}
+		return textOutput("from " + call.Model), nil
+	}
+
+	resp := env.chat("s1", "hello")
+	if resp.Content != "from backup" || resp.ModelUsed != "backup" {
+		t.Errorf("response = %q from %q, want the backup's answer", resp.Content, resp.ModelUsed)
+	}
+	history := env.history("s1")
+	if model := history[len(history)-1].Model; model != "backup" {
+		t.Errorf("stored assistant model = %q, want backup", model)
+	}
+}
+
+func TestChatFallsThroughWhenAModelCannotBeResolved(t *testing.T) {
+	env := newTestEnv(t)
+	modelChain = []string{"missing", "backup"}
+	resolve := loadChatModel
+	loadChatModel = func(name string) (*openai.ChatModel, error) {
+		if name == "missing" {
+			return nil, errors.New("no such model")
+		}
+		return resolve(name)
+	}
+
+	if resp := env.chat("s1", "hello"); resp.ModelUsed != "backup" {
+		t.Errorf("ModelUsed = %q, want backup", resp.ModelUsed)
+	}
+}
+
+func TestChatDoesNotFallThroughOnCompletionErrors(t *testing.T) {
+	env := newTestEnv(t)
+	modelChain = []string{"primary", "backup"}
+	env.model.respond = func(call fakeModelCall) (*openai.ChatModelOutput, error) {
+		return &openai.ChatModelOutput{}, nil // No choices: another model wouldn't fix the request
+	}
+
+	if _, err := Chat("s1", "hello"); !errors.Is(err, ErrNoCompletion) {
+		t.Fatalf("Chat error = %v, want ErrNoCompletion", err)
+	}
+	for _, c := range env.model.calls {
+		if c.Model != "primary" {
+			t.Errorf("fell through to %s on a completion error", c.Model)
+		}
+	}
+}
+
+func TestChatOptionsModelsOverrideThePackageChain(t *testing.T) {
+	env := newTestEnv(t)
+	modelChain = []string{"primary"}
+
+	env.chatWith("s1", "hello", ChatOptions{Models: []string{"special"}})
+	if got := env.model.lastCall(t).Model; got != "special" {
+		t.Errorf("answered by %q, want the per-request chain", got)
+	}
+}
+
+func TestSetModelChainValidatesAndResets(t *testing.T) {
+	newTestEnv(t)
+
+	if err := SetModelChain([]string{"a", " "}); err == nil {
+		t.Error("SetModelChain accepted a blank name")
+	}
+	if err := SetModelChain(nil); err != nil || !reflect.DeepEqual(modelChain, []string{modelName}) {
+		t.Errorf("SetModelChain(nil) = %v leaving %q, want the default chain", err, modelChain)
+	}
+}
+
+// downModel makes every model call fail with an availability error
+func downModel(call fakeModelCall) (*openai.ChatModelOutput, error) {
+	return nil, errors.New("503 service unavailable")
+}
+
+func TestChatReturnsAndStoresTheFallbackResponseWhenEnabled(t *testing.T) {
+	env := newTestEnv(t)
+	EnableFallback = true
+	FallbackResponse = "Sorry, try again later."
+	env.model.respond = downModel
+
+	resp := env.chat("s1", "hello")
+	if resp.Content != "Sorry, try again later." || !resp.Fallback || resp.ModelUsed != "" {
+		t.Errorf("response = %+v, want the fallback with Fallback set and no model", resp)
+	}
+	if !resp.Persisted {
+		t.Error("the fallback turn was not persisted")
+	}
+	assistant := env.history("s1")[2]
+	if assistant.Content != "Sorry, try again later." || !assistant.Fallback {
+		t.Errorf("stored assistant message = %+v, want the fallback marked with ChatMessage.fallback", assistant)
+	}
+}
+
+func TestChatFailsWhenEveryModelIsDownAndFallbackIsOff(t *testing.T) {
+	env := newTestEnv(t)
+	EnableFallback = false
+	env.model.respond = downModel
+
+	if _, err := Chat("s1", "hello"); !errors.Is(err, ErrModelUnavailable) {
+		t.Fatalf("Chat error = %v, want ErrModelUnavailable", err)
+	}
+	if n := env.store.nodeCount("ChatMessage"); n != 0 {
+		t.Errorf("%d messages stored for a failed turn", n)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// healthCheckTimeout bounds how long HealthCheck waits for Dgraph before reporting it as slow
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck verifies that Dgraph is reachable by running a lightweight, read-only query.
+// It never mutates data, so it is safe to back a /healthz probe.
+func HealthCheck(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	// A single-node lookup is the cheapest query that still exercises the connection end to end
+	query := `
+        query healthCheck {
+            health(func: has(dgraph.type), first: 1) {
+                uid
+            }
+        }
+    `
+
+	type result struct {
+		resp *dgraph.Response
+		err  error
+	}
+	done := make(chan result, 1) // Buffered so the query goroutine never blocks if we time out first
+	go func() {
+		resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{Query: query})
+		done <- result{resp: resp, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%w: dgraph health check did not complete: %w", ErrStorageFailure, ctx.Err())
+	case r := <-done:
+		if r.err != nil {
+			return fmt.Errorf("%w: dgraph health check query failed: %w", ErrStorageFailure, r.err)
+		}
+		if !json.Valid([]byte(r.resp.Json)) {
+			return fmt.Errorf("%w: dgraph health check returned malformed JSON: %s", ErrStorageFailure, r.resp.Json)
+		}
+		return nil
+	}
+}
+
+// ApplySchemaOnWarmUp makes WarmUp apply the Dgraph schema when GetSchemaStatus reports it isn't ready
+var ApplySchemaOnWarmUp = false
+
+// WarmUp prepares the package for traffic: it resolves every model in the chain (filling the model cache),
+// checks that Dgraph is reachable and, with ApplySchemaOnWarmUp, applies the schema if it is incomplete.
+// Every step runs even if an earlier one fails; the returned error joins the failures, naming each step.
+// Hosts call this once at startup.
+func WarmUp(ctx context.Context) error {
+	var errs []error
+
+	// 1. Resolve the models so the first Chat doesn't pay for it
+	for _, name := range modelChain {
+		if _, err := getChatModel(name); err != nil {
+			errs = append(errs, fmt.Errorf("warm-up: resolving model %s: %w: %w", name, ErrModelUnavailable, err))
+		}
+	}
+
+	// 2. Check the store, and only then its schema
+	if err := HealthCheck(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("warm-up: dgraph health check: %w", err))
+	} else if ApplySchemaOnWarmUp {
+		status, err := GetSchemaStatus()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("warm-up: reading schema status: %w", err))
+		} else if !status.Ready {
+			if _, err := ApplyDgraphSchema(); err != nil {
+				errs = append(errs, fmt.Errorf("warm-up: applying schema: %w", err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	logger.Info("warm-up complete", "models", len(modelChain))
+	return nil
+}
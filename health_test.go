@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestHealthCheckSucceedsAgainstReachableStore(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := HealthCheck(context.Background()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if n := len(env.store.callsNamed("healthCheck")); n != 1 {
+		t.Errorf("healthCheck queries = %d, want 1", n)
+	}
+	if n := env.store.mutationCount(); n != 0 {
+		t.Errorf("HealthCheck sent %d mutations, want none", n)
+	}
+}
+
+func TestHealthCheckWrapsStoreFailure(t *testing.T) {
+	env := newTestEnv(t)
+	unreachable := errors.New("connection refused")
+	env.store.fail = func(fakeStoreCall) error { return unreachable }
+
+	err := HealthCheck(context.Background())
+	if !errors.Is(err, ErrStorageFailure) || !errors.Is(err, unreachable) {
+		t.Fatalf("HealthCheck error = %v, want ErrStorageFailure wrapping the store error", err)
+	}
+}
+
+func TestHealthCheckRejectsMalformedResponse(t *testing.T) {
+	env := newTestEnv(t)
+	env.store.responses["healthCheck"] = "{not json"
+
+	if err := HealthCheck(context.Background()); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("HealthCheck error = %v, want ErrStorageFailure", err)
+	}
+}
+
+func TestWarmUpResolvesTheModelsAndChecksTheStore(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetModelChain([]string{"primary", "backup"}); err != nil {
+		t.Fatal(err)
+	}
+	loads := countModelLoads(t)
+
+	if err := WarmUp(context.Background()); err != nil {
+		t.Fatalf("WarmUp: %v", err)
+	}
+
+	if loads["primary"] != 1 || loads["backup"] != 1 {
+		t.Errorf("model loads = %v, want each model in the chain resolved once", loads)
+	}
+	if n := len(env.store.callsNamed("healthCheck")); n != 1 {
+		t.Errorf("healthCheck queries = %d, want 1", n)
+	}
+	if len(env.store.alters) != 0 {
+		t.Errorf("schema altered %d times without ApplySchemaOnWarmUp", len(env.store.alters))
+	}
+
+	env.chat("s1", "hello")
+	if loads["primary"] != 1 {
+		t.Errorf("the first Chat loaded the model again (%d loads), want it served from the warmed cache", loads["primary"])
+	}
+}
+
+func TestWarmUpReportsEveryFailedStep(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetModelChain([]string{"primary", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	resolve := loadChatModel
+	loadChatModel = func(name string) (*openai.ChatModel, error) {
+		if name == "missing" {
+			return nil, errors.New("no such model")
+		}
+		return resolve(name)
+	}
+	env.store.fail = func(call fakeStoreCall) error {
+		if call.Name == "healthCheck" {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	err := WarmUp(context.Background())
+
+	if !errors.Is(err, ErrModelUnavailable) || !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("WarmUp error = %v, want both the model and the store failure", err)
+	}
+	for _, step := range []string{"resolving model missing", "dgraph health check"} {
+		if !strings.Contains(err.Error(), step) {
+			t.Errorf("WarmUp error %q does not name the %q step", err, step)
+		}
+	}
+	if strings.Contains(err.Error(), "model primary") {
+		t.Errorf("WarmUp error %q blames the model that resolved", err)
+	}
+}
+
+func TestWarmUpAppliesAnIncompleteSchemaWhenAsked(t *testing.T) {
+	env := newTestEnv(t)
+	ApplySchemaOnWarmUp = true
+
+	if err := WarmUp(context.Background()); err != nil {
+		t.Fatalf("WarmUp: %v", err)
+	}
+	if len(env.store.alters) != 1 {
+		t.Fatalf("schema altered %d times, want the missing schema applied once", len(env.store.alters))
+	}
+
+	if err := WarmUp(context.Background()); err != nil {
+		t.Fatalf("second WarmUp: %v", err)
+	}
+	if len(env.store.alters) != 1 {
+		t.Errorf("schema altered again once it was ready (%d alters)", len(env.store.alters))
+	}
+}
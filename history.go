@@ -0,0 +1,49 @@
+package main
+
+// limitHistory keeps every system message and every pinned message, plus the last maxMessages other messages,
+// in their original order. A tool result whose tool call falls outside the window is dropped as well, since the
+// model can't use it alone. Zero or a negative maxMessages keeps everything.
+func limitHistory(history []DgraphChatMessage, maxMessages int) []DgraphChatMessage {
+	if maxMessages <= 0 {
+		return history
+	}
+	droppable := 0
+	for _, msg := range history {
+		if !alwaysInContext(msg) {
+			droppable++
+		}
+	}
+	if droppable <= maxMessages {
+		return history
+	}
+
+	skip := droppable - maxMessages
+	limited := make([]DgraphChatMessage, 0, len(history)-skip)
+	windowStarted := false // Set once the first message inside the window is kept
+	for _, msg := range history {
+		if alwaysInContext(msg) {
+			limited = append(limited, msg)
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if isOrphanToolResult(msg) && !windowStarted {
+			continue
+		}
+		windowStarted = true
+		limited = append(limited, msg)
+	}
+	return limited
+}
+
+// alwaysInContext reports whether msg survives every history limit: system prompts and pinned messages
+func alwaysInContext(msg DgraphChatMessage) bool {
+	return msg.Role == "system" || msg.Pinned
+}
+
+// isOrphanToolResult reports whether msg is a tool result, i.e. only meaningful after the call that produced it
+func isOrphanToolResult(msg DgraphChatMessage) bool {
+	return msg.Role == "function" || (msg.Role == "tool" && len(msg.ToolCalls) == 0)
+}
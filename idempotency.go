@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// findIdempotentResponse looks for a turn already stored under idempotencyKey in the session.
+// It returns the previously generated response when one exists, so retries don't re-invoke the model.
+// Otherwise it returns the UID of a user message written ahead under the key whose reply never made it
+// (see WriteAheadUserMessage), so the retry answers that message instead of storing it a second time.
+func findIdempotentResponse(sessionID string, idempotencyKey string) (previous *ChatResponse, writtenAheadUID string, err error) {
+	query := `
+        query getIdempotentTurn($sessionID: string, $key: string) {
+            messages(func: eq(ChatMessage.idempotencyKey, $key)) @filter(eq(ChatMessage.sessionIDRef, $sessionID) AND type(ChatMessage)) {
+                uid
+                role: ChatMessage.role
+                content: ChatMessage.content
+                toolCalls: ChatMessage.toolCalls
+            }
+        }
+    `
+	vars := map[string]string{
+		"$sessionID": sessionID,
+		"$key":       idempotencyKey,
+	}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: dgraph.ExecuteQuery failed for idempotency key in session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Messages []struct {
+			UID       string `json:"uid"`
+			Role      string `json:"role"`
+			Content   string `json:"content"`
+			ToolCalls string `json:"toolCalls"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return nil, "", fmt.Errorf("%w: failed to unmarshal idempotency lookup for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+
+	// The user message of the turn carries the same key; only the model's reply is replayed
+	for _, m := range queryResult.Messages {
+		if m.Role == "user" {
+			writtenAheadUID = m.UID
+		}
+		if m.Role != "assistant" && m.Role != "tool" {
+			continue
+		}
+		response := &ChatResponse{Content: m.Content, MessageUID: m.UID, Persisted: true}
+		if m.ToolCalls != "" {
+			if err := json.Unmarshal([]byte(m.ToolCalls), &response.ToolCalls); err != nil {
+				return nil, "", fmt.Errorf("%w: failed to unmarshal tool calls on message %s: %w", ErrStorageFailure, m.UID, err)
+			}
+		}
+		return response, "", nil
+	}
+	return nil, writtenAheadUID, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRepeatedIdempotencyKeyReturnsTheOriginalTurn(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("first answer", "second answer")
+	opts := ChatOptions{IdempotencyKey: "req-1"}
+
+	first := env.chatWith("s1", "hello", opts)
+	retry := env.chatWith("s1", "hello", opts)
+
+	if retry.Content != first.Content || retry.MessageUID != first.MessageUID {
+		t.Errorf("retry = %q (%s), want the original %q (%s)", retry.Content, retry.MessageUID, first.Content, first.MessageUID)
+	}
+	if n := env.model.callCount(); n != 1 {
+		t.Errorf("model called %d times, want 1", n)
+	}
+	assistants := 0
+	for _, msg := range env.history("s1") {
+		if msg.Role == "assistant" {
+			assistants++
+		}
+	}
+	if assistants != 1 {
+		t.Errorf("%d assistant messages stored, want 1", assistants)
+	}
+}
+
+func TestIdempotencyKeysAreScopedToTheirKeyAndSession(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("one", "two", "three")
+
+	env.chatWith("s1", "hello", ChatOptions{IdempotencyKey: "req-1"})
+	if resp := env.chatWith("s1", "hello again", ChatOptions{IdempotencyKey: "req-2"}); resp.Content != "two" {
+		t.Errorf("a new key replayed %q, want a new turn", resp.Content)
+	}
+	if resp := env.chatWith("s2", "hello", ChatOptions{IdempotencyKey: "req-1"}); resp.Content != "three" {
+		t.Errorf("the same key in another session replayed %q, want a new turn", resp.Content)
+	}
+	if n := env.model.callCount(); n != 3 {
+		t.Errorf("model called %d times, want 3", n)
+	}
+}
+
+func TestRetryAfterAFailedWriteAheadTurnReusesTheStoredUserMessage(t *testing.T) {
+	env := newTestEnv(t)
+	WriteAheadUserMessage = true
+	opts := ChatOptions{IdempotencyKey: "req-1"}
+	env.chat("s1", "earlier")
+	env.model.respond = downModel
+	if _, err := ChatWithOptions("s1", "hello", opts); err == nil {
+		t.Fatal("the turn succeeded against a down model")
+	}
+	env.model.respond = nil
+	env.model.reply("the answer")
+
+	resp := env.chatWith("s1", "hello", opts)
+
+	if resp.Content != "the answer" {
+		t.Errorf("retry content = %q, want a fresh answer", resp.Content)
+	}
+	history := env.history("s1")
+	want := []string{defaultSystemPrompt, "earlier", "ok", "hello", "the answer"}
+	if got := messageContents(history); !slices.Equal(got, want) {
+		t.Errorf("history = %q, want the written-ahead message answered once %q", got, want)
+	}
+	if sent := contents(env.model.lastCall(t).Messages); !slices.Equal(sent, want[:4]) {
+		t.Errorf("model input = %q, want the user message sent once %q", sent, want[:4])
+	}
+	// Once answered, the key replays the reply
+	calls := env.model.callCount()
+	if again := env.chatWith("s1", "hello", opts); again.MessageUID != resp.MessageUID || env.model.callCount() != calls {
+		t.Errorf("second retry = %+v, want the stored reply without a model call", again)
+	}
+}
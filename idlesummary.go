@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// SummarizeIdleSessions stores a model-written summary (ChatSession.summary) on every session whose
+// ChatSession.lastActivity is older than idleFor, so reopening it doesn't need the whole history up front.
+// A summary counts as fresh while ChatSession.summarizedAt is at or after the session's last activity, so
+// running it repeatedly only touches sessions that changed since; unlike CompactHistory, no message is removed.
+// A session that fails to summarize doesn't stop the rest: the failures are returned joined, alongside the
+// number of sessions summarized. It is meant to be driven by an external scheduler.
+func SummarizeIdleSessions(idleFor time.Duration) (int, error) {
+	if idleFor <= 0 {
+		return 0, fmt.Errorf("idleFor must be positive, got %s", idleFor)
+	}
+	cutoff := currentTime().Add(-idleFor)
+
+	query := `
+        query getIdleSessions($cutoff: string) {
+            sessions(func: lt(ChatSession.lastActivity, $cutoff)) @filter(type(ChatSession)) {
+                uid
+                sessionID: ChatSession.sessionID
+                lastActivity: ChatSession.lastActivity
+                summarizedAt: ChatSession.summarizedAt
+            }
+        }
+    `
+	vars := map[string]string{"$cutoff": cutoff.Format(time.RFC3339Nano)}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: dgraph.ExecuteQuery failed while finding idle sessions: %w", ErrStorageFailure, err)
+	}
+
+	var queryResult struct {
+		Sessions []struct {
+			UID          string    `json:"uid"`
+			SessionID    string    `json:"sessionID"`
+			LastActivity time.Time `json:"lastActivity"`
+			SummarizedAt time.Time `json:"summarizedAt"` // Zero when the session was never summarized
+		} `json:"sessions"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return 0, fmt.Errorf("%w: failed to unmarshal idle sessions: %w. JSON: %s", ErrStorageFailure, err, string(resp.Json))
+	}
+
+	summarized := 0
+	var errs []error
+	for _, s := range queryResult.Sessions {
+		if !s.SummarizedAt.IsZero() && !s.SummarizedAt.Before(s.LastActivity) {
+			continue // Already summarized since its last activity
+		}
+		stored, err := summarizeIdleSession(s.UID, s.SessionID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", s.SessionID, err))
+			continue
+		}
+		if stored {
+			summarized++
+		}
+	}
+
+	logger.Info("idle sessions summarized", "summarized", summarized, "failed", len(errs), "cutoff", cutoff)
+	return summarized, errors.Join(errs...)
+}
+
+// summarizeIdleSession writes the summary of one session onto its node, reporting false when the session
+// has nothing besides system prompts to summarize
+func summarizeIdleSession(sessionUID string, sessionID string) (bool, error) {
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	history, err := loadHistoryFromDgraph(context.Background(), sessionID)
+	if err != nil {
+		return false, err
+	}
+	var conversation []DgraphChatMessage
+	for _, msg := range history {
+		if msg.Role != "system" || msg.Summary {
+			conversation = append(conversation, msg)
+		}
+	}
+	if len(conversation) == 0 {
+		return false, nil
+	}
+
+	summary, _, err := summarizeMessages(context.Background(), conversation)
+	if err != nil {
+		return false, err
+	}
+
+	// ChatSession.lastActivity is left alone, so the session stays idle and the summary stays fresh
+	setJsonPayload, err := json.Marshal(map[string]interface{}{
+		"uid":                      sessionUID,
+		"ChatSession.summary":      summary,
+		"ChatSession.summarizedAt": currentTime().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal Dgraph SetJson: %w", err)
+	}
+	mutation := &dgraph.Mutation{
+		SetJson: string(setJsonPayload),
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		return false, fmt.Errorf("%w: dgraph.ExecuteMutations failed storing summary of session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+	return true, nil
+}
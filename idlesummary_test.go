@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// sessionSummary returns the ChatSession.summary stored for a session, or nil when there is none
+func sessionSummary(env *testEnv, sessionID string) any {
+	env.t.Helper()
+	uids := env.store.find("ChatSession", "ChatSession.sessionID", sessionID)
+	if len(uids) != 1 {
+		env.t.Fatalf("found %d ChatSession nodes for %s, want 1", len(uids), sessionID)
+	}
+	return env.store.value(uids[0], "ChatSession.summary")
+}
+
+func TestSummarizeIdleSessionsOnlySummarizesIdleOnes(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("idle reply", "active reply", "the idle summary")
+	env.chat("idle", "old question")
+	env.clock.Advance(2 * time.Hour)
+	env.chat("active", "new question")
+	calls := env.model.callCount()
+
+	summarized, err := SummarizeIdleSessions(time.Hour)
+
+	if err != nil || summarized != 1 {
+		t.Fatalf("SummarizeIdleSessions = %d, %v, want 1 session", summarized, err)
+	}
+	if got := sessionSummary(env, "idle"); got != "the idle summary" {
+		t.Errorf("idle session summary = %v, want the model's summary", got)
+	}
+	if got := sessionSummary(env, "active"); got != nil {
+		t.Errorf("active session summary = %v, want none", got)
+	}
+	if env.model.callCount() != calls+1 {
+		t.Errorf("model called %d times, want one summary", env.model.callCount()-calls)
+	}
+	if n := len(env.history("idle")); n != 3 {
+		t.Errorf("idle session has %d messages, want the history left in place", n)
+	}
+}
+
+func TestSummarizeIdleSessionsSkipsFreshSummaries(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("reply", "first summary", "reply again", "second summary")
+	env.chat("s1", "hello")
+	env.clock.Advance(2 * time.Hour)
+	if n, err := SummarizeIdleSessions(time.Hour); err != nil || n != 1 {
+		t.Fatalf("first run = %d, %v, want 1", n, err)
+	}
+	calls := env.model.callCount()
+
+	if n, err := SummarizeIdleSessions(time.Hour); err != nil || n != 0 {
+		t.Errorf("second run = %d, %v, want the fresh summary skipped", n, err)
+	}
+	if env.model.callCount() != calls {
+		t.Error("the model was called for a session whose summary is fresh")
+	}
+
+	// New activity makes the summary stale once the session goes idle again
+	env.chat("s1", "back again")
+	env.clock.Advance(2 * time.Hour)
+	if n, err := SummarizeIdleSessions(time.Hour); err != nil || n != 1 {
+		t.Errorf("run after new activity = %d, %v, want 1", n, err)
+	}
+	if got := sessionSummary(env, "s1"); got != "second summary" {
+		t.Errorf("summary = %v, want the refreshed one", got)
+	}
+}
+
+func TestSummarizeIdleSessionsCarriesOnPastFailures(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("broken", "unsummarizable")
+	env.chat("fine", "hello")
+	env.clock.Advance(2 * time.Hour)
+	env.model.respond = func(call fakeModelCall) (*openai.ChatModelOutput, error) {
+		for _, m := range call.Messages {
+			if strings.Contains(m.Content, "unsummarizable") {
+				return nil, errors.New("503 service unavailable")
+			}
+		}
+		return textOutput("a summary"), nil
+	}
+
+	summarized, err := SummarizeIdleSessions(time.Hour)
+
+	if summarized != 1 || err == nil || !strings.Contains(err.Error(), "session broken") {
+		t.Errorf("SummarizeIdleSessions = %d, %v, want 1 session and the failure of broken", summarized, err)
+	}
+	if got := sessionSummary(env, "fine"); got != "a summary" {
+		t.Errorf("fine session summary = %v, want it summarized despite the failure", got)
+	}
+}
+
+func TestSummarizeIdleSessionsRejectsANonPositiveThreshold(t *testing.T) {
+	newTestEnv(t)
+
+	if _, err := SummarizeIdleSessions(0); err == nil {
+		t.Error("SummarizeIdleSessions(0) succeeded, want an error")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// maxImagesPerTurn bounds how many images a single ChatWithImages call may attach
+const maxImagesPerTurn = 10
+
+// ImageInput is one image attached to a user message, given either by URL or as base64-encoded data
+type ImageInput struct {
+	URL      string `json:"url,omitempty"`      // Publicly reachable image URL (or a data: URL)
+	Data     string `json:"data,omitempty"`     // Base64-encoded image bytes, used when URL is empty
+	MimeType string `json:"mimeType,omitempty"` // Required with Data, e.g. "image/png"
+}
+
+// ChatWithImages processes a chat turn whose user message carries images, for models that accept image input.
+// Only references to the images are stored with the message (the URL, or a hash for inline data), never the bytes,
+// so later turns replay the text of this message without the images.
+func ChatWithImages(sessionID string, userMessage string, images []ImageInput) (*ChatResponse, error) {
+	if err := validateImages(images); err != nil {
+		return nil, err
+	}
+	return chat(sessionID, userMessage, images, ChatOptions{})
+}
+
+func validateImages(images []ImageInput) error {
+	if len(images) > maxImagesPerTurn {
+		return fmt.Errorf("%w: %d images exceeds the maximum of %d", ErrInvalidOptions, len(images), maxImagesPerTurn)
+	}
+	for i, img := range images {
+		switch {
+		case img.URL != "" && img.Data != "":
+			return fmt.Errorf("%w: image %d must set either url or data, not both", ErrInvalidOptions, i)
+		case img.URL == "" && img.Data == "":
+			return fmt.Errorf("%w: image %d must set url or data", ErrInvalidOptions, i)
+		case img.Data != "" && strings.TrimSpace(img.MimeType) == "":
+			return fmt.Errorf("%w: image %d has data but no mimeType", ErrInvalidOptions, i)
+		case img.Data != "":
+			if _, err := base64.StdEncoding.DecodeString(img.Data); err != nil {
+				return fmt.Errorf("%w: image %d data is not valid base64: %w", ErrInvalidOptions, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// imageRefs returns what is persisted for each image: its URL, or its MIME type and a content hash for inline data
+func imageRefs(images []ImageInput) []string {
+	refs := make([]string, len(images))
+	for i, img := range images {
+		if img.URL != "" && !strings.HasPrefix(img.URL, "data:") {
+			refs[i] = img.URL
+			continue
+		}
+		payload := img.Data
+		if payload == "" {
+			payload = img.URL
+		}
+		sum := sha256.Sum256([]byte(payload))
+		mimeType := img.MimeType
+		if mimeType == "" {
+			mimeType = "image"
+		}
+		refs[i] = fmt.Sprintf("inline:%s;sha256:%s", mimeType, hex.EncodeToString(sum[:]))
+	}
+	return refs
+}
+
+// newMultimodalUserMessage builds a user request message carrying the text followed by the images
+func newMultimodalUserMessage(content string, images []ImageInput) openai.RequestMessage {
+	parts := []openai.UserMessageContentPart{openai.NewTextContentPart(content)}
+	for _, img := range images {
+		if img.URL != "" {
+			parts = append(parts, openai.NewImageContentPartFromUrl(img.URL))
+		} else {
+			parts = append(parts, openai.NewImageContentPartFromData(img.Data, img.MimeType))
+		}
+	}
+	return openai.NewUserMessageFromParts(parts...)
+}
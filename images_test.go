@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChatWithImagesSendsMultimodalInputAndStoresReferences(t *testing.T) {
+	env := newTestEnv(t)
+	images := []ImageInput{{URL: "https://example.com/cat.png"}, {Data: "aGk=", MimeType: "image/png"}}
+
+	if _, err := ChatWithImages("s1", "what is this?", images); err != nil {
+		t.Fatalf("ChatWithImages: %v", err)
+	}
+
+	input := env.model.lastCall(t).Input
+	raw, err := json.Marshal(input.Messages[len(input.Messages)-1])
+	if err != nil {
+		t.Fatalf("marshaling the user message: %v", err)
+	}
+	var sent struct {
+		Role    string `json:"role"`
+		Content []struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			ImageURL struct {
+				URL string `json:"url"`
+			} `json:"image_url"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &sent); err != nil {
+		t.Fatalf("the user message is not multimodal: %v (%s)", err, raw)
+	}
+	if sent.Role != "user" || len(sent.Content) != 3 {
+		t.Fatalf("user message = %s, want a text part and two image parts", raw)
+	}
+	if sent.Content[0].Type != "text" || sent.Content[0].Text != "what is this?" {
+		t.Errorf("first part = %+v, want the text", sent.Content[0])
+	}
+	if sent.Content[1].Type != "image_url" || sent.Content[1].ImageURL.URL != "https://example.com/cat.png" {
+		t.Errorf("second part = %+v, want the image URL", sent.Content[1])
+	}
+	if sent.Content[2].ImageURL.URL != "data:image/png;base64,aGk=" {
+		t.Errorf("third part = %+v, want the inline data as a data URL", sent.Content[2])
+	}
+
+	stored := env.history("s1")[1]
+	if stored.Content != "what is this?" || len(stored.ImageRefs) != 2 {
+		t.Fatalf("stored user message = %+v, want the text with two image references", stored)
+	}
+	if stored.ImageRefs[0] != "https://example.com/cat.png" || !strings.HasPrefix(stored.ImageRefs[1], "inline:image/png;sha256:") {
+		t.Errorf("image refs = %q, want the URL and a hash of the inline data", stored.ImageRefs)
+	}
+	if strings.Contains(strings.Join(stored.ImageRefs, " "), "aGk=") {
+		t.Error("the raw image bytes were persisted")
+	}
+
+	// The next turn replays the earlier message as text only
+	env.chat("s1", "thanks")
+	replayed := env.model.lastCall(t).Messages[1]
+	if !reflect.DeepEqual(replayed, fakeMessage{Role: "user", Content: "what is this?"}) {
+		t.Errorf("replayed message = %+v, want the text without images", replayed)
+	}
+}
+
+func TestChatWithImagesRejectsInvalidImages(t *testing.T) {
+	env := newTestEnv(t)
+	cases := map[string][]ImageInput{
+		"url and data":    {{URL: "https://example.com/a.png", Data: "aGk=", MimeType: "image/png"}},
+		"neither":         {{}},
+		"data, no mime":   {{Data: "aGk="}},
+		"invalid base64":  {{Data: "not base64!", MimeType: "image/png"}},
+		"too many images": make([]ImageInput, maxImagesPerTurn+1),
+	}
+	for name, images := range cases {
+		if _, err := ChatWithImages("s1", "look", images); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: error = %v, want ErrInvalidOptions", name, err)
+		}
+	}
+	if n := env.model.callCount(); n != 0 {
+		t.Errorf("the model was called %d times for invalid input", n)
+	}
+}
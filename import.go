@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// ImportAllSessions reads ExportAllSessions output from r, one SessionExport per line, and stores each session.
+// A session that already exists is skipped, or replaced when overwrite is set. Lines that fail to parse or
+// store don't stop the import: their errors are collected and returned joined, alongside the number of
+// sessions that were imported.
+func ImportAllSessions(r io.Reader, overwrite bool) (imported int, err error) {
+	reader := bufio.NewReader(r)
+	var errs []error
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			errs = append(errs, fmt.Errorf("failed to read line %d: %w", lineNumber, readErr))
+			break
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var export SessionExport
+			if err := json.Unmarshal(line, &export); err != nil {
+				errs = append(errs, fmt.Errorf("line %d: failed to parse session: %w", lineNumber, err))
+			} else if stored, err := importSession(export, overwrite); err != nil {
+				errs = append(errs, fmt.Errorf("line %d: session %s: %w", lineNumber, export.SessionID, err))
+			} else if stored {
+				imported++
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+	return imported, errors.Join(errs...)
+}
+
+// importSession stores one exported session, reporting false when it was skipped because it already exists.
+// The messages are saved first and the session's own predicates are then restored over the new node.
+func importSession(export SessionExport, overwrite bool) (bool, error) {
+	sessionID := export.SessionID
+	if err := validateSessionID(sessionID); err != nil {
+		return false, err
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	exists, err := SessionExists(sessionID)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		if !overwrite {
+			return false, nil
+		}
+		cleared, err := ClearChat(sessionID)
+		if err != nil {
+			return false, err
+		}
+		if !cleared.Success {
+			return false, fmt.Errorf("%w: %s", ErrStorageFailure, cleared.Message)
+		}
+	}
+
+	messages := make([]DgraphChatMessage, len(export.Messages))
+	for i, msg := range export.Messages {
+		if !isKnownRole(msg.Role) {
+			return false, fmt.Errorf("message %d has unknown role %q", i, msg.Role)
+		}
+		msg.UID = "" // Always create new nodes
+		msg.DgraphType = []string{"ChatMessage"}
+		messages[i] = msg
+	}
+	saved, err := saveNewMessagesToDgraph(context.Background(), sessionID, export.Owner, messages)
+	if err != nil {
+		return false, err
+	}
+
+	sessionObject := map[string]interface{}{
+		"uid": saved.SessionUID,
+	}
+	if !export.CreatedAt.IsZero() {
+		sessionObject["ChatSession.createdAt"] = export.CreatedAt.Format(time.RFC3339Nano)
+	}
+	if !export.LastActivity.IsZero() {
+		sessionObject["ChatSession.lastActivity"] = export.LastActivity.Format(time.RFC3339Nano)
+	}
+	if export.Title != "" {
+		sessionObject["ChatSession.title"] = export.Title
+	}
+	if export.SystemPrompt != "" {
+		sessionObject["ChatSession.systemPrompt"] = export.SystemPrompt
+	}
+	if export.Model != "" {
+		sessionObject["ChatSession.model"] = export.Model
+	}
+	if len(export.Tags) > 0 {
+		sessionObject["ChatSession.tags"] = export.Tags
+	}
+	if export.Archived {
+		sessionObject["ChatSession.archived"] = true
+	}
+	setJsonPayload, err := json.Marshal(sessionObject)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal Dgraph SetJson: %w", err)
+	}
+	mutation := &dgraph.Mutation{
+		SetJson: string(setJsonPayload),
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		return false, fmt.Errorf("%w: dgraph.ExecuteMutations failed restoring predicates of session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+	return true, nil
+}
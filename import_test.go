@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exportsByID parses ExportAllSessions output, keyed by session ID
+func exportsByID(t *testing.T, data []byte) map[string]SessionExport {
+	t.Helper()
+	exports := map[string]SessionExport{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var export SessionExport
+		if err := json.Unmarshal(scanner.Bytes(), &export); err != nil {
+			t.Fatalf("line %q does not parse: %v", scanner.Text(), err)
+		}
+		exports[export.SessionID] = export
+	}
+	return exports
+}
+
+func TestImportAllSessionsRestoresABulkExport(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("first reply", "second reply")
+	env.chat("alpha", "hello")
+	env.chat("beta", "hi there")
+	if err := AddSessionTag("alpha", "vip"); err != nil {
+		t.Fatalf("AddSessionTag: %v", err)
+	}
+	if err := ArchiveSession("beta"); err != nil {
+		t.Fatalf("ArchiveSession: %v", err)
+	}
+
+	var backup bytes.Buffer
+	if _, err := ExportAllSessions(context.Background(), &backup); err != nil {
+		t.Fatalf("ExportAllSessions: %v", err)
+	}
+	for _, id := range []string{"alpha", "beta"} {
+		if _, err := ClearChat(id); err != nil {
+			t.Fatalf("ClearChat(%s): %v", id, err)
+		}
+	}
+
+	imported, err := ImportAllSessions(bytes.NewReader(backup.Bytes()), false)
+	if err != nil || imported != 2 {
+		t.Fatalf("ImportAllSessions = %d, %v, want 2 sessions", imported, err)
+	}
+
+	var restored bytes.Buffer
+	if _, err := ExportAllSessions(context.Background(), &restored); err != nil {
+		t.Fatalf("ExportAllSessions after import: %v", err)
+	}
+	want, got := exportsByID(t, backup.Bytes()), exportsByID(t, restored.Bytes())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restored sessions differ from the backup:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestImportAllSessionsSkipsOrOverwritesExistingSessions(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "original")
+	line := `{"sessionID":"s1","messages":[{"role":"user","content":"imported"}]}` + "\n"
+
+	imported, err := ImportAllSessions(strings.NewReader(line), false)
+	if err != nil || imported != 0 {
+		t.Errorf("ImportAllSessions without overwrite = %d, %v, want the existing session skipped", imported, err)
+	}
+	if got := messageContents(env.history("s1")); got[1] != "original" {
+		t.Errorf("history = %q, want it untouched", got)
+	}
+
+	imported, err = ImportAllSessions(strings.NewReader(line), true)
+	if err != nil || imported != 1 {
+		t.Fatalf("ImportAllSessions with overwrite = %d, %v, want 1", imported, err)
+	}
+	if got := messageContents(env.history("s1")); !reflect.DeepEqual(got, []string{"imported"}) {
+		t.Errorf("history = %q, want only the imported message", got)
+	}
+}
+
+func TestImportAllSessionsContinuesPastBadLines(t *testing.T) {
+	env := newTestEnv(t)
+	input := strings.Join([]string{
+		`{"sessionID":"good1","messages":[{"role":"user","content":"one"}]}`,
+		`not json`,
+		``,
+		`{"sessionID":"bad role","messages":[{"role":"wizard","content":"two"}]}`,
+		`{"sessionID":"good2","messages":[{"role":"user","content":"three"}]}`,
+	}, "\n")
+
+	imported, err := ImportAllSessions(strings.NewReader(input), false)
+	if imported != 2 {
+		t.Errorf("imported %d sessions, want the 2 valid ones", imported)
+	}
+	if err == nil || !strings.Contains(err.Error(), "line 2") || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("error = %v, want the failures of lines 2 and 4 collected", err)
+	}
+	for _, id := range []string{"good1", "good2"} {
+		if len(env.history(id)) != 1 {
+			t.Errorf("session %s was not imported", id)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// SessionIntegrity reports sequence-number problems in a session's stored history
+type SessionIntegrity struct {
+	SessionID     string   `json:"sessionID"`
+	MessageCount  int      `json:"messageCount"`
+	MissingSeqs   []int    `json:"missingSeqs,omitempty"`   // Sequence numbers in 1..max with no message
+	DuplicateSeqs []int    `json:"duplicateSeqs,omitempty"` // Sequence numbers shared by more than one message
+	Unnumbered    []string `json:"unnumbered,omitempty"`    // UIDs of messages without a sequence number
+	OutOfOrder    []string `json:"outOfOrder,omitempty"`    // UIDs of messages timestamped before the message preceding them in seq order
+	Healthy       bool     `json:"healthy"`
+}
+
+// VerifySession checks a session's messages for gaps, duplicate sequence numbers and out-of-order timestamps.
+// It only reads; use RepairSession to fix what it finds.
+func VerifySession(sessionID string) (SessionIntegrity, error) {
+	report := SessionIntegrity{SessionID: sessionID}
+	if err := validateSessionID(sessionID); err != nil {
+		return report, err
+	}
+
+	history, err := loadHistoryFromDgraph(context.Background(), sessionID)
+	if err != nil {
+		return report, err
+	}
+	report.MessageCount = len(history)
+
+	// 1. Walk the numbered messages in seq order
+	var numbered []DgraphChatMessage
+	for _, msg := range history {
+		if msg.Seq > 0 {
+			numbered = append(numbered, msg)
+		} else {
+			report.Unnumbered = append(report.Unnumbered, msg.UID)
+		}
+	}
+	sort.SliceStable(numbered, func(i, j int) bool { return numbered[i].Seq < numbered[j].Seq })
+
+	expected := 1
+	for i, msg := range numbered {
+		if i > 0 && msg.Seq == numbered[i-1].Seq {
+			if len(report.DuplicateSeqs) == 0 || report.DuplicateSeqs[len(report.DuplicateSeqs)-1] != msg.Seq {
+				report.DuplicateSeqs = append(report.DuplicateSeqs, msg.Seq)
+			}
+		}
+		for ; expected < msg.Seq; expected++ {
+			report.MissingSeqs = append(report.MissingSeqs, expected)
+		}
+		expected = msg.Seq + 1
+
+		// 2. A message may share its predecessor's timestamp (same turn), but never precede it
+		if i > 0 && msg.Timestamp.Before(numbered[i-1].Timestamp) {
+			report.OutOfOrder = append(report.OutOfOrder, msg.UID)
+		}
+	}
+
+	report.Healthy = len(report.MissingSeqs) == 0 && len(report.DuplicateSeqs) == 0 &&
+		len(report.Unnumbered) == 0 && len(report.OutOfOrder) == 0
+	return report, nil
+}
+
+// RepairSession renumbers a session's messages 1..n in timestamp order (existing seqs break ties)
+// and returns how many messages had their sequence number changed.
+func RepairSession(sessionID string) (int, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return 0, err
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	// loadHistoryFromDgraph already orders by timestamp, then seq
+	history, err := loadHistoryFromDgraph(context.Background(), sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	var nquadsBuilder strings.Builder
+	changed := 0
+	for i, msg := range history {
+		if msg.Seq == i+1 {
+			continue
+		}
+		nquadsBuilder.WriteString(fmt.Sprintf("<%s> <ChatMessage.seq> \"%d\" .\n", msg.UID, i+1))
+		changed++
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+
+	mutation := &dgraph.Mutation{
+		SetNquads: nquadsBuilder.String(),
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		return 0, fmt.Errorf("%w: dgraph.ExecuteMutations failed renumbering session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+	return changed, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVerifyAndRepairACorruptedSession(t *testing.T) {
+	env := newTestEnv(t)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	var messages []DgraphChatMessage
+	for i, content := range []string{"m1", "m2", "m3", "m4", "m5"} {
+		messages = append(messages, DgraphChatMessage{Role: "user", Content: content, Timestamp: start.Add(time.Duration(i) * time.Minute)})
+	}
+	saved, err := saveLocked("s1", "", messages)
+	if err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+	uids := saved.MessageUIDs
+
+	// m3 reuses seq 2 (leaving 3 missing), m4 is stamped before everything else and m5 lost its seq
+	env.store.set(uids[2], "ChatMessage.seq", 2)
+	env.store.set(uids[3], "ChatMessage.timestamp", start.Add(-time.Minute))
+	env.store.set(uids[4], "ChatMessage.seq", nil)
+
+	report, err := VerifySession("s1")
+	if err != nil {
+		t.Fatalf("VerifySession: %v", err)
+	}
+	want := SessionIntegrity{
+		SessionID:     "s1",
+		MessageCount:  5,
+		MissingSeqs:   []int{3},
+		DuplicateSeqs: []int{2},
+		Unnumbered:    []string{uids[4]},
+		OutOfOrder:    []string{uids[3]},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("VerifySession = %+v, want %+v", report, want)
+	}
+
+	changed, err := RepairSession("s1")
+	if err != nil {
+		t.Fatalf("RepairSession: %v", err)
+	}
+	if changed != 5 {
+		t.Errorf("RepairSession changed %d seqs, want 5", changed)
+	}
+	history := env.history("s1")
+	if got, want := messageContents(history), []string{"m4", "m1", "m2", "m3", "m5"}; !slices.Equal(got, want) {
+		t.Errorf("history after repair = %q, want timestamp order %q", got, want)
+	}
+	for i, msg := range history {
+		if msg.Seq != i+1 {
+			t.Errorf("%s has seq %d, want %d", msg.Content, msg.Seq, i+1)
+		}
+	}
+
+	if report, err := VerifySession("s1"); err != nil || !report.Healthy {
+		t.Errorf("VerifySession after repair = %+v, %v, want healthy", report, err)
+	}
+}
+
+func TestVerifyAndRepairAHealthySession(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+	env.chat("s1", "again")
+	mutations := env.store.mutationCount()
+
+	if report, err := VerifySession("s1"); err != nil || !report.Healthy || report.MessageCount != 5 {
+		t.Errorf("VerifySession = %+v, %v, want a healthy report of 5 messages", report, err)
+	}
+	if changed, err := RepairSession("s1"); err != nil || changed != 0 {
+		t.Errorf("RepairSession = %d, %v, want nothing to change", changed, err)
+	}
+	if n := env.store.mutationCount(); n != mutations {
+		t.Errorf("repairing a healthy session wrote %d mutations", n-mutations)
+	}
+}
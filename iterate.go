@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// defaultSessionPageSize is used by IterateSessions when no page size is given
+const defaultSessionPageSize = 1000
+
+// IterateSessions pages through every session ID, archived ones included, calling fn once per page.
+// Only one page is held in memory at a time, so it scales to graphs too large for ListSessions.
+// Pages follow UID order, which is stable while iterating; sessions created meanwhile may or may not be visited.
+// Returning an error from fn stops the iteration, and IterateSessions returns that error unchanged.
+func IterateSessions(pageSize int, fn func(sessionIDs []string) error) error {
+	if pageSize <= 0 {
+		pageSize = defaultSessionPageSize
+	}
+
+	query := `
+        query iterateSessions($first: int, $after: string) {
+            sessions(func: type(ChatSession), first: $first, after: $after) {
+                uid
+                sessionID: ChatSession.sessionID
+            }
+        }
+    `
+	after := "0x0" // Every real UID sorts after it
+	for {
+		vars := map[string]string{
+			"$first": strconv.Itoa(pageSize),
+			"$after": after,
+		}
+		resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+			Query:     query,
+			Variables: vars,
+		})
+		if err != nil {
+			return fmt.Errorf("%w: dgraph.ExecuteQuery failed paging sessions after %s: %w", ErrStorageFailure, after, err)
+		}
+
+		var queryResult struct {
+			Sessions []struct {
+				UID       string `json:"uid"`
+				SessionID string `json:"sessionID"`
+			} `json:"sessions"`
+		}
+		if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+			return fmt.Errorf("%w: failed to unmarshal session page: %w. JSON: %s", ErrStorageFailure, err, string(resp.Json))
+		}
+		if len(queryResult.Sessions) == 0 {
+			return nil
+		}
+
+		sessionIDs := make([]string, 0, len(queryResult.Sessions))
+		for _, s := range queryResult.Sessions {
+			if s.SessionID != "" {
+				sessionIDs = append(sessionIDs, s.SessionID)
+			}
+		}
+		if len(sessionIDs) > 0 {
+			if err := fn(sessionIDs); err != nil {
+				return err
+			}
+		}
+
+		if len(queryResult.Sessions) < pageSize {
+			return nil // A short page is the last one
+		}
+		after = queryResult.Sessions[len(queryResult.Sessions)-1].UID
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestIterateSessionsVisitsEverySessionOnceAcrossPages(t *testing.T) {
+	env := newTestEnv(t)
+	var want []string
+	for i := 0; i < 7; i++ {
+		id := fmt.Sprintf("s%d", i)
+		env.chat(id, "hello")
+		want = append(want, id)
+	}
+
+	var pages [][]string
+	err := IterateSessions(3, func(sessionIDs []string) error {
+		pages = append(pages, slices.Clone(sessionIDs))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("IterateSessions: %v", err)
+	}
+
+	if len(pages) != 3 || len(pages[0]) != 3 || len(pages[1]) != 3 || len(pages[2]) != 1 {
+		t.Errorf("pages = %q, want pages of 3, 3 and 1", pages)
+	}
+	got := slices.Concat(pages...)
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("visited = %q, want every session once: %q", got, want)
+	}
+}
+
+func TestIterateSessionsStopsWhenTheCallbackFails(t *testing.T) {
+	env := newTestEnv(t)
+	for i := 0; i < 5; i++ {
+		env.chat(fmt.Sprintf("s%d", i), "hello")
+	}
+	stop := errors.New("stop")
+
+	pages := 0
+	err := IterateSessions(2, func([]string) error {
+		pages++
+		return stop
+	})
+
+	if err != stop {
+		t.Errorf("error = %v, want the callback's error unchanged", err)
+	}
+	if pages != 1 {
+		t.Errorf("callback ran %d times, want iteration to stop after the first page", pages)
+	}
+}
+
+func TestIterateSessionsOnAnEmptyGraphNeverCallsBack(t *testing.T) {
+	newTestEnv(t)
+
+	err := IterateSessions(0, func([]string) error {
+		t.Error("callback ran with no sessions stored")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("IterateSessions: %v", err)
+	}
+}
+
+func TestIterateSessionsReportsStorageFailures(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+	env.store.fail = func(call fakeStoreCall) error {
+		if call.Name == "iterateSessions" {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	if err := IterateSessions(10, func([]string) error { return nil }); !errors.Is(err, ErrStorageFailure) {
+		t.Errorf("error = %v, want ErrStorageFailure", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// ChatOptions.ResponseFormat values
+const (
+	ResponseFormatText = "text"
+	ResponseFormatJSON = "json"
+)
+
+// strictJSONInstruction is appended for the single retry after the model returned content that isn't JSON
+const strictJSONInstruction = "Your previous reply was not valid JSON. Reply again with only a single valid JSON value: no prose, no Markdown code fences, no trailing text."
+
+// completeJSON is completeWithFallback for JSON-mode requests: the chosen completion must parse as JSON
+func completeJSON(ctx context.Context, chain []string, messages []openai.RequestMessage, configure func(*openai.ChatModelInput), choiceIndex int) (*openai.ChatModelOutput, string, error) {
+	return withJSONValidation(completeWithFallback)(ctx, chain, messages, configure, choiceIndex)
+}
+
+// withJSONValidation wraps complete so the chosen completion must parse as JSON. Wrapping a post-processed
+// completion validates the content as it will be returned and stored, not as the model sent it.
+// Content that doesn't parse gets one retry with a stricter instruction before ErrInvalidJSONResponse is returned.
+// Completions that call tools carry no content and are returned as-is.
+func withJSONValidation(complete completionFunc) completionFunc {
+	return func(ctx context.Context, chain []string, messages []openai.RequestMessage, configure func(*openai.ChatModelInput), choiceIndex int) (*openai.ChatModelOutput, string, error) {
+		output, answeringModel, err := complete(ctx, chain, messages, configure, choiceIndex)
+		if err != nil || isJSONCompletion(output, choiceIndex) {
+			return output, answeringModel, err
+		}
+		logger.Info("model returned invalid JSON, retrying with a stricter instruction", "model", answeringModel)
+
+		strictMessages := append(append([]openai.RequestMessage(nil), messages...), openai.NewSystemMessage(strictJSONInstruction))
+		output, answeringModel, err = complete(ctx, chain, strictMessages, configure, choiceIndex)
+		if err != nil {
+			return nil, "", err
+		}
+		if !isJSONCompletion(output, choiceIndex) {
+			return nil, "", fmt.Errorf("%w: model %s returned invalid JSON after a retry", ErrInvalidJSONResponse, answeringModel)
+		}
+		return output, answeringModel, nil
+	}
+}
+
+func isJSONCompletion(output *openai.ChatModelOutput, choiceIndex int) bool {
+	message := output.Choices[choiceIndex].Message
+	if len(message.ToolCalls) > 0 {
+		return true
+	}
+	return json.Valid([]byte(strings.TrimSpace(message.Content)))
+}
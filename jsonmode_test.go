@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestJSONModeAcceptsValidJSON(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply(`{"answer": 42}`)
+
+	resp := env.chatWith("s1", "as json", ChatOptions{ResponseFormat: ResponseFormatJSON})
+
+	if resp.Content != `{"answer": 42}` {
+		t.Errorf("Content = %q, want the raw JSON", resp.Content)
+	}
+	call := env.model.lastCall(t)
+	if !reflect.DeepEqual(call.Input.ResponseFormat, openai.ResponseFormatJson) {
+		t.Errorf("ResponseFormat = %+v, want JSON output requested", call.Input.ResponseFormat)
+	}
+	if n := env.model.callCount(); n != 1 {
+		t.Errorf("model called %d times, want no retry", n)
+	}
+	if stored := env.history("s1")[2].Content; stored != `{"answer": 42}` {
+		t.Errorf("stored content = %q, want the raw JSON", stored)
+	}
+}
+
+func TestJSONModeRetriesOnceWithAStricterInstruction(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("Sure! Here it is: {answer: 42}", `{"answer": 42}`)
+
+	resp := env.chatWith("s1", "as json", ChatOptions{ResponseFormat: ResponseFormatJSON})
+
+	if resp.Content != `{"answer": 42}` {
+		t.Errorf("Content = %q, want the retried JSON", resp.Content)
+	}
+	if n := env.model.callCount(); n != 2 {
+		t.Fatalf("model called %d times, want one retry", n)
+	}
+	if last := env.model.lastCall(t).Messages; last[len(last)-1] != (fakeMessage{Role: "system", Content: strictJSONInstruction}) {
+		t.Errorf("retry ended with %+v, want the strict JSON instruction", last[len(last)-1])
+	}
+}
+
+func TestJSONModeFailsWhenTheRetryIsStillInvalid(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("not json")
+
+	if _, err := ChatWithOptions("s1", "as json", ChatOptions{ResponseFormat: ResponseFormatJSON}); !errors.Is(err, ErrInvalidJSONResponse) {
+		t.Fatalf("error = %v, want ErrInvalidJSONResponse", err)
+	}
+	if n := env.model.callCount(); n != 2 {
+		t.Errorf("model called %d times, want exactly one retry", n)
+	}
+	if n := env.store.nodeCount("ChatMessage"); n != 0 {
+		t.Errorf("%d messages persisted for an invalid JSON turn", n)
+	}
+}
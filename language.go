@@ -0,0 +1,46 @@
+package main
+
+import "fmt"
+
+// LanguageDetector identifies the language of a user message.
+// Detect returns a language name or code (e.g. "en", "Portuguese"), or "" when it can't tell.
+type LanguageDetector interface {
+	Detect(text string) string
+}
+
+// languageDetector is nil by default, which disables detection
+var languageDetector LanguageDetector
+
+// SetLanguageDetector installs the detector whose result is stored on each user message as ChatMessage.lang.
+// Passing nil disables detection.
+func SetLanguageDetector(d LanguageDetector) {
+	languageDetector = d
+}
+
+// detectLanguage returns the detected language of text, or "" when no detector is configured
+func detectLanguage(text string) string {
+	if languageDetector == nil {
+		return ""
+	}
+	return languageDetector.Detect(text)
+}
+
+// languageInstruction is appended to the system prompt when ChatOptions.ForceLanguage is set
+func languageInstruction(language string) string {
+	return fmt.Sprintf("Always respond in %s, regardless of the language the user writes in.", language)
+}
+
+// withLanguageInstruction returns history with the response-language instruction added to its system prompt,
+// inserting a system message first if there is none. The input slice is not modified.
+func withLanguageInstruction(history []DgraphChatMessage, language string) []DgraphChatMessage {
+	instruction := languageInstruction(language)
+	augmented := make([]DgraphChatMessage, len(history), len(history)+1)
+	copy(augmented, history)
+	for i, msg := range augmented {
+		if msg.Role == "system" {
+			augmented[i].Content = msg.Content + "\n\n" + instruction
+			return augmented
+		}
+	}
+	return append([]DgraphChatMessage{{Role: "system", Content: instruction}}, augmented...)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// prefixDetector reports Portuguese for messages starting with "Olá" and English otherwise
+type prefixDetector struct{}
+
+func (prefixDetector) Detect(text string) string {
+	if strings.HasPrefix(text, "Olá") {
+		return "pt"
+	}
+	return "en"
+}
+
+func TestDetectedLanguageIsStoredOnTheUserMessage(t *testing.T) {
+	env := newTestEnv(t)
+	SetLanguageDetector(prefixDetector{})
+
+	env.chat("s1", "hello")
+	env.chat("s1", "Olá, tudo bem?")
+
+	history := env.history("s1")
+	if history[1].Lang != "en" || history[3].Lang != "pt" {
+		t.Errorf("stored languages = %q, %q, want en then pt", history[1].Lang, history[3].Lang)
+	}
+	if history[2].Lang != "" {
+		t.Errorf("assistant message has lang %q, want none", history[2].Lang)
+	}
+}
+
+func TestForceLanguageAddsTheInstructionToTheSystemPrompt(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.chatWith("s1", "hello", ChatOptions{ForceLanguage: "Spanish"})
+
+	system := env.model.lastCall(t).Messages[0]
+	if system.Role != "system" || !strings.HasPrefix(system.Content, defaultSystemPrompt) || !strings.HasSuffix(system.Content, languageInstruction("Spanish")) {
+		t.Errorf("system prompt sent = %q, want the default followed by the Spanish instruction", system.Content)
+	}
+	if stored := env.history("s1")[0].Content; stored != defaultSystemPrompt {
+		t.Errorf("stored system prompt = %q, want it without the per-turn instruction", stored)
+	}
+
+	env.chat("s1", "again")
+	if sent := env.model.lastCall(t).Messages[0].Content; sent != defaultSystemPrompt {
+		t.Errorf("system prompt without ForceLanguage = %q, want the plain default", sent)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import "sync/atomic"
+
+// Logger is the diagnostic sink used throughout the package.
+// The method set deliberately matches *slog.Logger, so hosts can pass slog.Default() directly
+// or wrap zap (e.g. a zap.SugaredLogger's Debugw/Infow/Warnw/Errorw) with a thin adapter.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// nopLogger discards everything; it is the default so the package stays quiet unless a host opts in
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+// installedLogger holds the Logger set by SetLogger. It is swapped atomically because detached goroutines
+// (message subscribers, streams) keep logging while a host replaces it.
+var installedLogger atomic.Pointer[loggerSlot]
+
+// loggerSlot boxes the interface so loggers of different concrete types can share one atomic.Pointer
+type loggerSlot struct{ Logger }
+
+// logger is what the package logs through; every call reads the currently installed Logger
+var logger Logger = currentLogger{}
+
+// currentLogger forwards to the installed Logger, or discards when none was set
+type currentLogger struct{}
+
+func (currentLogger) Debug(msg string, args ...any) { loadLogger().Debug(msg, args...) }
+func (currentLogger) Info(msg string, args ...any)  { loadLogger().Info(msg, args...) }
+func (currentLogger) Warn(msg string, args ...any)  { loadLogger().Warn(msg, args...) }
+func (currentLogger) Error(msg string, args ...any) { loadLogger().Error(msg, args...) }
+
+// loadLogger returns the installed Logger
+func loadLogger() Logger {
+	if slot := installedLogger.Load(); slot != nil {
+		return slot.Logger
+	}
+	return nopLogger{}
+}
+
+// SetLogger replaces the package logger. Passing nil restores the no-op default.
+// It is safe to call while other goroutines are logging.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	installedLogger.Store(&loggerSlot{l})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger keeps every entry as "LEVEL msg key=value ..."
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) record(level string, msg string, args []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, strings.TrimSpace(level+" "+msg+" "+fmt.Sprintln(args...)))
+}
+
+func (l *recordingLogger) Debug(msg string, args ...any) { l.record("DEBUG", msg, args) }
+func (l *recordingLogger) Info(msg string, args ...any)  { l.record("INFO", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...any)  { l.record("WARN", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...any) { l.record("ERROR", msg, args) }
+
+// count returns how many entries start with prefix ("LEVEL msg")
+func (l *recordingLogger) count(prefix string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, e := range l.entries {
+		if strings.HasPrefix(e, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// has reports whether some entry starts with prefix ("LEVEL msg")
+func (l *recordingLogger) has(prefix string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if strings.HasPrefix(e, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureStdout returns what fn writes to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestDefaultLoggerProducesNoOutput(t *testing.T) {
+	env := newTestEnv(t)
+	SetLogger(nil)
+
+	out := captureStdout(t, func() {
+		env.chat("quiet", "hello")
+		env.history("quiet")
+	})
+	if out != "" {
+		t.Errorf("a Chat turn wrote %q to stdout with the default logger", out)
+	}
+}
+
+func TestSetLoggerReceivesHistoryDumpAtDebugLevel(t *testing.T) {
+	env := newTestEnv(t)
+	recorder := &recordingLogger{}
+	SetLogger(recorder)
+
+	env.chat("loud", "hello")
+	if !recorder.has("DEBUG effective message history being sent") {
+		t.Errorf("no debug entry for the effective history; got %q", recorder.entries)
+	}
+	if !recorder.has("DEBUG history message") {
+		t.Errorf("history messages were not logged at debug level; got %q", recorder.entries)
+	}
+}
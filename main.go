@@ -3,35 +3,130 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	_ "github.com/hypermodeinc/modus/sdk/go" // Modus runtime
 	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
-	"github.com/hypermodeinc/modus/sdk/go/pkg/models"
 	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
 )
 
-const dgraphConnectionName = "website" // Must match modus.json
+const defaultDgraphConnectionName = "website" // Must match modus.json
+
+// dgraphConnectionName is the Dgraph connection used by every query, mutation and schema change
+var dgraphConnectionName = defaultDgraphConnectionName
+
 const modelName = "google-gemini"
-const defaultSystemPrompt = "You are a helpful assistant"
+
+const (
+	builtinSystemPrompt = "You are a helpful assistant"
+	builtinTemperature  = 0.7
+	maxTemperature      = 2.0
+)
+
+// defaultSystemPrompt and defaultTemperature apply when nothing more specific is configured
+var (
+	defaultSystemPrompt = builtinSystemPrompt
+	defaultTemperature  = builtinTemperature
+)
+
+// SetDefaultSystemPrompt changes the system prompt new sessions start with (unless SystemPromptTemplate is set).
+// An empty prompt restores the built-in default.
+func SetDefaultSystemPrompt(prompt string) error {
+	if prompt == "" {
+		defaultSystemPrompt = builtinSystemPrompt
+		return nil
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return fmt.Errorf("default system prompt must not be blank")
+	}
+	defaultSystemPrompt = prompt
+	return nil
+}
+
+// SetDefaultTemperature changes the sampling temperature used for chat completions; it must be within 0..2
+func SetDefaultTemperature(temperature float64) error {
+	if temperature < 0 || temperature > maxTemperature {
+		return fmt.Errorf("temperature must be between 0 and %.1f, got %v", maxTemperature, temperature)
+	}
+	defaultTemperature = temperature
+	return nil
+}
+
+// SetDgraphConnectionName points the package at a different Dgraph connection declared in modus.json.
+// An empty name restores the default.
+func SetDgraphConnectionName(name string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultDgraphConnectionName
+	}
+	dgraphConnectionName = name
+}
 
 // ChatResponse represents the response from the Chat function
 type ChatResponse struct {
-	Content string `json:"content"`
+	Content      string     `json:"content"`
+	ToolCalls    []ToolCall `json:"toolCalls,omitempty"`    // Set when the model asked to call tools instead of answering
+	Candidates   []string   `json:"candidates,omitempty"`   // Every generated completion when ChatOptions.N > 1
+	DryRunPrompt string     `json:"dryRunPrompt,omitempty"` // JSON-encoded request messages, set only when ChatOptions.DryRun is true
+	Fallback     bool       `json:"fallback,omitempty"`     // Set when no model was available and FallbackResponse was returned
+	MessageUID   string     `json:"messageUID,omitempty"`   // UID of the stored assistant message; empty when saving failed
+	Persisted    bool       `json:"persisted"`              // False when the turn could not be saved; the next turn won't see it in history
+	Truncated    bool       `json:"truncated,omitempty"`    // Set when the content was cut to MaxResponseChars
+	ModelUsed    string     `json:"modelUsed,omitempty"`    // The model that answered, after any fallback; empty for FallbackResponse
+	LatencyMs    int64      `json:"latencyMs"`              // Time spent getting the completion, including fallbacks and retries; 0 for cache hits
+	FinishReason string     `json:"finishReason,omitempty"` // Why the model stopped; "length" means the reply was cut off and ContinueLastResponse can extend it
+	Warnings     []string   `json:"warnings,omitempty"`     // Non-fatal issues with the turn, each "code: detail" (see the Warning* constants)
+	DebugPrompt  string     `json:"debugPrompt,omitempty"`  // JSON-encoded request messages sent to the model, set only when DebugIncludePrompt is on
 }
 
 // DgraphChatMessage is used for storing and retrieving messages from Dgraph
 type DgraphChatMessage struct {
-	UID        string    `json:"uid,omitempty"`         // UID from Dgraph, useful if we need to reference it
-	Role       string    `json:"role"`                  // Dgraph predicate: ChatMessage.role
-	Content    string    `json:"content"`               // Dgraph predicate: ChatMessage.content
-	Timestamp  time.Time `json:"timestamp"`             // Dgraph predicate: ChatMessage.timestamp
-	DgraphType []string  `json:"dgraph.type,omitempty"` // For setting Dgraph type
+	UID              string            `json:"uid,omitempty"`              // UID from Dgraph, useful if we need to reference it
+	Role             string            `json:"role"`                       // Dgraph predicate: ChatMessage.role
+	Content          string            `json:"content"`                    // Dgraph predicate: ChatMessage.content
+	Timestamp        time.Time         `json:"timestamp"`                  // Dgraph predicate: ChatMessage.timestamp
+	ToolCalls        []ToolCall        `json:"toolCalls,omitempty"`        // Dgraph predicate: ChatMessage.toolCalls (JSON-encoded)
+	ToolCallID       string            `json:"toolCallID,omitempty"`       // Dgraph predicate: ChatMessage.toolCallID, set on tool results
+	Moderation       string            `json:"moderation,omitempty"`       // Dgraph predicate: ChatMessage.moderationReason, set when output was blocked
+	Model            string            `json:"model,omitempty"`            // Dgraph predicate: ChatMessage.model, the model that generated an assistant message
+	IdempotencyKey   string            `json:"idempotencyKey,omitempty"`   // Dgraph predicate: ChatMessage.idempotencyKey, shared by both messages of a turn
+	Seq              int               `json:"seq,omitempty"`              // Dgraph predicate: ChatMessage.seq, 1-based position within the session
+	ImageRefs        []string          `json:"imageRefs,omitempty"`        // Dgraph predicate: ChatMessage.imageRefs (JSON-encoded), references to images attached to a user message
+	DocumentRefs     []string          `json:"documentRefs,omitempty"`     // Dgraph predicate: ChatMessage.documentRefs (JSON-encoded), IDs or titles of the context documents sent with a user message
+	PromptTokens     int               `json:"promptTokens,omitempty"`     // Dgraph predicate: ChatMessage.promptTokens, as reported by the model for an assistant message
+	CompletionTokens int               `json:"completionTokens,omitempty"` // Dgraph predicate: ChatMessage.completionTokens, as reported by the model for an assistant message
+	Lang             string            `json:"lang,omitempty"`             // Dgraph predicate: ChatMessage.lang, the detected language of a user message
+	Truncated        bool              `json:"truncated,omitempty"`        // Dgraph predicate: ChatMessage.truncated, set when MaxResponseChars cut the content
+	FullContent      string            `json:"fullContent,omitempty"`      // Dgraph predicate: ChatMessage.fullContent, written only with StoreUntruncatedResponse and not loaded with history
+	Cached           bool              `json:"cached,omitempty"`           // Dgraph predicate: ChatMessage.cached, set when the response came from the response cache
+	Sentiment        *float64          `json:"sentiment,omitempty"`        // Dgraph predicate: ChatMessage.sentiment, the analyzer's score for a user message
+	LatencyMs        int64             `json:"latencyMs,omitempty"`        // Dgraph predicate: ChatMessage.latencyMs, how long the model took to produce an assistant message
+	FinishReason     string            `json:"finishReason,omitempty"`     // Dgraph predicate: ChatMessage.finishReason, why the model stopped ("stop", "length", ...)
+	Fallback         bool              `json:"fallback,omitempty"`         // Dgraph predicate: ChatMessage.fallback, set when the canned FallbackResponse stood in for the model
+	Source           string            `json:"source,omitempty"`           // Dgraph predicate: ChatMessage.source, who created the message ("api", "model", ...)
+	Summary          bool              `json:"summary,omitempty"`          // Dgraph predicate: ChatMessage.summary, set on the system message CompactHistory wrote in place of older turns
+	Seed             int               `json:"seed,omitempty"`             // Dgraph predicate: ChatMessage.seed, the sampling seed requested for an assistant message
+	Pinned           bool              `json:"pinned,omitempty"`           // Dgraph predicate: ChatMessage.pinned, set by PinMessage to keep the message in every prompt
+	User             string            `json:"user,omitempty"`             // Dgraph predicate: ChatMessage.user, the end-user identifier (ChatOptions.User) sent with a user message
+	UserTruncated    bool              `json:"userTruncated,omitempty"`    // Dgraph predicate: ChatMessage.userTruncated, set when an oversized user message was cut to MaxUserMessageLength
+	Metadata         map[string]string `json:"metadata,omitempty"`         // Dgraph predicate: ChatMessage.metadata (JSON-encoded), the caller's ChatOptions.Metadata for the turn, never sent to the model
+	DgraphType       []string          `json:"dgraph.type,omitempty"`      // For setting Dgraph type
 }
 
+// WriteAheadUserMessage saves the user message before the model is invoked instead of together with the reply.
+// A failed save then fails the call before any tokens are spent, at the cost of storing user messages whose
+// reply never arrived when the model call itself fails.
+var WriteAheadUserMessage = false
+
+// DebugIncludePrompt fills ChatResponse.DebugPrompt with the exact messages sent to the model, for support cases.
+// It exposes the whole conversation (system prompt included) to the caller, so leave it off in production.
+var DebugIncludePrompt = false
+
 // ClearChatResponse represents the response from the ClearChat function
 type ClearChatResponse struct {
 	Success bool   `json:"success"`
@@ -40,164 +135,696 @@ type ClearChatResponse struct {
 
 // Chat processes a chat request, now with Dgraph-backed memory
 func Chat(sessionID string, userMessage string) (*ChatResponse, error) {
-	model, err := models.GetModel[openai.ChatModel](modelName)
+	return ChatWithOptions(sessionID, userMessage, ChatOptions{})
+}
+
+// ChatWithOptions processes a chat request like Chat, with per-call options
+func ChatWithOptions(sessionID string, userMessage string, opts ChatOptions) (*ChatResponse, error) {
+	return chat(sessionID, userMessage, nil, opts)
+}
+
+// chat runs one turn for every public Chat variant; images, if any, are attached to the new user message
+func chat(sessionID string, userMessage string, images []ImageInput, opts ChatOptions) (*ChatResponse, error) {
+	response, err := runChatTurn(sessionID, userMessage, images, opts)
+	recordTurn(err)
+	return response, err
+}
+
+func runChatTurn(sessionID string, userMessage string, images []ImageInput, opts ChatOptions) (*ChatResponse, error) {
+	turnCtx, cancel := turnContext() // Budget for everything up to the model's answer (see TurnTimeout)
+	defer cancel()
+
+	userMessage, userTruncated, err := validateChatInput(sessionID, userMessage)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateChatOptions(opts); err != nil {
+		return nil, err
+	}
+	userMessage, err = filterUserInput(userMessage) // No-op unless SetBlockedKeywords was called
 	if err != nil {
-		return nil, fmt.Errorf("error getting model: %w", err)
+		return nil, err
+	}
+
+	// Rejected turns are turned away before they queue on the session lock
+	if err := allowTurn(sessionID, currentTime()); err != nil {
+		return nil, err
+	}
+
+	// Hold the session lock across load -> invoke -> save so concurrent turns can't interleave
+	unlock := lockSession(sessionID)
+	defer unlock()
+	if err := checkTurnBudget(turnCtx); err != nil {
+		return nil, err // The budget ran out while queued behind another turn
+	}
+
+	// A turn that neither reads nor writes history never touches the session, so it needs no ownership check
+	stateless := !opts.includeHistory() && !opts.persist()
+
+	// A caller acting for a user may only continue that user's sessions
+	if opts.UserID != "" && !stateless {
+		if err := checkSessionOwner(sessionID, opts.UserID, false); err != nil {
+			return nil, err
+		}
+	}
+
+	// A retried request with a known idempotency key gets the original answer back, or, when only its
+	// written-ahead user message was stored, answers that message rather than storing it again
+	writtenAheadUID := ""
+	if opts.IdempotencyKey != "" && !opts.DryRun && opts.persist() {
+		previous, userMessageUID, err := findIdempotentResponse(sessionID, opts.IdempotencyKey)
+		if err != nil {
+			logger.Error("error checking idempotency key, processing as a new turn", "sessionID", sessionID, "error", err)
+		} else if previous != nil {
+			return previous, nil
+		}
+		writtenAheadUID = userMessageUID
 	}
 
-	turnTimestamp := time.Now().UTC() // Capture timestamp for the current turn
+	turnTimestamp := currentTime() // Capture timestamp for the current turn
 
 	ctx := context.Background() // Context for Dgraph operations
 
-	// 1. Load history from Dgraph
-	loadedMessages, err := loadHistoryFromDgraph(ctx, sessionID)
-	if err != nil {
-		// Log error but attempt to continue as a new session
-		fmt.Printf("Error loading history for session %s: %v. Treating as new session.\\n", sessionID, err)
-		loadedMessages = []DgraphChatMessage{} // Ensure it's an empty slice
+	var warnings []string // Non-fatal issues reported back in ChatResponse.Warnings
+	if userTruncated {
+		warnings = append(warnings, warning(WarningUserMessageTruncated, "cut to %d characters", MaxUserMessageLength))
+	}
+
+	// 1. Load history from Dgraph (unless the turn opted out of it)
+	var loadedMessages []DgraphChatMessage
+	var loadErr error
+	storeSystemPrompts := true // Only a genuinely new session stores its prompts
+	sessionPrompt := ""        // The existing session's stored system prompt, when known
+	if opts.includeHistory() {
+		loadedMessages, loadErr = loadHistoryFromDgraph(ctx, sessionID)
+		if loadErr != nil {
+			// Log error but attempt to continue as a new session
+			logger.Error("error loading history, treating as new session", "sessionID", sessionID, "error", loadErr)
+			loadedMessages = []DgraphChatMessage{} // Ensure it's an empty slice
+			warnings = append(warnings, warning(WarningHistoryUnavailable, "history could not be loaded; the model saw no earlier messages"))
+			storeSystemPrompts = false // The session may already have them
+		}
+		if writtenAheadUID != "" {
+			// The stored user message is this turn's own; it goes to the model once, as the new message
+			loadedMessages = slices.DeleteFunc(loadedMessages, func(m DgraphChatMessage) bool { return m.UID == writtenAheadUID })
+		}
+	} else if opts.persist() {
+		// The history isn't needed, but whether this turn creates the session still decides if its prompts are
+		// stored, and an existing session's stored prompt still outranks the default
+		metadata, err := GetSessionMetadata(sessionID)
+		switch {
+		case err == nil:
+			storeSystemPrompts = false
+			sessionPrompt = metadata.SystemPrompt
+		case !errors.Is(err, ErrSessionNotFound):
+			logger.Error("error looking up session, not storing system prompts", "sessionID", sessionID, "error", err)
+			storeSystemPrompts = false
+		}
+	}
+
+	// A double-submitted message gets the reply the first submission produced
+	if len(images) == 0 && !opts.DryRun {
+		if previous, found := findDuplicateTurn(loadedMessages, userMessage, turnTimestamp); found {
+			logger.Info("duplicate user message, returning the stored reply", "sessionID", sessionID, "messageUID", previous.MessageUID)
+			return previous, nil
+		}
 	}
 
 	var currentChatHistoryForLLM []DgraphChatMessage // History to build for the LLM
+	var systemMessagesToSave []DgraphChatMessage     // Only set when this turn creates the session
 	if len(loadedMessages) == 0 {
-		// Add default system prompt if no history (new session or failed load)
-		currentChatHistoryForLLM = append(currentChatHistoryForLLM, DgraphChatMessage{
-			Role:      "system",
-			Content:   defaultSystemPrompt,
-			Timestamp: time.Now().UTC(), // Timestamp mainly for consistency here
-		})
+		// Add the system prompt(s) if no history (new session, failed load or history left out)
+		systemPrompts, _, err := resolveSystemPrompt(opts, sessionPrompt)
+		if err != nil {
+			return nil, err
+		}
+		for _, systemPrompt := range systemPrompts {
+			systemMessage := DgraphChatMessage{
+				Role:       "system",
+				Content:    systemPrompt,
+				Timestamp:  turnTimestamp, // seq keeps them ahead of the turn's other messages, in order
+				DgraphType: []string{"ChatMessage"},
+			}
+			currentChatHistoryForLLM = append(currentChatHistoryForLLM, systemMessage)
+			if storeSystemPrompts {
+				systemMessagesToSave = append(systemMessagesToSave, systemMessage)
+			}
+		}
 	} else {
-		currentChatHistoryForLLM = loadedMessages
+		currentChatHistoryForLLM = limitHistory(loadedMessages, opts.MaxHistoryMessages)
+		if dropped := len(loadedMessages) - len(currentChatHistoryForLLM); dropped > 0 {
+			// Logged too, so "the bot forgot earlier context" reports can be traced without the response
+			logger.Debug("history trimmed to fit the prompt", "sessionID", sessionID, "dropped", dropped, "stored", len(loadedMessages), "maxHistoryMessages", opts.MaxHistoryMessages)
+			warnings = append(warnings, warning(WarningHistoryLimited, "%d of %d stored messages were left out of the prompt", dropped, len(loadedMessages)))
+		}
+		// The stored prompt is part of the history; a per-request prompt (or the default, for a session
+		// that never stored one) takes its place in what the model sees, without changing what is stored
+		systemPrompts, fromSession, err := resolveSystemPrompt(opts, storedSystemPrompt(loadedMessages))
+		if err != nil {
+			return nil, err
+		}
+		if !fromSession {
+			currentChatHistoryForLLM = replaceSystemPrompts(currentChatHistoryForLLM, systemPrompts, turnTimestamp)
+		}
 	}
+	currentChatHistoryForLLM = withExamples(currentChatHistoryForLLM, opts.Examples)
 
 	// 2. Prepare and add current user message to in-memory history for LLM
 	userMessageToSave := DgraphChatMessage{
-		Role:       "user",
-		Content:    userMessage,
-		Timestamp:  turnTimestamp, // Use captured turn timestamp
-		DgraphType: []string{"ChatMessage"},
+		Role:           "user",
+		Content:        userMessage,
+		Timestamp:      turnTimestamp, // Use captured turn timestamp
+		IdempotencyKey: opts.IdempotencyKey,
+		Source:         messageSource(opts),
+		User:           opts.User,
+		UserTruncated:  userTruncated,
+		Metadata:       opts.Metadata,
+		DgraphType:     []string{"ChatMessage"},
+	}
+	if len(images) > 0 {
+		userMessageToSave.ImageRefs = imageRefs(images)
+	}
+	if len(opts.ContextDocuments) > 0 {
+		userMessageToSave.DocumentRefs = documentRefs(opts.ContextDocuments) // The text itself is never stored
+	}
+	userMessageToSave.Lang = detectLanguage(userMessage)
+	userMessageToSave.Sentiment = scoreSentiment(sessionID, userMessage)
+	if EnableRedaction && RedactLLMInput {
+		// Stored history is already redacted on save; only the new message needs it before the LLM sees it
+		userMessageToSave.Content = redactPII(userMessageToSave.Content)
+	}
+
+	// Optionally inject semantically relevant past messages just ahead of the new user message
+	if EnableSemanticMemory && opts.RelevantMemoryK > 0 && len(loadedMessages) > 0 {
+		relevant, err := RetrieveRelevant(sessionID, userMessage, opts.RelevantMemoryK)
+		if err != nil {
+			logger.Error("error retrieving relevant messages, continuing without them", "sessionID", sessionID, "error", err)
+		} else if memoryMessage, ok := buildRelevantMemoryMessage(relevant, currentChatHistoryForLLM); ok {
+			currentChatHistoryForLLM = append(currentChatHistoryForLLM, memoryMessage)
+		}
+	}
+	// Retrieved documents ground this turn only, so they sit right before the new user message
+	if len(opts.ContextDocuments) > 0 {
+		documentsMessage, err := contextDocumentsMessage(opts.ContextDocuments)
+		if err != nil {
+			return nil, err
+		}
+		currentChatHistoryForLLM = append(currentChatHistoryForLLM, documentsMessage)
 	}
 	currentChatHistoryForLLM = append(currentChatHistoryForLLM, userMessageToSave)
+	if opts.ForceLanguage != "" {
+		currentChatHistoryForLLM = withLanguageInstruction(currentChatHistoryForLLM, opts.ForceLanguage)
+	}
 
 	// 3. Convert currentChatHistoryForLLM to modelMessages for the OpenAI model SDK
-	var modelMessagesForOpenAI []openai.RequestMessage
-	for _, msg := range currentChatHistoryForLLM {
-		switch msg.Role {
-		case "system":
-			modelMessagesForOpenAI = append(modelMessagesForOpenAI, openai.NewSystemMessage(msg.Content))
-		case "user":
-			modelMessagesForOpenAI = append(modelMessagesForOpenAI, openai.NewUserMessage(msg.Content))
-		case "assistant":
-			modelMessagesForOpenAI = append(modelMessagesForOpenAI, openai.NewAssistantMessage(msg.Content))
-		}
+	modelMessagesForOpenAI := toModelMessages(currentChatHistoryForLLM)
+	if len(images) > 0 {
+		// The new user message is always last; swap in a version that carries the images themselves
+		modelMessagesForOpenAI[len(modelMessagesForOpenAI)-1] = newMultimodalUserMessage(userMessageToSave.Content, images)
 	}
 
-	fmt.Printf("DEBUG: Effective message history being sent for session %s:\\n", sessionID)
+	logger.Debug("effective message history being sent", "sessionID", sessionID, "messages", len(currentChatHistoryForLLM))
 	for _, chatMsg := range currentChatHistoryForLLM {
-		fmt.Printf("  - Role: %s, Content: %s, Timestamp: %s\\n", chatMsg.Role, chatMsg.Content, chatMsg.Timestamp.Format(time.RFC3339))
+		logger.Debug("history message", "role", chatMsg.Role, "content", chatMsg.Content, "timestamp", chatMsg.Timestamp.Format(time.RFC3339))
 	}
 
-	// 4. Invoke LLM
-	input, err := model.CreateInput(modelMessagesForOpenAI...)
-	if err != nil {
-		return nil, fmt.Errorf("error creating model input: %w", err)
+	// In dry-run mode, stop here: report the exact prompt without invoking the model or saving anything
+	if opts.DryRun {
+		promptJson, err := json.Marshal(modelMessagesForOpenAI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize dry-run prompt: %w", err)
+		}
+		return &ChatResponse{DryRunPrompt: string(promptJson)}, nil
 	}
-	input.Temperature = 0.7 // Example temperature
 
-	output, err := model.Invoke(input)
-	if err != nil {
-		return nil, fmt.Errorf("error invoking model: %w", err)
+	debugPrompt := ""
+	if DebugIncludePrompt {
+		promptJson, err := json.Marshal(modelMessagesForOpenAI)
+		if err != nil {
+			logger.Error("error serializing debug prompt", "sessionID", sessionID, "error", err)
+		} else {
+			debugPrompt = string(promptJson)
+		}
+	}
+
+	// With write-ahead on, the user message is stored before the model is called, so it survives a failed save later
+	userMessageSaved := writtenAheadUID != "" // A retry of a failed turn whose user message is already stored
+	if WriteAheadUserMessage && opts.persist() && !userMessageSaved {
+		writeAhead := append(append([]DgraphChatMessage(nil), systemMessagesToSave...), userMessageToSave)
+		saved, err := saveNewMessagesToDgraph(ctx, sessionID, opts.UserID, writeAhead)
+		if err != nil {
+			return nil, err // Nothing has reached the model yet, so the caller can simply retry
+		}
+		userMessageSaved = true
+		publishMessageEvents(sessionID, saved)
+	}
+
+	// 4. Invoke LLM, falling back through the model chain if a model is unavailable
+	configureInput := func(input *openai.ChatModelInput) {
+		input.Temperature = defaultTemperature
+		input.Tools = toOpenAITools(opts.Tools)
+		if opts.N > 1 {
+			input.N = opts.N
+		}
+		input.Stop = opts.Stop
+		input.PresencePenalty = opts.PresencePenalty   // Zero is omitted from the request
+		input.FrequencyPenalty = opts.FrequencyPenalty // Zero is omitted from the request
+		input.Seed = opts.Seed                         // Zero is omitted from the request
+		input.User = opts.User                         // Empty is omitted from the request
+		if opts.ResponseFormat == ResponseFormatJSON {
+			input.ResponseFormat = openai.ResponseFormatJson
+		}
+	}
+	complete := withPostProcessing(completeWithFallback) // No-op unless post-processors are registered
+	if opts.ResponseFormat == ResponseFormatJSON {
+		complete = withJSONValidation(complete) // Validates the post-processed content parses, retrying once
+	}
+
+	var (
+		assistantContent string
+		toolCalls        []ToolCall
+		candidates       []string
+		usage            openai.Usage
+		answeringModel   string
+		usedFallback     bool
+		usedCache        bool
+		finishReason     string
+	)
+	sessionModel := ""
+	if len(opts.Models) == 0 && !stateless {
+		if sessionModel, err = getSessionModel(sessionID); err != nil {
+			logger.Error("error loading session model, using the default chain", "sessionID", sessionID, "error", err)
+		}
+	}
+	chain := resolveModelChain(opts, sessionModel)
+	cacheKey := ""
+	if EnableResponseCache {
+		key, err := responseCacheKey(chain, modelMessagesForOpenAI, opts)
+		if err != nil {
+			logger.Error("error computing response cache key, skipping cache", "sessionID", sessionID, "error", err)
+		} else if cached, ok := getCachedResponse(key, currentTime()); ok {
+			logger.Debug("response cache hit", "sessionID", sessionID)
+			assistantContent = cached.content
+			toolCalls = cached.toolCalls
+			candidates = cached.candidates
+			answeringModel = cached.model
+			usedCache = true
+		} else {
+			cacheKey = key
+		}
+	}
+
+	var latencyMs int64
+	if !usedCache {
+		invokeStart := currentTime()
+		output, model, err := complete(turnCtx, chain, modelMessagesForOpenAI, configureInput, opts.PersistIndex)
+		latencyMs = currentTime().Sub(invokeStart).Milliseconds()
+		if err == nil {
+			metrics.ObserveModelLatency(model, currentTime().Sub(invokeStart))
+		}
+		if err != nil {
+			if !EnableFallback || !errors.Is(err, ErrModelUnavailable) {
+				if opts.persist() {
+					recordErrorEvent(sessionID, err) // No-op unless PersistTurnErrors is on
+				}
+				return nil, err // Nothing has been persisted for this turn yet
+			}
+			// Degrade gracefully: answer with the canned response and record it like any other turn
+			logger.Error("no model available, returning fallback response", "sessionID", sessionID, "error", err)
+			assistantContent = FallbackResponse
+			usedFallback = true
+			warnings = append(warnings, warning(WarningFallbackResponse, "no model was available"))
+		} else {
+			chosen := output.Choices[opts.PersistIndex] // Only this candidate becomes part of the stored history
+			assistantContent = strings.TrimSpace(chosen.Message.Content)
+			toolCalls = fromOpenAIToolCalls(chosen.Message.ToolCalls)
+			if opts.N > 1 {
+				candidates = completionCandidates(output)
+			}
+			usage = output.Usage
+			finishReason = chosen.FinishReason
+			answeringModel = model
+			if opts.Seed != 0 && output.SystemFingerprint == "" {
+				// Providers that honor seeds report a fingerprint to compare runs by; without one, reproducibility is unlikely
+				warnings = append(warnings, warning(WarningSeedUnsupported, "model %s did not confirm seed support; results may not be reproducible", model))
+			}
+			if len(chain) > 0 && model != chain[0] {
+				warnings = append(warnings, warning(WarningModelFallback, "answered by %s instead of %s", model, chain[0]))
+			}
+			if cacheKey != "" {
+				putCachedResponse(cacheKey, cachedResponse{content: assistantContent, toolCalls: toolCalls, candidates: candidates, model: model}, currentTime())
+			}
+		}
+	}
+
+	// Run the output past the moderator (no-op unless one is configured)
+	assistantContent, moderationReason := moderateContent(assistantContent)
+	if moderationReason != "" {
+		logger.Info("assistant response blocked by moderation", "sessionID", sessionID, "reason", moderationReason)
+		warnings = append(warnings, warning(WarningResponseModerated, "%s", moderationReason))
+	}
+
+	// Cap very long responses (no-op unless MaxResponseChars is set)
+	fullContent := assistantContent
+	assistantContent, truncated := truncateResponse(assistantContent, MaxResponseChars)
+	if truncated {
+		warnings = append(warnings, warning(WarningResponseTruncated, "cut from %d to %d characters", len([]rune(fullContent)), MaxResponseChars))
 	}
-	assistantContent := strings.TrimSpace(output.Choices[0].Message.Content)
 
 	assistantMessageToSave := DgraphChatMessage{
-		Role:       "assistant",
-		Content:    assistantContent,
-		Timestamp:  turnTimestamp, // Use captured turn timestamp
-		DgraphType: []string{"ChatMessage"},
+		Role:             "assistant",
+		Content:          assistantContent,
+		Timestamp:        turnTimestamp, // Use captured turn timestamp
+		Moderation:       moderationReason,
+		Model:            answeringModel,
+		IdempotencyKey:   opts.IdempotencyKey,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Fallback:         usedFallback,
+		Truncated:        truncated,
+		Cached:           usedCache,
+		LatencyMs:        latencyMs,
+		FinishReason:     finishReason,
+		Source:           SourceModel,
+		Seed:             opts.Seed,
+		DgraphType:       []string{"ChatMessage"},
+	}
+	if truncated && StoreUntruncatedResponse {
+		assistantMessageToSave.FullContent = fullContent
+	}
+	if len(toolCalls) > 0 {
+		// The model asked to call tools rather than answer; record the turn under the "tool" role
+		assistantMessageToSave.Role = "tool"
+		assistantMessageToSave.ToolCalls = toolCalls
 	}
 
-	// 5. Save the NEW user message and NEW assistant response to Dgraph
-	newMessagesToPersist := []DgraphChatMessage{userMessageToSave, assistantMessageToSave}
-	err = saveNewMessagesToDgraph(ctx, sessionID, newMessagesToPersist)
-	if err != nil {
-		// Log error, but chat can still return. Persistence for the *next* turn might be affected.
-		fmt.Printf("CRITICAL: Error saving new messages for session %s: %v. Subsequent history may be incomplete.\\n", sessionID, err)
+	// 5. Save the new session's system prompt and the NEW user message (unless written ahead), then the NEW assistant response
+	newMessagesToPersist := append(append([]DgraphChatMessage(nil), systemMessagesToSave...), userMessageToSave, assistantMessageToSave)
+	if userMessageSaved {
+		newMessagesToPersist = []DgraphChatMessage{assistantMessageToSave}
+	}
+	var assistantMessageUID string
+	persisted := false
+	if !opts.persist() {
+		logger.Debug("persistence disabled for this turn, nothing saved", "sessionID", sessionID)
+	} else if saved, err := saveNewMessagesToDgraph(ctx, sessionID, opts.UserID, newMessagesToPersist); err != nil {
+		// The content is still returned; Persisted=false tells the client this turn is missing from history
+		logger.Error("error saving new messages, subsequent history may be incomplete", "sessionID", sessionID, "error", err)
+		warnings = append(warnings, warning(WarningNotPersisted, "%v", err))
+	} else {
+		persisted = true
+		assistantMessageUID = saved.MessageUIDs[len(saved.MessageUIDs)-1] // The assistant message is always saved last
+		publishMessageEvents(sessionID, saved)
+
+		if EnableEntityExtraction && !usedFallback {
+			userContent, replyContent := userMessageToSave.Content, assistantContent
+			if EnableRedaction {
+				// Facts are stored like messages, so they must not carry PII the messages were stored without
+				userContent, replyContent = redactPII(userContent), redactPII(replyContent)
+			}
+			if saved, err := extractAndSaveEntities(sessionID, userContent, replyContent, turnTimestamp); err != nil {
+				logger.Error("error extracting entities", "sessionID", sessionID, "error", err)
+			} else if saved > 0 {
+				logger.Debug("saved extracted entities", "sessionID", sessionID, "count", saved)
+			}
+		}
+
+		if pruned, err := pruneSessionMessages(ctx, sessionID); err != nil {
+			logger.Error("error pruning old messages", "sessionID", sessionID, "error", err)
+		} else if pruned > 0 {
+			logger.Debug("pruned old messages", "sessionID", sessionID, "count", pruned)
+		}
 	}
 
 	return &ChatResponse{
-		Content: assistantContent,
+		Content:      assistantContent,
+		ToolCalls:    toolCalls,
+		Candidates:   candidates,
+		MessageUID:   assistantMessageUID,
+		Persisted:    persisted,
+		Fallback:     usedFallback,
+		Truncated:    truncated,
+		ModelUsed:    answeringModel,
+		LatencyMs:    latencyMs,
+		FinishReason: finishReason,
+		Warnings:     warnings,
+		DebugPrompt:  debugPrompt,
 	}, nil
 }
 
+// chatMessageFields is the selection block decoded by queryChatMessages; every message query should use it
+const chatMessageFields = `
+                uid
+                role: ChatMessage.role
+                content: ChatMessage.content
+                timestamp: ChatMessage.timestamp
+                toolCalls: ChatMessage.toolCalls
+                toolCallID: ChatMessage.toolCallID
+                moderation: ChatMessage.moderationReason
+                model: ChatMessage.model
+                seq: ChatMessage.seq
+                imageRefs: ChatMessage.imageRefs
+                documentRefs: ChatMessage.documentRefs
+                fallback: ChatMessage.fallback
+                source: ChatMessage.source
+                summary: ChatMessage.summary
+                seed: ChatMessage.seed
+                pinned: ChatMessage.pinned
+                user: ChatMessage.user
+                userTruncated: ChatMessage.userTruncated
+                metadata: ChatMessage.metadata
+                lang: ChatMessage.lang
+                truncated: ChatMessage.truncated
+                cached: ChatMessage.cached
+                sentiment: ChatMessage.sentiment
+                latencyMs: ChatMessage.latencyMs
+                finishReason: ChatMessage.finishReason
+                promptTokens: ChatMessage.promptTokens
+                completionTokens: ChatMessage.completionTokens
+`
+
 func loadHistoryFromDgraph(ctx context.Context, sessionID string) ([]DgraphChatMessage, error) {
 	// 1. Find the UID of the ChatSession with the given sessionID.
 	// 2. Find ChatMessage nodes linked to this ChatSession via the new ChatMessage.sessionIDRef predicate, ordered by timestamp.
 	query := `
         query getSessionMessages($sessionID: string) {
-            messages(func: eq(ChatMessage.sessionIDRef, $sessionID), orderasc: ChatMessage.timestamp) @filter(type(ChatMessage)) {
-                uid
-                role: ChatMessage.role
-                content: ChatMessage.content
-                timestamp: ChatMessage.timestamp
+            messages(func: eq(ChatMessage.sessionIDRef, $sessionID), orderasc: ChatMessage.timestamp) @filter(type(ChatMessage)) {` + chatMessageFields + `
             }
         }
     `
 	vars := map[string]string{"$sessionID": sessionID}
 
-	resp, err := dgraph.ExecuteQuery(dgraphConnectionName, &dgraph.Query{
+	loadStart := currentTime()
+	chatMessages, err := queryChatMessages(query, vars, sessionID)
+	recordStorage("load", loadStart, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dgraph's `orderasc` should handle the ordering, but the (timestamp, seq) sort stays authoritative.
+	// When the two disagree beyond the order of same-timestamp messages, the stored data deserves a look.
+	dgraphOrder := append([]DgraphChatMessage(nil), chatMessages...)
+	sortChatMessages(chatMessages)
+	if misplaced := countMisordered(dgraphOrder, chatMessages); misplaced > 0 {
+		logger.Warn("stored messages came back out of timestamp order; using the sorted order", "sessionID", sessionID, "misplaced", misplaced, "messages", len(chatMessages))
+	}
+
+	return chatMessages, nil
+}
+
+// countMisordered counts the positions where got holds a different message than sorted, ignoring
+// reordering among messages that share a timestamp (Dgraph doesn't order those by seq)
+func countMisordered(got []DgraphChatMessage, sorted []DgraphChatMessage) int {
+	misplaced := 0
+	for i := range got {
+		if got[i].UID != sorted[i].UID && !got[i].Timestamp.Equal(sorted[i].Timestamp) {
+			misplaced++
+		}
+	}
+	return misplaced
+}
+
+// queryChatMessages runs a query whose "messages" block selects chatMessageFields and decodes the result.
+// The returned messages keep the order Dgraph produced.
+func queryChatMessages(query string, vars map[string]string, sessionID string) ([]DgraphChatMessage, error) {
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
 		Query:     query,
 		Variables: vars,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("dgraph.ExecuteQuery failed for session %s: %w", sessionID, err)
+		return nil, fmt.Errorf("%w: dgraph.ExecuteQuery failed for session %s: %w", ErrStorageFailure, sessionID, err)
 	}
 
 	// Revised struct to match the simpler Dgraph JSON output from the new query.
 	// The "messages" key in the JSON will directly contain an array of chat message objects.
 	var queryResult struct {
 		Messages []struct {
-			UID       string    `json:"uid"`
-			Role      string    `json:"role"`      // Corresponds to the alias "role" in the DQL query
-			Content   string    `json:"content"`   // Corresponds to the alias "content" in the DQL query
-			Timestamp time.Time `json:"timestamp"` // Corresponds to the alias "timestamp" in the DQL query
+			UID              string    `json:"uid"`
+			Role             string    `json:"role"`             // Corresponds to the alias "role" in the DQL query
+			Content          string    `json:"content"`          // Corresponds to the alias "content" in the DQL query
+			Timestamp        time.Time `json:"timestamp"`        // Corresponds to the alias "timestamp" in the DQL query
+			ToolCalls        string    `json:"toolCalls"`        // JSON-encoded []ToolCall, only present on tool-call turns
+			ToolCallID       string    `json:"toolCallID"`       // Only present on tool results
+			Moderation       string    `json:"moderation"`       // Only present on blocked assistant messages
+			Model            string    `json:"model"`            // Only present on model-generated messages
+			Seq              int       `json:"seq"`              // Zero for messages saved before sequence numbers existed
+			Truncated        bool      `json:"truncated"`        // Only present on truncated responses
+			Cached           bool      `json:"cached"`           // Only present on cached responses
+			Sentiment        *float64  `json:"sentiment"`        // Only present when a sentiment analyzer was configured
+			LatencyMs        int64     `json:"latencyMs"`        // Only present on model-generated messages
+			FinishReason     string    `json:"finishReason"`     // Only present on model-generated messages
+			Fallback         bool      `json:"fallback"`         // Only present on fallback responses
+			Source           string    `json:"source"`           // Only present on messages saved after sources were recorded
+			Summary          bool      `json:"summary"`          // Only present on CompactHistory summaries
+			Seed             int       `json:"seed"`             // Only present on messages generated with ChatOptions.Seed
+			Pinned           bool      `json:"pinned"`           // Only present on pinned messages
+			User             string    `json:"user"`             // Only present on user messages sent with ChatOptions.User
+			UserTruncated    bool      `json:"userTruncated"`    // Only present on user messages cut to MaxUserMessageLength
+			Lang             string    `json:"lang"`             // Only present when a language detector was configured
+			ImageRefs        string    `json:"imageRefs"`        // JSON-encoded []string, only present on user messages with images
+			DocumentRefs     string    `json:"documentRefs"`     // JSON-encoded []string, only present on user messages sent with context documents
+			Metadata         string    `json:"metadata"`         // JSON-encoded map[string]string, only present on user messages sent with ChatOptions.Metadata
+			PromptTokens     int       `json:"promptTokens"`     // Only present on model-generated messages
+			CompletionTokens int       `json:"completionTokens"` // Only present on model-generated messages
 		} `json:"messages"` // This tag matches the alias "messages" in the Dgraph query
 	}
 
-	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal Dgraph response for session %s: %w. JSON: %s", sessionID, err, string(resp.Json))
+	// A missing or null "messages" block is an empty session; a body that doesn't decode is an error
+	if err := decodeDgraphResponse(resp.Json, &queryResult); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal Dgraph response for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
 	}
 
-	var chatMessages []DgraphChatMessage
-	// Iterate directly over queryResult.Messages which contains the filtered and ordered messages.
-	if queryResult.Messages != nil { // Check if Messages is not nil (it will be an empty slice if no messages found)
-		for _, m := range queryResult.Messages {
-			chatMessages = append(chatMessages, DgraphChatMessage{
-				UID:       m.UID,
-				Role:      m.Role,
-				Content:   m.Content,
-				Timestamp: m.Timestamp,
-				// DgraphType is not strictly needed for loaded messages unless we re-mutate them
-			})
+	chatMessages := []DgraphChatMessage{}
+	for _, m := range queryResult.Messages {
+		chatMessage := DgraphChatMessage{
+			UID:              m.UID,
+			Role:             m.Role,
+			Content:          m.Content,
+			Timestamp:        m.Timestamp,
+			ToolCallID:       m.ToolCallID,
+			Moderation:       m.Moderation,
+			Model:            m.Model,
+			Seq:              m.Seq,
+			PromptTokens:     m.PromptTokens,
+			CompletionTokens: m.CompletionTokens,
+			Fallback:         m.Fallback,
+			Source:           m.Source,
+			Summary:          m.Summary,
+			Seed:             m.Seed,
+			Pinned:           m.Pinned,
+			User:             m.User,
+			UserTruncated:    m.UserTruncated,
+			Lang:             m.Lang,
+			Truncated:        m.Truncated,
+			Cached:           m.Cached,
+			Sentiment:        m.Sentiment,
+			LatencyMs:        m.LatencyMs,
+			FinishReason:     m.FinishReason,
+			// DgraphType is not strictly needed for loaded messages unless we re-mutate them
+		}
+		if m.ToolCalls != "" {
+			if err := json.Unmarshal([]byte(m.ToolCalls), &chatMessage.ToolCalls); err != nil {
+				return nil, fmt.Errorf("%w: failed to unmarshal tool calls on message %s: %w", ErrStorageFailure, m.UID, err)
+			}
+		}
+		if m.ImageRefs != "" {
+			if err := json.Unmarshal([]byte(m.ImageRefs), &chatMessage.ImageRefs); err != nil {
+				return nil, fmt.Errorf("%w: failed to unmarshal image references on message %s: %w", ErrStorageFailure, m.UID, err)
+			}
+		}
+		if m.DocumentRefs != "" {
+			if err := json.Unmarshal([]byte(m.DocumentRefs), &chatMessage.DocumentRefs); err != nil {
+				return nil, fmt.Errorf("%w: failed to unmarshal document references on message %s: %w", ErrStorageFailure, m.UID, err)
+			}
+		}
+		if m.Metadata != "" {
+			if err := json.Unmarshal([]byte(m.Metadata), &chatMessage.Metadata); err != nil {
+				return nil, fmt.Errorf("%w: failed to unmarshal metadata on message %s: %w", ErrStorageFailure, m.UID, err)
+			}
 		}
+		chatMessages = append(chatMessages, chatMessage)
 	}
 
-	// Dgraph's `orderasc` should handle the ordering.
-	// An explicit sort here is a safeguard but might be redundant if Dgraph guarantees order.
-	// Given the previous sort was kept as a safeguard, we'll keep it.
+	return chatMessages, nil
+}
+
+// sortChatMessages orders messages chronologically.
+// Messages of the same turn can share a timestamp, so seq breaks ties.
+func sortChatMessages(chatMessages []DgraphChatMessage) {
 	sort.SliceStable(chatMessages, func(i, j int) bool {
-		return chatMessages[i].Timestamp.Before(chatMessages[j].Timestamp)
+		if !chatMessages[i].Timestamp.Equal(chatMessages[j].Timestamp) {
+			return chatMessages[i].Timestamp.Before(chatMessages[j].Timestamp)
+		}
+		return chatMessages[i].Seq < chatMessages[j].Seq
 	})
+}
 
-	return chatMessages, nil
+// savedMessages identifies the nodes a saveNewMessagesToDgraph call wrote
+type savedMessages struct {
+	SessionUID  string              // The ChatSession node; empty only if Dgraph didn't report it
+	MessageUIDs []string            // One per saved message, in order
+	Messages    []DgraphChatMessage // The messages as stored, i.e. after redaction
 }
 
-func saveNewMessagesToDgraph(ctx context.Context, sessionID string, newMessages []DgraphChatMessage) error {
-	const sessionBlankNode = "_:session"
+// saveNewMessagesToDgraph persists newMessages for the session and returns the UIDs of the session node and of each message.
+// owner, when set, is recorded as ChatSession.owner if this save creates the session.
+// The caller must hold lockSession(sessionID): the next seq is read before the upsert runs,
+// so two unlocked saves for the same session could assign the same sequence numbers.
+func saveNewMessagesToDgraph(ctx context.Context, sessionID string, owner string, newMessages []DgraphChatMessage) (_ *savedMessages, err error) {
+	defer func(start time.Time) { recordStorage("save", start, err) }(currentTime())
+
+	if !sessionLocked(sessionID) {
+		return nil, fmt.Errorf("saveNewMessagesToDgraph called for session %s without holding its session lock", sessionID)
+	}
+
+	// uid(session) resolves to the existing ChatSession node via the upsert query below,
+	// or to a newly created node the first time a session is saved
+	const sessionBlankNode = "uid(session)"
 	var dgraphMutations []interface{}
+
+	if EnableRedaction {
+		newMessages = redactMessages(newMessages) // Never persist raw PII, regardless of what the LLM saw
+	}
+
+	var embeddings [][]float32
+	if EnableSemanticMemory {
+		var err error
+		embeddings, err = embedMessages(newMessages)
+		if err != nil {
+			// Messages are still saved; they just won't be found by RetrieveRelevant
+			logger.Error("error embedding messages, saving without embeddings", "sessionID", sessionID, "error", err)
+			embeddings = nil
+		}
+	}
+
+	firstSeq, err := nextMessageSeq(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
 	sessionUpsertObject := map[string]interface{}{
-		"uid":                   sessionBlankNode,
-		"ChatSession.sessionID": sessionID,
-		"dgraph.type":           "ChatSession",
+		"uid":                      sessionBlankNode,
+		"ChatSession.sessionID":    sessionID,
+		"ChatSession.lastActivity": currentTime().Format(time.RFC3339Nano),
+		"dgraph.type":              "ChatSession",
+	}
+	if firstSeq == 1 {
+		// Nothing has been stored for this session yet, so this save creates it
+		sessionUpsertObject["ChatSession.createdAt"] = sessionUpsertObject["ChatSession.lastActivity"]
+		// With several leading system messages the session records them all, in order
+		var systemPrompts []string
+		for _, msg := range newMessages {
+			if msg.Role != "system" {
+				break
+			}
+			systemPrompts = append(systemPrompts, msg.Content)
+		}
+		if len(systemPrompts) > 0 {
+			sessionUpsertObject["ChatSession.systemPrompt"] = strings.Join(systemPrompts, "\n\n")
+		}
+		if owner != "" {
+			sessionUpsertObject["ChatSession.owner"] = owner
+		}
 	}
 	dgraphMutations = append(dgraphMutations, sessionUpsertObject)
 
@@ -210,6 +837,102 @@ func saveNewMessagesToDgraph(ctx context.Context, sessionID string, newMessages
 			"ChatMessage.content":      msg.Content,
 			"ChatMessage.timestamp":    msg.Timestamp.Format(time.RFC3339Nano),
 			"ChatMessage.sessionIDRef": sessionID, // Link message to session by sessionID
+			"ChatMessage.seq":          firstSeq + i,
+		}
+		if len(msg.ToolCalls) > 0 {
+			toolCallsJson, err := json.Marshal(msg.ToolCalls)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal tool calls: %w", err)
+			}
+			chatMessageObject["ChatMessage.toolCalls"] = string(toolCallsJson)
+		}
+		if msg.ToolCallID != "" {
+			chatMessageObject["ChatMessage.toolCallID"] = msg.ToolCallID
+		}
+		if msg.Moderation != "" {
+			chatMessageObject["ChatMessage.moderationReason"] = msg.Moderation
+		}
+		if msg.Model != "" {
+			chatMessageObject["ChatMessage.model"] = msg.Model
+		}
+		if msg.IdempotencyKey != "" {
+			chatMessageObject["ChatMessage.idempotencyKey"] = msg.IdempotencyKey
+		}
+		if len(msg.ImageRefs) > 0 {
+			imageRefsJson, err := json.Marshal(msg.ImageRefs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal image references: %w", err)
+			}
+			chatMessageObject["ChatMessage.imageRefs"] = string(imageRefsJson)
+		}
+		if len(msg.DocumentRefs) > 0 {
+			documentRefsJson, err := json.Marshal(msg.DocumentRefs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal document references: %w", err)
+			}
+			chatMessageObject["ChatMessage.documentRefs"] = string(documentRefsJson)
+		}
+		if len(msg.Metadata) > 0 {
+			metadataJson, err := json.Marshal(msg.Metadata)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal message metadata: %w", err)
+			}
+			chatMessageObject["ChatMessage.metadata"] = string(metadataJson)
+		}
+		if msg.FinishReason != "" {
+			chatMessageObject["ChatMessage.finishReason"] = msg.FinishReason
+		}
+		if msg.LatencyMs > 0 {
+			chatMessageObject["ChatMessage.latencyMs"] = msg.LatencyMs
+		}
+		if msg.Sentiment != nil {
+			chatMessageObject["ChatMessage.sentiment"] = *msg.Sentiment
+		}
+		if msg.Cached {
+			chatMessageObject["ChatMessage.cached"] = true
+		}
+		if msg.Truncated {
+			chatMessageObject["ChatMessage.truncated"] = true
+		}
+		if msg.FullContent != "" {
+			chatMessageObject["ChatMessage.fullContent"] = msg.FullContent
+		}
+		if msg.Lang != "" {
+			chatMessageObject["ChatMessage.lang"] = msg.Lang
+		}
+		if msg.Fallback {
+			chatMessageObject["ChatMessage.fallback"] = true
+		}
+		if msg.Source != "" {
+			chatMessageObject["ChatMessage.source"] = msg.Source
+		}
+		if msg.Summary {
+			chatMessageObject["ChatMessage.summary"] = true
+		}
+		if msg.Seed != 0 {
+			chatMessageObject["ChatMessage.seed"] = msg.Seed
+		}
+		if msg.Pinned {
+			chatMessageObject["ChatMessage.pinned"] = true
+		}
+		if msg.User != "" {
+			chatMessageObject["ChatMessage.user"] = msg.User
+		}
+		if msg.UserTruncated {
+			chatMessageObject["ChatMessage.userTruncated"] = true
+		}
+		if msg.PromptTokens > 0 {
+			chatMessageObject["ChatMessage.promptTokens"] = msg.PromptTokens
+		}
+		if msg.CompletionTokens > 0 {
+			chatMessageObject["ChatMessage.completionTokens"] = msg.CompletionTokens
+		}
+		if i < len(embeddings) && len(embeddings[i]) > 0 {
+			embeddingJson, err := json.Marshal(embeddings[i])
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal embedding: %w", err)
+			}
+			chatMessageObject["ChatMessage.embedding"] = string(embeddingJson) // Dgraph parses vectors from their string form
 		}
 		dgraphMutations = append(dgraphMutations, chatMessageObject)
 		// The explicit sessionLinkToMessage mutation is no longer needed
@@ -217,7 +940,7 @@ func saveNewMessagesToDgraph(ctx context.Context, sessionID string, newMessages
 
 	setJsonPayload, err := json.Marshal(dgraphMutations)
 	if err != nil {
-		return fmt.Errorf("failed to marshal Dgraph SetJson: %w", err)
+		return nil, fmt.Errorf("failed to marshal Dgraph SetJson: %w", err)
 	}
 
 	// Constructing a dgraph.Mutation object
@@ -225,13 +948,56 @@ func saveNewMessagesToDgraph(ctx context.Context, sessionID string, newMessages
 		SetJson: string(setJsonPayload),
 	}
 
-	// Adjusted ExecuteMutations call: assuming it takes 2 arguments and CommitNow is implicit or default.
-	_, err = dgraph.ExecuteMutations(dgraphConnectionName, mutation)
+	// Run as an upsert so every turn reuses (and touches) the same ChatSession node
+	upsertQuery := `
+        query findSession($sessionID: string) {
+            session as existing(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession)) {
+                uid
+            }
+        }
+    `
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     upsertQuery,
+		Variables: map[string]string{"$sessionID": sessionID},
+	}, mutation)
 	if err != nil {
-		return fmt.Errorf("dgraph.ExecuteMutations failed for session %s: %w. Payload: %s", sessionID, err, string(setJsonPayload))
+		return nil, fmt.Errorf("%w: dgraph.ExecuteMutations failed for session %s: %w. Payload: %s", ErrStorageFailure, sessionID, err, string(setJsonPayload))
 	}
 
-	return nil
+	// Map each message's blank node back to the UID Dgraph assigned it
+	saved := &savedMessages{MessageUIDs: make([]string, len(newMessages)), Messages: newMessages}
+	for i := range newMessages {
+		uid := assignedUID(resp.Uids, fmt.Sprintf("msg%d", i))
+		if uid == "" {
+			// The write went through, but nothing saved can be referenced without its UID
+			return nil, fmt.Errorf("%w: %w: no UID assigned to message %d of session %s. Uids: %v", ErrStorageFailure, ErrMalformedResponse, i, sessionID, resp.Uids)
+		}
+		saved.MessageUIDs[i] = uid
+	}
+
+	// An existing session is found by the upsert query; a new one is created from the empty uid(session)
+	var existing struct {
+		Existing []struct {
+			UID string `json:"uid"`
+		} `json:"existing"`
+	}
+	if err := decodeDgraphResponse(resp.Json, &existing); err == nil && len(existing.Existing) > 0 {
+		saved.SessionUID = existing.Existing[0].UID
+	} else {
+		saved.SessionUID = resp.Uids["uid(session)"]
+	}
+	if saved.SessionUID == "" {
+		logger.Info("Dgraph did not report the session UID", "sessionID", sessionID)
+	}
+	return saved, nil
+}
+
+// assignedUID looks up a blank node in a mutation's Uids map, which may be keyed with or without the "_:" prefix
+func assignedUID(uids map[string]string, blankNode string) string {
+	if uid, ok := uids[blankNode]; ok {
+		return uid
+	}
+	return uids["_:"+blankNode]
 }
 
 // ClearChat clears the chat history for a specific session from Dgraph
@@ -245,11 +1011,17 @@ func ClearChat(sessionID string) (*ClearChatResponse, error) {
             messages(func: eq(ChatMessage.sessionIDRef, $sessionID)) @filter(type(ChatMessage)) {
                 uid
             }
+            entities(func: eq(Entity.sessionIDRef, $sessionID)) @filter(type(Entity)) {
+                uid
+            }
+            errorEvents(func: eq(ErrorEvent.sessionIDRef, $sessionID)) @filter(type(ErrorEvent)) {
+                uid
+            }
         }
     `
 	vars := map[string]string{"$sessionID": sessionID}
 
-	queryResponse, err := dgraph.ExecuteQuery(dgraphConnectionName, &dgraph.Query{
+	queryResponse, err := executeQuery(dgraphConnectionName, &dgraph.Query{
 		Query:     query,
 		Variables: vars,
 	})
@@ -267,6 +1039,12 @@ func ClearChat(sessionID string) (*ClearChatResponse, error) {
 		Messages []struct {
 			UID string `json:"uid"`
 		} `json:"messages"`
+		Entities []struct {
+			UID string `json:"uid"`
+		} `json:"entities"`
+		ErrorEvents []struct {
+			UID string `json:"uid"`
+		} `json:"errorEvents"`
 	}
 	if err := json.Unmarshal([]byte(queryResponse.Json), &queryResult); err != nil {
 		return &ClearChatResponse{
@@ -285,6 +1063,16 @@ func ClearChat(sessionID string) (*ClearChatResponse, error) {
 			uidsToDelete = append(uidsToDelete, msg.UID)
 		}
 	}
+	for _, entity := range queryResult.Entities {
+		if entity.UID != "" {
+			uidsToDelete = append(uidsToDelete, entity.UID)
+		}
+	}
+	for _, event := range queryResult.ErrorEvents {
+		if event.UID != "" {
+			uidsToDelete = append(uidsToDelete, event.UID)
+		}
+	}
 
 	if len(uidsToDelete) == 0 {
 		return &ClearChatResponse{
@@ -306,7 +1094,7 @@ func ClearChat(sessionID string) (*ClearChatResponse, error) {
 		DelNquads: deleteNquadsPayload, // Using DelNquads
 	}
 
-	_, err = dgraph.ExecuteMutations(dgraphConnectionName, mutation)
+	_, err = executeMutations(dgraphConnectionName, mutation)
 	if err != nil {
 		return &ClearChatResponse{
 			Success: false,
@@ -320,6 +1108,31 @@ func ClearChat(sessionID string) (*ClearChatResponse, error) {
 	}, nil
 }
 
+// ClearChats clears several sessions, returning each one's ClearChat result keyed by session ID.
+// A failure on one session is recorded in its result and doesn't stop the others.
+func ClearChats(sessionIDs []string) (map[string]ClearChatResponse, error) {
+	results := make(map[string]ClearChatResponse, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		if _, done := results[sessionID]; done {
+			continue // Listed twice
+		}
+		if err := validateSessionID(sessionID); err != nil {
+			results[sessionID] = ClearChatResponse{Success: false, Message: err.Error()}
+			continue
+		}
+
+		unlock := lockSession(sessionID)
+		resp, err := ClearChat(sessionID)
+		unlock()
+		if err != nil {
+			results[sessionID] = ClearChatResponse{Success: false, Message: err.Error()}
+			continue
+		}
+		results[sessionID] = *resp
+	}
+	return results, nil
+}
+
 // SayHello is kept from the original code
 func SayHello(name *string) string {
 	var s string
@@ -331,21 +1144,3 @@ func SayHello(name *string) string {
 
 	return fmt.Sprintf("Hello, %s!", s)
 }
-
-// ApplyDgraphSchema defines and applies the Dgraph schema.
-// This function should be called to ensure Dgraph is properly configured.
-func ApplyDgraphSchema() (string, error) {
-	schema := `
-		ChatSession.sessionID: string @index(exact) .
-		ChatMessage.role: string .
-		ChatMessage.content: string .
-		ChatMessage.timestamp: datetime @index(day) @index(hour) .
-		ChatMessage.sessionIDRef: string @index(exact) .
-	`
-	// The connection name must match the one in modus.json and used in other Dgraph calls
-	err := dgraph.AlterSchema(dgraphConnectionName, schema)
-	if err != nil {
-		return "", fmt.Errorf("failed to alter Dgraph schema: %w", err)
-	}
-	return "Dgraph schema applied successfully.", nil
-}
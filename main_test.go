@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestChatResponseCarriesTheAssistantMessageUID(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("hi there")
+
+	resp := env.chat("s1", "hello")
+	if resp.MessageUID == "" {
+		t.Fatal("MessageUID is empty after a successful save")
+	}
+	if role, content := env.store.value(resp.MessageUID, "ChatMessage.role"), env.store.value(resp.MessageUID, "ChatMessage.content"); role != "assistant" || content != "hi there" {
+		t.Errorf("MessageUID %s points at a %v message %q, want the assistant reply", resp.MessageUID, role, content)
+	}
+}
+
+func TestChatResponseHasNoUIDWhenTheSaveFails(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("hi there")
+	env.store.fail = func(call fakeStoreCall) error {
+		if len(call.Request.Mutations) > 0 {
+			return errors.New("aborted")
+		}
+		return nil
+	}
+
+	resp := env.chat("s1", "hello")
+	if resp.MessageUID != "" || resp.Content != "hi there" {
+		t.Errorf("response = %q with UID %q, want the content without a UID", resp.Content, resp.MessageUID)
+	}
+}
+
+func TestClearChatsReportsEachSessionAndContinuesPastFailures(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+	env.chat("s2", "hello")
+	env.chat("broken", "hello")
+	env.chat("kept", "hello")
+	env.store.fail = func(call fakeStoreCall) error {
+		if call.Request.Query != nil && call.Request.Query.Variables["$sessionID"] == "broken" {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+
+	results, err := ClearChats([]string{"s1", "missing", "broken", "s2", "s1", ""})
+	if err != nil {
+		t.Fatalf("ClearChats: %v", err)
+	}
+	if len(results) != 5 {
+		t.Errorf("got %d results, want one per distinct session ID: %+v", len(results), results)
+	}
+	for _, id := range []string{"s1", "s2", "missing"} {
+		if !results[id].Success {
+			t.Errorf("%s: %+v, want success", id, results[id])
+		}
+	}
+	for _, id := range []string{"broken", ""} {
+		if results[id].Success {
+			t.Errorf("%q: %+v, want a failure", id, results[id])
+		}
+	}
+
+	env.store.fail = nil
+	for id, want := range map[string]int{"s1": 0, "s2": 0, "broken": 3, "kept": 3} {
+		if n := len(env.history(id)); n != want {
+			t.Errorf("%s has %d messages after ClearChats, want %d", id, n, want)
+		}
+	}
+	if n := len(env.store.find("ChatSession", "ChatSession.sessionID", "s1")); n != 0 {
+		t.Errorf("the s1 session node survived ClearChats")
+	}
+}
+
+func TestChatReportsTheAnsweringModelAndLatency(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.respond = func(call fakeModelCall) (*openai.ChatModelOutput, error) {
+		env.clock.Advance(250 * time.Millisecond)
+		return textOutput("hi"), nil
+	}
+
+	resp := env.chat("s1", "hello")
+
+	if resp.ModelUsed != modelName {
+		t.Errorf("ModelUsed = %q, want the configured %q", resp.ModelUsed, modelName)
+	}
+	if resp.LatencyMs < 250 || resp.LatencyMs > 300 {
+		t.Errorf("LatencyMs = %d, want the ~250ms spent in the model", resp.LatencyMs)
+	}
+	assistant := env.history("s1")[2]
+	if assistant.LatencyMs != resp.LatencyMs || assistant.Model != modelName {
+		t.Errorf("stored latency/model = %d/%q, want %d/%q", assistant.LatencyMs, assistant.Model, resp.LatencyMs, modelName)
+	}
+}
+
+func TestSetDefaultTemperatureAppliesToLaterTurns(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := SetDefaultTemperature(0.1); err != nil {
+		t.Fatalf("SetDefaultTemperature(0.1): %v", err)
+	}
+	env.chat("s1", "hello")
+
+	if got := env.model.lastCall(t).Input.Temperature; got != 0.1 {
+		t.Errorf("temperature sent = %v, want 0.1", got)
+	}
+}
+
+func TestSetDefaultTemperatureRejectsOutOfRangeValues(t *testing.T) {
+	env := newTestEnv(t)
+
+	for _, temperature := range []float64{-0.1, 2.1} {
+		if err := SetDefaultTemperature(temperature); err == nil {
+			t.Errorf("SetDefaultTemperature(%v) accepted", temperature)
+		}
+	}
+	env.chat("s1", "hello")
+	if got := env.model.lastCall(t).Input.Temperature; got != builtinTemperature {
+		t.Errorf("temperature sent = %v, want the rejected values to leave %v in place", got, builtinTemperature)
+	}
+}
+
+func TestSetDefaultSystemPromptAppliesToNewSessions(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := SetDefaultSystemPrompt("You are a pirate."); err != nil {
+		t.Fatalf("SetDefaultSystemPrompt: %v", err)
+	}
+	env.chat("s1", "hello")
+
+	messages := env.model.lastCall(t).Messages
+	if messages[0].Role != "system" || messages[0].Content != "You are a pirate." {
+		t.Errorf("first message = %+v, want the configured system prompt", messages[0])
+	}
+}
+
+func TestSetDefaultSystemPromptValidates(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := SetDefaultSystemPrompt("   "); err == nil {
+		t.Error("a blank prompt was accepted")
+	}
+	if err := SetDefaultSystemPrompt("custom"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDefaultSystemPrompt(""); err != nil {
+		t.Fatalf("SetDefaultSystemPrompt(\"\"): %v", err)
+	}
+	env.chat("s1", "hello")
+
+	if got := env.model.lastCall(t).Messages[0].Content; !strings.Contains(got, builtinSystemPrompt) {
+		t.Errorf("system prompt = %q, want the empty prompt to restore the built-in default", got)
+	}
+}
+
+// rewriteSaveUids passes the Uids map of message saves through rewrite before the package sees it
+func rewriteSaveUids(env *testEnv, rewrite func(map[string]string) map[string]string) {
+	executeDgraph = func(connection string, request *dgraph.Request) (*dgraph.Response, error) {
+		resp, err := env.store.execute(connection, request)
+		if err == nil && request.Query != nil && dqlQueryName(request.Query.Query) == "findSession" {
+			resp.Uids = rewrite(resp.Uids)
+		}
+		return resp, err
+	}
+}
+
+func TestSaveResolvesTheAssignedUIDs(t *testing.T) {
+	env := newTestEnv(t)
+	messages := []DgraphChatMessage{{Role: "user", Content: "first"}, {Role: "assistant", Content: "second"}}
+
+	saved, err := saveLocked("s1", "", messages)
+	if err != nil {
+		t.Fatalf("saveNewMessagesToDgraph: %v", err)
+	}
+
+	for i, content := range []string{"first", "second"} {
+		if uids := env.store.find("ChatMessage", "ChatMessage.content", content); len(uids) != 1 || saved.MessageUIDs[i] != uids[0] {
+			t.Errorf("MessageUIDs[%d] = %s, want the node storing %q (%v)", i, saved.MessageUIDs[i], content, uids)
+		}
+	}
+	sessionUID := env.store.find("ChatSession", "ChatSession.sessionID", "s1")[0]
+	if saved.SessionUID != sessionUID {
+		t.Errorf("SessionUID = %s, want the new session node %s", saved.SessionUID, sessionUID)
+	}
+
+	again, err := saveLocked("s1", "", []DgraphChatMessage{{Role: "user", Content: "third"}})
+	if err != nil {
+		t.Fatalf("saveNewMessagesToDgraph: %v", err)
+	}
+	if again.SessionUID != sessionUID {
+		t.Errorf("SessionUID on an existing session = %s, want %s", again.SessionUID, sessionUID)
+	}
+}
+
+func TestSaveUpsertReusesTheSessionNodeOfTheSameID(t *testing.T) {
+	env := newTestEnv(t)
+
+	if _, err := saveLocked("s1", "", []DgraphChatMessage{{Role: "user", Content: "hello"}}); err != nil {
+		t.Fatalf("saveNewMessagesToDgraph: %v", err)
+	}
+
+	query, conditions := env.store.lastUpsert("findSession")
+	if !strings.Contains(query, "session as existing(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession))") {
+		t.Errorf("the save doesn't resolve the session by ID and type:\n%s", query)
+	}
+	// Unconditional, so the first save creates the session node that later saves resolve
+	if want := map[string]string{"": ""}; !reflect.DeepEqual(conditions, want) {
+		t.Errorf("conditions = %v, want %v", conditions, want)
+	}
+	if got := env.store.callsNamed("findSession")[0].Request.Mutations[0].SetJson; !strings.Contains(got, `"uid":"uid(session)"`) {
+		t.Errorf("the session object doesn't reference the upsert variable: %s", got)
+	}
+}
+
+func TestSaveResolvesBlankNodesReportedWithThePrefix(t *testing.T) {
+	env := newTestEnv(t)
+	rewriteSaveUids(env, func(uids map[string]string) map[string]string {
+		prefixed := map[string]string{}
+		for name, uid := range uids {
+			if strings.HasPrefix(name, "msg") {
+				name = "_:" + name
+			}
+			prefixed[name] = uid
+		}
+		return prefixed
+	})
+
+	resp := env.chat("s1", "hello")
+
+	if uids := env.store.find("ChatMessage", "ChatMessage.content", "ok"); len(uids) != 1 || resp.MessageUID != uids[0] {
+		t.Errorf("MessageUID = %q, want the stored reply %v", resp.MessageUID, uids)
+	}
+}
+
+func TestSaveFailsWhenAMessageUIDIsMissing(t *testing.T) {
+	env := newTestEnv(t)
+	rewriteSaveUids(env, func(map[string]string) map[string]string { return map[string]string{} })
+
+	_, err := saveLocked("s1", "", []DgraphChatMessage{{Role: "user", Content: "hello"}})
+
+	if !errors.Is(err, ErrStorageFailure) || !errors.Is(err, ErrMalformedResponse) {
+		t.Errorf("error = %v, want ErrStorageFailure and ErrMalformedResponse", err)
+	}
+}
+
+func TestDebugPromptIsIncludedOnlyWhenEnabled(t *testing.T) {
+	env := newTestEnv(t)
+
+	if resp := env.chat("s1", "hello"); resp.DebugPrompt != "" {
+		t.Errorf("DebugPrompt = %q with the flag off, want empty", resp.DebugPrompt)
+	}
+
+	DebugIncludePrompt = true
+	resp := env.chat("s1", "again")
+
+	var sent []fakeMessage
+	if err := json.Unmarshal([]byte(resp.DebugPrompt), &sent); err != nil {
+		t.Fatalf("DebugPrompt %q is not the JSON request messages: %v", resp.DebugPrompt, err)
+	}
+	if want := env.model.lastCall(t).Messages; !reflect.DeepEqual(sent, want) {
+		t.Errorf("DebugPrompt = %+v, want exactly what the model received: %+v", sent, want)
+	}
+	for _, msg := range env.history("s1") {
+		if strings.Contains(msg.Content, `"role"`) {
+			t.Errorf("the debug prompt leaked into stored message %+v", msg)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models"
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+const embeddingModelName = "embeddings" // Must match modus.json
+
+// EnableSemanticMemory turns on embedding of every saved message (ChatMessage.embedding)
+// so that RetrieveRelevant and ChatOptions.RelevantMemoryK can find semantically related history.
+var EnableSemanticMemory = false
+
+// relevantOverfetchFactor widens the vector search before the per-session filter is applied,
+// since similar_to ranks across all sessions and the filter only narrows the candidates afterwards.
+const relevantOverfetchFactor = 10
+
+// Embedder turns texts into vectors, one per input, in the same order
+type Embedder interface {
+	Embed(texts []string) ([][]float32, error)
+}
+
+// modelEmbedder embeds using the Modus embeddings model declared in modus.json
+type modelEmbedder struct{}
+
+func (modelEmbedder) Embed(texts []string) ([][]float32, error) {
+	model, err := models.GetModel[openai.EmbeddingsModel](embeddingModelName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error getting embeddings model: %w", ErrModelUnavailable, err)
+	}
+	input, err := model.CreateInput(texts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating embeddings input: %w", err)
+	}
+	output, err := model.Invoke(input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error invoking embeddings model: %w", ErrModelUnavailable, err)
+	}
+	if len(output.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings model returned %d vectors for %d inputs", len(output.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range output.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("embeddings model returned out-of-range index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+var embedder Embedder = modelEmbedder{}
+
+// SetEmbedder replaces the embedder used for semantic memory. Passing nil restores the model-backed default.
+func SetEmbedder(e Embedder) {
+	if e == nil {
+		e = modelEmbedder{}
+	}
+	embedder = e
+}
+
+// embedMessages computes embeddings for the given messages, returning vectors in the same order
+func embedMessages(messages []DgraphChatMessage) ([][]float32, error) {
+	texts := make([]string, len(messages))
+	for i, msg := range messages {
+		texts[i] = msg.Content
+	}
+	return embedder.Embed(texts)
+}
+
+// RetrieveRelevant returns up to k messages from the session that are semantically closest to query
+func RetrieveRelevant(sessionID string, query string, k int) ([]DgraphChatMessage, error) {
+	if k <= 0 {
+		return []DgraphChatMessage{}, nil
+	}
+
+	vectors, err := embedder.Embed([]string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for a single query", len(vectors))
+	}
+	vectorJson, err := json.Marshal(vectors[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query vector: %w", err)
+	}
+
+	dql := `
+        query retrieveRelevant($sessionID: string, $vector: float32vector, $topK: int) {
+            messages(func: similar_to(ChatMessage.embedding, $topK, $vector)) @filter(eq(ChatMessage.sessionIDRef, $sessionID) AND type(ChatMessage)) {
+                uid
+                role: ChatMessage.role
+                content: ChatMessage.content
+                timestamp: ChatMessage.timestamp
+            }
+        }
+    `
+	vars := map[string]string{
+		"$sessionID": sessionID,
+		"$vector":    string(vectorJson),
+		"$topK":      fmt.Sprint(k * relevantOverfetchFactor),
+	}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     dql,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: dgraph.ExecuteQuery failed for relevant messages in session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Messages []struct {
+			UID       string    `json:"uid"`
+			Role      string    `json:"role"`
+			Content   string    `json:"content"`
+			Timestamp time.Time `json:"timestamp"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal relevant messages for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+
+	// similar_to returns candidates nearest-first, so the first k that survive the filter are the top-k
+	relevant := []DgraphChatMessage{}
+	for _, m := range queryResult.Messages {
+		if len(relevant) == k {
+			break
+		}
+		relevant = append(relevant, DgraphChatMessage{
+			UID:       m.UID,
+			Role:      m.Role,
+			Content:   m.Content,
+			Timestamp: m.Timestamp,
+		})
+	}
+	return relevant, nil
+}
+
+// buildRelevantMemoryMessage formats retrieved messages into a system message for the LLM,
+// skipping any that are already part of the history being sent
+func buildRelevantMemoryMessage(relevant []DgraphChatMessage, history []DgraphChatMessage) (DgraphChatMessage, bool) {
+	inHistory := make(map[string]bool, len(history))
+	for _, msg := range history {
+		if msg.UID != "" {
+			inHistory[msg.UID] = true
+		}
+	}
+
+	var sb strings.Builder
+	for _, msg := range relevant {
+		if inHistory[msg.UID] {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("- %s: %s\n", msg.Role, msg.Content))
+	}
+	if sb.Len() == 0 {
+		return DgraphChatMessage{}, false
+	}
+
+	return DgraphChatMessage{
+		Role:      "system",
+		Content:   "Relevant earlier messages from this conversation:\n" + sb.String(),
+		Timestamp: currentTime(),
+	}, true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// keywordEmbedder gives each text one dimension per keyword it mentions, so similarity is predictable
+type keywordEmbedder struct {
+	keywords []string
+	calls    int
+}
+
+func (e *keywordEmbedder) Embed(texts []string) ([][]float32, error) {
+	e.calls++
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, len(e.keywords)+1)
+		vector[len(e.keywords)] = 0.01 // Keeps keyword-free texts from being zero vectors
+		for j, keyword := range e.keywords {
+			if strings.Contains(strings.ToLower(text), keyword) {
+				vector[j] = 1
+			}
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+func newMemoryEnv(t *testing.T) *testEnv {
+	env := newTestEnv(t)
+	EnableSemanticMemory = true
+	SetEmbedder(&keywordEmbedder{keywords: []string{"cat", "weather", "golang"}})
+	env.model.reply("Noted.")
+	env.chat("s1", "My cat is called Miso")
+	env.chat("s1", "The weather is grey today")
+	env.chat("s1", "I write golang for a living")
+	env.chat("other", "My neighbour's cat is called Tom")
+	return env
+}
+
+func TestRetrieveRelevantRanksBySimilarityWithinTheSession(t *testing.T) {
+	newMemoryEnv(t)
+
+	relevant, err := RetrieveRelevant("s1", "what's my cat's name?", 1)
+	if err != nil {
+		t.Fatalf("RetrieveRelevant: %v", err)
+	}
+	if len(relevant) != 1 || relevant[0].Content != "My cat is called Miso" {
+		t.Errorf("RetrieveRelevant = %+v, want the session's own cat message", relevant)
+	}
+
+	none, err := RetrieveRelevant("s1", "anything", 0)
+	if err != nil || len(none) != 0 {
+		t.Errorf("RetrieveRelevant with k=0 = %+v, %v; want nothing", none, err)
+	}
+}
+
+func TestChatInjectsRelevantMemoriesOutsideTheSentHistory(t *testing.T) {
+	env := newMemoryEnv(t)
+
+	env.chatWith("s1", "remind me about my cat", ChatOptions{RelevantMemoryK: 1, MaxHistoryMessages: 2})
+
+	var memory string
+	for _, m := range env.model.lastCall(t).Messages {
+		if strings.HasPrefix(m.Content, "Relevant earlier messages") {
+			memory = m.Content
+		}
+	}
+	if !strings.Contains(memory, "user: My cat is called Miso") {
+		t.Errorf("no relevant memory injected; prompt was %q", contents(env.model.lastCall(t).Messages))
+	}
+}
+
+func TestMessagesAreStoredWithoutEmbeddingsWhenMemoryIsOff(t *testing.T) {
+	env := newTestEnv(t)
+	embedder := &keywordEmbedder{keywords: []string{"cat"}}
+	SetEmbedder(embedder)
+
+	env.chat("s1", "My cat is called Miso")
+	if embedder.calls != 0 {
+		t.Errorf("embedder called %d times with EnableSemanticMemory off", embedder.calls)
+	}
+	for _, uid := range env.store.find("ChatMessage", "ChatMessage.sessionIDRef", "s1") {
+		if env.store.value(uid, "ChatMessage.embedding") != nil {
+			t.Errorf("message %s has an embedding with EnableSemanticMemory off", uid)
+		}
+	}
+}
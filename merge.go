@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// MergeSessions moves every message (and extracted entity and error event) of secondaryID into primaryID, renumbers the
+// combined history by timestamp, adds the secondary's tags to the primary and deletes the secondary
+// ChatSession node, all in one upsert. On equal timestamps the primary's messages come first, and each
+// session's messages keep their seq order. The primary's system prompt stays at the head of the history;
+// the secondary's is deleted, so the merged session is never prompted with two.
+// Sessions of different owners are never merged.
+func MergeSessions(primaryID string, secondaryID string) error {
+	if err := validateSessionID(primaryID); err != nil {
+		return err
+	}
+	if err := validateSessionID(secondaryID); err != nil {
+		return err
+	}
+	if primaryID == secondaryID {
+		return fmt.Errorf("cannot merge session %s into itself", primaryID)
+	}
+
+	// Lock both IDs in a fixed order so a concurrent merge in the other direction can't deadlock
+	first, second := primaryID, secondaryID
+	if second < first {
+		first, second = second, first
+	}
+	unlockFirst := lockSession(first)
+	defer unlockFirst()
+	unlockSecond := lockSession(second)
+	defer unlockSecond()
+
+	// 1. Both sessions must exist and belong to the same owner
+	primaryUID, err := findSessionUID(primaryID)
+	if err != nil {
+		return err
+	}
+	if _, err := findSessionUID(secondaryID); err != nil {
+		return err
+	}
+	primarySettings, err := getSessionSettings(primaryID)
+	if err != nil {
+		return err
+	}
+	secondarySettings, err := getSessionSettings(secondaryID)
+	if err != nil {
+		return err
+	}
+	if primarySettings.Owner != secondarySettings.Owner {
+		return fmt.Errorf("%w: sessions %s and %s belong to different owners", ErrAccessDenied, primaryID, secondaryID)
+	}
+
+	// 2. Combine the histories in timestamp order
+	ctx := context.Background()
+	primaryHistory, err := loadHistoryFromDgraph(ctx, primaryID)
+	if err != nil {
+		return err
+	}
+	secondaryHistory, err := loadHistoryFromDgraph(ctx, secondaryID)
+	if err != nil {
+		return err
+	}
+	primaryPrompt := leadingSystemMessages(primaryHistory)
+	secondaryPrompt := secondaryHistory[:leadingSystemMessages(secondaryHistory)]
+	secondaryHistory = secondaryHistory[len(secondaryPrompt):]
+
+	type mergedMessage struct {
+		DgraphChatMessage
+		secondary bool
+	}
+	var conversation []mergedMessage
+	for _, msg := range primaryHistory[primaryPrompt:] {
+		conversation = append(conversation, mergedMessage{msg, false})
+	}
+	for _, msg := range secondaryHistory {
+		conversation = append(conversation, mergedMessage{msg, true})
+	}
+	// The two halves of a turn share a timestamp, so ties fall back to the primary first, then seq
+	sort.SliceStable(conversation, func(i, j int) bool {
+		a, b := conversation[i], conversation[j]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		if a.secondary != b.secondary {
+			return !a.secondary
+		}
+		return a.Seq < b.Seq
+	})
+	merged := append([]DgraphChatMessage(nil), primaryHistory[:primaryPrompt]...)
+	for _, msg := range conversation {
+		merged = append(merged, msg.DgraphChatMessage)
+	}
+
+	// 3. Re-parent the secondary's messages, renumber everything and carry its tags over, then drop the secondary
+	// session and its system prompt
+	escapedPrimaryID := dgraph.EscapeRDF(primaryID)
+	var setBuilder strings.Builder
+	for _, msg := range secondaryHistory {
+		setBuilder.WriteString(fmt.Sprintf("<%s> <ChatMessage.sessionIDRef> \"%s\" .\n", msg.UID, escapedPrimaryID))
+	}
+	for i, msg := range merged {
+		setBuilder.WriteString(fmt.Sprintf("<%s> <ChatMessage.seq> \"%d\" .\n", msg.UID, i+1))
+	}
+	for _, tag := range secondarySettings.Tags {
+		// ChatSession.tags is a set, so tags both sessions carry aren't duplicated
+		setBuilder.WriteString(fmt.Sprintf("<%s> <ChatSession.tags> \"%s\" .\n", primaryUID, dgraph.EscapeRDF(tag)))
+	}
+
+	upsertQuery := `
+        query mergeSessions($secondaryID: string) {
+            secondarySession as var(func: eq(ChatSession.sessionID, $secondaryID)) @filter(type(ChatSession))
+            secondaryEntities as var(func: eq(Entity.sessionIDRef, $secondaryID)) @filter(type(Entity))
+            secondaryErrorEvents as var(func: eq(ErrorEvent.sessionIDRef, $secondaryID)) @filter(type(ErrorEvent))
+        }
+    `
+	var delBuilder strings.Builder
+	delBuilder.WriteString("uid(secondarySession) * * .\n")
+	for _, msg := range secondaryPrompt {
+		delBuilder.WriteString(fmt.Sprintf("<%s> * * .\n", msg.UID))
+	}
+	mutation := &dgraph.Mutation{
+		SetNquads: setBuilder.String(),
+		DelNquads: delBuilder.String(),
+	}
+	// Setting on an empty uid() variable would create a node, so entities and error events move only when there are some
+	entityMutation := &dgraph.Mutation{
+		SetNquads: fmt.Sprintf("uid(secondaryEntities) <Entity.sessionIDRef> \"%s\" .\n", escapedPrimaryID),
+		Condition: "@if(gt(len(secondaryEntities), 0))",
+	}
+	errorEventMutation := &dgraph.Mutation{
+		SetNquads: fmt.Sprintf("uid(secondaryErrorEvents) <ErrorEvent.sessionIDRef> \"%s\" .\n", escapedPrimaryID),
+		Condition: "@if(gt(len(secondaryErrorEvents), 0))",
+	}
+	_, err = executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     upsertQuery,
+		Variables: map[string]string{"$secondaryID": secondaryID},
+	}, mutation, entityMutation, errorEventMutation)
+	if err != nil {
+		return fmt.Errorf("%w: dgraph upsert failed merging %s into %s: %w", ErrStorageFailure, secondaryID, primaryID, err)
+	}
+	return nil
+}
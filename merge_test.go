@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// saveAt stores one user message per content for the session, two minutes apart starting at start
+func saveAt(t *testing.T, sessionID string, owner string, start time.Time, contents ...string) {
+	t.Helper()
+	messages := make([]DgraphChatMessage, len(contents))
+	for i, content := range contents {
+		messages[i] = DgraphChatMessage{Role: "user", Content: content, Timestamp: start.Add(time.Duration(i) * 2 * time.Minute)}
+	}
+	if _, err := saveLocked(sessionID, owner, messages); err != nil {
+		t.Fatalf("saving %s: %v", sessionID, err)
+	}
+}
+
+func TestMergeSessionsCombinesHistoriesInTimestampOrder(t *testing.T) {
+	env := newTestEnv(t)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	saveAt(t, "primary", "", start, "p1", "p2", "p3")
+	saveAt(t, "secondary", "", start.Add(time.Minute), "s1", "s2")
+
+	if err := MergeSessions("primary", "secondary"); err != nil {
+		t.Fatalf("MergeSessions: %v", err)
+	}
+
+	history := env.history("primary")
+	if got, want := messageContents(history), []string{"p1", "s1", "p2", "s2", "p3"}; !slices.Equal(got, want) {
+		t.Errorf("merged history = %q, want %q", got, want)
+	}
+	for i, msg := range history {
+		if msg.Seq != i+1 {
+			t.Errorf("%s has seq %d, want %d", msg.Content, msg.Seq, i+1)
+		}
+	}
+	if _, err := GetHistory("secondary"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetHistory(secondary) = %v, want ErrSessionNotFound after the merge", err)
+	}
+	if n := env.store.nodeCount("ChatSession"); n != 1 {
+		t.Errorf("%d ChatSession nodes remain, want only the primary", n)
+	}
+}
+
+func TestMergeSessionsUnionsTagsAndMovesEntities(t *testing.T) {
+	newTestEnv(t)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	saveAt(t, "primary", "", start, "p1")
+	saveAt(t, "secondary", "", start, "s1")
+	for id, tags := range map[string][]string{"primary": {"work", "shared"}, "secondary": {"shared", "urgent"}} {
+		for _, tag := range tags {
+			if err := AddSessionTag(id, tag); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	SetEntityExtractor(&fixedExtractor{triples: []Triple{{"Alice", "works at", "Acme"}}})
+	if _, err := extractAndSaveEntities("secondary", "Alice works at Acme", "ok", start); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MergeSessions("primary", "secondary"); err != nil {
+		t.Fatalf("MergeSessions: %v", err)
+	}
+
+	sessions, err := ListSessions(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := slices.Clone(sessions[0].Tags)
+	slices.Sort(tags)
+	if len(sessions) != 1 || !slices.Equal(tags, []string{"shared", "urgent", "work"}) {
+		t.Errorf("sessions after merge = %+v, want the primary with the union of both tag sets", sessions)
+	}
+	if entities, err := RetrieveEntities("primary"); err != nil || len(entities) != 1 {
+		t.Errorf("primary entities = %+v, %v, want the secondary's fact", entities, err)
+	}
+}
+
+func TestMergeSessionsRejectsDifferentOwners(t *testing.T) {
+	env := newTestEnv(t)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	saveAt(t, "alice-chat", "alice", start, "a1")
+	saveAt(t, "bob-chat", "bob", start, "b1")
+	saveAt(t, "nobody-chat", "", start, "n1")
+
+	for _, secondary := range []string{"bob-chat", "nobody-chat"} {
+		if err := MergeSessions("alice-chat", secondary); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("merging %s into alice-chat = %v, want ErrAccessDenied", secondary, err)
+		}
+	}
+	if n := len(env.history("bob-chat")); n != 1 {
+		t.Errorf("bob-chat has %d messages after the rejected merge, want 1", n)
+	}
+	if n := len(env.history("alice-chat")); n != 1 {
+		t.Errorf("alice-chat has %d messages after the rejected merges, want 1", n)
+	}
+}
+
+func TestMergeSessionsRejectsInvalidPairs(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+
+	if err := MergeSessions("s1", "s1"); err == nil {
+		t.Error("merging a session into itself was accepted")
+	}
+	if err := MergeSessions("s1", "missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("merging a missing session = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestMergeSessionsKeepsOnlyThePrimarysSystemPrompt(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("p-answer", "s-answer", "next answer")
+	env.chatWith("primary", "p-question", ChatOptions{SystemPrompt: "primary prompt"})
+	env.chatWith("secondary", "s-question", ChatOptions{SystemPrompt: "secondary prompt"})
+
+	if err := MergeSessions("primary", "secondary"); err != nil {
+		t.Fatalf("MergeSessions: %v", err)
+	}
+
+	history := env.history("primary")
+	if got, want := messageContents(history), []string{"primary prompt", "p-question", "p-answer", "s-question", "s-answer"}; !slices.Equal(got, want) {
+		t.Errorf("merged history = %q, want %q", got, want)
+	}
+	if n := len(env.store.find("ChatMessage", "ChatMessage.content", "secondary prompt")); n != 0 {
+		t.Errorf("%d nodes still hold the secondary's prompt, want it deleted", n)
+	}
+
+	env.chat("primary", "next")
+	var prompts []string
+	for _, m := range env.model.lastCall(t).Messages {
+		if m.Role == "system" {
+			prompts = append(prompts, m.Content)
+		}
+	}
+	if !slices.Equal(prompts, []string{"primary prompt"}) {
+		t.Errorf("model saw system prompts %q, want only the primary's", prompts)
+	}
+}
+
+func TestMergeSessionsKeepsTurnHalvesInOrderOnEqualTimestamps(t *testing.T) {
+	env := newTestEnv(t)
+	at := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	turn := func(sessionID string, question string, answer string) {
+		t.Helper()
+		messages := []DgraphChatMessage{
+			{Role: "user", Content: question, Timestamp: at},
+			{Role: "assistant", Content: answer, Timestamp: at},
+		}
+		if _, err := saveLocked(sessionID, "", messages); err != nil {
+			t.Fatalf("saving %s: %v", sessionID, err)
+		}
+	}
+	turn("primary", "p-question", "p-answer")
+	turn("secondary", "s-question", "s-answer")
+
+	if err := MergeSessions("primary", "secondary"); err != nil {
+		t.Fatalf("MergeSessions: %v", err)
+	}
+
+	if got, want := messageContents(env.history("primary")), []string{"p-question", "p-answer", "s-question", "s-answer"}; !slices.Equal(got, want) {
+		t.Errorf("merged history = %q, want each turn's halves together and in order %q", got, want)
+	}
+}
+
+func TestMergeSessionsUpsertGuardsTheMovedReferences(t *testing.T) {
+	env := newTestEnv(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	saveAt(t, "primary", "", start, "a")
+	saveAt(t, "secondary", "", start.Add(time.Minute), "b")
+
+	if err := MergeSessions("primary", "secondary"); err != nil {
+		t.Fatalf("MergeSessions: %v", err)
+	}
+
+	_, conditions := env.store.lastUpsert("mergeSessions")
+	want := map[string]string{
+		"":                          "", // Messages are addressed by UID, so the main mutation needs no guard
+		"uid(secondaryEntities)":    "@if(gt(len(secondaryEntities), 0))",
+		"uid(secondaryErrorEvents)": "@if(gt(len(secondaryErrorEvents), 0))",
+	}
+	if !reflect.DeepEqual(conditions, want) {
+		t.Errorf("conditions = %v, want %v", conditions, want)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// RoleHandler builds the model request message for a stored message of one role; returning nil skips the message
+type RoleHandler func(msg DgraphChatMessage) openai.RequestMessage
+
+// builtinRoleHandlers cover the roles this package stores itself
+var builtinRoleHandlers = map[string]RoleHandler{
+	"system": func(msg DgraphChatMessage) openai.RequestMessage {
+		return openai.NewSystemMessage(msg.Content)
+	},
+	"user": func(msg DgraphChatMessage) openai.RequestMessage {
+		return openai.NewUserMessage(msg.Content)
+	},
+	"assistant": func(msg DgraphChatMessage) openai.RequestMessage {
+		return openai.NewAssistantMessage(msg.Content)
+	},
+	"tool": func(msg DgraphChatMessage) openai.RequestMessage {
+		if len(msg.ToolCalls) > 0 {
+			// The model's own tool-call turn is replayed as an assistant message carrying the calls
+			assistantMessage := openai.NewAssistantMessage(msg.Content)
+			assistantMessage.ToolCalls = toOpenAIToolCalls(msg.ToolCalls)
+			return assistantMessage
+		}
+		return openai.NewToolMessage(msg.Content, msg.ToolCallID)
+	},
+	"function": func(msg DgraphChatMessage) openai.RequestMessage {
+		// Legacy function results are sent using the tool message shape that replaced them
+		return openai.NewToolMessage(msg.Content, msg.ToolCallID)
+	},
+}
+
+var (
+	roleHandlersMu sync.RWMutex
+	roleHandlers   = maps.Clone(builtinRoleHandlers)
+)
+
+// RegisterRoleHandler makes role a known message role, converted for the model by handler
+// (e.g. "developer" with openai.NewDeveloperMessage). It replaces any existing handler for the role.
+// A nil handler restores the built-in handler for a built-in role, or unregisters a custom one.
+func RegisterRoleHandler(role string, handler RoleHandler) error {
+	if strings.TrimSpace(role) == "" {
+		return fmt.Errorf("role must not be empty")
+	}
+	roleHandlersMu.Lock()
+	defer roleHandlersMu.Unlock()
+	if handler == nil {
+		handler = builtinRoleHandlers[role]
+	}
+	if handler == nil {
+		delete(roleHandlers, role)
+	} else {
+		roleHandlers[role] = handler
+	}
+	return nil
+}
+
+// isKnownRole reports whether messages with role can be stored and sent to the model
+func isKnownRole(role string) bool {
+	roleHandlersMu.RLock()
+	defer roleHandlersMu.RUnlock()
+	return roleHandlers[role] != nil
+}
+
+// toModelMessages converts stored/in-memory history into request messages for the OpenAI model SDK.
+// Messages with unrecognized roles are logged and skipped rather than silently dropped.
+func toModelMessages(history []DgraphChatMessage) []openai.RequestMessage {
+	roleHandlersMu.RLock()
+	handlers := maps.Clone(roleHandlers)
+	roleHandlersMu.RUnlock()
+
+	var modelMessages []openai.RequestMessage
+	for _, msg := range history {
+		handler, ok := handlers[msg.Role]
+		if !ok {
+			handler = skipUnknownRole
+		}
+		if modelMessage := handler(msg); modelMessage != nil {
+			modelMessages = append(modelMessages, modelMessage)
+		}
+	}
+	return modelMessages
+}
+
+// skipUnknownRole is the handler for roles nothing was registered for
+func skipUnknownRole(msg DgraphChatMessage) openai.RequestMessage {
+	logger.Info("skipping message with unrecognized role", "role", msg.Role, "uid", msg.UID)
+	return nil
+}
+
+// GetMessagesByRole returns the session's messages with the given role, in chronological order.
+// It returns an empty slice when nothing matches.
+func GetMessagesByRole(sessionID string, role string) ([]DgraphChatMessage, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+	if !isKnownRole(role) {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+
+	query := `
+        query getMessagesByRole($sessionID: string, $role: string) {
+            messages(func: eq(ChatMessage.sessionIDRef, $sessionID), orderasc: ChatMessage.timestamp) @filter(eq(ChatMessage.role, $role) AND type(ChatMessage)) {` + chatMessageFields + `
+            }
+        }
+    `
+	vars := map[string]string{
+		"$sessionID": sessionID,
+		"$role":      role,
+	}
+
+	messages, err := queryChatMessages(query, vars, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	sortChatMessages(messages)
+	return messages, nil
+}
+
+// GetMessagesInRange returns the session's messages with timestamps within [from, to], in chronological order
+func GetMessagesInRange(sessionID string, from time.Time, to time.Time) ([]DgraphChatMessage, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("invalid time range: from %s is after to %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	query := `
+        query getMessagesInRange($sessionID: string, $from: string, $to: string) {
+            messages(func: eq(ChatMessage.sessionIDRef, $sessionID), orderasc: ChatMessage.timestamp) @filter(ge(ChatMessage.timestamp, $from) AND le(ChatMessage.timestamp, $to) AND type(ChatMessage)) {` + chatMessageFields + `
+            }
+        }
+    `
+	vars := map[string]string{
+		"$sessionID": sessionID,
+		"$from":      from.UTC().Format(time.RFC3339Nano),
+		"$to":        to.UTC().Format(time.RFC3339Nano),
+	}
+
+	messages, err := queryChatMessages(query, vars, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	sortChatMessages(messages)
+	return messages, nil
+}
+
+// LoadHistoryReverse returns up to limit of the session's messages older than before, newest first, for UIs
+// that page backwards. A zero before starts from the latest message; passing the oldest returned timestamp
+// fetches the next page. Messages sharing a timestamp (like the two halves of a turn) are never split across
+// pages, so a page may hold fewer than limit messages even when more remain.
+func LoadHistoryReverse(sessionID string, before time.Time, limit int) ([]DgraphChatMessage, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+
+	// Dgraph rejects declared variables that go unused, so $before only appears with a cursor
+	params := "$sessionID: string"
+	filter := "type(ChatMessage)"
+	vars := map[string]string{"$sessionID": sessionID}
+	if !before.IsZero() {
+		params += ", $before: string"
+		filter = "lt(ChatMessage.timestamp, $before) AND " + filter
+		vars["$before"] = before.UTC().Format(time.RFC3339Nano)
+	}
+	// One message past the page shows whether the page's oldest timestamp group continues beyond it
+	query := fmt.Sprintf(`
+        query loadHistoryReverse(%s) {
+            messages(func: eq(ChatMessage.sessionIDRef, $sessionID), orderdesc: ChatMessage.timestamp, orderdesc: ChatMessage.seq, first: %d) @filter(%s) {`+chatMessageFields+`
+            }
+        }
+    `, params, limit+1, filter)
+
+	messages, err := queryChatMessages(query, vars, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	sortChatMessages(messages)
+	slices.Reverse(messages)
+	if len(messages) <= limit {
+		return messages, nil
+	}
+
+	// The page ends partway through a group of same-timestamp messages when the next one shares its timestamp;
+	// the next page's cursor would skip the rest, so leave the whole group for that page instead
+	next := messages[limit]
+	messages = messages[:limit]
+	end := len(messages)
+	for end > 0 && messages[end-1].Timestamp.Equal(next.Timestamp) {
+		end--
+	}
+	if end > 0 {
+		messages = messages[:end]
+	}
+	return messages, nil
+}
+
+// GetLastMessage returns the session's most recent message without loading the rest of the history.
+// It returns ErrSessionNotFound when the session has no messages.
+func GetLastMessage(sessionID string) (*DgraphChatMessage, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+
+	// Both messages of a turn share a timestamp, so seq decides between them
+	query := `
+        query getLastMessage($sessionID: string) {
+            messages(func: eq(ChatMessage.sessionIDRef, $sessionID), orderdesc: ChatMessage.timestamp, orderdesc: ChatMessage.seq, first: 1) @filter(type(ChatMessage)) {` + chatMessageFields + `
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	messages, err := queryChatMessages(query, vars, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	return &messages[0], nil
+}
+
+// AppendMessage stores a message in the session without invoking the model, e.g. to seed a conversation
+// or inject a system notice mid-conversation. It takes the next sequence number and returns the new message's UID.
+func AppendMessage(sessionID string, role string, content string) (string, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return "", err
+	}
+	if !isKnownRole(role) {
+		return "", fmt.Errorf("unknown role %q", role)
+	}
+	if strings.TrimSpace(content) == "" {
+		return "", ErrEmptyMessage
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	message := DgraphChatMessage{
+		Role:       role,
+		Content:    content,
+		Timestamp:  currentTime(),
+		DgraphType: []string{"ChatMessage"},
+	}
+	saved, err := saveNewMessagesToDgraph(context.Background(), sessionID, "", []DgraphChatMessage{message})
+	if err != nil {
+		return "", err
+	}
+	return saved.MessageUIDs[0], nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// mixedRoleHistory has one message of every built-in role, the tool-call turn included
+func mixedRoleHistory() []DgraphChatMessage {
+	return []DgraphChatMessage{
+		{Role: "system", Content: "be brief", DgraphType: []string{"ChatMessage"}},
+		{Role: "user", Content: "weather?", DgraphType: []string{"ChatMessage"}},
+		{Role: "tool", ToolCalls: []ToolCall{{ID: "call_1", Name: "get_weather", Arguments: "{}"}}, DgraphType: []string{"ChatMessage"}},
+		{Role: "tool", Content: `{"sky":"clear"}`, ToolCallID: "call_1", DgraphType: []string{"ChatMessage"}},
+		{Role: "function", Content: `{"legacy":true}`, ToolCallID: "call_0", DgraphType: []string{"ChatMessage"}},
+		{Role: "assistant", Content: "Clear skies.", DgraphType: []string{"ChatMessage"}},
+	}
+}
+
+func TestMixedRolesRoundTripWithoutDrops(t *testing.T) {
+	env := newTestEnv(t)
+	history := mixedRoleHistory()
+	if _, err := saveLocked("s1", "", history); err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+
+	loaded := env.history("s1")
+	if len(loaded) != len(history) {
+		t.Fatalf("loaded %d messages, want %d", len(loaded), len(history))
+	}
+	for i, msg := range loaded {
+		want := history[i]
+		if msg.Role != want.Role || msg.Content != want.Content || msg.ToolCallID != want.ToolCallID || !reflect.DeepEqual(msg.ToolCalls, want.ToolCalls) {
+			t.Errorf("message %d = %+v, want role %q content %q tool call ID %q tool calls %+v", i, msg, want.Role, want.Content, want.ToolCallID, want.ToolCalls)
+		}
+	}
+
+	messages := decodeRequestMessages(toModelMessages(loaded))
+	wantRoles := []string{"system", "user", "assistant", "tool", "tool", "assistant"}
+	var roles []string
+	for _, m := range messages {
+		roles = append(roles, m.Role)
+	}
+	if !reflect.DeepEqual(roles, wantRoles) {
+		t.Errorf("model roles = %q, want %q", roles, wantRoles)
+	}
+}
+
+func TestUnknownRolesAreLoggedAndSkipped(t *testing.T) {
+	newTestEnv(t)
+	recorder := &recordingLogger{}
+	SetLogger(recorder)
+	history := append(mixedRoleHistory(), DgraphChatMessage{Role: "narrator", Content: "meanwhile"})
+
+	messages := toModelMessages(history)
+	if len(messages) != len(history)-1 {
+		t.Errorf("converted %d messages, want all %d known ones", len(messages), len(history)-1)
+	}
+	if !recorder.has("INFO skipping message with unrecognized role role narrator") {
+		t.Errorf("the skipped role was not logged; got %q", recorder.entries)
+	}
+}
+
+func TestGetMessagesByRoleFiltersToOneRoleInOrder(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "first")
+	env.chat("s1", "second")
+	env.chat("other", "not mine")
+
+	users, err := GetMessagesByRole("s1", "user")
+	if err != nil {
+		t.Fatalf("GetMessagesByRole: %v", err)
+	}
+	if got := messageContents(users); !reflect.DeepEqual(got, []string{"first", "second"}) {
+		t.Errorf("user messages = %q, want [first second]", got)
+	}
+
+	tools, err := GetMessagesByRole("s1", "tool")
+	if err != nil || tools == nil || len(tools) != 0 {
+		t.Errorf("GetMessagesByRole(tool) = %#v, %v; want an empty slice", tools, err)
+	}
+}
+
+func TestGetMessagesByRoleRejectsUnknownRoles(t *testing.T) {
+	env := newTestEnv(t)
+
+	if _, err := GetMessagesByRole("s1", "narrator"); err == nil {
+		t.Error("GetMessagesByRole accepted an unknown role")
+	}
+	if n := env.store.callCount(); n != 0 {
+		t.Errorf("an unknown role reached the store %d times", n)
+	}
+}
+
+// messageContents returns the content of each stored message, in order
+func messageContents(messages []DgraphChatMessage) []string {
+	out := make([]string, len(messages))
+	for i, m := range messages {
+		out[i] = m.Content
+	}
+	return out
+}
+
+func TestGetMessagesInRangeReturnsTheSubrangeInclusively(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "09:00") // Clock starts 2025-01-02 03:04:05
+	env.clock.Advance(time.Hour)
+	env.chat("s1", "10:00")
+	env.clock.Advance(time.Hour)
+	env.chat("s1", "11:00")
+	history := env.history("s1")
+
+	from, to := history[3].Timestamp, history[4].Timestamp // Exactly the middle turn
+	messages, err := GetMessagesInRange("s1", from, to)
+	if err != nil {
+		t.Fatalf("GetMessagesInRange: %v", err)
+	}
+	if got := messageContents(messages); !reflect.DeepEqual(got, []string{"10:00", "ok"}) {
+		t.Errorf("messages in range = %q, want the middle turn", got)
+	}
+
+	none, err := GetMessagesInRange("s1", to.Add(time.Minute), to.Add(2*time.Minute))
+	if err != nil || len(none) != 0 {
+		t.Errorf("an empty window returned %q, %v", messageContents(none), err)
+	}
+}
+
+func TestGetMessagesInRangeRejectsInvertedRanges(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+
+	if _, err := GetMessagesInRange("s1", now, now.Add(-time.Second)); err == nil {
+		t.Error("an inverted range was accepted")
+	}
+	if n := env.store.callCount(); n != 0 {
+		t.Errorf("an inverted range reached the store %d times", n)
+	}
+}
+
+func TestGetLastMessageReturnsTheNewestMessage(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("a1", "a2", "a3")
+	for _, msg := range []string{"q1", "q2", "q3"} {
+		env.chat("s1", msg)
+		env.clock.Advance(time.Minute)
+	}
+	env.chat("other", "later session")
+
+	last, err := GetLastMessage("s1")
+	if err != nil {
+		t.Fatalf("GetLastMessage: %v", err)
+	}
+	history := env.history("s1")
+	if want := history[len(history)-1]; last.Content != "a3" || last.Role != "assistant" || last.UID != want.UID || last.Seq != want.Seq {
+		t.Errorf("GetLastMessage = %+v, want the final reply %+v", *last, want)
+	}
+}
+
+func TestGetLastMessageOfAnEmptySession(t *testing.T) {
+	newTestEnv(t)
+
+	if _, err := GetLastMessage("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetLastMessage error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestAppendMessageStoresAMessageWithoutTheModel(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+
+	uid, err := AppendMessage("s1", "assistant", "scripted follow-up")
+	if err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	if _, err := AppendMessage("s1", "system", "notice: maintenance at noon"); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+
+	if n := env.model.callCount(); n != 1 {
+		t.Errorf("model called %d times, want only the Chat turn", n)
+	}
+	history := env.history("s1")
+	if got, want := messageContents(history), []string{defaultSystemPrompt, "hello", "ok", "scripted follow-up", "notice: maintenance at noon"}; !slices.Equal(got, want) {
+		t.Fatalf("history = %q, want %q", got, want)
+	}
+	if appended := history[3]; appended.UID != uid || appended.Role != "assistant" || appended.Seq != 4 {
+		t.Errorf("appended message = %+v, want assistant at seq 4 with UID %s", appended, uid)
+	}
+	if next := env.chat("s1", "and now?"); !next.Persisted {
+		t.Fatal("the following turn was not saved")
+	}
+	if got := contents(env.model.lastCall(t).Messages); got[3] != "scripted follow-up" {
+		t.Errorf("next model input = %q, want the appended message included", got)
+	}
+}
+
+func TestAppendMessageValidatesItsInput(t *testing.T) {
+	env := newTestEnv(t)
+
+	if _, err := AppendMessage("s1", "narrator", "hello"); err == nil {
+		t.Error("AppendMessage accepted an unknown role")
+	}
+	if _, err := AppendMessage("s1", "user", "   "); !errors.Is(err, ErrEmptyMessage) {
+		t.Errorf("AppendMessage with blank content = %v, want ErrEmptyMessage", err)
+	}
+	if _, err := AppendMessage("", "user", "hello"); !errors.Is(err, ErrEmptySessionID) {
+		t.Errorf("AppendMessage without a session = %v, want ErrEmptySessionID", err)
+	}
+	if n := env.store.nodeCount("ChatMessage"); n != 0 {
+		t.Errorf("%d messages stored from invalid input", n)
+	}
+}
+
+func TestLoadHistoryReversePagesBackwardsNewestFirst(t *testing.T) {
+	newTestEnv(t)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	saveAt(t, "s1", "", start, "m1", "m2", "m3", "m4", "m5", "m6", "m7")
+
+	var pages [][]string
+	before := time.Time{}
+	for {
+		page, err := LoadHistoryReverse("s1", before, 3)
+		if err != nil {
+			t.Fatalf("LoadHistoryReverse: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, messageContents(page))
+		before = page[len(page)-1].Timestamp
+	}
+
+	want := [][]string{{"m7", "m6", "m5"}, {"m4", "m3", "m2"}, {"m1"}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %q, want %q", pages, want)
+	}
+}
+
+func TestLoadHistoryReverseKeepsTurnsTogether(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("re u1", "re u2", "re u3")
+	for _, message := range []string{"u1", "u2", "u3"} {
+		env.chat("s1", message)
+		env.clock.Advance(time.Minute)
+	}
+
+	first, err := LoadHistoryReverse("s1", time.Time{}, 3)
+	if err != nil {
+		t.Fatalf("LoadHistoryReverse: %v", err)
+	}
+	if got := messageContents(first); !slices.Equal(got, []string{"re u3", "u3"}) {
+		t.Errorf("first page = %q, want the last turn only, not half of the one before", got)
+	}
+	second, err := LoadHistoryReverse("s1", first[len(first)-1].Timestamp, 3)
+	if err != nil {
+		t.Fatalf("LoadHistoryReverse: %v", err)
+	}
+	if got := messageContents(second); !slices.Equal(got, []string{"re u2", "u2"}) {
+		t.Errorf("second page = %q, want the middle turn", got)
+	}
+}
+
+func TestLoadHistoryReverseValidatesItsArguments(t *testing.T) {
+	newTestEnv(t)
+
+	if _, err := LoadHistoryReverse("s1", time.Time{}, 0); err == nil {
+		t.Error("a zero limit was accepted")
+	}
+	if _, err := LoadHistoryReverse("", time.Time{}, 10); !errors.Is(err, ErrEmptySessionID) {
+		t.Errorf("error = %v, want ErrEmptySessionID", err)
+	}
+}
+
+func TestARegisteredRoleHandlerIsUsedForConversion(t *testing.T) {
+	env := newTestEnv(t)
+	if err := RegisterRoleHandler("developer", func(msg DgraphChatMessage) openai.RequestMessage {
+		return openai.NewDeveloperMessage("[dev] " + msg.Content)
+	}); err != nil {
+		t.Fatalf("RegisterRoleHandler: %v", err)
+	}
+	env.chat("s1", "hello")
+	if _, err := AppendMessage("s1", "developer", "prefer short answers"); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+
+	env.chat("s1", "again")
+
+	sent := env.model.lastCall(t).Messages
+	if got := sent[len(sent)-2]; got != (fakeMessage{Role: "developer", Content: "[dev] prefer short answers"}) {
+		t.Errorf("converted message = %+v, want the custom handler's developer message", got)
+	}
+}
+
+func TestANilRoleHandlerRestoresOrUnregisters(t *testing.T) {
+	newTestEnv(t)
+	history := []DgraphChatMessage{{Role: "user", Content: "hi"}, {Role: "narrator", Content: "meanwhile"}}
+	shout := func(msg DgraphChatMessage) openai.RequestMessage {
+		return openai.NewUserMessage(strings.ToUpper(msg.Content))
+	}
+	if err := RegisterRoleHandler("user", shout); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterRoleHandler("narrator", shout); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(decodeRequestMessages(toModelMessages(history))); !slices.Equal(got, []string{"HI", "MEANWHILE"}) {
+		t.Fatalf("converted = %q, want both custom handlers applied", got)
+	}
+
+	if err := RegisterRoleHandler("user", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterRoleHandler("narrator", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := contents(decodeRequestMessages(toModelMessages(history))); !slices.Equal(got, []string{"hi"}) {
+		t.Errorf("converted = %q, want the built-in user handler back and the custom role skipped", got)
+	}
+	if isKnownRole("narrator") {
+		t.Error("the unregistered role is still known")
+	}
+	if err := RegisterRoleHandler(" ", shout); err == nil {
+		t.Error("a blank role was accepted")
+	}
+}
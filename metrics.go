@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Metrics receives counters and timings from the chat pipeline.
+// Implementations adapt these calls to Prometheus, OpenTelemetry, StatsD and so on; they must be safe for concurrent use.
+type Metrics interface {
+	IncTurns()                                               // A Chat turn completed successfully
+	ObserveModelLatency(model string, d time.Duration)       // A completion was obtained from model
+	ObserveStorageLatency(operation string, d time.Duration) // A load or save ran against Dgraph, whether or not it failed
+	IncErrors(kind string)                                   // An error of the given kind (see errorKind) occurred
+}
+
+// nopMetrics discards everything; it is the default
+type nopMetrics struct{}
+
+func (nopMetrics) IncTurns()                                   {}
+func (nopMetrics) ObserveModelLatency(string, time.Duration)   {}
+func (nopMetrics) ObserveStorageLatency(string, time.Duration) {}
+func (nopMetrics) IncErrors(string)                            {}
+
+var metrics Metrics = nopMetrics{}
+
+// SetMetrics installs the metrics sink. Passing nil restores the no-op default.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	metrics = m
+}
+
+// Error kinds reported through Metrics.IncErrors
+const (
+	errorKindValidation       = "validation"
+	errorKindRateLimited      = "rate_limited"
+	errorKindAccessDenied     = "access_denied"
+	errorKindBlocked          = "blocked"
+	errorKindTimeout          = "timeout"
+	errorKindModelUnavailable = "model_unavailable"
+	errorKindNoCompletion     = "no_completion"
+	errorKindInvalidJSON      = "invalid_json"
+	errorKindStorage          = "storage"
+	errorKindOther            = "other"
+)
+
+// errorKind classifies err by the sentinel it wraps, giving metrics a small, fixed label set
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrEmptySessionID), errors.Is(err, ErrEmptyMessage), errors.Is(err, ErrMessageTooLong),
+		errors.Is(err, ErrEmptyUserID), errors.Is(err, ErrInvalidOptions):
+		return errorKindValidation
+	case errors.Is(err, ErrRateLimited):
+		return errorKindRateLimited
+	case errors.Is(err, ErrAccessDenied):
+		return errorKindAccessDenied
+	case errors.Is(err, ErrBlockedContent):
+		return errorKindBlocked
+	case errors.Is(err, ErrTurnTimeout):
+		return errorKindTimeout
+	case errors.Is(err, ErrModelUnavailable):
+		return errorKindModelUnavailable
+	case errors.Is(err, ErrNoCompletion):
+		return errorKindNoCompletion
+	case errors.Is(err, ErrInvalidJSONResponse):
+		return errorKindInvalidJSON
+	case errors.Is(err, ErrStorageFailure):
+		return errorKindStorage
+	default:
+		return errorKindOther
+	}
+}
+
+// recordStorage reports a storage operation's latency and, if it failed, a storage error
+func recordStorage(operation string, start time.Time, err error) {
+	metrics.ObserveStorageLatency(operation, currentTime().Sub(start))
+	if err != nil {
+		metrics.IncErrors(errorKindStorage)
+	}
+}
+
+// recordTurn reports the outcome of a Chat turn. Storage errors are already counted by recordStorage where they happen.
+func recordTurn(err error) {
+	if err == nil {
+		metrics.IncTurns()
+		return
+	}
+	if kind := errorKind(err); kind != errorKindStorage {
+		metrics.IncErrors(kind)
+	}
+}
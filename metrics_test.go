@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// fakeMetrics records every call it receives
+type fakeMetrics struct {
+	mu             sync.Mutex
+	turns          int
+	modelLatencies map[string][]time.Duration
+	storageLatency map[string]int
+	errorsByKind   map[string]int
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{modelLatencies: map[string][]time.Duration{}, storageLatency: map[string]int{}, errorsByKind: map[string]int{}}
+}
+
+func (m *fakeMetrics) IncTurns() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.turns++
+}
+
+func (m *fakeMetrics) ObserveModelLatency(model string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.modelLatencies[model] = append(m.modelLatencies[model], d)
+}
+
+func (m *fakeMetrics) ObserveStorageLatency(operation string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.storageLatency[operation]++
+}
+
+func (m *fakeMetrics) IncErrors(kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errorsByKind[kind]++
+}
+
+func TestMetricsFireOnASuccessfulTurn(t *testing.T) {
+	env := newTestEnv(t)
+	sink := newFakeMetrics()
+	SetMetrics(sink)
+
+	env.chat("s1", "hello")
+
+	if sink.turns != 1 {
+		t.Errorf("turns = %d, want 1", sink.turns)
+	}
+	if latencies := sink.modelLatencies[modelName]; len(latencies) != 1 || latencies[0] <= 0 {
+		t.Errorf("model latencies = %v, want one positive observation for %s", sink.modelLatencies, modelName)
+	}
+	if sink.storageLatency["load"] == 0 || sink.storageLatency["save"] != 1 {
+		t.Errorf("storage observations = %v, want the history load and one save", sink.storageLatency)
+	}
+	if len(sink.errorsByKind) != 0 {
+		t.Errorf("errors = %v on a successful turn", sink.errorsByKind)
+	}
+}
+
+func TestMetricsCountErrorsByKind(t *testing.T) {
+	env := newTestEnv(t)
+	sink := newFakeMetrics()
+	SetMetrics(sink)
+	env.model.respond = func(fakeModelCall) (*openai.ChatModelOutput, error) {
+		return nil, errors.New("503 service unavailable")
+	}
+
+	Chat("s1", "hello")
+	Chat("", "hello")
+
+	if sink.errorsByKind[errorKindModelUnavailable] != 1 || sink.errorsByKind[errorKindValidation] != 1 {
+		t.Errorf("errors = %v, want one model_unavailable and one validation", sink.errorsByKind)
+	}
+	if sink.turns != 0 {
+		t.Errorf("turns = %d, want failed turns not counted", sink.turns)
+	}
+}
+
+func TestSetMetricsNilRestoresTheNoOpDefault(t *testing.T) {
+	env := newTestEnv(t)
+	SetMetrics(newFakeMetrics())
+
+	SetMetrics(nil)
+
+	if _, ok := metrics.(nopMetrics); !ok {
+		t.Errorf("metrics = %T, want nopMetrics", metrics)
+	}
+	env.chat("s1", "still works")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models"
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// chatModelCache holds resolved chat model handles by model name, so models.GetModel runs once per name.
+// Failed lookups aren't cached, so a model that becomes available later is picked up.
+var chatModelCache = struct {
+	mu     sync.RWMutex
+	models map[string]*openai.ChatModel
+}{models: map[string]*openai.ChatModel{}}
+
+// loadChatModel resolves a chat model from the host; it is what the cache falls back to on a miss
+var loadChatModel = func(name string) (*openai.ChatModel, error) {
+	return models.GetModel[openai.ChatModel](name)
+}
+
+// getChatModel returns the cached handle for name, resolving and caching it on first use
+func getChatModel(name string) (*openai.ChatModel, error) {
+	chatModelCache.mu.RLock()
+	model, ok := chatModelCache.models[name]
+	chatModelCache.mu.RUnlock()
+	if ok {
+		return model, nil
+	}
+
+	model, err := loadChatModel(name)
+	if err != nil {
+		return nil, err
+	}
+
+	chatModelCache.mu.Lock()
+	defer chatModelCache.mu.Unlock()
+	if cached, ok := chatModelCache.models[name]; ok {
+		return cached, nil // Another caller resolved it first
+	}
+	chatModelCache.models[name] = model
+	return model, nil
+}
+
+// InvalidateModelCache drops the cached handles for the given model names, or every handle when none are given
+func InvalidateModelCache(names ...string) {
+	chatModelCache.mu.Lock()
+	defer chatModelCache.mu.Unlock()
+	if len(names) == 0 {
+		chatModelCache.models = map[string]*openai.ChatModel{}
+		return
+	}
+	for _, name := range names {
+		delete(chatModelCache.models, name)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// countModelLoads wraps loadChatModel, counting lookups per model name
+func countModelLoads(t testing.TB) map[string]int {
+	loads := map[string]int{}
+	resolve := loadChatModel
+	withValue(t, &loadChatModel, func(name string) (*openai.ChatModel, error) {
+		loads[name]++
+		return resolve(name)
+	})
+	return loads
+}
+
+func TestGetModelIsCalledOnceForRepeatedChats(t *testing.T) {
+	env := newTestEnv(t)
+	loads := countModelLoads(t)
+
+	for i := 0; i < 5; i++ {
+		env.chat("s1", "hello")
+	}
+	env.chat("s2", "another session, same model")
+
+	if loads[modelName] != 1 || len(loads) != 1 {
+		t.Errorf("model lookups = %v, want %s resolved exactly once", loads, modelName)
+	}
+	if n := env.model.callCount(); n != 6 {
+		t.Errorf("model invoked %d times, want every turn to reach it", n)
+	}
+}
+
+func TestModelCacheKeepsNamesApartAndCanBeInvalidated(t *testing.T) {
+	newTestEnv(t)
+	loads := countModelLoads(t)
+
+	a, err := getChatModel("model-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := getChatModel("model-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b || a.Info().Name != "model-a" || b.Info().Name != "model-b" {
+		t.Errorf("handles for different names = %s and %s, want distinct models", a.Info().Name, b.Info().Name)
+	}
+	if again, _ := getChatModel("model-a"); again != a {
+		t.Error("a repeated lookup returned a new handle")
+	}
+
+	InvalidateModelCache("model-a")
+	getChatModel("model-a")
+	getChatModel("model-b")
+	if loads["model-a"] != 2 || loads["model-b"] != 1 {
+		t.Errorf("lookups after invalidating model-a = %v, want only model-a resolved again", loads)
+	}
+	InvalidateModelCache()
+	getChatModel("model-b")
+	if loads["model-b"] != 2 {
+		t.Errorf("model-b lookups = %d after invalidating everything, want 2", loads["model-b"])
+	}
+}
+
+func TestModelCacheDoesNotKeepFailedLookups(t *testing.T) {
+	newTestEnv(t)
+	available := false
+	resolve := loadChatModel
+	loadChatModel = func(name string) (*openai.ChatModel, error) {
+		if !available {
+			return nil, errors.New("model not deployed yet")
+		}
+		return resolve(name)
+	}
+
+	if _, err := getChatModel("late"); err == nil {
+		t.Fatal("lookup of an unavailable model succeeded")
+	}
+	available = true
+	if _, err := getChatModel("late"); err != nil {
+		t.Errorf("lookup after the model became available = %v, want success", err)
+	}
+}
+
+func BenchmarkGetChatModelCached(b *testing.B) {
+	newTestEnv(b)
+	if _, err := getChatModel(modelName); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		getChatModel(modelName)
+	}
+}
+
+func BenchmarkGetChatModelUncached(b *testing.B) {
+	newTestEnv(b)
+	for i := 0; i < b.N; i++ {
+		InvalidateModelCache()
+		getChatModel(modelName)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+// Moderator inspects assistant output before it is returned.
+// Check reports whether the content is flagged and, if so, why.
+type Moderator interface {
+	Check(content string) (flagged bool, reason string)
+}
+
+// ModerationFallbackMessage replaces assistant content that the moderator flags
+var ModerationFallbackMessage = "I'm sorry, but I can't help with that."
+
+// moderator is nil by default, which makes moderation a no-op
+var moderator Moderator
+
+// SetModerator installs the Moderator applied to assistant output. Passing nil disables moderation.
+func SetModerator(m Moderator) {
+	moderator = m
+}
+
+// moderateContent returns the content to deliver and, when it was blocked, the moderation reason
+func moderateContent(content string) (string, string) {
+	if moderator == nil || content == "" {
+		return content, ""
+	}
+	flagged, reason := moderator.Check(content)
+	if !flagged {
+		return content, ""
+	}
+	if reason == "" {
+		reason = "flagged by moderator" // Always record something so blocked turns are identifiable
+	}
+	return ModerationFallbackMessage, reason
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// keywordModerator flags content containing its keyword
+type keywordModerator struct {
+	keyword string
+	reason  string
+}
+
+func (m keywordModerator) Check(content string) (bool, string) {
+	if strings.Contains(strings.ToLower(content), m.keyword) {
+		return true, m.reason
+	}
+	return false, ""
+}
+
+func TestModeratorBlocksFlaggedResponses(t *testing.T) {
+	env := newTestEnv(t)
+	SetModerator(keywordModerator{keyword: "forbidden", reason: "mentions forbidden topic"})
+	env.model.reply("Here is the FORBIDDEN recipe")
+
+	resp := env.chat("s1", "tell me")
+	if resp.Content != ModerationFallbackMessage {
+		t.Errorf("Content = %q, want the moderation fallback", resp.Content)
+	}
+
+	history := env.history("s1")
+	stored := history[len(history)-1]
+	if stored.Content != ModerationFallbackMessage || stored.Moderation != "mentions forbidden topic" {
+		t.Errorf("stored assistant message = %q, moderation %q; want the fallback and the reason", stored.Content, stored.Moderation)
+	}
+}
+
+func TestModeratorPassesCleanResponses(t *testing.T) {
+	env := newTestEnv(t)
+	SetModerator(keywordModerator{keyword: "forbidden"})
+	env.model.reply("All good")
+
+	if resp := env.chat("s1", "tell me"); resp.Content != "All good" {
+		t.Errorf("Content = %q, want the model's answer", resp.Content)
+	}
+	history := env.history("s1")
+	if reason := history[len(history)-1].Moderation; reason != "" {
+		t.Errorf("clean response stored with moderation reason %q", reason)
+	}
+}
+
+func TestModeratorWithoutReasonStillRecordsOne(t *testing.T) {
+	env := newTestEnv(t)
+	SetModerator(keywordModerator{keyword: "forbidden"})
+	env.model.reply("forbidden")
+
+	env.chat("s1", "tell me")
+	history := env.history("s1")
+	if reason := history[len(history)-1].Moderation; reason == "" {
+		t.Error("a blocked response was stored without a moderation reason")
+	}
+}
+
+func TestNoModeratorIsANoOp(t *testing.T) {
+	env := newTestEnv(t)
+	SetModerator(nil)
+	env.model.reply("forbidden")
+
+	if resp := env.chat("s1", "tell me"); resp.Content != "forbidden" {
+		t.Errorf("Content = %q with no moderator, want it unchanged", resp.Content)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+// ChatOptions configures a single ChatWithOptions call.
+// The zero value reproduces the behavior of Chat.
+type ChatOptions struct {
+	Tools              []ToolDefinition  `json:"tools,omitempty"`              // Functions the model may call instead of answering directly
+	RelevantMemoryK    int               `json:"relevantMemoryK,omitempty"`    // Inject up to K semantically relevant past messages (requires EnableSemanticMemory)
+	IdempotencyKey     string            `json:"idempotencyKey,omitempty"`     // Retries with the same key return the stored response instead of re-invoking the model
+	N                  int               `json:"n,omitempty"`                  // Number of completions to generate (0 or 1 means a single completion)
+	PersistIndex       int               `json:"persistIndex,omitempty"`       // Which of the N completions to persist and return as Content
+	Stop               []string          `json:"stop,omitempty"`               // Sequences at which generation halts
+	Models             []string          `json:"models,omitempty"`             // Ordered fallback chain for this call, overriding SetModelChain
+	DryRun             bool              `json:"dryRun,omitempty"`             // Build and return the prompt (ChatResponse.DryRunPrompt) without calling the model or saving
+	ResponseFormat     string            `json:"responseFormat,omitempty"`     // "json" for strict JSON output (validated before saving); "" or "text" for plain text
+	TemplateVars       map[string]string `json:"templateVars,omitempty"`       // Values for {{variable}} placeholders in SystemPromptTemplate and SystemMessages, used when the session is created
+	MaxHistoryMessages int               `json:"maxHistoryMessages,omitempty"` // Send only the most recent N non-system messages of history (0 sends all)
+	Examples           []Example         `json:"examples,omitempty"`           // Few-shot exchanges placed after the system prompt; sent to the model but never saved
+	UserID             string            `json:"userID,omitempty"`             // The user this turn is for: new sessions are owned by them, and other users' sessions are refused
+	ForceLanguage      string            `json:"forceLanguage,omitempty"`      // Instruct the model to respond in this language (e.g. "Spanish")
+	PresencePenalty    float64           `json:"presencePenalty,omitempty"`    // -2.0..2.0; positive values push the model toward new topics (0 leaves it unset)
+	FrequencyPenalty   float64           `json:"frequencyPenalty,omitempty"`   // -2.0..2.0; positive values discourage verbatim repetition (0 leaves it unset)
+	SystemMessages     []string          `json:"systemMessages,omitempty"`     // Several system messages (e.g. persona, guardrails, format) sent in order; like SystemPrompt they override the stored prompt, and a new session stores them separately
+	Source             string            `json:"source,omitempty"`             // Who sent the user message, recorded for auditing (e.g. "web", "job"); defaults to SourceAPI
+	Seed               int               `json:"seed,omitempty"`               // Sampling seed for reproducible generations, where the model supports it (0 leaves it unset)
+	IncludeHistory     *bool             `json:"includeHistory,omitempty"`     // false sends only the system prompt and the new message, without loading history (default true)
+	Persist            *bool             `json:"persist,omitempty"`            // false writes nothing to Dgraph for this turn (default true)
+	ContextDocuments   []Document        `json:"contextDocuments,omitempty"`   // Retrieved documents sent ahead of the user message (see ContextDocumentTemplate); only references are stored
+	User               string            `json:"user,omitempty"`               // End-user identifier passed to the model provider for abuse monitoring, and stored on the user message
+	Metadata           map[string]string `json:"metadata,omitempty"`           // Caller context for the turn (UI version, experiment id, ...), stored on the user message and never sent to the model
+	SystemPrompt       string            `json:"systemPrompt,omitempty"`       // Overrides the session's stored system prompt for this turn; a new session stores it as its own (see resolveSystemPrompt)
+}
+
+// includeHistory reports whether the turn loads and sends the session's history
+func (opts ChatOptions) includeHistory() bool {
+	return opts.IncludeHistory == nil || *opts.IncludeHistory
+}
+
+// persist reports whether the turn is saved
+func (opts ChatOptions) persist() bool {
+	return opts.Persist == nil || *opts.Persist
+}
+
+// Message sources recorded in ChatMessage.source
+const (
+	SourceAPI   = "api"   // Default for user messages arriving through Chat
+	SourceModel = "model" // Every assistant message the model produced
+)
+
+// messageSource returns the source to record on a turn's user message
+func messageSource(opts ChatOptions) string {
+	if opts.Source == "" {
+		return SourceAPI
+	}
+	return opts.Source
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestMultipleCompletionsReturnAllButStoreOne(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.replies = []*openai.ChatModelOutput{outputWithChoices("stop", "alpha", "beta", "gamma")}
+
+	resp := env.chatWith("s1", "options please", ChatOptions{N: 3, PersistIndex: 1})
+
+	if want := []string{"alpha", "beta", "gamma"}; !reflect.DeepEqual(resp.Candidates, want) {
+		t.Errorf("Candidates = %q, want %q", resp.Candidates, want)
+	}
+	if resp.Content != "beta" {
+		t.Errorf("Content = %q, want the persisted candidate", resp.Content)
+	}
+	if n := env.model.lastCall(t).Input.N; n != 3 {
+		t.Errorf("model input N = %d, want 3", n)
+	}
+	var assistants []string
+	for _, msg := range env.history("s1") {
+		if msg.Role == "assistant" {
+			assistants = append(assistants, msg.Content)
+		}
+	}
+	if !reflect.DeepEqual(assistants, []string{"beta"}) {
+		t.Errorf("stored assistant messages = %q, want only the chosen candidate", assistants)
+	}
+}
+
+func TestSingleCompletionHasNoCandidates(t *testing.T) {
+	env := newTestEnv(t)
+
+	if resp := env.chat("s1", "hello"); len(resp.Candidates) != 0 {
+		t.Errorf("Candidates = %q without N, want none", resp.Candidates)
+	}
+}
+
+func TestInvalidCompletionCountsAreRejected(t *testing.T) {
+	for _, opts := range []ChatOptions{
+		{N: -1},
+		{N: maxCompletions + 1},
+		{N: 2, PersistIndex: 2},
+		{PersistIndex: 1},
+	} {
+		env := newTestEnv(t)
+		if _, err := ChatWithOptions("s1", "hello", opts); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("N=%d PersistIndex=%d: error = %v, want ErrInvalidOptions", opts.N, opts.PersistIndex, err)
+		}
+		if env.model.callCount() != 0 {
+			t.Errorf("N=%d PersistIndex=%d: the model was called", opts.N, opts.PersistIndex)
+		}
+	}
+}
+
+func TestStopSequencesArePassedToTheModel(t *testing.T) {
+	env := newTestEnv(t)
+	stop := []string{"\nUser:", "###"}
+
+	env.chatWith("s1", "hello", ChatOptions{Stop: stop})
+	if got := env.model.lastCall(t).Input.Stop; !reflect.DeepEqual(got, stop) {
+		t.Errorf("model input Stop = %q, want %q", got, stop)
+	}
+}
+
+func TestInvalidStopSequencesAreRejected(t *testing.T) {
+	for name, stop := range map[string][]string{
+		"too many": {"a", "b", "c", "d", "e"},
+		"empty":    {"a", ""},
+	} {
+		env := newTestEnv(t)
+		if _, err := ChatWithOptions("s1", "hello", ChatOptions{Stop: stop}); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: error = %v, want ErrInvalidOptions", name, err)
+		}
+		if env.model.callCount() != 0 {
+			t.Errorf("%s: the model was called", name)
+		}
+	}
+}
+
+func TestDryRunReturnsThePromptWithoutCallingTheModelOrWriting(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("a1")
+	env.chat("s1", "q1")
+	calls, mutations := env.model.callCount(), env.store.mutationCount()
+
+	resp := env.chatWith("s1", "q2", ChatOptions{DryRun: true})
+
+	if n := env.model.callCount(); n != calls {
+		t.Errorf("the model was called %d times in dry-run mode", n-calls)
+	}
+	if n := env.store.mutationCount(); n != mutations {
+		t.Errorf("%d Dgraph writes in dry-run mode", n-mutations)
+	}
+	if resp.Content != "" || resp.Persisted {
+		t.Errorf("dry-run response = %+v, want only the prompt", resp)
+	}
+	var prompt []fakeMessage
+	if err := json.Unmarshal([]byte(resp.DryRunPrompt), &prompt); err != nil {
+		t.Fatalf("DryRunPrompt is not JSON request messages: %v (%s)", err, resp.DryRunPrompt)
+	}
+	want := []fakeMessage{
+		{Role: "system", Content: defaultSystemPrompt},
+		{Role: "user", Content: "q1"},
+		{Role: "assistant", Content: "a1"},
+		{Role: "user", Content: "q2"},
+	}
+	if !reflect.DeepEqual(prompt, want) {
+		t.Errorf("DryRunPrompt = %+v, want %+v", prompt, want)
+	}
+}
+
+func TestDryRunOfANewSessionCreatesNothing(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp := env.chatWith("new", "hello", ChatOptions{DryRun: true})
+
+	if resp.DryRunPrompt == "" {
+		t.Error("no prompt returned")
+	}
+	if n := env.store.totalNodes(); n != 0 || env.model.callCount() != 0 {
+		t.Errorf("dry run stored %d nodes and made %d model calls", n, env.model.callCount())
+	}
+}
+
+func TestMaxHistoryMessagesLimitsTheModelInput(t *testing.T) {
+	env := newTestEnv(t)
+	stored := []DgraphChatMessage{{Role: "system", Content: "Be brief"}}
+	for i := 1; i <= 10; i++ {
+		stored = append(stored,
+			DgraphChatMessage{Role: "user", Content: fmt.Sprintf("q%d", i)},
+			DgraphChatMessage{Role: "assistant", Content: fmt.Sprintf("a%d", i)})
+	}
+	if _, err := saveLocked("s1", "", stored); err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+
+	resp := env.chatWith("s1", "next", ChatOptions{MaxHistoryMessages: 6})
+
+	want := []string{"Be brief", "q8", "a8", "q9", "a9", "q10", "a10", "next"}
+	if got := contents(env.model.lastCall(t).Messages); !reflect.DeepEqual(got, want) {
+		t.Errorf("model input = %q, want the system prompt, the last 6 messages and the new one %q", got, want)
+	}
+	if len(resp.Warnings) != 1 || !strings.HasPrefix(resp.Warnings[0], WarningHistoryLimited) {
+		t.Errorf("Warnings = %q, want a %s warning", resp.Warnings, WarningHistoryLimited)
+	}
+	if n := len(env.history("s1")); n != 23 {
+		t.Errorf("stored history has %d messages, want all 21 kept plus the new turn", n)
+	}
+
+	env.chatWith("s1", "all of it", ChatOptions{MaxHistoryMessages: 100})
+	if n := len(env.model.lastCall(t).Messages); n != 24 {
+		t.Errorf("model input has %d messages under a larger limit, want the whole history (24)", n)
+	}
+}
+
+func TestPenaltiesArePassedToTheModel(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.chatWith("s1", "hello", ChatOptions{PresencePenalty: 0.5, FrequencyPenalty: -1.25})
+	input := env.model.lastCall(t).Input
+	if input.PresencePenalty != 0.5 || input.FrequencyPenalty != -1.25 {
+		t.Errorf("penalties sent = %v/%v, want 0.5/-1.25", input.PresencePenalty, input.FrequencyPenalty)
+	}
+
+	env.chat("s1", "defaults")
+	input = env.model.lastCall(t).Input
+	if input.PresencePenalty != 0 || input.FrequencyPenalty != 0 {
+		t.Errorf("penalties without options = %v/%v, want them left unset", input.PresencePenalty, input.FrequencyPenalty)
+	}
+	raw, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "penalty") {
+		t.Errorf("request %s carries a penalty, want both omitted by default", raw)
+	}
+}
+
+func TestOutOfRangePenaltiesAreRejected(t *testing.T) {
+	env := newTestEnv(t)
+	for _, opts := range []ChatOptions{{PresencePenalty: 2.01}, {PresencePenalty: -3}, {FrequencyPenalty: 2.5}, {FrequencyPenalty: -2.01}} {
+		if _, err := ChatWithOptions("s1", "hello", opts); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("ChatWithOptions(%+v) error = %v, want ErrInvalidOptions", opts, err)
+		}
+	}
+	if _, err := ChatWithOptions("s1", "hello", ChatOptions{PresencePenalty: 2, FrequencyPenalty: -2}); err != nil {
+		t.Errorf("penalties at the limits were rejected: %v", err)
+	}
+	if n := env.model.callCount(); n != 1 {
+		t.Errorf("model called %d times, want only the valid request", n)
+	}
+}
+
+func TestMessageSourcesArePersistedAndReturnedByGetHistory(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "from the api")
+	env.chatWith("s1", "from a job", ChatOptions{Source: "job"})
+
+	history, err := GetHistory("s1")
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	var got []string
+	for _, msg := range history {
+		if msg.Role != "system" {
+			got = append(got, msg.Role+":"+msg.Source)
+		}
+	}
+	want := []string{"user:" + SourceAPI, "assistant:" + SourceModel, "user:job", "assistant:" + SourceModel}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sources = %q, want %q", got, want)
+	}
+	uid := env.store.find("ChatMessage", "ChatMessage.content", "from a job")[0]
+	if source := env.store.value(uid, "ChatMessage.source"); source != "job" {
+		t.Errorf("ChatMessage.source = %v, want job", source)
+	}
+}
+
+func TestBlankSourceIsRejected(t *testing.T) {
+	env := newTestEnv(t)
+
+	if _, err := ChatWithOptions("s1", "hello", ChatOptions{Source: "  "}); !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("error = %v, want ErrInvalidOptions", err)
+	}
+	if n := env.store.totalNodes(); n != 0 {
+		t.Errorf("%d nodes stored for invalid options", n)
+	}
+}
+
+func TestSeedIsPassedToTheModelAndRecorded(t *testing.T) {
+	env := newTestEnv(t)
+	output := textOutput("reproducible")
+	output.SystemFingerprint = "fp_1"
+	env.model.replies = []*openai.ChatModelOutput{output}
+
+	resp := env.chatWith("s1", "hello", ChatOptions{Seed: 42})
+
+	if got := env.model.lastCall(t).Input.Seed; got != 42 {
+		t.Errorf("seed sent = %d, want 42", got)
+	}
+	history := env.history("s1")
+	if reply := history[len(history)-1]; reply.Seed != 42 {
+		t.Errorf("stored assistant seed = %d, want 42", reply.Seed)
+	}
+	if user := history[len(history)-2]; user.Seed != 0 {
+		t.Errorf("stored user seed = %d, want the seed only on the assistant message", user.Seed)
+	}
+	if len(resp.Warnings) != 0 {
+		t.Errorf("Warnings = %q, want none when the model reports a fingerprint", resp.Warnings)
+	}
+}
+
+func TestSeedWithoutAFingerprintWarnsInsteadOfFailing(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp := env.chatWith("s1", "hello", ChatOptions{Seed: 7})
+
+	if len(resp.Warnings) != 1 || !strings.HasPrefix(resp.Warnings[0], WarningSeedUnsupported) {
+		t.Errorf("Warnings = %q, want a %s warning", resp.Warnings, WarningSeedUnsupported)
+	}
+	if !resp.Persisted {
+		t.Error("the turn was not persisted")
+	}
+}
+
+func TestNoSeedLeavesTheInputUnset(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp := env.chat("s1", "hello")
+
+	if got := env.model.lastCall(t).Input.Seed; got != 0 || len(resp.Warnings) != 0 {
+		t.Errorf("seed sent = %d with warnings %q, want neither", got, resp.Warnings)
+	}
+}
+
+func TestUserReachesTheModelAndIsStoredOnTheUserMessage(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.chatWith("s1", "hello", ChatOptions{User: "end-user-7"})
+
+	if got := env.model.lastCall(t).Input.User; got != "end-user-7" {
+		t.Errorf("user sent = %q, want end-user-7", got)
+	}
+	history := env.history("s1")
+	if user := history[1]; user.Role != "user" || user.User != "end-user-7" {
+		t.Errorf("stored user message = %+v, want ChatMessage.user set", user)
+	}
+	if reply := history[2]; reply.User != "" {
+		t.Errorf("stored reply carries user %q, want it only on the user message", reply.User)
+	}
+}
+
+func TestNoUserLeavesTheInputAndMessageUnset(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.chat("s1", "hello")
+
+	if got := env.model.lastCall(t).Input.User; got != "" {
+		t.Errorf("user sent = %q, want none", got)
+	}
+	uid := env.store.find("ChatMessage", "ChatMessage.content", "hello")[0]
+	if v := env.store.value(uid, "ChatMessage.user"); v != nil {
+		t.Errorf("ChatMessage.user = %v, want the predicate left out", v)
+	}
+}
+
+func TestMetadataRoundTripsOnTheUserMessage(t *testing.T) {
+	env := newTestEnv(t)
+	metadata := map[string]string{"source": "widget", "uiVersion": "2.3.1", "experiment": "exp-42"}
+
+	env.chatWith("s1", "hi", ChatOptions{Metadata: metadata})
+
+	history, err := GetHistory("s1")
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if !reflect.DeepEqual(history[1].Metadata, metadata) {
+		t.Errorf("user message metadata = %v, want %v", history[1].Metadata, metadata)
+	}
+	if history[2].Metadata != nil {
+		t.Errorf("assistant message metadata = %v, want none", history[2].Metadata)
+	}
+	raw, _ := json.Marshal(env.model.lastCall(t).Input.Messages)
+	for _, value := range metadata {
+		if strings.Contains(string(raw), value) {
+			t.Errorf("model input %s leaks metadata value %q", raw, value)
+		}
+	}
+}
+
+func TestBlankMetadataKeysAreRejected(t *testing.T) {
+	env := newTestEnv(t)
+
+	_, err := ChatWithOptions("s1", "hi", ChatOptions{Metadata: map[string]string{" ": "x"}})
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("error = %v, want ErrInvalidOptions", err)
+	}
+	if env.model.callCount() != 0 {
+		t.Error("the model was called for an invalid request")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// checkSessionOwner verifies that userID owns the session, returning ErrAccessDenied otherwise.
+// Sessions created without an owner belong to no user, so user-scoped access to them is denied too.
+// A session that doesn't exist yet passes unless mustExist is set, in which case ErrSessionNotFound is returned.
+func checkSessionOwner(sessionID string, userID string, mustExist bool) error {
+	query := `
+        query getSessionOwner($sessionID: string) {
+            session(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession)) {
+                uid
+                owner: ChatSession.owner
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: dgraph.ExecuteQuery failed reading owner of session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Session []struct {
+			Owner string `json:"owner"`
+		} `json:"session"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal owner of session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	if len(queryResult.Session) == 0 {
+		if mustExist {
+			return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+		}
+		return nil
+	}
+	if queryResult.Session[0].Owner != userID {
+		// Don't reveal who the owner is
+		return fmt.Errorf("%w: session %s does not belong to user %s", ErrAccessDenied, sessionID, userID)
+	}
+	return nil
+}
+
+// GetHistoryForUser is GetHistory restricted to sessions owned by userID
+func GetHistoryForUser(sessionID string, userID string) ([]DgraphChatMessage, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+	if err := validateUserID(userID); err != nil {
+		return nil, err
+	}
+	if err := checkSessionOwner(sessionID, userID, true); err != nil {
+		return nil, err
+	}
+	return GetHistory(sessionID)
+}
+
+// ClearChatForUser is ClearChat restricted to sessions owned by userID
+func ClearChatForUser(sessionID string, userID string) (*ClearChatResponse, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+	if err := validateUserID(userID); err != nil {
+		return nil, err
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	if err := checkSessionOwner(sessionID, userID, true); err != nil {
+		return nil, err
+	}
+	return ClearChat(sessionID)
+}
+
+// ListSessionsForUser is ListSessions restricted to sessions owned by userID
+func ListSessionsForUser(userID string, includeArchived bool) ([]SessionInfo, error) {
+	if err := validateUserID(userID); err != nil {
+		return nil, err
+	}
+
+	filter := "type(ChatSession)"
+	if !includeArchived {
+		filter += " AND NOT eq(ChatSession.archived, true)"
+	}
+
+	query := `
+        query listSessionsForUser($owner: string) {
+            sessions(func: eq(ChatSession.owner, $owner)) @filter(` + filter + `) {` + sessionInfoFields + `
+            }
+        }
+    `
+	return querySessionInfos(query, map[string]string{"$owner": userID})
+}
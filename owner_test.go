@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSessionsAreIsolatedByOwner(t *testing.T) {
+	env := newTestEnv(t)
+	env.chatWith("alice-chat", "hello", ChatOptions{UserID: "alice"})
+	env.chatWith("bob-chat", "hello", ChatOptions{UserID: "bob"})
+
+	if history, err := GetHistoryForUser("alice-chat", "alice"); err != nil || len(history) != 3 {
+		t.Errorf("owner's GetHistoryForUser = %d messages, %v", len(history), err)
+	}
+	if _, err := GetHistoryForUser("alice-chat", "bob"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("GetHistoryForUser by another user = %v, want ErrAccessDenied", err)
+	}
+	if _, err := ChatWithOptions("alice-chat", "let me in", ChatOptions{UserID: "bob"}); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Chat by another user = %v, want ErrAccessDenied", err)
+	}
+	if _, err := ClearChatForUser("alice-chat", "bob"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("ClearChatForUser by another user = %v, want ErrAccessDenied", err)
+	}
+	if n := len(env.history("alice-chat")); n != 3 {
+		t.Errorf("alice-chat has %d messages after bob's attempts, want 3", n)
+	}
+
+	listed, err := ListSessionsForUser("bob", false)
+	if err != nil {
+		t.Fatalf("ListSessionsForUser: %v", err)
+	}
+	if got := sessionIDs(listed); !slices.Equal(got, []string{"bob-chat"}) || listed[0].Owner != "bob" {
+		t.Errorf("ListSessionsForUser(bob) = %+v, want only bob-chat", listed)
+	}
+}
+
+func TestUserScopedAccessToUnownedAndMissingSessions(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("anonymous", "hello")
+
+	if _, err := GetHistoryForUser("anonymous", "alice"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("GetHistoryForUser of an unowned session = %v, want ErrAccessDenied", err)
+	}
+	if _, err := GetHistoryForUser("missing", "alice"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetHistoryForUser of a missing session = %v, want ErrSessionNotFound", err)
+	}
+	if resp, err := ClearChatForUser("anonymous", "alice"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("ClearChatForUser of an unowned session = %+v, %v, want ErrAccessDenied", resp, err)
+	}
+}
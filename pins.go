@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// PinMessage marks a message so it is always sent to the model, however much history MaxHistoryMessages
+// leaves out, and is never removed by retention pruning or CompactHistory
+func PinMessage(sessionID string, messageUID string) error {
+	return setMessagePinned(sessionID, messageUID, true)
+}
+
+// UnpinMessage returns a pinned message to the normal history limits
+func UnpinMessage(sessionID string, messageUID string) error {
+	return setMessagePinned(sessionID, messageUID, false)
+}
+
+func setMessagePinned(sessionID string, messageUID string, pinned bool) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return err
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	if err := checkSessionMessage(sessionID, messageUID); err != nil {
+		return err
+	}
+
+	// Unpinning removes the predicate, so unpinned and never-pinned messages look the same
+	mutation := &dgraph.Mutation{}
+	if pinned {
+		mutation.SetNquads = fmt.Sprintf("<%s> <ChatMessage.pinned> \"true\" .\n", messageUID)
+	} else {
+		mutation.DelNquads = fmt.Sprintf("<%s> <ChatMessage.pinned> * .\n", messageUID)
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		return fmt.Errorf("%w: dgraph.ExecuteMutations failed updating pinned state of message %s: %w", ErrStorageFailure, messageUID, err)
+	}
+	return nil
+}
+
+// checkSessionMessage confirms that messageUID is a message of the session
+func checkSessionMessage(sessionID string, messageUID string) error {
+	if messageUID == "" {
+		return fmt.Errorf("messageUID must not be empty")
+	}
+	query := `
+        query findSessionMessage($uid: string, $sessionID: string) {
+            message(func: uid($uid)) @filter(eq(ChatMessage.sessionIDRef, $sessionID) AND type(ChatMessage)) {
+                uid
+            }
+        }
+    `
+	vars := map[string]string{
+		"$uid":       messageUID,
+		"$sessionID": sessionID,
+	}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: dgraph.ExecuteQuery failed looking up message %s: %w", ErrStorageFailure, messageUID, err)
+	}
+
+	var queryResult struct {
+		Message []struct {
+			UID string `json:"uid"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal message lookup: %w. JSON: %s", ErrStorageFailure, err, string(resp.Json))
+	}
+	if len(queryResult.Message) == 0 {
+		return fmt.Errorf("message %s not found in session %s", messageUID, sessionID)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAPinnedMessageSurvivesTheHistoryLimit(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("a1", "a2", "a3", "a4", "a5")
+	pinned := env.chat("s1", "u1")
+	for _, message := range []string{"u2", "u3", "u4"} {
+		env.chat("s1", message)
+	}
+	if err := PinMessage("s1", pinned.MessageUID); err != nil {
+		t.Fatalf("PinMessage: %v", err)
+	}
+
+	env.chatWith("s1", "u5", ChatOptions{MaxHistoryMessages: 2})
+
+	got := contents(env.model.lastCall(t).Messages)
+	want := []string{defaultSystemPrompt, "a1", "u4", "a4", "u5"}
+	if !slices.Equal(got, want) {
+		t.Errorf("model input = %q, want %q: the pinned reply kept, its unpinned neighbours dropped", got, want)
+	}
+}
+
+func TestUnpinningReturnsAMessageToTheHistoryLimit(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("a1", "a2", "a3", "a4")
+	pinned := env.chat("s1", "u1")
+	env.chat("s1", "u2")
+	env.chat("s1", "u3")
+	if err := PinMessage("s1", pinned.MessageUID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UnpinMessage("s1", pinned.MessageUID); err != nil {
+		t.Fatalf("UnpinMessage: %v", err)
+	}
+	if v := env.store.value(pinned.MessageUID, "ChatMessage.pinned"); v != nil {
+		t.Errorf("ChatMessage.pinned = %v after unpinning, want it removed", v)
+	}
+	env.chatWith("s1", "u4", ChatOptions{MaxHistoryMessages: 2})
+
+	if got := contents(env.model.lastCall(t).Messages); slices.Contains(got, "a1") {
+		t.Errorf("model input = %q, want the unpinned message dropped", got)
+	}
+}
+
+func TestPinningIsRecordedAndReturnedWithTheHistory(t *testing.T) {
+	env := newTestEnv(t)
+	resp := env.chat("s1", "hello")
+
+	if err := PinMessage("s1", resp.MessageUID); err != nil {
+		t.Fatalf("PinMessage: %v", err)
+	}
+
+	history := env.history("s1")
+	if reply := history[len(history)-1]; !reply.Pinned {
+		t.Errorf("stored reply = %+v, want it pinned", reply)
+	}
+	if history[1].Pinned {
+		t.Error("the user message was pinned too")
+	}
+}
+
+func TestPinMessageRejectsAMessageOfAnotherSession(t *testing.T) {
+	env := newTestEnv(t)
+	other := env.chat("other", "hello")
+	env.chat("s1", "hello")
+	mutations := env.store.mutationCount()
+
+	err := PinMessage("s1", other.MessageUID)
+
+	if err == nil || !strings.Contains(err.Error(), "not found in session s1") {
+		t.Errorf("error = %v, want the message reported missing from s1", err)
+	}
+	if n := env.store.mutationCount(); n != mutations {
+		t.Errorf("%d mutations for a rejected pin", n-mutations)
+	}
+}
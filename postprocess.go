@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// PostProcessor transforms assistant content (e.g. stripping reasoning markers) before it is returned and stored
+type PostProcessor func(content string) string
+
+var (
+	postProcessorsMu sync.RWMutex
+	postProcessors   []PostProcessor
+)
+
+// AddPostProcessor registers fn to run on every Chat completion, after the previously registered ones.
+// Content a processor chain leaves blank is treated like a blank model response: it is retried and
+// eventually fails with ErrNoCompletion. Passing nil is a no-op.
+func AddPostProcessor(fn PostProcessor) {
+	if fn == nil {
+		return
+	}
+	postProcessorsMu.Lock()
+	defer postProcessorsMu.Unlock()
+	postProcessors = append(postProcessors, fn)
+}
+
+// ClearPostProcessors removes every registered post-processor
+func ClearPostProcessors() {
+	postProcessorsMu.Lock()
+	defer postProcessorsMu.Unlock()
+	postProcessors = nil
+}
+
+// completionFunc is the shape shared by completeWithFallback and completeJSON
+type completionFunc func(ctx context.Context, chain []string, messages []openai.RequestMessage, configure func(*openai.ChatModelInput), choiceIndex int) (*openai.ChatModelOutput, string, error)
+
+// postProcessorsKey carries the processors withPostProcessing installed down to requestCompletion
+type postProcessorsKey struct{}
+
+// withPostProcessing wraps complete so every choice's content goes through the registered post-processors.
+// The processors run inside requestCompletion, so content they leave blank is retried by the same loop, and
+// against the same emptyCompletionRetries, as a blank model answer: a turn never makes more model calls than
+// it would without them. Only the choice at choiceIndex has to survive processing with usable content.
+func withPostProcessing(complete completionFunc) completionFunc {
+	return func(ctx context.Context, chain []string, messages []openai.RequestMessage, configure func(*openai.ChatModelInput), choiceIndex int) (*openai.ChatModelOutput, string, error) {
+		postProcessorsMu.RLock()
+		processors := append([]PostProcessor(nil), postProcessors...)
+		postProcessorsMu.RUnlock()
+
+		if len(processors) > 0 {
+			ctx = context.WithValue(ctx, postProcessorsKey{}, processors)
+		}
+		return complete(ctx, chain, messages, configure, choiceIndex)
+	}
+}
+
+// postProcess runs the processors ctx carries, if any, over the content of every choice
+func postProcess(ctx context.Context, output *openai.ChatModelOutput) {
+	processors, _ := ctx.Value(postProcessorsKey{}).([]PostProcessor)
+	for i := range output.Choices {
+		for _, process := range processors {
+			output.Choices[i].Message.Content = process(output.Choices[i].Message.Content)
+		}
+	}
+}
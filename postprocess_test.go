@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestPostProcessorsShapeTheReturnedAndStoredContent(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("hello there")
+	AddPostProcessor(strings.ToUpper)
+
+	resp := env.chat("s1", "hi")
+
+	if resp.Content != "HELLO THERE" {
+		t.Errorf("Content = %q, want the processed reply", resp.Content)
+	}
+	if stored := env.history("s1")[2].Content; stored != "HELLO THERE" {
+		t.Errorf("stored content = %q, want the processed reply", stored)
+	}
+}
+
+func TestPostProcessorsRunInRegistrationOrder(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("answer")
+	AddPostProcessor(func(s string) string { return s + " [1]" })
+	AddPostProcessor(func(s string) string { return s + " [2]" })
+	AddPostProcessor(nil)
+
+	if resp := env.chat("s1", "hi"); resp.Content != "answer [1] [2]" {
+		t.Errorf("Content = %q, want the processors applied in order", resp.Content)
+	}
+}
+
+func TestContentLeftBlankByPostProcessingIsRetried(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("<think>only reasoning</think>", "<think>hmm</think>the answer")
+	AddPostProcessor(func(s string) string {
+		if i := strings.Index(s, "</think>"); i >= 0 {
+			return s[i+len("</think>"):]
+		}
+		return s
+	})
+
+	resp := env.chat("s1", "hi")
+
+	if resp.Content != "the answer" || env.model.callCount() != 2 {
+		t.Errorf("Content = %q after %d calls, want the retried answer", resp.Content, env.model.callCount())
+	}
+
+	env.model.replies = nil
+	env.model.reply("<think>never answers</think>")
+	if _, err := Chat("s2", "hi"); !errors.Is(err, ErrNoCompletion) {
+		t.Errorf("error = %v, want ErrNoCompletion once processing keeps leaving nothing", err)
+	}
+}
+
+func TestJSONModeValidatesThePostProcessedContent(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply(`{"answer": 42}`)
+	AddPostProcessor(func(s string) string { return s + " (verified)" })
+
+	if _, err := ChatWithOptions("s1", "as json", ChatOptions{ResponseFormat: ResponseFormatJSON}); !errors.Is(err, ErrInvalidJSONResponse) {
+		t.Fatalf("error = %v, want ErrInvalidJSONResponse for JSON a processor broke", err)
+	}
+	if n := env.model.callCount(); n != 2 {
+		t.Errorf("model called %d times, want the broken JSON retried once", n)
+	}
+	if n := env.store.nodeCount("ChatMessage"); n != 0 {
+		t.Errorf("%d messages persisted for an invalid JSON turn", n)
+	}
+}
+
+func TestJSONModeAcceptsContentAPostProcessorMadeValid(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("```json\n{\"answer\": 42}\n```")
+	AddPostProcessor(func(s string) string {
+		return strings.TrimSuffix(strings.TrimPrefix(s, "```json\n"), "\n```")
+	})
+
+	resp := env.chatWith("s1", "as json", ChatOptions{ResponseFormat: ResponseFormatJSON})
+
+	if resp.Content != `{"answer": 42}` || env.model.callCount() != 1 {
+		t.Errorf("Content = %q after %d calls, want the unfenced JSON without a retry", resp.Content, env.model.callCount())
+	}
+}
+
+func TestBlankingPostProcessorSharesTheEmptyCompletionRetries(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetEmptyCompletionRetries(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetModelChain([]string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	// Blank answers and answers the processor strips to nothing, in turn
+	env.model.respond = func(fakeModelCall) (*openai.ChatModelOutput, error) {
+		if env.model.callCount()%2 == 1 {
+			return textOutput(" "), nil
+		}
+		return textOutput("<think>stripped</think>"), nil
+	}
+	AddPostProcessor(func(s string) string { return strings.TrimPrefix(s, "<think>stripped</think>") })
+
+	if _, err := Chat("s1", "hi"); !errors.Is(err, ErrNoCompletion) {
+		t.Fatalf("error = %v, want ErrNoCompletion", err)
+	}
+	if n := env.model.callCount(); n != 3 {
+		t.Errorf("model called %d times, want 3: one attempt plus the 2 configured retries, not a retry loop per layer", n)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimit is how many Chat turns a session may start per RateLimitWindow. Zero or a negative value disables limiting.
+// Limiter state lives in this process only, like the session locks.
+var RateLimit = 0
+
+// RateLimitWindow is the period over which RateLimit turns are allowed; a session's allowance refills continuously
+var RateLimitWindow = time.Minute
+
+// rateLimiterSweepSize is the number of tracked sessions above which idle buckets are swept on the next check
+const rateLimiterSweepSize = 1024
+
+// tokenBucket holds a session's remaining allowance as of its last update
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+var (
+	rateLimiterMu sync.Mutex
+	rateBuckets   = map[string]*tokenBucket{}
+)
+
+// allowTurn takes one token from the session's bucket, returning ErrRateLimited when none is left
+func allowTurn(sessionID string, now time.Time) error {
+	if RateLimit <= 0 || RateLimitWindow <= 0 {
+		return nil
+	}
+	capacity := float64(RateLimit)
+	refillPerSecond := capacity / RateLimitWindow.Seconds()
+
+	rateLimiterMu.Lock()
+	defer rateLimiterMu.Unlock()
+
+	if len(rateBuckets) > rateLimiterSweepSize {
+		sweepRateBuckets(now, capacity, refillPerSecond)
+	}
+
+	bucket, ok := rateBuckets[sessionID]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updated: now}
+		rateBuckets[sessionID] = bucket
+	}
+	bucket.tokens = min(capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*refillPerSecond)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / refillPerSecond * float64(time.Second))
+		return fmt.Errorf("%w: session %s may send %d messages per %s; retry in %s", ErrRateLimited, sessionID, RateLimit, RateLimitWindow, wait.Round(time.Second))
+	}
+	bucket.tokens--
+	return nil
+}
+
+// sweepRateBuckets drops buckets that have refilled completely, since a fresh bucket is equivalent.
+// Callers must hold rateLimiterMu.
+func sweepRateBuckets(now time.Time, capacity float64, refillPerSecond float64) int {
+	removed := 0
+	for sessionID, bucket := range rateBuckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*refillPerSecond >= capacity {
+			delete(rateBuckets, sessionID)
+			removed++
+		}
+	}
+	return removed
+}
+
+// CleanupRateLimiter forgets sessions whose allowance has fully refilled and returns how many were removed.
+// Idle sessions are also swept automatically once many are tracked; this lets hosts do it on their own schedule.
+func CleanupRateLimiter() int {
+	rateLimiterMu.Lock()
+	defer rateLimiterMu.Unlock()
+	if RateLimit <= 0 || RateLimitWindow <= 0 {
+		removed := len(rateBuckets)
+		rateBuckets = map[string]*tokenBucket{}
+		return removed
+	}
+	capacity := float64(RateLimit)
+	return sweepRateBuckets(currentTime(), capacity, capacity/RateLimitWindow.Seconds())
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimitRejectsTurnsBeyondTheLimit(t *testing.T) {
+	env := newTestEnv(t)
+	RateLimit = 3
+	RateLimitWindow = time.Minute
+
+	for i := 0; i < 3; i++ {
+		env.chat("s1", "hello")
+	}
+	if _, err := Chat("s1", "one too many"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("fourth Chat error = %v, want ErrRateLimited", err)
+	}
+	if n := env.model.callCount(); n != 3 {
+		t.Errorf("model called %d times, want the rejected turn to stop first", n)
+	}
+	env.chat("s2", "other sessions have their own allowance")
+
+	env.clock.Advance(20 * time.Second) // Refills one of the three tokens
+	env.chat("s1", "allowed again")
+	if _, err := Chat("s1", "but only once"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Chat after a partial refill = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestCleanupRateLimiterForgetsRefilledSessions(t *testing.T) {
+	env := newTestEnv(t)
+	RateLimit = 2
+	RateLimitWindow = time.Minute
+	env.chat("idle", "hello")
+	env.clock.Advance(time.Minute)
+	env.chat("busy", "hello")
+
+	if removed := CleanupRateLimiter(); removed != 1 {
+		t.Errorf("CleanupRateLimiter removed %d buckets, want only the idle one", removed)
+	}
+	rateLimiterMu.Lock()
+	_, idle := rateBuckets["idle"]
+	_, busy := rateBuckets["busy"]
+	rateLimiterMu.Unlock()
+	if idle || !busy {
+		t.Errorf("after cleanup idle tracked = %v, busy tracked = %v, want only busy", idle, busy)
+	}
+}
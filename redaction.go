@@ -0,0 +1,60 @@
+package main
+
+import (
+	"regexp"
+)
+
+// EnableRedaction replaces detected PII in message content before it is persisted to Dgraph
+var EnableRedaction = false
+
+// RedactLLMInput additionally redacts the content sent to the LLM. It only applies when EnableRedaction is on;
+// by default the model still sees the raw user message so it can act on it.
+var RedactLLMInput = false
+
+// PIIDetector replaces every match of Pattern with Token
+type PIIDetector struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Token   string
+}
+
+// PIIDetectors are applied in order. Card numbers run before phone numbers so long digit runs
+// are tagged as cards rather than partially matched as phones. Hosts may replace or extend this list.
+var PIIDetectors = []PIIDetector{
+	{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		Token:   "[EMAIL]",
+	},
+	{
+		Name:    "credit_card",
+		Pattern: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		Token:   "[CREDIT_CARD]",
+	},
+	{
+		Name:    "phone",
+		Pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?\(?\d{3}\)?[ .\-]?\d{3}[ .\-]?\d{4}\b`),
+		Token:   "[PHONE]",
+	},
+}
+
+// redactPII applies every configured detector to content
+func redactPII(content string) string {
+	for _, d := range PIIDetectors {
+		if d.Pattern == nil {
+			continue
+		}
+		content = d.Pattern.ReplaceAllString(content, d.Token)
+	}
+	return content
+}
+
+// redactMessages returns a copy of messages with PII redacted from their content
+func redactMessages(messages []DgraphChatMessage) []DgraphChatMessage {
+	redacted := make([]DgraphChatMessage, len(messages))
+	for i, msg := range messages {
+		msg.Content = redactPII(msg.Content)
+		redacted[i] = msg
+	}
+	return redacted
+}
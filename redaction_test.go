@@ -0,0 +1,76 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedactPIIReplacesEachType(t *testing.T) {
+	newTestEnv(t)
+	tests := []struct {
+		name, in, want string
+	}{
+		{"email", "write to jane.doe+chat@example.co.uk today", "write to [EMAIL] today"},
+		{"credit card with spaces", "card 4111 1111 1111 1111 expires soon", "card [CREDIT_CARD] expires soon"},
+		{"credit card with dashes", "4111-1111-1111-1111", "[CREDIT_CARD]"},
+		{"phone", "call (555) 123-4567 now", "call [PHONE] now"},
+		{"international phone", "or +44 555 123 4567", "or [PHONE]"},
+		{"nothing to redact", "the meeting is at 10:30", "the meeting is at 10:30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactPII(tt.in); got != tt.want {
+				t.Errorf("redactPII(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactPIIUsesConfiguredDetectors(t *testing.T) {
+	newTestEnv(t)
+	PIIDetectors = []PIIDetector{{Name: "ssn", Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), Token: "[SSN]"}}
+
+	if got := redactPII("ssn 123-45-6789, mail a@b.io"); got != "ssn [SSN], mail a@b.io" {
+		t.Errorf("redactPII = %q, want only the configured detector applied", got)
+	}
+}
+
+func TestRedactionAppliesToStorageButNotTheModelByDefault(t *testing.T) {
+	env := newTestEnv(t)
+	EnableRedaction = true
+	env.model.reply("I'll email jane@example.com")
+
+	env.chat("s1", "my email is jane@example.com")
+
+	if prompt := contents(env.model.lastCall(t).Messages); !strings.Contains(strings.Join(prompt, "\n"), "my email is jane@example.com") {
+		t.Errorf("the model didn't get the raw message: %q", prompt)
+	}
+	for _, msg := range env.history("s1") {
+		if strings.Contains(msg.Content, "jane@example.com") {
+			t.Errorf("stored %s message still has the email: %q", msg.Role, msg.Content)
+		}
+	}
+}
+
+func TestRedactLLMInputRedactsThePrompt(t *testing.T) {
+	env := newTestEnv(t)
+	EnableRedaction = true
+	RedactLLMInput = true
+
+	env.chat("s1", "my email is jane@example.com")
+
+	prompt := contents(env.model.lastCall(t).Messages)
+	if last := prompt[len(prompt)-1]; last != "my email is [EMAIL]" {
+		t.Errorf("the model got %q, want the redacted message", last)
+	}
+}
+
+func TestRedactionOffStoresContentVerbatim(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.chat("s1", "my email is jane@example.com")
+	if got := env.history("s1")[1].Content; got != "my email is jane@example.com" {
+		t.Errorf("stored %q with redaction off", got)
+	}
+}
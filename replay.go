@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// ReplayTurn pairs a stored assistant response with the response the current model gives for the same history
+type ReplayTurn struct {
+	UserMessageUID   string `json:"userMessageUID"`
+	UserMessage      string `json:"userMessage"`
+	OriginalResponse string `json:"originalResponse"` // Empty when the stored turn has no reply
+	ReplayedResponse string `json:"replayedResponse"` // Empty when the replay failed
+	Model            string `json:"model,omitempty"`  // The model that produced ReplayedResponse
+	Error            string `json:"error,omitempty"`  // Why the replay of this turn failed, if it did
+	Changed          bool   `json:"changed"`          // Whether the trimmed responses differ
+}
+
+// ReplayConversation re-runs every user message of a stored session against the current model chain,
+// each with the stored history up to that point, and returns the original and new responses side by side.
+// Nothing is persisted. A turn that fails to replay records its error and the replay moves on.
+func ReplayConversation(sessionID string) ([]ReplayTurn, error) {
+	history, err := loadHistoryFromDgraph(context.Background(), sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	// Chat only sends the default system prompt to sessions that don't store one, so do the same here
+	var prefix []DgraphChatMessage
+	if history[0].Role != "system" {
+		prefix = append(prefix, DgraphChatMessage{Role: "system", Content: defaultSystemPrompt})
+	}
+
+	configureInput := func(input *openai.ChatModelInput) {
+		input.Temperature = defaultTemperature
+	}
+
+	turns := []ReplayTurn{}
+	for i, msg := range history {
+		if msg.Role != "user" {
+			continue
+		}
+		turn := ReplayTurn{UserMessageUID: msg.UID, UserMessage: msg.Content}
+		for _, next := range history[i+1:] {
+			if next.Role == "user" {
+				break
+			}
+			if next.Role == "assistant" || next.Role == "tool" {
+				turn.OriginalResponse = next.Content
+				break
+			}
+		}
+
+		modelMessages := toModelMessages(append(append([]DgraphChatMessage(nil), prefix...), history[:i+1]...))
+		output, answeringModel, err := completeWithFallback(context.Background(), modelChain, modelMessages, configureInput, 0)
+		if err != nil {
+			turn.Error = err.Error()
+			logger.Error("error replaying turn", "sessionID", sessionID, "uid", msg.UID, "error", err)
+		} else {
+			turn.ReplayedResponse = strings.TrimSpace(output.Choices[0].Message.Content)
+			turn.Model = answeringModel
+			turn.Changed = turn.ReplayedResponse != strings.TrimSpace(turn.OriginalResponse)
+		}
+		turns = append(turns, turn)
+	}
+	return turns, nil
+}
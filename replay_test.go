@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// echoModel deterministically answers "re: " followed by the last message it was sent
+func echoModel(call fakeModelCall) (*openai.ChatModelOutput, error) {
+	return textOutput("re: " + call.Messages[len(call.Messages)-1].Content), nil
+}
+
+func TestReplayConversationComparesEachTurnWithoutPersisting(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("re: q1", "an older answer")
+	env.chat("s1", "q1")
+	env.chat("s1", "q2")
+	env.model.respond = echoModel
+	mutations := env.store.mutationCount()
+	env.model.calls = nil
+
+	turns, err := ReplayConversation("s1")
+	if err != nil {
+		t.Fatalf("ReplayConversation: %v", err)
+	}
+	history := env.history("s1")
+	want := []ReplayTurn{
+		{UserMessageUID: history[1].UID, UserMessage: "q1", OriginalResponse: "re: q1", ReplayedResponse: "re: q1", Model: modelName},
+		{UserMessageUID: history[3].UID, UserMessage: "q2", OriginalResponse: "an older answer", ReplayedResponse: "re: q2", Model: modelName, Changed: true},
+	}
+	if !reflect.DeepEqual(turns, want) {
+		t.Errorf("ReplayConversation = %+v, want %+v", turns, want)
+	}
+
+	// Each replay sees the stored history up to and including its user message
+	if got := contents(env.model.calls[1].Messages); !reflect.DeepEqual(got, []string{defaultSystemPrompt, "q1", "re: q1", "q2"}) {
+		t.Errorf("second replay sent %q", got)
+	}
+	if n := env.store.mutationCount(); n != mutations {
+		t.Errorf("replay wrote %d mutations", n-mutations)
+	}
+}
+
+func TestReplayConversationRecordsFailedTurns(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "q1")
+	env.model.respond = func(fakeModelCall) (*openai.ChatModelOutput, error) {
+		return nil, errors.New("503 service unavailable")
+	}
+
+	turns, err := ReplayConversation("s1")
+	if err != nil {
+		t.Fatalf("ReplayConversation: %v", err)
+	}
+	if len(turns) != 1 || turns[0].Error == "" || turns[0].ReplayedResponse != "" || turns[0].OriginalResponse != "ok" {
+		t.Errorf("turns = %+v, want the failure recorded next to the original", turns)
+	}
+}
+
+func TestReplayConversationOfUnknownSession(t *testing.T) {
+	newTestEnv(t)
+
+	if _, err := ReplayConversation("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("error = %v, want ErrSessionNotFound", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "context"
+
+// MaxMessagesPerSession caps how many messages are stored per session. After each Chat turn is saved,
+// the oldest messages beyond the cap are deleted from Dgraph. System and pinned messages are never pruned
+// and don't count toward the cap. Zero or a negative value disables pruning.
+var MaxMessagesPerSession = 0
+
+// minRetainedMessages is the latest turn (user message plus reply), which is kept even when the cap is smaller
+const minRetainedMessages = 2
+
+// pruneSessionMessages deletes the session's oldest non-system messages until at most MaxMessagesPerSession remain
+// and returns how many were deleted. Callers must hold the session lock.
+func pruneSessionMessages(ctx context.Context, sessionID string) (int, error) {
+	if MaxMessagesPerSession <= 0 {
+		return 0, nil
+	}
+
+	history, err := loadHistoryFromDgraph(ctx, sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	var prunable []string
+	for _, msg := range history {
+		if !alwaysInContext(msg) {
+			prunable = append(prunable, msg.UID)
+		}
+	}
+
+	limit := max(MaxMessagesPerSession, minRetainedMessages)
+	if len(prunable) <= limit {
+		return 0, nil
+	}
+
+	// History is chronological, so the excess is at the front
+	oldest := prunable[:len(prunable)-limit]
+	if err := deleteNodesByUID(oldest); err != nil {
+		return 0, err
+	}
+	return len(oldest), nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMaxMessagesPerSessionPrunesTheOldestTurns(t *testing.T) {
+	env := newTestEnv(t)
+	MaxMessagesPerSession = 4
+	env.model.reply("a1", "a2", "a3", "a4")
+
+	for _, msg := range []string{"q1", "q2", "q3", "q4"} {
+		env.chat("s1", msg)
+	}
+
+	history := env.history("s1")
+	want := []string{defaultSystemPrompt, "q3", "a3", "q4", "a4"}
+	if got := messageContents(history); !slices.Equal(got, want) {
+		t.Errorf("history = %q, want the system prompt and the last two turns %q", got, want)
+	}
+	if n := env.store.nodeCount("ChatMessage"); n != len(want) {
+		t.Errorf("%d ChatMessage nodes remain, want the pruned ones deleted (%d)", n, len(want))
+	}
+}
+
+func TestMaxMessagesPerSessionKeepsTheLatestTurnBelowItsSize(t *testing.T) {
+	env := newTestEnv(t)
+	MaxMessagesPerSession = 1
+	env.model.reply("a1", "a2")
+
+	env.chat("s1", "q1")
+	env.chat("s1", "q2")
+
+	if got, want := messageContents(env.history("s1")), []string{defaultSystemPrompt, "q2", "a2"}; !slices.Equal(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+}
+
+func TestMaxMessagesPerSessionDisabled(t *testing.T) {
+	env := newTestEnv(t)
+	MaxMessagesPerSession = 0
+
+	for _, msg := range []string{"q1", "q2", "q3"} {
+		env.chat("s1", msg)
+	}
+
+	if n := len(env.history("s1")); n != 7 {
+		t.Errorf("history has %d messages, want all 7 kept", n)
+	}
+}
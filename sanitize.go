@@ -0,0 +1,58 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SanitizerPrefixes are the boilerplate openings SanitizeOutput strips from a response. A pattern only counts
+// when it matches at the very start of the content, so the same words later in a sentence are left alone.
+// Hosts may replace or extend this list.
+var SanitizerPrefixes = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^as an ai(?: language model| assistant)?(?: developed by [^,.]+)?[,:]\s*`),
+	regexp.MustCompile(`(?i)^as a (?:large )?language model[,:]\s*`),
+	regexp.MustCompile(`(?i)^i(?:'m| am) an ai(?: language model| assistant)?(?:,| and)\s*`),
+}
+
+var (
+	excessBlankLines   = regexp.MustCompile(`\n{3,}`)
+	trailingWhitespace = regexp.MustCompile(`[ \t]+\n`)
+)
+
+// SanitizeOutput is a PostProcessor that strips an echoed default system prompt and any SanitizerPrefixes
+// from the start of a response, then drops trailing whitespace and collapses runs of blank lines into one.
+// Indentation and spacing within lines are kept so code blocks survive. Enable it with AddPostProcessor(SanitizeOutput).
+func SanitizeOutput(content string) string {
+	content = strings.TrimSpace(strings.ReplaceAll(content, "\r\n", "\n"))
+
+	if prompt := strings.TrimSpace(defaultSystemPrompt); prompt != "" && strings.HasPrefix(content, prompt) {
+		content = strings.TrimSpace(content[len(prompt):])
+	}
+
+	// Prefixes can be stacked ("As an AI language model, as a language model, ..."), so strip until none match
+	stripped := false
+	for matched := true; matched; {
+		matched = false
+		for _, prefix := range SanitizerPrefixes {
+			if prefix == nil {
+				continue
+			}
+			if loc := prefix.FindStringIndex(content); loc != nil && loc[0] == 0 && loc[1] > 0 {
+				content = content[loc[1]:]
+				matched, stripped = true, true
+			}
+		}
+	}
+	if stripped {
+		// The prefix took the sentence's opening, so its remainder now starts the reply
+		if r, size := utf8.DecodeRuneInString(content); unicode.IsLower(r) {
+			content = string(unicode.ToUpper(r)) + content[size:]
+		}
+	}
+
+	content = trailingWhitespace.ReplaceAllString(content+"\n", "\n")
+	content = excessBlankLines.ReplaceAllString(content, "\n\n")
+	return strings.TrimSpace(content)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSanitizeOutputStripsBoilerplatePrefixes(t *testing.T) {
+	newTestEnv(t)
+
+	tests := map[string]string{
+		"As an AI language model, the capital of France is Paris.": "The capital of France is Paris.",
+		"as an AI: paris.":                           "Paris.",
+		"I'm an AI assistant and I think so.":        "I think so.",
+		"As an AI, as a language model, here it is.": "Here it is.",
+		"Plain answer.":                              "Plain answer.",
+	}
+	for in, want := range tests {
+		if got := SanitizeOutput(in); got != want {
+			t.Errorf("SanitizeOutput(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSanitizeOutputLeavesThePrefixWordsMidSentence(t *testing.T) {
+	newTestEnv(t)
+
+	const content = "Speaking to you as an AI language model, I can only guess."
+	if got := SanitizeOutput(content); got != content {
+		t.Errorf("SanitizeOutput(%q) = %q, want it unchanged", content, got)
+	}
+}
+
+func TestSanitizeOutputNormalizesWhitespace(t *testing.T) {
+	newTestEnv(t)
+
+	in := "\r\n  First line   \r\n\r\n\r\n\r\nSecond line\t\n    indented code\n\n"
+	want := "First line\n\nSecond line\n    indented code"
+	if got := SanitizeOutput(in); got != want {
+		t.Errorf("SanitizeOutput(%q) = %q, want %q", in, got, want)
+	}
+}
+
+func TestSanitizeOutputStripsAnEchoedSystemPrompt(t *testing.T) {
+	newTestEnv(t)
+	defaultSystemPrompt = "You are a helpful assistant."
+
+	if got := SanitizeOutput("You are a helpful assistant.\n\nHello!"); got != "Hello!" {
+		t.Errorf("SanitizeOutput = %q, want the echoed prompt removed", got)
+	}
+}
+
+func TestSanitizeOutputUsesConfiguredPrefixes(t *testing.T) {
+	newTestEnv(t)
+	SanitizerPrefixes = []*regexp.Regexp{regexp.MustCompile(`^Sure!\s*`), nil}
+
+	if got := SanitizeOutput("Sure! here you go"); got != "Here you go" {
+		t.Errorf("SanitizeOutput = %q, want the custom prefix stripped", got)
+	}
+	if got := SanitizeOutput("As an AI, I agree."); got != "As an AI, I agree." {
+		t.Errorf("SanitizeOutput = %q, want the replaced default prefixes ignored", got)
+	}
+}
+
+func TestSanitizeOutputAsAPostProcessorShapesTheStoredReply(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("As an AI assistant, hello.\n\n\n\nBye.")
+	AddPostProcessor(SanitizeOutput)
+
+	resp := env.chat("s1", "hi")
+
+	const want = "Hello.\n\nBye."
+	if resp.Content != want {
+		t.Errorf("Content = %q, want %q", resp.Content, want)
+	}
+	if stored := env.history("s1")[2].Content; stored != want {
+		t.Errorf("stored content = %q, want %q", stored, want)
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// dgraphSchema is the desired schema for every predicate this package reads or writes.
+// Datetime predicates accept a single granularity tokenizer, so timestamps use hour (which also serves day-level ranges).
+const dgraphSchema = `
+		ChatSession.sessionID: string @index(exact) .
+		ChatSession.lastActivity: datetime @index(hour) .
+		ChatSession.createdAt: datetime @index(hour) .
+		ChatSession.title: string .
+		ChatSession.systemPrompt: string .
+		ChatSession.model: string .
+		ChatSession.tags: [string] @index(exact) .
+		ChatSession.archived: bool @index(bool) .
+		ChatSession.owner: string @index(exact) .
+		ChatSession.parentSession: uid @reverse .
+		ChatSession.summary: string .
+		ChatSession.summarizedAt: datetime .
+		ChatMessage.role: string @index(exact) .
+		ChatMessage.content: string @index(fulltext) .
+		ChatMessage.timestamp: datetime @index(hour) .
+		ChatMessage.sessionIDRef: string @index(exact) .
+		ChatMessage.seq: int @index(int) .
+		ChatMessage.toolCalls: string .
+		ChatMessage.toolCallID: string .
+		ChatMessage.moderationReason: string .
+		ChatMessage.model: string .
+		ChatMessage.imageRefs: string .
+		ChatMessage.documentRefs: string .
+		ChatMessage.fallback: bool .
+		ChatMessage.source: string @index(exact) .
+		ChatMessage.summary: bool .
+		ChatMessage.seed: int .
+		ChatMessage.pinned: bool .
+		ChatMessage.user: string @index(exact) .
+		ChatMessage.userTruncated: bool .
+		ChatMessage.metadata: string .
+		ChatMessage.truncated: bool .
+		ChatMessage.cached: bool .
+		ChatMessage.sentiment: float .
+		ChatMessage.latencyMs: int .
+		ChatMessage.finishReason: string .
+		ChatMessage.fullContent: string .
+		ChatMessage.streamedChunks: int .
+		ChatMessage.lang: string @index(exact) .
+		ChatMessage.promptTokens: int .
+		ChatMessage.completionTokens: int .
+		ChatMessage.idempotencyKey: string @index(exact) .
+		ChatMessage.embedding: float32vector @index(hnsw(metric:"cosine")) .
+		Entity.subject: string @index(exact, term) .
+		Entity.predicate: string @index(exact) .
+		Entity.object: string @index(exact, term) .
+		Entity.sessionIDRef: string @index(exact) .
+		Entity.createdAt: datetime @index(hour) .
+		ErrorEvent.kind: string @index(exact) .
+		ErrorEvent.message: string .
+		ErrorEvent.sessionIDRef: string @index(exact) .
+		ErrorEvent.createdAt: datetime @index(hour) .
+	`
+
+// schemaPredicate is one predicate definition, parsed from DQL schema text or from a schema query
+type schemaPredicate struct {
+	Name       string
+	Type       string
+	List       bool
+	Tokenizers []string // Tokenizer names only (e.g. "hnsw"), sorted; options like metric are not compared
+	Count      bool
+	Upsert     bool
+	Reverse    bool
+	Lang       bool
+	Definition string // The original DQL line, used when applying the predicate
+}
+
+// canonical renders the comparable parts of the predicate in a stable form
+func (p schemaPredicate) canonical() string {
+	var sb strings.Builder
+	sb.WriteString(p.Name)
+	sb.WriteString(": ")
+	if p.List {
+		sb.WriteString("[" + p.Type + "]")
+	} else {
+		sb.WriteString(p.Type)
+	}
+	if len(p.Tokenizers) > 0 {
+		sb.WriteString(" @index(" + strings.Join(p.Tokenizers, ", ") + ")")
+	}
+	if p.Count {
+		sb.WriteString(" @count")
+	}
+	if p.Upsert {
+		sb.WriteString(" @upsert")
+	}
+	if p.Reverse {
+		sb.WriteString(" @reverse")
+	}
+	if p.Lang {
+		sb.WriteString(" @lang")
+	}
+	sb.WriteString(" .")
+	return sb.String()
+}
+
+// parseSchema parses DQL predicate definitions ("name: type @directive(...) .", one per line)
+func parseSchema(schema string) (map[string]schemaPredicate, error) {
+	predicates := make(map[string]schemaPredicate)
+	for _, line := range strings.Split(schema, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parseSchemaLine(line)
+		if err != nil {
+			return nil, err
+		}
+		predicates[p.Name] = p
+	}
+	return predicates, nil
+}
+
+func parseSchemaLine(line string) (schemaPredicate, error) {
+	p := schemaPredicate{Definition: line}
+
+	body := strings.TrimSpace(strings.TrimSuffix(line, "."))
+	name, rest, ok := strings.Cut(body, ":")
+	if !ok {
+		return p, fmt.Errorf("invalid schema line (missing ':'): %s", line)
+	}
+	p.Name = strings.TrimSpace(name)
+	rest = strings.TrimSpace(rest)
+
+	typ, directives, _ := strings.Cut(rest, " ")
+	if strings.HasPrefix(typ, "[") && strings.HasSuffix(typ, "]") {
+		p.List = true
+		typ = strings.TrimSuffix(strings.TrimPrefix(typ, "["), "]")
+	}
+	if p.Name == "" || typ == "" {
+		return p, fmt.Errorf("invalid schema line: %s", line)
+	}
+	p.Type = typ
+
+	// Walk the directives, honoring nested parentheses such as @index(hnsw(metric:"cosine"))
+	for i := 0; i < len(directives); {
+		if directives[i] != '@' {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(directives) && directives[j] != '(' && directives[j] != ' ' {
+			j++
+		}
+		directive := directives[i+1 : j]
+		args := ""
+		if j < len(directives) && directives[j] == '(' {
+			depth := 0
+			k := j
+			for ; k < len(directives); k++ {
+				if directives[k] == '(' {
+					depth++
+				} else if directives[k] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if depth != 0 {
+				return p, fmt.Errorf("unbalanced parentheses in schema line: %s", line)
+			}
+			args = directives[j+1 : k]
+			j = k + 1
+		}
+
+		switch directive {
+		case "index":
+			p.Tokenizers = append(p.Tokenizers, splitTokenizers(args)...)
+		case "count":
+			p.Count = true
+		case "upsert":
+			p.Upsert = true
+		case "reverse":
+			p.Reverse = true
+		case "lang":
+			p.Lang = true
+		default:
+			return p, fmt.Errorf("unsupported directive @%s in schema line: %s", directive, line)
+		}
+		i = j
+	}
+	sort.Strings(p.Tokenizers)
+	return p, nil
+}
+
+// splitTokenizers returns the tokenizer names in an @index argument list, dropping any options
+func splitTokenizers(args string) []string {
+	var names []string
+	depth, start := 0, 0
+	flush := func(end int) {
+		part := strings.TrimSpace(args[start:end])
+		if name, _, _ := strings.Cut(part, "("); strings.TrimSpace(name) != "" {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	for i, r := range args {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				flush(i)
+				start = i + 1
+			}
+		}
+	}
+	flush(len(args))
+	return names
+}
+
+// GetCurrentSchema returns the deployed schema for this package's predicates, one DQL definition per line
+func GetCurrentSchema() (string, error) {
+	predicates, err := getCurrentSchemaPredicates()
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(predicates))
+	for name := range predicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(predicates[name].canonical())
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// getCurrentSchemaPredicates queries Dgraph for the deployed ChatSession/ChatMessage/Entity predicates
+func getCurrentSchemaPredicates() (map[string]schemaPredicate, error) {
+	query := `
+        schema {
+            type
+            index
+            tokenizer
+            list
+            count
+            upsert
+            reverse
+            lang
+        }
+    `
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{Query: query})
+	if err != nil {
+		return nil, fmt.Errorf("%w: dgraph.ExecuteQuery failed reading schema: %w", ErrStorageFailure, err)
+	}
+
+	var queryResult struct {
+		Schema []struct {
+			Predicate string   `json:"predicate"`
+			Type      string   `json:"type"`
+			Tokenizer []string `json:"tokenizer"`
+			List      bool     `json:"list"`
+			Count     bool     `json:"count"`
+			Upsert    bool     `json:"upsert"`
+			Reverse   bool     `json:"reverse"`
+			Lang      bool     `json:"lang"`
+		} `json:"schema"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal schema: %w. JSON: %s", ErrStorageFailure, err, string(resp.Json))
+	}
+
+	predicates := make(map[string]schemaPredicate)
+	for _, s := range queryResult.Schema {
+		// Only our own predicates are of interest; Dgraph's internal ones (dgraph.*) are skipped
+		if !strings.HasPrefix(s.Predicate, "ChatSession.") && !strings.HasPrefix(s.Predicate, "ChatMessage.") && !strings.HasPrefix(s.Predicate, "Entity.") &&
+			!strings.HasPrefix(s.Predicate, "ErrorEvent.") {
+			continue
+		}
+		tokenizers := append([]string(nil), s.Tokenizer...)
+		sort.Strings(tokenizers)
+		predicates[s.Predicate] = schemaPredicate{
+			Name:       s.Predicate,
+			Type:       s.Type,
+			List:       s.List,
+			Tokenizers: tokenizers,
+			Count:      s.Count,
+			Upsert:     s.Upsert,
+			Reverse:    s.Reverse,
+			Lang:       s.Lang,
+		}
+	}
+	return predicates, nil
+}
+
+// diffSchema returns the desired predicates that are missing from, or differ in, the current schema
+func diffSchema(desired map[string]schemaPredicate, current map[string]schemaPredicate) []schemaPredicate {
+	var changed []schemaPredicate
+	for name, want := range desired {
+		have, ok := current[name]
+		if !ok || have.canonical() != want.canonical() {
+			changed = append(changed, want)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Name < changed[j].Name })
+	return changed
+}
+
+// PredicateStatus reports how one expected predicate compares with the deployed schema
+type PredicateStatus struct {
+	Name     string `json:"name"`
+	Present  bool   `json:"present"`          // The predicate exists in Dgraph
+	Indexed  bool   `json:"indexed"`          // Every expected tokenizer is deployed (trivially true when none are expected)
+	Matches  bool   `json:"matches"`          // Type, index and directives all match what ApplyDgraphSchema would apply
+	Expected string `json:"expected"`         // The desired definition
+	Actual   string `json:"actual,omitempty"` // The deployed definition; empty when the predicate is missing
+}
+
+// SchemaStatus is a readiness report for the Dgraph schema
+type SchemaStatus struct {
+	Ready      bool              `json:"ready"` // Every expected predicate is present and indexed
+	Predicates []PredicateStatus `json:"predicates"`
+}
+
+// GetSchemaStatus compares the deployed schema with the one this package expects, predicate by predicate.
+// Ready is false if anything is missing or lacks its index; a type or directive mismatch alone only clears Matches.
+func GetSchemaStatus() (SchemaStatus, error) {
+	desired, err := parseSchema(dgraphSchema)
+	if err != nil {
+		return SchemaStatus{}, fmt.Errorf("invalid desired schema: %w", err)
+	}
+	current, err := getCurrentSchemaPredicates()
+	if err != nil {
+		return SchemaStatus{}, err
+	}
+
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	status := SchemaStatus{Ready: true, Predicates: make([]PredicateStatus, 0, len(names))}
+	for _, name := range names {
+		want := desired[name]
+		predicate := PredicateStatus{Name: name, Expected: want.canonical()}
+		if have, ok := current[name]; ok {
+			predicate.Present = true
+			predicate.Indexed = hasTokenizers(have.Tokenizers, want.Tokenizers)
+			predicate.Matches = have.canonical() == want.canonical()
+			predicate.Actual = have.canonical()
+		}
+		if !predicate.Present || !predicate.Indexed {
+			status.Ready = false
+		}
+		status.Predicates = append(status.Predicates, predicate)
+	}
+	return status, nil
+}
+
+// hasTokenizers reports whether every tokenizer in want is among have
+func hasTokenizers(have []string, want []string) bool {
+	deployed := make(map[string]bool, len(have))
+	for _, t := range have {
+		deployed[t] = true
+	}
+	for _, t := range want {
+		if !deployed[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyDgraphSchema defines and applies the Dgraph schema.
+// This function should be called to ensure Dgraph is properly configured.
+// Only predicates that are missing or differ from the deployed schema are altered, so repeated calls are cheap.
+func ApplyDgraphSchema() (string, error) {
+	desired, err := parseSchema(dgraphSchema)
+	if err != nil {
+		return "", fmt.Errorf("invalid desired schema: %w", err)
+	}
+	current, err := getCurrentSchemaPredicates()
+	if err != nil {
+		return "", err
+	}
+
+	changed := diffSchema(desired, current)
+	if len(changed) == 0 {
+		return "Dgraph schema is up to date: no changes.", nil
+	}
+
+	var alter strings.Builder
+	names := make([]string, len(changed))
+	for i, p := range changed {
+		alter.WriteString(p.Definition)
+		alter.WriteString("\n")
+		names[i] = p.Name
+	}
+
+	// The connection name must match the one in modus.json and used in other Dgraph calls
+	err = alterDgraphSchema(dgraphConnectionName, alter.String())
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to alter Dgraph schema: %w", ErrStorageFailure, err)
+	}
+	return fmt.Sprintf("Dgraph schema applied successfully: %d predicate(s) changed (%s).", len(changed), strings.Join(names, ", ")), nil
+}
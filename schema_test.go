@@ -0,0 +1,204 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffSchemaReportsMissingAndChangedPredicates(t *testing.T) {
+	desired, err := parseSchema(`
+		A.name: string @index(exact) .
+		A.tags: [string] @index(exact, term) .
+		A.count: int .
+		A.vector: float32vector @index(hnsw(metric:"cosine")) .
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := parseSchema(`
+		A.name: string @index(exact) .
+		A.tags: [string] @index(term, exact) .
+		A.count: string .
+		A.vector: float32vector @index(hnsw(metric:"euclidean")) .
+		A.unused: bool .
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := diffSchema(desired, current)
+	if len(changed) != 1 || changed[0].Name != "A.count" || changed[0].Definition != "A.count: int ." {
+		t.Errorf("diffSchema = %+v, want only A.count with its desired definition", changed)
+	}
+
+	delete(current, "A.name")
+	var names []string
+	for _, p := range diffSchema(desired, current) {
+		names = append(names, p.Name)
+	}
+	if strings.Join(names, ",") != "A.count,A.name" {
+		t.Errorf("diffSchema names = %q, want the missing and changed predicates in order", names)
+	}
+}
+
+func TestApplyDgraphSchemaOnlyAltersTheDiff(t *testing.T) {
+	env := newTestEnv(t)
+
+	summary, err := ApplyDgraphSchema()
+	if err != nil {
+		t.Fatalf("ApplyDgraphSchema on an empty store: %v", err)
+	}
+	desired, _ := parseSchema(dgraphSchema)
+	if len(env.store.alters) != 1 || !strings.Contains(summary, "predicate(s) changed") {
+		t.Fatalf("first apply = %q with %d alters, want one alter of everything", summary, len(env.store.alters))
+	}
+	if n := strings.Count(strings.TrimSpace(env.store.alters[0]), "\n") + 1; n != len(desired) {
+		t.Errorf("first alter defined %d predicates, want %d", n, len(desired))
+	}
+
+	summary, err = ApplyDgraphSchema()
+	if err != nil {
+		t.Fatalf("second ApplyDgraphSchema: %v", err)
+	}
+	if !strings.Contains(summary, "no changes") || len(env.store.alters) != 1 {
+		t.Errorf("second apply = %q with %d alters in total, want no changes and no new alter", summary, len(env.store.alters))
+	}
+
+	// Drift on one predicate is repaired on its own
+	drifted := env.store.deployed["ChatMessage.role"]
+	drifted.Tokenizers = nil
+	env.store.deployed["ChatMessage.role"] = drifted
+	summary, err = ApplyDgraphSchema()
+	if err != nil {
+		t.Fatalf("ApplyDgraphSchema after drift: %v", err)
+	}
+	if len(env.store.alters) != 2 || strings.TrimSpace(env.store.alters[1]) != "ChatMessage.role: string @index(exact) ." {
+		t.Errorf("drift repair altered %q, want only ChatMessage.role", env.store.alters[len(env.store.alters)-1])
+	}
+	if !strings.Contains(summary, "1 predicate(s) changed (ChatMessage.role)") {
+		t.Errorf("drift repair summary = %q", summary)
+	}
+}
+
+func TestGetCurrentSchemaListsOnlyThisPackagesPredicates(t *testing.T) {
+	env := newTestEnv(t)
+	env.store.deployDesiredSchema()
+
+	current, err := GetCurrentSchema()
+	if err != nil {
+		t.Fatalf("GetCurrentSchema: %v", err)
+	}
+	if strings.Contains(current, "dgraph.type") {
+		t.Error("GetCurrentSchema includes Dgraph's internal predicates")
+	}
+	if !strings.Contains(current, "ChatSession.tags: [string] @index(exact) .\n") {
+		t.Errorf("GetCurrentSchema is missing ChatSession.tags:\n%s", current)
+	}
+	desired, _ := parseSchema(dgraphSchema)
+	if n := strings.Count(current, "\n"); n != len(desired) {
+		t.Errorf("GetCurrentSchema has %d lines, want %d", n, len(desired))
+	}
+}
+
+func TestSchemaIndexesRoleContentAndSeq(t *testing.T) {
+	env := newTestEnv(t)
+
+	predicates, err := parseSchema(dgraphSchema)
+	if err != nil {
+		t.Fatalf("dgraphSchema is not valid DQL: %v", err)
+	}
+	for name, tokenizer := range map[string]string{
+		"ChatMessage.role":    "exact",
+		"ChatMessage.content": "fulltext",
+		"ChatMessage.seq":     "int",
+	} {
+		if !hasTokenizers(predicates[name].Tokenizers, []string{tokenizer}) {
+			t.Errorf("%s has tokenizers %q, want %s", name, predicates[name].Tokenizers, tokenizer)
+		}
+	}
+
+	if _, err := ApplyDgraphSchema(); err != nil {
+		t.Fatalf("ApplyDgraphSchema: %v", err)
+	}
+	for _, definition := range []string{
+		"ChatMessage.role: string @index(exact) .",
+		"ChatMessage.content: string @index(fulltext) .",
+		"ChatMessage.seq: int @index(int) .",
+	} {
+		if !strings.Contains(env.store.alters[0], definition+"\n") {
+			t.Errorf("the applied schema is missing %q", definition)
+		}
+	}
+}
+
+// statusOf returns the named predicate's entry in status
+func statusOf(t *testing.T, status SchemaStatus, name string) PredicateStatus {
+	t.Helper()
+	for _, p := range status.Predicates {
+		if p.Name == name {
+			return p
+		}
+	}
+	t.Fatalf("no status reported for %s", name)
+	return PredicateStatus{}
+}
+
+func TestGetSchemaStatusIsReadyWhenTheWholeSchemaIsDeployed(t *testing.T) {
+	env := newTestEnv(t)
+	env.store.deployDesiredSchema()
+
+	status, err := GetSchemaStatus()
+	if err != nil {
+		t.Fatalf("GetSchemaStatus: %v", err)
+	}
+	if !status.Ready {
+		t.Error("Ready = false for the complete schema")
+	}
+	for _, p := range status.Predicates {
+		if !p.Present || !p.Indexed || !p.Matches || p.Actual != p.Expected {
+			t.Errorf("%s = %+v, want present, indexed and matching", p.Name, p)
+		}
+	}
+}
+
+func TestGetSchemaStatusReportsMissingPredicatesAndIndexes(t *testing.T) {
+	env := newTestEnv(t)
+	env.store.deployDesiredSchema()
+	delete(env.store.deployed, "ChatSession.lastActivity")
+	unindexed := env.store.deployed["ChatMessage.sessionIDRef"]
+	unindexed.Tokenizers = nil
+	env.store.deployed["ChatMessage.sessionIDRef"] = unindexed
+
+	status, err := GetSchemaStatus()
+	if err != nil {
+		t.Fatalf("GetSchemaStatus: %v", err)
+	}
+	if status.Ready {
+		t.Error("Ready = true with a predicate missing and an index dropped")
+	}
+	if missing := statusOf(t, status, "ChatSession.lastActivity"); missing.Present || missing.Actual != "" {
+		t.Errorf("missing predicate = %+v, want not present", missing)
+	}
+	if p := statusOf(t, status, "ChatMessage.sessionIDRef"); !p.Present || p.Indexed || p.Matches {
+		t.Errorf("unindexed predicate = %+v, want present but neither indexed nor matching", p)
+	}
+	if p := statusOf(t, status, "ChatMessage.content"); !p.Present || !p.Indexed || !p.Matches {
+		t.Errorf("untouched predicate = %+v, want it still reported healthy", p)
+	}
+}
+
+func TestGetSchemaStatusStaysReadyOnADirectiveMismatch(t *testing.T) {
+	env := newTestEnv(t)
+	env.store.deployDesiredSchema()
+	extra := env.store.deployed["ChatMessage.sessionIDRef"]
+	extra.Count = true
+	env.store.deployed["ChatMessage.sessionIDRef"] = extra
+
+	status, err := GetSchemaStatus()
+	if err != nil {
+		t.Fatalf("GetSchemaStatus: %v", err)
+	}
+	if p := statusOf(t, status, "ChatMessage.sessionIDRef"); !status.Ready || !p.Indexed || p.Matches {
+		t.Errorf("Ready = %v, predicate = %+v, want ready with only Matches cleared", status.Ready, p)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// SentimentAnalyzer scores the sentiment of a user message, conventionally from -1 (negative) to 1 (positive)
+type SentimentAnalyzer interface {
+	Analyze(text string) (float64, error)
+}
+
+// sentimentAnalyzer is nil by default, which disables sentiment scoring
+var sentimentAnalyzer SentimentAnalyzer
+
+// SetSentimentAnalyzer installs the analyzer whose score is stored on each user message as ChatMessage.sentiment.
+// Passing nil disables scoring.
+func SetSentimentAnalyzer(a SentimentAnalyzer) {
+	sentimentAnalyzer = a
+}
+
+// scoreSentiment returns the message's sentiment score, or nil when no analyzer is configured or it failed
+func scoreSentiment(sessionID string, text string) *float64 {
+	if sentimentAnalyzer == nil {
+		return nil
+	}
+	score, err := sentimentAnalyzer.Analyze(text)
+	if err != nil {
+		logger.Error("error analyzing sentiment, saving without a score", "sessionID", sessionID, "error", err)
+		return nil
+	}
+	return &score
+}
+
+// SessionSentiment returns the average sentiment score of the session's scored user messages, or zero if none are scored
+func SessionSentiment(sessionID string) (float64, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return 0, err
+	}
+
+	query := `
+        query getSessionSentiment($sessionID: string) {
+            var(func: eq(ChatMessage.sessionIDRef, $sessionID)) @filter(type(ChatMessage) AND eq(ChatMessage.role, "user")) {
+                scores as ChatMessage.sentiment
+            }
+            sentiment() {
+                average: avg(val(scores))
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: dgraph.ExecuteQuery failed averaging sentiment for session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Sentiment []struct {
+			Average *float64 `json:"average"` // Absent when no message is scored
+		} `json:"sentiment"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return 0, fmt.Errorf("%w: failed to unmarshal sentiment for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	if len(queryResult.Sentiment) == 0 || queryResult.Sentiment[0].Average == nil {
+		return 0, nil
+	}
+	return *queryResult.Sentiment[0].Average, nil
+}
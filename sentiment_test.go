@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// tableAnalyzer scores messages from a fixed table and fails on anything else
+type tableAnalyzer map[string]float64
+
+func (a tableAnalyzer) Analyze(text string) (float64, error) {
+	score, ok := a[text]
+	if !ok {
+		return 0, errors.New("unscorable")
+	}
+	return score, nil
+}
+
+func TestSentimentIsStoredOnUserMessagesAndAveraged(t *testing.T) {
+	env := newTestEnv(t)
+	SetSentimentAnalyzer(tableAnalyzer{"love it": 0.9, "meh": -0.3, "ok": 5}) // "ok" is the model's reply, which must not be scored
+
+	for _, msg := range []string{"love it", "meh", "???"} {
+		env.chat("s1", msg)
+	}
+
+	history := env.history("s1")
+	if s := history[1].Sentiment; s == nil || *s != 0.9 {
+		t.Errorf("first user message sentiment = %v, want 0.9", s)
+	}
+	if s := history[5].Sentiment; s != nil {
+		t.Errorf("a message the analyzer failed on has sentiment %v, want none", *s)
+	}
+	if s := history[2].Sentiment; s != nil {
+		t.Errorf("assistant reply has sentiment %v; only user messages are scored", *s)
+	}
+
+	average, err := SessionSentiment("s1")
+	if err != nil {
+		t.Fatalf("SessionSentiment: %v", err)
+	}
+	if want := (0.9 - 0.3) / 2; math.Abs(average-want) > 1e-9 {
+		t.Errorf("SessionSentiment = %v, want the average of the scored messages %v", average, want)
+	}
+}
+
+func TestSentimentWithoutAnAnalyzer(t *testing.T) {
+	env := newTestEnv(t)
+	SetSentimentAnalyzer(nil)
+
+	env.chat("s1", "love it")
+
+	if s := env.history("s1")[1].Sentiment; s != nil {
+		t.Errorf("sentiment = %v without an analyzer, want none", *s)
+	}
+	if average, err := SessionSentiment("s1"); err != nil || average != 0 {
+		t.Errorf("SessionSentiment = %v, %v, want 0, nil", average, err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "sync"
+
+// sessionLocks serializes the read-modify-write span of Chat per session.
+// NOTE: this only protects against concurrent calls within a single process; multi-instance
+// deployments can still interleave turns for the same session across instances.
+var sessionLocks = struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}{locks: make(map[string]*sessionLock)}
+
+// sessionLock is reference counted so idle sessions don't accumulate entries in the map
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int
+	held bool // Guarded by sessionLocks.mu; set while some caller holds mu
+}
+
+// lockSession blocks until the caller holds the session's lock and returns the function that releases it
+func lockSession(sessionID string) func() {
+	sessionLocks.mu.Lock()
+	l, ok := sessionLocks.locks[sessionID]
+	if !ok {
+		l = &sessionLock{}
+		sessionLocks.locks[sessionID] = l
+	}
+	l.refs++
+	sessionLocks.mu.Unlock()
+
+	l.mu.Lock()
+	sessionLocks.mu.Lock()
+	l.held = true
+	sessionLocks.mu.Unlock()
+
+	return func() {
+		sessionLocks.mu.Lock()
+		l.held = false
+		sessionLocks.mu.Unlock()
+		l.mu.Unlock()
+
+		sessionLocks.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(sessionLocks.locks, sessionID)
+		}
+		sessionLocks.mu.Unlock()
+	}
+}
+
+// sessionLocked reports whether some caller currently holds the session's lock.
+// It can't tell which caller, so it guards against forgotten locks rather than proving ownership.
+func sessionLocked(sessionID string) bool {
+	sessionLocks.mu.Lock()
+	defer sessionLocks.mu.Unlock()
+	l, ok := sessionLocks.locks[sessionID]
+	return ok && l.held
+}
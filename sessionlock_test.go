@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestConcurrentChatsKeepSequencesConsistent(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.respond = func(fakeModelCall) (*openai.ChatModelOutput, error) {
+		time.Sleep(5 * time.Millisecond) // Widens the window in which an unlocked turn would interleave
+		return textOutput("ok"), nil
+	}
+
+	const turns = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, turns)
+	for range turns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Chat("shared", "hello"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	history := env.history("shared")
+	if len(history) != 1+2*turns {
+		t.Fatalf("stored %d messages, want %d", len(history), 1+2*turns)
+	}
+	for i, msg := range history {
+		if msg.Seq != i+1 {
+			t.Errorf("message %d has seq %d, want %d", i, msg.Seq, i+1)
+		}
+		if i > 0 && (msg.Role == "user") == (history[i-1].Role == "user") {
+			t.Errorf("messages %d and %d are both %s: turns interleaved", i-1, i, msg.Role)
+		}
+	}
+	if n := len(sessionLocks.locks); n != 0 {
+		t.Errorf("%d session locks left after every turn finished", n)
+	}
+}
+
+func TestSessionLockIsReleasedWhenChatFails(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.respond = func(fakeModelCall) (*openai.ChatModelOutput, error) { return nil, errors.New("down") }
+	if _, err := Chat("s1", "hello"); err == nil {
+		t.Fatal("Chat succeeded with a failing model")
+	}
+
+	env.model.respond = nil
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		env.chat("s1", "hello again")
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the next Chat is still waiting for the lock of a failed turn")
+	}
+}
+
+func TestSaveWithoutTheSessionLockIsRejected(t *testing.T) {
+	env := newTestEnv(t)
+
+	_, err := saveNewMessagesToDgraph(context.Background(), "s1", "", []DgraphChatMessage{{Role: "user", Content: "hello"}})
+
+	if err == nil {
+		t.Fatal("unlocked save succeeded, want an error")
+	}
+	if n := env.store.totalNodes(); n != 0 {
+		t.Errorf("unlocked save wrote %d nodes, want none", n)
+	}
+}
+
+func TestSessionLockedTracksTheHolder(t *testing.T) {
+	newTestEnv(t)
+	if sessionLocked("s1") {
+		t.Fatal("sessionLocked before locking = true")
+	}
+
+	unlock := lockSession("s1")
+	if !sessionLocked("s1") || sessionLocked("s2") {
+		t.Errorf("sessionLocked(s1), sessionLocked(s2) = %v, %v, want true, false", sessionLocked("s1"), sessionLocked("s2"))
+	}
+	unlock()
+
+	if sessionLocked("s1") {
+		t.Error("sessionLocked after unlocking = true")
+	}
+}
+
+func TestConcurrentLockedSavesAssignDistinctSeqs(t *testing.T) {
+	env := newTestEnv(t)
+
+	const saves = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, saves)
+	for i := range saves {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := saveLocked("s1", "", []DgraphChatMessage{{Role: "user", Content: string(rune('a' + i))}}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("saveLocked: %v", err)
+	}
+
+	seen := map[int]bool{}
+	for _, msg := range env.history("s1") {
+		if seen[msg.Seq] {
+			t.Fatalf("seq %d assigned twice", msg.Seq)
+		}
+		seen[msg.Seq] = true
+	}
+	if len(seen) != saves {
+		t.Errorf("stored %d distinct seqs, want %d", len(seen), saves)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// SetSessionModel makes model the session's default, used by every turn that doesn't pass ChatOptions.Models.
+// The package model chain still serves as its fallback. The model must be allowed (see AllowedModels);
+// an empty model removes the override.
+func SetSessionModel(sessionID string, model string) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return err
+	}
+	model = strings.TrimSpace(model)
+	if model != "" && !isAllowedModel(model) {
+		return fmt.Errorf("%w: model %q is not allowed", ErrInvalidOptions, model)
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	sessionUID, err := findSessionUID(sessionID)
+	if err != nil {
+		return err
+	}
+
+	mutation := &dgraph.Mutation{}
+	if model != "" {
+		mutation.SetNquads = fmt.Sprintf("<%s> <ChatSession.model> \"%s\" .\n", sessionUID, dgraph.EscapeRDF(model))
+	} else {
+		mutation.DelNquads = fmt.Sprintf("<%s> <ChatSession.model> * .\n", sessionUID)
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		return fmt.Errorf("%w: dgraph.ExecuteMutations failed setting model of session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+	return nil
+}
+
+// getSessionModel returns the session's stored model override, or "" when it has none (or doesn't exist yet)
+func getSessionModel(sessionID string) (string, error) {
+	query := `
+        query getSessionModel($sessionID: string) {
+            session(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession)) {
+                model: ChatSession.model
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: dgraph.ExecuteQuery failed reading model of session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Session []struct {
+			Model string `json:"model"`
+		} `json:"session"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return "", fmt.Errorf("%w: failed to unmarshal model of session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	if len(queryResult.Session) == 0 {
+		return "", nil
+	}
+	return queryResult.Session[0].Model, nil
+}
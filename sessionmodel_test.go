@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestSessionModelIsUsedForLaterTurns(t *testing.T) {
+	env := newTestEnv(t)
+	AllowedModels = []string{modelName, "other-model"}
+	env.chat("s1", "hello")
+
+	if err := SetSessionModel("s1", "other-model"); err != nil {
+		t.Fatalf("SetSessionModel: %v", err)
+	}
+	resp := env.chat("s1", "again")
+
+	if got := env.model.lastCall(t).Model; got != "other-model" || resp.ModelUsed != "other-model" {
+		t.Errorf("turn answered by %q (ModelUsed %q), want the session model", got, resp.ModelUsed)
+	}
+	env.chat("s2", "hello")
+	if got := env.model.lastCall(t).Model; got != modelName {
+		t.Errorf("another session used %q, want the package default %q", got, modelName)
+	}
+}
+
+func TestPerRequestModelsOverrideTheSessionModel(t *testing.T) {
+	env := newTestEnv(t)
+	AllowedModels = []string{modelName, "other-model", "request-model"}
+	env.chat("s1", "hello")
+	if err := SetSessionModel("s1", "other-model"); err != nil {
+		t.Fatal(err)
+	}
+
+	env.chatWith("s1", "again", ChatOptions{Models: []string{"request-model"}})
+
+	if got := env.model.lastCall(t).Model; got != "request-model" {
+		t.Errorf("turn answered by %q, want the per-request model", got)
+	}
+}
+
+func TestTheSessionModelFallsBackToThePackageChain(t *testing.T) {
+	env := newTestEnv(t)
+	AllowedModels = []string{modelName, "other-model"}
+	env.chat("s1", "hello")
+	if err := SetSessionModel("s1", "other-model"); err != nil {
+		t.Fatal(err)
+	}
+	env.model.respond = func(call fakeModelCall) (*openai.ChatModelOutput, error) {
+		if call.Model == "other-model" {
+			return nil, errors.New("503 service unavailable")
+		}
+		return textOutput("from default"), nil
+	}
+
+	if resp := env.chat("s1", "again"); resp.ModelUsed != modelName {
+		t.Errorf("ModelUsed = %q, want the package default once the session model is down", resp.ModelUsed)
+	}
+}
+
+func TestClearingTheSessionModelRestoresTheDefault(t *testing.T) {
+	env := newTestEnv(t)
+	AllowedModels = []string{modelName, "other-model"}
+	env.chat("s1", "hello")
+	if err := SetSessionModel("s1", "other-model"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetSessionModel("s1", ""); err != nil {
+		t.Fatalf("SetSessionModel(\"\"): %v", err)
+	}
+	env.chat("s1", "again")
+
+	if got := env.model.lastCall(t).Model; got != modelName {
+		t.Errorf("turn answered by %q, want the package default", got)
+	}
+}
+
+func TestSetSessionModelValidates(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+
+	if err := SetSessionModel("s1", "not-allowed"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("error = %v, want ErrInvalidOptions for a model outside the allowlist", err)
+	}
+	if err := SetSessionModel("missing", modelName); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("error = %v, want ErrSessionNotFound", err)
+	}
+	if uid := env.store.find("ChatSession", "ChatSession.sessionID", "s1")[0]; env.store.value(uid, "ChatSession.model") != nil {
+		t.Error("a rejected model was stored")
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// GetHistory returns the stored messages of a session in chronological order.
+// It returns ErrSessionNotFound when nothing is stored under sessionID.
+func GetHistory(sessionID string) ([]DgraphChatMessage, error) {
+	messages, err := loadHistoryFromDgraph(context.Background(), sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	return messages, nil
+}
+
+// RenameSession changes a session's identifier, carrying all of its messages over to the new ID.
+// Messages, entities and error events reference their session by ID (ChatMessage.sessionIDRef,
+// Entity.sessionIDRef, ErrorEvent.sessionIDRef), so those references are rewritten too.
+func RenameSession(oldSessionID string, newSessionID string) error {
+	if strings.TrimSpace(oldSessionID) == "" || strings.TrimSpace(newSessionID) == "" {
+		return ErrEmptySessionID
+	}
+	if oldSessionID == newSessionID {
+		return fmt.Errorf("cannot rename session %s to itself", oldSessionID)
+	}
+
+	// Lock both IDs in a fixed order so a concurrent rename in the other direction can't deadlock
+	first, second := oldSessionID, newSessionID
+	if second < first {
+		first, second = second, first
+	}
+	unlockFirst := lockSession(first)
+	defer unlockFirst()
+	unlockSecond := lockSession(second)
+	defer unlockSecond()
+
+	// 1. Verify the old session exists and the new ID is free, so the caller gets a precise error
+	query := `
+        query checkRename($oldID: string, $newID: string) {
+            old(func: eq(ChatSession.sessionID, $oldID)) @filter(type(ChatSession)) {
+                uid
+            }
+            taken(func: eq(ChatSession.sessionID, $newID)) @filter(type(ChatSession)) {
+                uid
+            }
+        }
+    `
+	vars := map[string]string{"$oldID": oldSessionID, "$newID": newSessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: dgraph.ExecuteQuery failed checking rename of %s: %w", ErrStorageFailure, oldSessionID, err)
+	}
+
+	var queryResult struct {
+		Old []struct {
+			UID string `json:"uid"`
+		} `json:"old"`
+		Taken []struct {
+			UID string `json:"uid"`
+		} `json:"taken"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal rename check for %s: %w. JSON: %s", ErrStorageFailure, oldSessionID, err, string(resp.Json))
+	}
+	if len(queryResult.Old) == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, oldSessionID)
+	}
+	if len(queryResult.Taken) > 0 {
+		return fmt.Errorf("session %s already exists", newSessionID)
+	}
+
+	// 2. Rewrite the session, message, entity and error event references in one upsert.
+	// The conditions re-check that the new ID is still free at commit time. Messages, entities and error events
+	// get their own mutations because a session may have none, and an empty uid() variable would create a node.
+	upsertQuery := `
+        query renameSession($oldID: string, $newID: string) {
+            oldSession as var(func: eq(ChatSession.sessionID, $oldID)) @filter(type(ChatSession))
+            oldMessages as var(func: eq(ChatMessage.sessionIDRef, $oldID)) @filter(type(ChatMessage))
+            oldEntities as var(func: eq(Entity.sessionIDRef, $oldID)) @filter(type(Entity))
+            oldErrorEvents as var(func: eq(ErrorEvent.sessionIDRef, $oldID)) @filter(type(ErrorEvent))
+            taken as var(func: eq(ChatSession.sessionID, $newID)) @filter(type(ChatSession))
+        }
+    `
+	escapedNewID := dgraph.EscapeRDF(newSessionID)
+	mutations := []*dgraph.Mutation{
+		{
+			SetNquads: fmt.Sprintf("uid(oldSession) <ChatSession.sessionID> \"%s\" .\n", escapedNewID),
+			Condition: "@if(eq(len(taken), 0))",
+		},
+		{
+			SetNquads: fmt.Sprintf("uid(oldMessages) <ChatMessage.sessionIDRef> \"%s\" .\n", escapedNewID),
+			Condition: "@if(eq(len(taken), 0) AND gt(len(oldMessages), 0))",
+		},
+		{
+			SetNquads: fmt.Sprintf("uid(oldEntities) <Entity.sessionIDRef> \"%s\" .\n", escapedNewID),
+			Condition: "@if(eq(len(taken), 0) AND gt(len(oldEntities), 0))",
+		},
+		{
+			SetNquads: fmt.Sprintf("uid(oldErrorEvents) <ErrorEvent.sessionIDRef> \"%s\" .\n", escapedNewID),
+			Condition: "@if(eq(len(taken), 0) AND gt(len(oldErrorEvents), 0))",
+		},
+	}
+
+	_, err = executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     upsertQuery,
+		Variables: vars,
+	}, mutations...)
+	if err != nil {
+		return fmt.Errorf("%w: dgraph upsert failed renaming %s to %s: %w", ErrStorageFailure, oldSessionID, newSessionID, err)
+	}
+
+	return nil
+}
+
+// newSessionID generates a random, URL-safe session identifier
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ForkSession copies a session's messages, up to and including uptoMessageUID, into a fresh session
+// and returns the new session's ID. An empty uptoMessageUID copies the whole history.
+// The fork gets the original's owner, tags and model override; the original session is left untouched.
+func ForkSession(sessionID string, uptoMessageUID string) (string, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return "", err
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	ctx := context.Background()
+
+	history, err := loadHistoryFromDgraph(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	if len(history) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	// 1. Select the prefix of the history to copy
+	end := len(history)
+	if uptoMessageUID != "" {
+		end = -1
+		for i, msg := range history {
+			if msg.UID == uptoMessageUID {
+				end = i + 1
+				break
+			}
+		}
+		if end == -1 {
+			return "", fmt.Errorf("message %s not found in session %s", uptoMessageUID, sessionID)
+		}
+	}
+
+	source, err := getSessionSettings(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	// 2. Copy the messages as new nodes (no UIDs) under the new session
+	forkedID, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+	copies := make([]DgraphChatMessage, end)
+	for i, msg := range history[:end] {
+		msg.UID = ""
+		msg.DgraphType = []string{"ChatMessage"}
+		copies[i] = msg
+	}
+
+	// Nobody else knows forkedID yet, but the save still requires its lock
+	unlockFork := lockSession(forkedID)
+	saved, err := saveNewMessagesToDgraph(ctx, forkedID, source.Owner, copies)
+	unlockFork()
+	if err != nil {
+		return "", err
+	}
+
+	// The save records the owner; tags and the model override are set on the new session node afterwards
+	if len(source.Tags) > 0 || source.Model != "" {
+		sessionObject := map[string]interface{}{
+			"uid": saved.SessionUID,
+		}
+		if len(source.Tags) > 0 {
+			sessionObject["ChatSession.tags"] = source.Tags
+		}
+		if source.Model != "" {
+			sessionObject["ChatSession.model"] = source.Model
+		}
+		setJsonPayload, err := json.Marshal(sessionObject)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal Dgraph SetJson: %w", err)
+		}
+		mutation := &dgraph.Mutation{
+			SetJson: string(setJsonPayload),
+		}
+		if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+			return "", fmt.Errorf("%w: dgraph.ExecuteMutations failed copying tags and model to fork %s: %w", ErrStorageFailure, forkedID, err)
+		}
+	}
+
+	// 3. Link the fork to the session it branched from, so GetSessionTree can find it
+	if err := linkParentSession(forkedID, sessionID); err != nil {
+		// The fork itself is usable; it just won't show up in the original's tree
+		logger.Error("error linking forked session to its parent", "sessionID", forkedID, "parentSessionID", sessionID, "error", err)
+	}
+	return forkedID, nil
+}
+
+// sessionSettings are the ChatSession predicates that forks inherit and merges reconcile
+type sessionSettings struct {
+	Owner string   `json:"owner"`
+	Tags  []string `json:"tags"`
+	Model string   `json:"model"`
+}
+
+// getSessionSettings loads the owner, tags and model override of a session.
+// A session with messages but no ChatSession node yields empty settings.
+func getSessionSettings(sessionID string) (sessionSettings, error) {
+	query := `
+        query getSessionSettings($sessionID: string) {
+            session(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession)) {
+                owner: ChatSession.owner
+                tags: ChatSession.tags
+                model: ChatSession.model
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return sessionSettings{}, fmt.Errorf("%w: dgraph.ExecuteQuery failed loading settings of session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Session []sessionSettings `json:"session"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return sessionSettings{}, fmt.Errorf("%w: failed to unmarshal settings of session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	if len(queryResult.Session) == 0 {
+		return sessionSettings{}, nil
+	}
+	return queryResult.Session[0], nil
+}
+
+// SessionMetadata describes a session for display, without its messages
+type SessionMetadata struct {
+	SessionID    string    `json:"sessionID"`
+	Title        string    `json:"title,omitempty"`
+	SystemPrompt string    `json:"systemPrompt,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	Summary      string    `json:"summary,omitempty"` // Written by SummarizeIdleSessions; may predate the latest messages
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActivity time.Time `json:"lastActivity"`
+	MessageCount int       `json:"messageCount"`
+}
+
+// GetSessionMetadata returns the stored ChatSession predicates together with the session's message count.
+// Sessions created before ChatSession.createdAt existed report their first message's timestamp instead.
+func GetSessionMetadata(sessionID string) (*SessionMetadata, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+
+	query := `
+        query getSessionMetadata($sessionID: string) {
+            session(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession)) {
+                title: ChatSession.title
+                systemPrompt: ChatSession.systemPrompt
+                model: ChatSession.model
+                summary: ChatSession.summary
+                createdAt: ChatSession.createdAt
+                lastActivity: ChatSession.lastActivity
+            }
+            var(func: eq(ChatMessage.sessionIDRef, $sessionID)) @filter(type(ChatMessage)) {
+                timestamps as ChatMessage.timestamp
+            }
+            messageStats() {
+                firstAt: min(val(timestamps))
+            }
+            messages(func: eq(ChatMessage.sessionIDRef, $sessionID)) @filter(type(ChatMessage)) {
+                total: count(uid)
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: dgraph.ExecuteQuery failed loading metadata for session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Session []struct {
+			Title        string    `json:"title"`
+			SystemPrompt string    `json:"systemPrompt"`
+			Model        string    `json:"model"`
+			Summary      string    `json:"summary"`
+			CreatedAt    time.Time `json:"createdAt"`
+			LastActivity time.Time `json:"lastActivity"`
+		} `json:"session"`
+		MessageStats []struct {
+			FirstAt time.Time `json:"firstAt"`
+		} `json:"messageStats"`
+		Messages []struct {
+			Total int `json:"total"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal metadata for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	if len(queryResult.Session) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	session := queryResult.Session[0]
+	metadata := &SessionMetadata{
+		SessionID:    sessionID,
+		Title:        session.Title,
+		SystemPrompt: session.SystemPrompt,
+		Model:        session.Model,
+		Summary:      session.Summary,
+		CreatedAt:    session.CreatedAt,
+		LastActivity: session.LastActivity,
+	}
+	if metadata.CreatedAt.IsZero() && len(queryResult.MessageStats) > 0 {
+		metadata.CreatedAt = queryResult.MessageStats[0].FirstAt
+	}
+	if len(queryResult.Messages) > 0 {
+		metadata.MessageCount = queryResult.Messages[0].Total
+	}
+	return metadata, nil
+}
+
+// SessionInfo is the summary of a session returned by the session listing functions
+type SessionInfo struct {
+	SessionID    string    `json:"sessionID"`
+	Title        string    `json:"title,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActivity time.Time `json:"lastActivity"`
+	Archived     bool      `json:"archived,omitempty"`
+	Owner        string    `json:"owner,omitempty"`
+}
+
+// sessionInfoFields is the selection block decoded into SessionInfo; every session listing query should use it
+const sessionInfoFields = `
+                sessionID: ChatSession.sessionID
+                title: ChatSession.title
+                tags: ChatSession.tags
+                createdAt: ChatSession.createdAt
+                lastActivity: ChatSession.lastActivity
+                archived: ChatSession.archived
+                owner: ChatSession.owner`
+
+// querySessionInfos runs a session listing query and decodes its "sessions" block, most recently active first
+func querySessionInfos(query string, vars map[string]string) ([]SessionInfo, error) {
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: dgraph.ExecuteQuery failed listing sessions: %w", ErrStorageFailure, err)
+	}
+
+	var queryResult struct {
+		Sessions []SessionInfo `json:"sessions"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal sessions: %w. JSON: %s", ErrStorageFailure, err, string(resp.Json))
+	}
+
+	sessions := queryResult.Sessions
+	if sessions == nil {
+		sessions = []SessionInfo{}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].LastActivity.After(sessions[j].LastActivity)
+	})
+	return sessions, nil
+}
+
+// findSessionUID returns the UID of the session's ChatSession node, or ErrSessionNotFound
+func findSessionUID(sessionID string) (string, error) {
+	query := `
+        query findSessionUID($sessionID: string) {
+            session(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession)) {
+                uid
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: dgraph.ExecuteQuery failed looking up session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Session []struct {
+			UID string `json:"uid"`
+		} `json:"session"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return "", fmt.Errorf("%w: failed to unmarshal session lookup for %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	if len(queryResult.Session) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	return queryResult.Session[0].UID, nil
+}
+
+// SessionExists reports whether a ChatSession node exists for sessionID, without loading any messages
+func SessionExists(sessionID string) (bool, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return false, err
+	}
+
+	query := `
+        query sessionExists($sessionID: string) {
+            sessions(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession)) {
+                total: count(uid)
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return false, fmt.Errorf("%w: dgraph.ExecuteQuery failed checking session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Sessions []struct {
+			Total int `json:"total"`
+		} `json:"sessions"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return false, fmt.Errorf("%w: failed to unmarshal session count for %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	return len(queryResult.Sessions) > 0 && queryResult.Sessions[0].Total > 0, nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+func TestRenameSessionMovesTheHistory(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("machine-id", "hello")
+	env.chat("machine-id", "again")
+	before := env.history("machine-id")
+
+	if err := RenameSession("machine-id", "Trip planning"); err != nil {
+		t.Fatalf("RenameSession: %v", err)
+	}
+
+	after, err := GetHistory("Trip planning")
+	if err != nil {
+		t.Fatalf("GetHistory under the new ID: %v", err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("history has %d messages under the new ID, want %d", len(after), len(before))
+	}
+	for i := range after {
+		if after[i].UID != before[i].UID || after[i].Content != before[i].Content {
+			t.Errorf("message %d changed: %+v, want %+v", i, after[i], before[i])
+		}
+	}
+	if _, err := GetHistory("machine-id"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetHistory under the old ID error = %v, want ErrSessionNotFound", err)
+	}
+	if n := env.store.nodeCount("ChatSession"); n != 1 {
+		t.Errorf("%d sessions stored after the rename, want 1", n)
+	}
+
+	env.chat("Trip planning", "continuing")
+	if n := len(env.history("Trip planning")); n != len(before)+2 {
+		t.Errorf("the renamed session has %d messages after another turn, want %d", n, len(before)+2)
+	}
+}
+
+func TestRenameSessionRejectsTakenEmptyAndUnknownIDs(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("a", "hello")
+	env.chat("b", "hello")
+
+	if err := RenameSession("a", "b"); err == nil {
+		t.Error("renaming onto an existing session succeeded")
+	}
+	if err := RenameSession("a", " "); !errors.Is(err, ErrEmptySessionID) {
+		t.Errorf("renaming to a blank ID error = %v, want ErrEmptySessionID", err)
+	}
+	if err := RenameSession("missing", "c"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("renaming an unknown session error = %v, want ErrSessionNotFound", err)
+	}
+	if n := len(env.history("a")); n != 3 {
+		t.Errorf("session a has %d messages after the refused renames, want 3", n)
+	}
+}
+
+func TestForkSessionAtAMidpointCopiesOnlyEarlierMessages(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("one", "two", "three")
+	env.chat("orig", "first")
+	env.chat("orig", "second")
+	env.chat("orig", "third")
+	original := env.history("orig")
+	midpoint := original[4] // The assistant reply of the second turn
+
+	forkID, err := ForkSession("orig", midpoint.UID)
+	if err != nil {
+		t.Fatalf("ForkSession: %v", err)
+	}
+
+	fork := env.history(forkID)
+	if len(fork) != 5 {
+		t.Fatalf("fork has %d messages, want 5", len(fork))
+	}
+	for i, msg := range fork {
+		if msg.Content != original[i].Content || msg.Role != original[i].Role || msg.UID == original[i].UID {
+			t.Errorf("fork message %d = %q (%s, uid %s), want a new copy of %q", i, msg.Content, msg.Role, msg.UID, original[i].Content)
+		}
+	}
+	if n := len(env.history("orig")); n != len(original) {
+		t.Errorf("the original has %d messages after the fork, want %d", n, len(original))
+	}
+}
+
+func TestForkSessionWithoutUIDCopiesEverything(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("orig", "first")
+	env.chat("orig", "second")
+
+	forkID, err := ForkSession("orig", "")
+	if err != nil {
+		t.Fatalf("ForkSession: %v", err)
+	}
+	if got, want := len(env.history(forkID)), len(env.history("orig")); got != want {
+		t.Errorf("fork has %d messages, want all %d", got, want)
+	}
+}
+
+func TestForkSessionInheritsOwnerTagsAndModel(t *testing.T) {
+	env := newTestEnv(t)
+	AllowedModels = []string{modelName, "other-model"}
+	env.chatWith("orig", "hello", ChatOptions{UserID: "alice"})
+	if err := AddSessionTag("orig", "travel"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSessionModel("orig", "other-model"); err != nil {
+		t.Fatal(err)
+	}
+
+	forkID, err := ForkSession("orig", "")
+	if err != nil {
+		t.Fatalf("ForkSession: %v", err)
+	}
+
+	sessions, err := ListSessionsForUser("alice", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forkInfo *SessionInfo
+	for i := range sessions {
+		if sessions[i].SessionID == forkID {
+			forkInfo = &sessions[i]
+		}
+	}
+	if forkInfo == nil {
+		t.Fatalf("the fork isn't listed for the original's owner: %+v", sessions)
+	}
+	if len(forkInfo.Tags) != 1 || forkInfo.Tags[0] != "travel" {
+		t.Errorf("fork tags = %q, want [travel]", forkInfo.Tags)
+	}
+	if model, err := getSessionModel(forkID); err != nil || model != "other-model" {
+		t.Errorf("fork model = %q, %v; want other-model", model, err)
+	}
+	if _, err := ChatWithOptions(forkID, "hi", ChatOptions{UserID: "mallory"}); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("another user continuing the fork got %v, want ErrAccessDenied", err)
+	}
+}
+
+func TestForkSessionRejectsBlankUnknownAndForeignInput(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("orig", "hello")
+
+	if _, err := ForkSession(" ", ""); !errors.Is(err, ErrEmptySessionID) {
+		t.Errorf("forking a blank ID error = %v, want ErrEmptySessionID", err)
+	}
+	if _, err := ForkSession("missing", ""); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("forking an unknown session error = %v, want ErrSessionNotFound", err)
+	}
+	if _, err := ForkSession("orig", "0xdead"); err == nil {
+		t.Error("forking at a message outside the session succeeded")
+	}
+	if n := env.store.nodeCount("ChatSession"); n != 1 {
+		t.Errorf("%d sessions stored after the refused forks, want 1", n)
+	}
+}
+
+func TestForkSessionWaitsForTheSessionLock(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("orig", "hello")
+
+	unlock := lockSession("orig")
+	done := make(chan error, 1)
+	go func() {
+		_, err := ForkSession("orig", "")
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("ForkSession ran while another turn held the session lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("ForkSession: %v", err)
+	}
+}
+
+func TestGetSessionMetadataReturnsEveryField(t *testing.T) {
+	env := newTestEnv(t)
+	AllowedModels = []string{"other-model"}
+	env.chatWith("s1", "hello", ChatOptions{SystemPrompt: "Be terse"})
+	env.clock.Advance(time.Hour)
+	env.chat("s1", "again")
+	if err := SetSessionModel("s1", "other-model"); err != nil {
+		t.Fatal(err)
+	}
+	sessionUID := env.store.find("ChatSession", "ChatSession.sessionID", "s1")[0]
+	env.store.set(sessionUID, "ChatSession.title", "Greetings")
+	env.store.set(sessionUID, "ChatSession.summary", "Said hello twice")
+
+	metadata, err := GetSessionMetadata("s1")
+	if err != nil {
+		t.Fatalf("GetSessionMetadata: %v", err)
+	}
+	created := env.store.value(sessionUID, "ChatSession.createdAt").(time.Time)
+	lastActivity := env.store.value(sessionUID, "ChatSession.lastActivity").(time.Time)
+	if !lastActivity.After(created) {
+		t.Fatalf("lastActivity %s should be after createdAt %s", lastActivity, created)
+	}
+	want := SessionMetadata{
+		SessionID:    "s1",
+		Title:        "Greetings",
+		SystemPrompt: "Be terse",
+		Model:        "other-model",
+		Summary:      "Said hello twice",
+		CreatedAt:    created,
+		LastActivity: lastActivity,
+		MessageCount: 5,
+	}
+	if !metadata.CreatedAt.Equal(want.CreatedAt) || !metadata.LastActivity.Equal(want.LastActivity) {
+		t.Errorf("created/last activity = %s/%s, want %s/%s", metadata.CreatedAt, metadata.LastActivity, want.CreatedAt, want.LastActivity)
+	}
+	metadata.CreatedAt, metadata.LastActivity = want.CreatedAt, want.LastActivity
+	if *metadata != want {
+		t.Errorf("GetSessionMetadata = %+v, want %+v", *metadata, want)
+	}
+}
+
+func TestGetSessionMetadataFallsBackToTheFirstMessageTime(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("legacy", "hello")
+	sessionUID := env.store.find("ChatSession", "ChatSession.sessionID", "legacy")[0]
+	env.store.set(sessionUID, "ChatSession.createdAt", nil)
+
+	metadata, err := GetSessionMetadata("legacy")
+	if err != nil {
+		t.Fatalf("GetSessionMetadata: %v", err)
+	}
+	if first := env.history("legacy")[0].Timestamp; !metadata.CreatedAt.Equal(first) {
+		t.Errorf("CreatedAt = %s, want the first message's %s", metadata.CreatedAt, first)
+	}
+}
+
+func TestGetSessionMetadataOfUnknownSession(t *testing.T) {
+	newTestEnv(t)
+
+	if _, err := GetSessionMetadata("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetSessionMetadata error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSessionExistsForStoredSessionsOnly(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+
+	exists, err := SessionExists("s1")
+	if err != nil || !exists {
+		t.Errorf("SessionExists(s1) = %v, %v, want true", exists, err)
+	}
+	exists, err = SessionExists("unknown")
+	if err != nil || exists {
+		t.Errorf("SessionExists(unknown) = %v, %v, want false and no error", exists, err)
+	}
+	if n := len(env.store.callsNamed("getSessionMessages")); n != 1 {
+		t.Errorf("history loaded %d times, want SessionExists not to load any messages", n)
+	}
+}
+
+func TestSessionExistsReportsStorageFailures(t *testing.T) {
+	env := newTestEnv(t)
+	env.store.fail = func(fakeStoreCall) error { return errors.New("connection refused") }
+
+	if _, err := SessionExists("s1"); !errors.Is(err, ErrStorageFailure) {
+		t.Errorf("error = %v, want ErrStorageFailure", err)
+	}
+	if _, err := SessionExists(""); !errors.Is(err, ErrEmptySessionID) {
+		t.Errorf("error = %v, want ErrEmptySessionID", err)
+	}
+}
+
+func TestRenameSessionWithoutMessagesCreatesNoNodes(t *testing.T) {
+	env := newTestEnv(t)
+	if _, err := executeMutations(dgraphConnectionName, &dgraph.Mutation{
+		SetJson: `{"uid": "_:session", "dgraph.type": "ChatSession", "ChatSession.sessionID": "empty"}`,
+	}); err != nil {
+		t.Fatalf("seeding: %v", err)
+	}
+
+	if err := RenameSession("empty", "renamed"); err != nil {
+		t.Fatalf("RenameSession: %v", err)
+	}
+
+	if n := env.store.totalNodes(); n != 1 {
+		t.Errorf("%d nodes after renaming an empty session, want only the session", n)
+	}
+	if got := env.store.find("ChatSession", "ChatSession.sessionID", "renamed"); len(got) != 1 {
+		t.Errorf("renamed session nodes = %v, want 1", got)
+	}
+}
+
+func TestRenameSessionUpsertGuardsEveryMutation(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+
+	if err := RenameSession("s1", "s2"); err != nil {
+		t.Fatalf("RenameSession: %v", err)
+	}
+
+	query, conditions := env.store.lastUpsert("renameSession")
+	want := map[string]string{
+		"uid(oldSession)":     "@if(eq(len(taken), 0))",
+		"uid(oldMessages)":    "@if(eq(len(taken), 0) AND gt(len(oldMessages), 0))",
+		"uid(oldEntities)":    "@if(eq(len(taken), 0) AND gt(len(oldEntities), 0))",
+		"uid(oldErrorEvents)": "@if(eq(len(taken), 0) AND gt(len(oldErrorEvents), 0))",
+	}
+	if !reflect.DeepEqual(conditions, want) {
+		t.Errorf("conditions = %v, want %v", conditions, want)
+	}
+	if !strings.Contains(query, "taken as var(func: eq(ChatSession.sessionID, $newID)) @filter(type(ChatSession))") {
+		t.Errorf("the upsert doesn't re-check the new ID at commit time:\n%s", query)
+	}
+}
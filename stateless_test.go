@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAFullyStatelessTurnNeverTouchesTheStore(t *testing.T) {
+	env := newTestEnv(t)
+	off := false
+	WriteAheadUserMessage = true
+	env.model.reply("utility answer")
+
+	resp := env.chatWith("s1", "summarize this", ChatOptions{IncludeHistory: &off, Persist: &off, UserID: "u1"})
+
+	if n := len(env.store.calls); n != 0 {
+		t.Errorf("store called %d times (%+v), want no reads or writes", n, env.store.calls)
+	}
+	if resp.Content != "utility answer" || resp.Persisted || resp.MessageUID != "" {
+		t.Errorf("response = %+v, want the answer, not persisted", resp)
+	}
+	if got := contents(env.model.lastCall(t).Messages); !slices.Equal(got, []string{defaultSystemPrompt, "summarize this"}) {
+		t.Errorf("model input = %q, want only the system prompt and the message", got)
+	}
+}
+
+func TestLeavingHistoryOutSendsOnlyThePromptButStillSaves(t *testing.T) {
+	env := newTestEnv(t)
+	off := false
+	env.chat("s1", "earlier")
+
+	resp := env.chatWith("s1", "one-off", ChatOptions{IncludeHistory: &off})
+
+	if got := contents(env.model.lastCall(t).Messages); !slices.Equal(got, []string{defaultSystemPrompt, "one-off"}) {
+		t.Errorf("model input = %q, want the earlier turn left out", got)
+	}
+	if len(env.store.callsNamed("getSessionMessages")) != 1 {
+		t.Errorf("history loaded %d times, want only by the first turn", len(env.store.callsNamed("getSessionMessages")))
+	}
+	if !resp.Persisted {
+		t.Error("the turn was not persisted")
+	}
+	history := env.history("s1")
+	if got := messageContents(history); !slices.Equal(got, []string{defaultSystemPrompt, "earlier", "ok", "one-off", "ok"}) {
+		t.Errorf("history = %q, want the turn appended without a second system prompt", got)
+	}
+}
+
+func TestNotPersistingStillUsesTheHistory(t *testing.T) {
+	env := newTestEnv(t)
+	off := false
+	env.chat("s1", "earlier")
+	mutations := env.store.mutationCount()
+
+	resp := env.chatWith("s1", "what did I say?", ChatOptions{Persist: &off})
+
+	if got := contents(env.model.lastCall(t).Messages); !slices.Contains(got, "earlier") {
+		t.Errorf("model input = %q, want the stored history", got)
+	}
+	if n := env.store.mutationCount(); n != mutations || resp.Persisted {
+		t.Errorf("%d mutations after a Persist=false turn (Persisted=%v), want none", n-mutations, resp.Persisted)
+	}
+	if n := len(env.history("s1")); n != 3 {
+		t.Errorf("history has %d messages, want the unpersisted turn left out", n)
+	}
+}
+
+func TestExplicitTrueMatchesTheDefaults(t *testing.T) {
+	env := newTestEnv(t)
+	on := true
+	env.chat("s1", "earlier")
+
+	env.chatWith("s1", "again", ChatOptions{IncludeHistory: &on, Persist: &on})
+
+	if n := len(env.history("s1")); n != 5 {
+		t.Errorf("history has %d messages, want both turns stored", n)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// Stats summarizes the messages stored for a session
+type Stats struct {
+	TotalMessages   int            `json:"totalMessages"`
+	MessagesByRole  map[string]int `json:"messagesByRole"`
+	FirstMessageAt  time.Time      `json:"firstMessageAt"` // Zero for empty sessions
+	LastMessageAt   time.Time      `json:"lastMessageAt"`  // Zero for empty sessions
+	TotalCharacters int            `json:"totalCharacters"`
+}
+
+// CountMessages returns how many messages are stored for the session, without loading them
+func CountMessages(sessionID string) (int, error) {
+	query := `
+        query countSessionMessages($sessionID: string) {
+            messages(func: eq(ChatMessage.sessionIDRef, $sessionID)) @filter(type(ChatMessage)) {
+                total: count(uid)
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: dgraph.ExecuteQuery failed counting messages for session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	// count(uid) at the root comes back as a single-element list: {"messages":[{"total":N}]}
+	var queryResult struct {
+		Messages []struct {
+			Total int `json:"total"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return 0, fmt.Errorf("%w: failed to unmarshal message count for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+	if len(queryResult.Messages) == 0 {
+		return 0, nil
+	}
+	return queryResult.Messages[0].Total, nil
+}
+
+// SessionStats returns per-role counts, the first/last message timestamps and the total stored characters.
+// Empty or unknown sessions yield zero values rather than an error.
+func SessionStats(sessionID string) (Stats, error) {
+	query := `
+        query getSessionStats($sessionID: string) {
+            messages(func: eq(ChatMessage.sessionIDRef, $sessionID)) @filter(type(ChatMessage)) {
+                role: ChatMessage.role
+                content: ChatMessage.content
+                timestamp: ChatMessage.timestamp
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	stats := Stats{MessagesByRole: map[string]int{}}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return stats, fmt.Errorf("%w: dgraph.ExecuteQuery failed loading stats for session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	var queryResult struct {
+		Messages []struct {
+			Role      string    `json:"role"`
+			Content   string    `json:"content"`
+			Timestamp time.Time `json:"timestamp"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return stats, fmt.Errorf("%w: failed to unmarshal stats for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+
+	for _, m := range queryResult.Messages {
+		stats.TotalMessages++
+		stats.MessagesByRole[m.Role]++
+		stats.TotalCharacters += utf8.RuneCountInString(m.Content)
+		if stats.FirstMessageAt.IsZero() || m.Timestamp.Before(stats.FirstMessageAt) {
+			stats.FirstMessageAt = m.Timestamp
+		}
+		if m.Timestamp.After(stats.LastMessageAt) {
+			stats.LastMessageAt = m.Timestamp
+		}
+	}
+	return stats, nil
+}
+
+// EstimateCost returns the session's estimated spend from the token counts stored on its messages,
+// charging pricePer1kPrompt per 1,000 prompt tokens and pricePer1kCompletion per 1,000 completion tokens.
+// Sessions without token data cost zero.
+func EstimateCost(sessionID string, pricePer1kPrompt float64, pricePer1kCompletion float64) (float64, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return 0, err
+	}
+	if pricePer1kPrompt < 0 || pricePer1kCompletion < 0 {
+		return 0, fmt.Errorf("prices must not be negative (prompt %v, completion %v)", pricePer1kPrompt, pricePer1kCompletion)
+	}
+
+	query := `
+        query getSessionTokens($sessionID: string) {
+            var(func: eq(ChatMessage.sessionIDRef, $sessionID)) @filter(type(ChatMessage)) {
+                promptTokens as ChatMessage.promptTokens
+                completionTokens as ChatMessage.completionTokens
+            }
+            tokens() {
+                prompt: sum(val(promptTokens))
+                completion: sum(val(completionTokens))
+            }
+        }
+    `
+	vars := map[string]string{"$sessionID": sessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: dgraph.ExecuteQuery failed summing tokens for session %s: %w", ErrStorageFailure, sessionID, err)
+	}
+
+	// Each aggregate comes back in its own element, and is absent when no message carries the predicate
+	var queryResult struct {
+		Tokens []struct {
+			Prompt     int `json:"prompt"`
+			Completion int `json:"completion"`
+		} `json:"tokens"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return 0, fmt.Errorf("%w: failed to unmarshal token totals for session %s: %w. JSON: %s", ErrStorageFailure, sessionID, err, string(resp.Json))
+	}
+
+	var promptTokens, completionTokens int
+	for _, t := range queryResult.Tokens {
+		promptTokens += t.Prompt
+		completionTokens += t.Completion
+	}
+	return float64(promptTokens)/1000*pricePer1kPrompt + float64(completionTokens)/1000*pricePer1kCompletion, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCountMessagesAndSessionStatsOverMixedMessages(t *testing.T) {
+	env := newTestEnv(t)
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	messages := mixedRoleHistory()
+	for i := range messages {
+		messages[i].Timestamp = start.Add(time.Duration(i) * time.Minute)
+	}
+	if _, err := saveLocked("s1", "", messages); err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+	env.chat("other", "not counted")
+
+	count, err := CountMessages("s1")
+	if err != nil || count != len(messages) {
+		t.Errorf("CountMessages = %d, %v; want %d", count, err, len(messages))
+	}
+
+	stats, err := SessionStats("s1")
+	if err != nil {
+		t.Fatalf("SessionStats: %v", err)
+	}
+	wantRoles := map[string]int{"system": 1, "user": 1, "tool": 2, "function": 1, "assistant": 1}
+	if !reflect.DeepEqual(stats.MessagesByRole, wantRoles) {
+		t.Errorf("MessagesByRole = %v, want %v", stats.MessagesByRole, wantRoles)
+	}
+	characters := 0
+	for _, m := range messages {
+		characters += len([]rune(m.Content))
+	}
+	if stats.TotalMessages != len(messages) || stats.TotalCharacters != characters {
+		t.Errorf("TotalMessages = %d, TotalCharacters = %d; want %d and %d", stats.TotalMessages, stats.TotalCharacters, len(messages), characters)
+	}
+	if !stats.FirstMessageAt.Equal(start) || !stats.LastMessageAt.Equal(start.Add(5*time.Minute)) {
+		t.Errorf("first/last = %s/%s, want %s/%s", stats.FirstMessageAt, stats.LastMessageAt, start, start.Add(5*time.Minute))
+	}
+}
+
+func TestCountMessagesAndSessionStatsOfEmptySession(t *testing.T) {
+	newTestEnv(t)
+
+	if count, err := CountMessages("empty"); err != nil || count != 0 {
+		t.Errorf("CountMessages = %d, %v; want 0", count, err)
+	}
+	stats, err := SessionStats("empty")
+	if err != nil {
+		t.Fatalf("SessionStats: %v", err)
+	}
+	if stats.TotalMessages != 0 || stats.TotalCharacters != 0 || len(stats.MessagesByRole) != 0 || !stats.FirstMessageAt.IsZero() || !stats.LastMessageAt.IsZero() {
+		t.Errorf("SessionStats of an empty session = %+v, want zeros", stats)
+	}
+}
+
+func TestEstimateCostSumsStoredTokenCounts(t *testing.T) {
+	env := newTestEnv(t)
+	messages := []DgraphChatMessage{
+		{Role: "user", Content: "q1"},
+		{Role: "assistant", Content: "a1", PromptTokens: 1200, CompletionTokens: 300},
+		{Role: "user", Content: "q2"},
+		{Role: "assistant", Content: "a2", PromptTokens: 800, CompletionTokens: 700},
+	}
+	if _, err := saveLocked("s1", "", messages); err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+
+	cost, err := EstimateCost("s1", 0.5, 2)
+	if err != nil {
+		t.Fatalf("EstimateCost: %v", err)
+	}
+	if want := 2000.0/1000*0.5 + 1000.0/1000*2; math.Abs(cost-want) > 1e-9 {
+		t.Errorf("EstimateCost = %v, want %v", cost, want)
+	}
+
+	env.chat("live", "hello")
+	assistant := env.history("live")[2]
+	if assistant.PromptTokens != 10 || assistant.CompletionTokens != 5 {
+		t.Errorf("Chat stored tokens %d/%d, want the model's usage 10/5", assistant.PromptTokens, assistant.CompletionTokens)
+	}
+}
+
+func TestEstimateCostWithoutTokenData(t *testing.T) {
+	newTestEnv(t)
+	if _, err := saveLocked("s1", "", []DgraphChatMessage{{Role: "user", Content: "q"}}); err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+
+	for _, sessionID := range []string{"s1", "missing"} {
+		cost, err := EstimateCost(sessionID, 1, 1)
+		if err != nil || cost != 0 {
+			t.Errorf("EstimateCost(%s) = %v, %v, want 0, nil", sessionID, cost, err)
+		}
+	}
+	if _, err := EstimateCost("s1", -1, 1); err == nil {
+		t.Error("EstimateCost accepted a negative price")
+	}
+}
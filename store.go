@@ -0,0 +1,25 @@
+package main
+
+import "github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+
+// executeDgraph sends one request to a Dgraph connection. Every query and mutation in the package goes
+// through it (see executeQuery and executeMutations), so it is the single point where the store is reached.
+var executeDgraph = dgraph.Execute
+
+// alterDgraphSchema applies DQL schema definitions on a Dgraph connection
+var alterDgraphSchema = dgraph.AlterSchema
+
+// executeQuery runs a query, and any mutations along with it as an upsert, like dgraph.ExecuteQuery
+func executeQuery(connection string, query *dgraph.Query, mutations ...*dgraph.Mutation) (*dgraph.Response, error) {
+	return executeDgraph(connection, &dgraph.Request{
+		Query:     query,
+		Mutations: mutations,
+	})
+}
+
+// executeMutations runs mutations without a query, like dgraph.ExecuteMutations
+func executeMutations(connection string, mutations ...*dgraph.Mutation) (*dgraph.Response, error) {
+	return executeDgraph(connection, &dgraph.Request{
+		Mutations: mutations,
+	})
+}
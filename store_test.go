@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStoreCallsUseTheConfiguredConnectionName(t *testing.T) {
+	env := newTestEnv(t)
+	AllowDestructiveOps = true
+	SetDgraphConnectionName("analytics")
+
+	env.chat("s1", "hello")
+	if _, err := ApplyDgraphSchema(); err != nil {
+		t.Fatalf("ApplyDgraphSchema: %v", err)
+	}
+	if _, err := DropAllSessions(context.Background()); err != nil {
+		t.Fatalf("DropAllSessions: %v", err)
+	}
+
+	env.store.mu.Lock()
+	calls := append([]fakeStoreCall(nil), env.store.calls...)
+	env.store.mu.Unlock()
+	if len(calls) == 0 {
+		t.Fatal("nothing reached the store")
+	}
+	sawAlter := false
+	for _, c := range calls {
+		if c.Connection != "analytics" {
+			t.Errorf("call %q used connection %q, want analytics", c.Name, c.Connection)
+		}
+		sawAlter = sawAlter || c.Name == "alter"
+	}
+	if !sawAlter {
+		t.Error("the schema change never reached the store")
+	}
+}
+
+func TestSetDgraphConnectionNameRestoresTheDefault(t *testing.T) {
+	env := newTestEnv(t)
+	SetDgraphConnectionName("analytics")
+	SetDgraphConnectionName("  ")
+
+	env.chat("s1", "hello")
+	env.store.mu.Lock()
+	defer env.store.mu.Unlock()
+	for _, c := range env.store.calls {
+		if c.Connection != "website" {
+			t.Errorf("call %q used connection %q after resetting, want website", c.Name, c.Connection)
+		}
+	}
+	if dgraphConnectionName != "website" {
+		t.Errorf("dgraphConnectionName = %q, want the default", dgraphConnectionName)
+	}
+}
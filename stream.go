@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// StreamCheckpointChunks and StreamCheckpointInterval turn on stream checkpoints (both 0 = off).
+// The reply is stored complete before its first chunk goes out and a checkpoint never rewrites it: it records
+// how many chunks the client has received (ChatMessage.streamedChunks), every StreamCheckpointChunks chunks or
+// once StreamCheckpointInterval has passed since the last one, whichever comes first, and once more when the
+// stream completes. After a disconnect or crash, ResumeChatStream picks the reply up from the last checkpoint.
+var (
+	StreamCheckpointChunks   = 0
+	StreamCheckpointInterval time.Duration
+)
+
+// StreamEvent types
+const (
+	StreamEventChunk = "chunk" // Delta carries the next piece of the response
+	StreamEventDone  = "done"  // Content carries the full response; the stream ends
+	StreamEventError = "error" // Error describes why the turn failed; the stream ends
+)
+
+// StreamEvent is one event of a ChatStreamChan stream, shaped to map directly onto server-sent events
+type StreamEvent struct {
+	Type       string `json:"type"`
+	Delta      string `json:"delta,omitempty"`
+	Content    string `json:"content,omitempty"`
+	MessageUID string `json:"messageUID,omitempty"`
+	Persisted  bool   `json:"persisted,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ChatStreamChan runs a chat turn and delivers the response as a channel of events: chunks, then a final "done"
+// event with the full content and message UID, or an "error" event if the turn fails. The channel is closed once
+// the stream ends or ctx is cancelled.
+//
+// The model SDK has no token streaming, so the turn completes (and is saved) first and the response is then
+// emitted in word-sized chunks. Cancelling ctx stops delivery but doesn't abort a model call already in flight.
+func ChatStreamChan(ctx context.Context, sessionID string, userMessage string) (<-chan StreamEvent, error) {
+	if _, _, err := validateChatInput(sessionID, userMessage); err != nil {
+		return nil, err
+	}
+
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+
+		response, err := Chat(sessionID, userMessage)
+		if err != nil {
+			sendStreamEvent(ctx, events, StreamEvent{Type: StreamEventError, Error: err.Error()})
+			return
+		}
+		// Without a stored message there is nothing a checkpoint could point a resumed stream at
+		checkpointing := response.Persisted && response.MessageUID != ""
+		streamReply(ctx, events, sessionID, response.MessageUID, response.Content, 0, checkpointing, response.Persisted)
+	}()
+	return events, nil
+}
+
+// ResumeChatStream re-delivers a stored reply from its last stream checkpoint: the chunks ChatStreamChan had
+// not confirmed as received, then "done" with the full content. With no checkpoint recorded the whole reply
+// is sent. The chunks are cut from the stored content, so under EnableRedaction they carry the redacted text.
+func ResumeChatStream(ctx context.Context, sessionID string, messageUID string) (<-chan StreamEvent, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+	content, streamed, err := getStreamedMessage(sessionID, messageUID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+		streamReply(ctx, events, sessionID, messageUID, content, streamed, true, true)
+	}()
+	return events, nil
+}
+
+// streamReply sends content's chunks from index start on, then "done". With checkpointing on (and one of the
+// Stream* settings set) it records delivery progress on the message as it goes.
+// An interrupted stream keeps its last checkpoint, so a resumed one repeats at most the chunks since then.
+func streamReply(ctx context.Context, events chan<- StreamEvent, sessionID string, messageUID string, content string, start int, checkpointing bool, persisted bool) {
+	checkpointing = checkpointing && (StreamCheckpointChunks > 0 || StreamCheckpointInterval > 0)
+	checkpoint := func(delivered int) {
+		if err := checkpointStream(sessionID, messageUID, delivered); err != nil {
+			logger.Error("error checkpointing streamed response", "sessionID", sessionID, "uid", messageUID, "error", err)
+		}
+	}
+
+	chunks := splitStreamChunks(content)
+	lastCheckpoint := currentTime()
+	sinceCheckpoint := 0
+	for i := start; i < len(chunks); i++ {
+		if !sendStreamEvent(ctx, events, StreamEvent{Type: StreamEventChunk, Delta: chunks[i]}) {
+			return
+		}
+		if !checkpointing {
+			continue
+		}
+		sinceCheckpoint++
+		if (StreamCheckpointChunks > 0 && sinceCheckpoint >= StreamCheckpointChunks) ||
+			(StreamCheckpointInterval > 0 && currentTime().Sub(lastCheckpoint) >= StreamCheckpointInterval) {
+			checkpoint(i + 1)
+			sinceCheckpoint, lastCheckpoint = 0, currentTime()
+		}
+	}
+	if checkpointing && sinceCheckpoint > 0 {
+		checkpoint(len(chunks))
+	}
+	sendStreamEvent(ctx, events, StreamEvent{
+		Type:       StreamEventDone,
+		Content:    content,
+		MessageUID: messageUID,
+		Persisted:  persisted,
+	})
+}
+
+// sendStreamEvent delivers event unless ctx is cancelled first, reporting whether it was delivered
+func sendStreamEvent(ctx context.Context, events chan<- StreamEvent, event StreamEvent) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// checkpointStream records that the first delivered chunks of a stored reply reached the client.
+// It holds the session lock like every other write to the session, and the upsert leaves a message
+// deleted in the meantime alone instead of recreating it.
+func checkpointStream(sessionID string, messageUID string, delivered int) error {
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	query := `
+        query checkpointStream($uid: string) {
+            message as var(func: uid($uid)) @filter(type(ChatMessage))
+        }
+    `
+	mutation := &dgraph.Mutation{
+		SetNquads: fmt.Sprintf("uid(message) <ChatMessage.streamedChunks> \"%d\" .\n", delivered),
+		Condition: "@if(gt(len(message), 0))",
+	}
+	_, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: map[string]string{"$uid": messageUID},
+	}, mutation)
+	if err != nil {
+		return fmt.Errorf("%w: dgraph upsert failed checkpointing stream of message %s: %w", ErrStorageFailure, messageUID, err)
+	}
+	return nil
+}
+
+// getStreamedMessage loads a message of the session with its stream checkpoint (zero when none was recorded)
+func getStreamedMessage(sessionID string, messageUID string) (string, int, error) {
+	if messageUID == "" {
+		return "", 0, fmt.Errorf("messageUID must not be empty")
+	}
+	query := `
+        query getStreamedMessage($uid: string, $sessionID: string) {
+            message(func: uid($uid)) @filter(eq(ChatMessage.sessionIDRef, $sessionID) AND type(ChatMessage)) {
+                uid
+                content: ChatMessage.content
+                streamedChunks: ChatMessage.streamedChunks
+            }
+        }
+    `
+	vars := map[string]string{
+		"$uid":       messageUID,
+		"$sessionID": sessionID,
+	}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: dgraph.ExecuteQuery failed loading message %s: %w", ErrStorageFailure, messageUID, err)
+	}
+
+	var queryResult struct {
+		Message []struct {
+			Content        string `json:"content"`
+			StreamedChunks int    `json:"streamedChunks"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return "", 0, fmt.Errorf("%w: failed to unmarshal message %s: %w. JSON: %s", ErrStorageFailure, messageUID, err, string(resp.Json))
+	}
+	if len(queryResult.Message) == 0 {
+		return "", 0, fmt.Errorf("message %s not found in session %s", messageUID, sessionID)
+	}
+	return queryResult.Message[0].Content, queryResult.Message[0].StreamedChunks, nil
+}
+
+// splitStreamChunks cuts content into words, each keeping its trailing whitespace, so the chunks concatenate back to content
+func splitStreamChunks(content string) []string {
+	var chunks []string
+	start := 0
+	inSpace := false
+	for i, r := range content {
+		space := unicode.IsSpace(r)
+		if inSpace && !space {
+			chunks = append(chunks, content[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(content) {
+		chunks = append(chunks, content[start:])
+	}
+	return chunks
+}
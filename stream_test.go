@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// drain reads events until the channel is closed
+func drain(t *testing.T, events <-chan StreamEvent) []StreamEvent {
+	t.Helper()
+	var got []StreamEvent
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return got
+			}
+			got = append(got, event)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("the stream was not closed after %d events", len(got))
+		}
+	}
+}
+
+func TestChatStreamChanReassemblesTheFullResponse(t *testing.T) {
+	env := newTestEnv(t)
+	const reply = "Hello there,  streaming\nworld! 🙂"
+	env.model.reply(reply)
+
+	events, err := ChatStreamChan(context.Background(), "s1", "hi")
+	if err != nil {
+		t.Fatalf("ChatStreamChan: %v", err)
+	}
+	got := drain(t, events)
+
+	var assembled strings.Builder
+	for _, event := range got[:len(got)-1] {
+		if event.Type != StreamEventChunk {
+			t.Fatalf("event %+v before the end, want only chunks", event)
+		}
+		assembled.WriteString(event.Delta)
+	}
+	if len(got) < 3 {
+		t.Errorf("got %d events, want the reply split into several chunks", len(got))
+	}
+	if assembled.String() != reply {
+		t.Errorf("chunks reassemble to %q, want %q", assembled.String(), reply)
+	}
+	done := got[len(got)-1]
+	history := env.history("s1")
+	if done.Type != StreamEventDone || done.Content != reply || !done.Persisted || done.MessageUID != history[2].UID {
+		t.Errorf("final event = %+v, want done with the full content and UID %s", done, history[2].UID)
+	}
+}
+
+func TestChatStreamChanDeliversErrorsAsATerminalEvent(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.respond = func(fakeModelCall) (*openai.ChatModelOutput, error) {
+		return nil, errors.New("503 service unavailable")
+	}
+
+	events, err := ChatStreamChan(context.Background(), "s1", "hi")
+	if err != nil {
+		t.Fatalf("ChatStreamChan: %v", err)
+	}
+	got := drain(t, events)
+	if len(got) != 1 || got[0].Type != StreamEventError || got[0].Error == "" {
+		t.Errorf("events = %+v, want a single error event", got)
+	}
+}
+
+func TestChatStreamChanClosesWhenTheContextIsCancelled(t *testing.T) {
+	env := newTestEnv(t)
+	env.model.reply("one two three four five")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events, err := ChatStreamChan(ctx, "s1", "hi")
+	if err != nil {
+		t.Fatalf("ChatStreamChan: %v", err)
+	}
+	if first := <-events; first.Type != StreamEventChunk {
+		t.Fatalf("first event = %+v, want a chunk", first)
+	}
+	cancel()
+	time.Sleep(50 * time.Millisecond) // With nobody reading, the pending send can only see the cancellation
+	for _, event := range drain(t, events) {
+		if event.Type == StreamEventDone {
+			t.Error("the stream finished normally after being cancelled")
+		}
+	}
+}
+
+func TestChatStreamChanRejectsInvalidInput(t *testing.T) {
+	newTestEnv(t)
+
+	if _, err := ChatStreamChan(context.Background(), "", "hi"); !errors.Is(err, ErrEmptySessionID) {
+		t.Errorf("error = %v, want ErrEmptySessionID", err)
+	}
+}
+
+// receive reads the next n events, failing the test if the stream ends first
+func receive(t *testing.T, events <-chan StreamEvent, n int) []StreamEvent {
+	t.Helper()
+	got := make([]StreamEvent, 0, n)
+	for len(got) < n {
+		event, ok := <-events
+		if !ok {
+			t.Fatalf("the stream ended after %d events, want %d", len(got), n)
+		}
+		got = append(got, event)
+	}
+	return got
+}
+
+// streamCheckpoint returns the delivery checkpoint recorded on a message
+func streamCheckpoint(t *testing.T, sessionID string, messageUID string) int {
+	t.Helper()
+	_, streamed, err := getStreamedMessage(sessionID, messageUID)
+	if err != nil {
+		t.Fatalf("getStreamedMessage: %v", err)
+	}
+	return streamed
+}
+
+func TestChatStreamChanInterruptedStreamKeepsTheFullReply(t *testing.T) {
+	env := newTestEnv(t)
+	StreamCheckpointChunks = 2
+	const reply = "one two three four five six seven"
+	env.model.reply(reply)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events, err := ChatStreamChan(ctx, "s1", "hi")
+	if err != nil {
+		t.Fatalf("ChatStreamChan: %v", err)
+	}
+	// Checkpoints follow chunks 2 and 4; receiving chunk 5 means the second one was written
+	received := receive(t, events, 5)
+	cancel()
+	time.Sleep(50 * time.Millisecond) // With nobody reading, the pending send can only see the cancellation
+	drain(t, events)
+
+	last := env.history("s1")[2]
+	if last.Content != reply || last.FinishReason != "stop" {
+		t.Errorf("stored reply = %q (finish %q), want the complete reply untouched", last.Content, last.FinishReason)
+	}
+	if got := streamCheckpoint(t, "s1", last.UID); got != 4 {
+		t.Errorf("checkpoint = %d chunks, want 4", got)
+	}
+
+	// Resuming repeats the chunk delivered after the checkpoint, then sends the rest
+	resumed, err := ResumeChatStream(context.Background(), "s1", last.UID)
+	if err != nil {
+		t.Fatalf("ResumeChatStream: %v", err)
+	}
+	rest := drain(t, resumed)
+	var assembled strings.Builder
+	for _, event := range received[:4] {
+		assembled.WriteString(event.Delta)
+	}
+	for _, event := range rest[:len(rest)-1] {
+		assembled.WriteString(event.Delta)
+	}
+	if assembled.String() != reply {
+		t.Errorf("delivered up to the checkpoint plus resumed = %q, want %q", assembled.String(), reply)
+	}
+	if done := rest[len(rest)-1]; done.Type != StreamEventDone || done.Content != reply || done.MessageUID != last.UID {
+		t.Errorf("resumed stream ended with %+v, want done with the full reply", done)
+	}
+	if got := streamCheckpoint(t, "s1", last.UID); got != 7 {
+		t.Errorf("checkpoint after resuming = %d chunks, want all 7", got)
+	}
+}
+
+func TestChatStreamChanCompletedStreamRecordsEveryChunk(t *testing.T) {
+	env := newTestEnv(t)
+	StreamCheckpointChunks = 2
+	const reply = "one two three four five"
+	env.model.reply(reply)
+
+	events, err := ChatStreamChan(context.Background(), "s1", "hi")
+	if err != nil {
+		t.Fatalf("ChatStreamChan: %v", err)
+	}
+	drain(t, events)
+
+	last := env.history("s1")[2]
+	if last.Content != reply {
+		t.Errorf("stored reply = %q, want %q", last.Content, reply)
+	}
+	if got := streamCheckpoint(t, "s1", last.UID); got != 5 {
+		t.Errorf("checkpoint = %d chunks, want all 5", got)
+	}
+}
+
+func TestChatStreamChanCheckpointsOnTheInterval(t *testing.T) {
+	env := newTestEnv(t)
+	StreamCheckpointInterval = time.Second
+	env.model.reply("one two three four five")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events, err := ChatStreamChan(ctx, "s1", "hi")
+	if err != nil {
+		t.Fatalf("ChatStreamChan: %v", err)
+	}
+	receive(t, events, 1)
+	env.clock.Advance(2 * time.Second)
+	receive(t, events, 2) // The interval passed by chunk 2: checkpoint of 2 chunks
+	receive(t, events, 1) // No checkpoint after chunk 3, well within the interval
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	drain(t, events)
+
+	if got := streamCheckpoint(t, "s1", env.history("s1")[2].UID); got != 2 {
+		t.Errorf("checkpoint = %d chunks, want the interval checkpoint of 2", got)
+	}
+}
+
+func TestChatStreamChanWithoutCheckpointingWritesNothing(t *testing.T) {
+	env := newTestEnv(t)
+	const reply = "one two three four five"
+	env.model.reply(reply)
+
+	events, err := ChatStreamChan(context.Background(), "s1", "hi")
+	if err != nil {
+		t.Fatalf("ChatStreamChan: %v", err)
+	}
+	receive(t, events, 1)
+	mutations := env.store.mutationCount() // The turn is saved before the first chunk
+	drain(t, events)
+
+	if env.store.mutationCount() != mutations {
+		t.Error("the stream wrote to the store with checkpointing off")
+	}
+	if got := streamCheckpoint(t, "s1", env.history("s1")[2].UID); got != 0 {
+		t.Errorf("checkpoint = %d, want none recorded", got)
+	}
+}
+
+func TestCheckpointStreamWaitsForTheSessionLock(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hi")
+	uid := env.history("s1")[2].UID
+	mutations := env.store.mutationCount()
+
+	unlock := lockSession("s1")
+	done := make(chan error, 1)
+	go func() { done <- checkpointStream("s1", uid, 3) }()
+	time.Sleep(20 * time.Millisecond)
+	if env.store.mutationCount() != mutations {
+		t.Error("the checkpoint was written while another writer held the session lock")
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("checkpointStream: %v", err)
+	}
+	if got := streamCheckpoint(t, "s1", uid); got != 3 {
+		t.Errorf("checkpoint = %d, want 3", got)
+	}
+}
+
+func TestCheckpointStreamLeavesADeletedMessageDeleted(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hi")
+	uid := env.history("s1")[2].UID
+	if _, err := ClearChat("s1"); err != nil {
+		t.Fatalf("ClearChat: %v", err)
+	}
+
+	if err := checkpointStream("s1", uid, 3); err != nil {
+		t.Fatalf("checkpointStream: %v", err)
+	}
+	if n := env.store.totalNodes(); n != 0 {
+		t.Errorf("%d nodes after checkpointing a deleted message, want none recreated", n)
+	}
+}
+
+func TestCheckpointStreamUpsertOnlyTouchesAnExistingMessage(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hi")
+
+	if err := checkpointStream("s1", env.history("s1")[2].UID, 3); err != nil {
+		t.Fatalf("checkpointStream: %v", err)
+	}
+
+	query, conditions := env.store.lastUpsert("checkpointStream")
+	if want := map[string]string{"uid(message)": "@if(gt(len(message), 0))"}; !reflect.DeepEqual(conditions, want) {
+		t.Errorf("conditions = %v, want %v", conditions, want)
+	}
+	if !strings.Contains(query, "@filter(type(ChatMessage))") {
+		t.Errorf("the checkpoint can match nodes other than messages:\n%s", query)
+	}
+}
+
+func TestResumeChatStreamWithoutACheckpointSendsTheWholeReply(t *testing.T) {
+	env := newTestEnv(t)
+	const reply = "one two three"
+	env.model.reply(reply)
+	env.chat("s1", "hi")
+
+	events, err := ResumeChatStream(context.Background(), "s1", env.history("s1")[2].UID)
+	if err != nil {
+		t.Fatalf("ResumeChatStream: %v", err)
+	}
+	got := drain(t, events)
+	if len(got) != 4 || got[0].Delta != "one " || got[3].Type != StreamEventDone || got[3].Content != reply {
+		t.Errorf("events = %+v, want every chunk and done", got)
+	}
+
+	if _, err := ResumeChatStream(context.Background(), "other", env.history("s1")[2].UID); err == nil {
+		t.Error("resuming a message of another session succeeded")
+	}
+}
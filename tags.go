@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// normalizeTag trims a tag and rejects blank ones.
+// ChatSession.tags is a list predicate, which Dgraph stores as a set, so re-adding a tag is a no-op.
+func normalizeTag(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return "", fmt.Errorf("tag must not be empty")
+	}
+	return tag, nil
+}
+
+// AddSessionTag attaches a freeform tag to an existing session
+func AddSessionTag(sessionID string, tag string) error {
+	return updateSessionTag(sessionID, tag, true)
+}
+
+// RemoveSessionTag detaches a tag from a session. Removing a tag the session doesn't have is not an error.
+func RemoveSessionTag(sessionID string, tag string) error {
+	return updateSessionTag(sessionID, tag, false)
+}
+
+func updateSessionTag(sessionID string, tag string, add bool) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return err
+	}
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return err
+	}
+
+	unlock := lockSession(sessionID)
+	defer unlock()
+
+	sessionUID, err := findSessionUID(sessionID)
+	if err != nil {
+		return err
+	}
+
+	nquad := fmt.Sprintf("<%s> <ChatSession.tags> \"%s\" .\n", sessionUID, dgraph.EscapeRDF(tag))
+	mutation := &dgraph.Mutation{}
+	if add {
+		mutation.SetNquads = nquad
+	} else {
+		mutation.DelNquads = nquad
+	}
+	if _, err := executeMutations(dgraphConnectionName, mutation); err != nil {
+		return fmt.Errorf("%w: dgraph.ExecuteMutations failed updating tag %q on session %s: %w", ErrStorageFailure, tag, sessionID, err)
+	}
+	return nil
+}
+
+// ListSessionsByTag returns the sessions carrying the tag, most recently active first
+func ListSessionsByTag(tag string) ([]SessionInfo, error) {
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        query listSessionsByTag($tag: string) {
+            sessions(func: eq(ChatSession.tags, $tag)) @filter(type(ChatSession)) {` + sessionInfoFields + `
+            }
+        }
+    `
+	return querySessionInfos(query, map[string]string{"$tag": tag})
+}
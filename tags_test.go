@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSessionTagsAddRemoveAndList(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("tagged", "hello")
+	env.chat("untagged", "hello")
+
+	for _, tag := range []string{" work ", "urgent", "work"} {
+		if err := AddSessionTag("tagged", tag); err != nil {
+			t.Fatalf("AddSessionTag(%q): %v", tag, err)
+		}
+	}
+	if err := RemoveSessionTag("tagged", "urgent"); err != nil {
+		t.Fatalf("RemoveSessionTag: %v", err)
+	}
+
+	sessions, err := ListSessionsByTag("work")
+	if err != nil {
+		t.Fatalf("ListSessionsByTag: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "tagged" {
+		t.Fatalf("ListSessionsByTag(work) = %+v, want only the tagged session", sessions)
+	}
+	if !slices.Equal(sessions[0].Tags, []string{"work"}) {
+		t.Errorf("tags = %q, want the trimmed, de-duplicated [work]", sessions[0].Tags)
+	}
+
+	removed, err := ListSessionsByTag("urgent")
+	if err != nil {
+		t.Fatalf("ListSessionsByTag: %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("ListSessionsByTag(urgent) = %+v, want none after removal", removed)
+	}
+}
+
+func TestSessionTagsRejectBlankTagsAndUnknownSessions(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("s1", "hello")
+
+	if err := AddSessionTag("s1", "   "); err == nil {
+		t.Error("AddSessionTag accepted a blank tag")
+	}
+	if err := AddSessionTag("missing", "work"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("AddSessionTag on a missing session = %v, want ErrSessionNotFound", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SystemPromptTemplate, when set, replaces the default system prompt for new sessions.
+// It may contain {{variable}} placeholders, filled from ChatOptions.TemplateVars when the session is created;
+// the rendered prompt is what gets stored, so later turns are unaffected by changes to the template.
+var SystemPromptTemplate = ""
+
+// StrictTemplateVars makes a placeholder without a matching TemplateVars entry an error.
+// When false, such placeholders render as empty strings.
+var StrictTemplateVars = false
+
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// renderTemplate substitutes every {{name}} placeholder in tmpl with vars[name]
+func renderTemplate(tmpl string, vars map[string]string, strict bool) (string, error) {
+	var missing []string
+	rendered := templatePlaceholder.ReplaceAllStringFunc(tmpl, func(placeholder string) string {
+		name := templatePlaceholder.FindStringSubmatch(placeholder)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if strict && len(missing) > 0 {
+		return "", fmt.Errorf("%w: missing template variables: %s", ErrInvalidOptions, strings.Join(missing, ", "))
+	}
+	return rendered, nil
+}
+
+// resolveSystemPrompt returns the system message(s) for a turn, by precedence:
+//  1. the per-request prompt: ChatOptions.SystemPrompt, else ChatOptions.SystemMessages, rendered with TemplateVars
+//  2. sessionPrompt, the prompt the session stored when it was created (already rendered)
+//  3. the package default: SystemPromptTemplate, else the default system prompt, rendered with TemplateVars
+//
+// Blank values count as unset, so an empty per-request prompt never overrides a stored one.
+// fromSession reports that the stored prompt was chosen, i.e. that the session's own messages already carry it.
+func resolveSystemPrompt(opts ChatOptions, sessionPrompt string) (prompts []string, fromSession bool, err error) {
+	var templates []string
+	switch {
+	case strings.TrimSpace(opts.SystemPrompt) != "":
+		templates = []string{opts.SystemPrompt}
+	case len(opts.SystemMessages) > 0:
+		templates = opts.SystemMessages
+	case strings.TrimSpace(sessionPrompt) != "":
+		return []string{sessionPrompt}, true, nil
+	case SystemPromptTemplate != "":
+		templates = []string{SystemPromptTemplate}
+	default:
+		templates = []string{defaultSystemPrompt}
+	}
+
+	prompts = make([]string, len(templates))
+	for i, tmpl := range templates {
+		rendered, err := renderTemplate(tmpl, opts.TemplateVars, StrictTemplateVars)
+		if err != nil {
+			return nil, false, err
+		}
+		prompts[i] = rendered
+	}
+	return prompts, false, nil
+}
+
+// leadingSystemMessages counts the system messages a history starts with: the prompt(s) the session was created with
+func leadingSystemMessages(history []DgraphChatMessage) int {
+	n := 0
+	for n < len(history) && history[n].Role == "system" && !history[n].Summary {
+		n++
+	}
+	return n
+}
+
+// storedSystemPrompt joins a session's leading system messages the way ChatSession.systemPrompt stores them
+func storedSystemPrompt(history []DgraphChatMessage) string {
+	var prompts []string
+	for _, msg := range history[:leadingSystemMessages(history)] {
+		prompts = append(prompts, msg.Content)
+	}
+	return strings.Join(prompts, "\n\n")
+}
+
+// replaceSystemPrompts returns history with its leading system messages swapped for prompts, stamped with
+// timestamp. Like examples, replacements only live in the model input; the input slice is not modified.
+func replaceSystemPrompts(history []DgraphChatMessage, prompts []string, timestamp time.Time) []DgraphChatMessage {
+	replaced := make([]DgraphChatMessage, 0, len(prompts)+len(history))
+	for _, prompt := range prompts {
+		replaced = append(replaced, DgraphChatMessage{Role: "system", Content: prompt, Timestamp: timestamp})
+	}
+	return append(replaced, history[leadingSystemMessages(history):]...)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSystemPromptTemplateInterpolatesAndStoresTheRenderedPrompt(t *testing.T) {
+	env := newTestEnv(t)
+	SystemPromptTemplate = "You are helping {{ name }}. Today is {{date}}."
+	vars := map[string]string{"name": "Ana", "date": "2025-01-02"}
+
+	env.chatWith("s1", "hello", ChatOptions{TemplateVars: vars})
+
+	const rendered = "You are helping Ana. Today is 2025-01-02."
+	if sent := env.model.lastCall(t).Messages[0]; sent != (fakeMessage{Role: "system", Content: rendered}) {
+		t.Errorf("system message sent = %+v, want %q", sent, rendered)
+	}
+	if stored := env.history("s1")[0].Content; stored != rendered {
+		t.Errorf("stored system prompt = %q, want the rendered %q", stored, rendered)
+	}
+
+	// Later turns reuse the stored prompt, even when the template changes
+	SystemPromptTemplate = "Changed {{name}}"
+	env.chat("s1", "again")
+	if sent := env.model.lastCall(t).Messages[0].Content; sent != rendered {
+		t.Errorf("second turn system prompt = %q, want the stored %q", sent, rendered)
+	}
+}
+
+func TestMissingTemplateVariables(t *testing.T) {
+	env := newTestEnv(t)
+	SystemPromptTemplate = "Hi {{name}}, it is {{date}}."
+
+	StrictTemplateVars = false
+	env.chatWith("lenient", "hello", ChatOptions{TemplateVars: map[string]string{"name": "Ana"}})
+	if sent := env.model.lastCall(t).Messages[0].Content; sent != "Hi Ana, it is ." {
+		t.Errorf("lenient rendering = %q, want the missing variable left blank", sent)
+	}
+
+	StrictTemplateVars = true
+	if _, err := ChatWithOptions("strict", "hello", ChatOptions{TemplateVars: map[string]string{"name": "Ana"}}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("strict rendering error = %v, want ErrInvalidOptions", err)
+	}
+}
+
+func TestSystemMessagesAreSentInOrderAndStoredSeparately(t *testing.T) {
+	env := newTestEnv(t)
+	opts := ChatOptions{SystemMessages: []string{"You are a pirate.", "Answer in one line."}}
+
+	env.chatWith("s1", "hello", opts)
+
+	sent := env.model.lastCall(t).Messages
+	if got, want := contents(sent[:3]), []string{"You are a pirate.", "Answer in one line.", "hello"}; !slices.Equal(got, want) {
+		t.Errorf("model input = %q, want both system messages first, in order", got)
+	}
+	if sent[0].Role != "system" || sent[1].Role != "system" {
+		t.Errorf("roles = %q, %q, want system", sent[0].Role, sent[1].Role)
+	}
+	history := env.history("s1")
+	if history[0].Role != "system" || history[1].Role != "system" || history[0].Content != "You are a pirate." || history[1].Content != "Answer in one line." {
+		t.Errorf("stored history starts %+v, %+v, want one system node per message", history[0], history[1])
+	}
+
+	// Later turns' system messages override the stored ones for that turn only
+	env.chatWith("s1", "again", ChatOptions{SystemMessages: []string{"You are a poet."}})
+	if got := contents(env.model.lastCall(t).Messages[:2]); !slices.Equal(got, []string{"You are a poet.", "hello"}) {
+		t.Errorf("second turn starts %q, want the per-request system message in place of the stored ones", got)
+	}
+	env.chat("s1", "once more")
+	if got := contents(env.model.lastCall(t).Messages[:2]); !slices.Equal(got, []string{"You are a pirate.", "Answer in one line."}) {
+		t.Errorf("third turn system messages = %q, want the stored ones", got)
+	}
+	if got := messageContents(env.history("s1")[:2]); !slices.Equal(got, []string{"You are a pirate.", "Answer in one line."}) {
+		t.Errorf("stored system messages = %q, want them unchanged", got)
+	}
+}
+
+func TestBlankSystemMessageIsRejected(t *testing.T) {
+	env := newTestEnv(t)
+
+	_, err := ChatWithOptions("s1", "hello", ChatOptions{SystemMessages: []string{"fine", "  "}})
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("error = %v, want ErrInvalidOptions", err)
+	}
+	if n := env.model.callCount(); n != 0 {
+		t.Errorf("model called %d times for invalid options", n)
+	}
+}
+
+func TestResolveSystemPromptPrecedence(t *testing.T) {
+	newTestEnv(t)
+	defaultSystemPrompt = "package default"
+	vars := map[string]string{"name": "Ana"}
+
+	tests := []struct {
+		name          string
+		opts          ChatOptions
+		sessionPrompt string
+		template      string
+		want          []string
+		fromSession   bool
+	}{
+		{"request over session", ChatOptions{SystemPrompt: "request for {{name}}", TemplateVars: vars}, "stored", "", []string{"request for Ana"}, false},
+		{"request over default", ChatOptions{SystemPrompt: "request"}, "", "", []string{"request"}, false},
+		{"empty request keeps the session's", ChatOptions{SystemPrompt: ""}, "stored", "", []string{"stored"}, true},
+		{"blank request keeps the session's", ChatOptions{SystemPrompt: "  \n"}, "stored", "", []string{"stored"}, true},
+		{"session over default", ChatOptions{}, "stored", "template", []string{"stored"}, true},
+		{"system messages over session", ChatOptions{SystemMessages: []string{"m1", "m2"}}, "stored", "template", []string{"m1", "m2"}, false},
+		{"request prompt over system messages", ChatOptions{SystemPrompt: "request", SystemMessages: []string{"m1"}}, "stored", "", []string{"request"}, false},
+		{"blank session falls back", ChatOptions{}, " ", "", []string{"package default"}, false},
+		{"system messages", ChatOptions{SystemMessages: []string{"m1", "m2 {{name}}"}, TemplateVars: vars}, "", "template", []string{"m1", "m2 Ana"}, false},
+		{"template", ChatOptions{TemplateVars: vars}, "", "hi {{name}}", []string{"hi Ana"}, false},
+		{"package default", ChatOptions{}, "", "", []string{"package default"}, false},
+	}
+	for _, tt := range tests {
+		SystemPromptTemplate = tt.template
+		got, fromSession, err := resolveSystemPrompt(tt.opts, tt.sessionPrompt)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) || fromSession != tt.fromSession {
+			t.Errorf("%s: resolveSystemPrompt = %q, fromSession %v; want %q, %v", tt.name, got, fromSession, tt.want, tt.fromSession)
+		}
+	}
+}
+
+func TestPerRequestSystemPromptOverridesTheStoredOneForThatTurnOnly(t *testing.T) {
+	env := newTestEnv(t)
+	env.chatWith("s1", "hello", ChatOptions{SystemPrompt: "session prompt"})
+
+	env.chatWith("s1", "override", ChatOptions{SystemPrompt: "request prompt"})
+	if got := env.model.lastCall(t).Messages[0].Content; got != "request prompt" {
+		t.Errorf("model saw system prompt %q, want the per-request one", got)
+	}
+
+	env.chatWith("s1", "plain", ChatOptions{SystemPrompt: ""})
+	if got := env.model.lastCall(t).Messages[0].Content; got != "session prompt" {
+		t.Errorf("model saw system prompt %q, want the stored one", got)
+	}
+	if got := env.history("s1")[0].Content; got != "session prompt" {
+		t.Errorf("stored system prompt = %q, want it unchanged", got)
+	}
+}
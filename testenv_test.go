@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// testEnv is an isolated package state for one test: an in-memory store, a scripted model and a manual clock
+type testEnv struct {
+	t     testing.TB
+	store *fakeStore
+	model *fakeModel
+	clock *fakeClock
+}
+
+// newTestEnv installs the fakes and restores every package-level setting when the test ends,
+// so tests can change globals freely. Tests using it must not run in parallel.
+func newTestEnv(t testing.TB) *testEnv {
+	t.Helper()
+
+	preserve(t, &AllowDestructiveOps)
+	preserve(t, &BlocklistMode)
+	preserve(t, &blocklistPattern)
+	preserve(t, &TurnTimeout)
+	preserve(t, &EnableResponseCache)
+	preserve(t, &ResponseCacheTTL)
+	preserve(t, &ResponseCacheMaxSize)
+	preserve(t, &emptyCompletionRetries)
+	preserve(t, &ModelSlotTimeout)
+	preserve(t, &DuplicateMessageWindow)
+	preserve(t, &ContextDocumentTemplate)
+	preserve(t, &ContextDocumentsPreamble)
+	preserve(t, &EnableEntityExtraction)
+	preserve(t, &entityExtractor)
+	preserve(t, &PersistTurnErrors)
+	preserve(t, &EnableFallback)
+	preserve(t, &FallbackResponse)
+	preserve(t, &modelChain)
+	preserve(t, &AllowedModels)
+	preserve(t, &ApplySchemaOnWarmUp)
+	preserve(t, &languageDetector)
+	savedLogger := loadLogger()
+	t.Cleanup(func() { SetLogger(savedLogger) })
+	preserve(t, &dgraphConnectionName)
+	preserve(t, &defaultSystemPrompt)
+	preserve(t, &defaultTemperature)
+	preserve(t, &WriteAheadUserMessage)
+	preserve(t, &DebugIncludePrompt)
+	preserve(t, &EnableSemanticMemory)
+	preserve(t, &embedder)
+	preserve(t, &metrics)
+	preserve(t, &ModerationFallbackMessage)
+	preserve(t, &moderator)
+	preserve(t, &RateLimit)
+	preserve(t, &RateLimitWindow)
+	preserve(t, &EnableRedaction)
+	preserve(t, &RedactLLMInput)
+	preserve(t, &PIIDetectors)
+	preserve(t, &MaxMessagesPerSession)
+	preserve(t, &SanitizerPrefixes)
+	preserve(t, &sentimentAnalyzer)
+	preserve(t, &SystemPromptTemplate)
+	preserve(t, &StrictTemplateVars)
+	preserve(t, &MaxResponseChars)
+	preserve(t, &StoreUntruncatedResponse)
+	preserve(t, &MaxUserMessageLength)
+	preserve(t, &UserMessageLengthMode)
+	preserve(t, &UserTruncationNote)
+	preserve(t, &StreamCheckpointChunks)
+	preserve(t, &StreamCheckpointInterval)
+	preserve(t, &clock)
+	preserve(t, &executeDgraph)
+	preserve(t, &alterDgraphSchema)
+	preserve(t, &invokeChatModel)
+	preserve(t, &loadChatModel)
+
+	resetRegistries := func() {
+		ClearPostProcessors()
+		ClearMessageSubscribers()
+		ClearResponseCache()
+		InvalidateModelCache()
+		_ = SetMaxConcurrentModelCalls(0)
+		roleHandlersMu.Lock()
+		roleHandlers = maps.Clone(builtinRoleHandlers)
+		roleHandlersMu.Unlock()
+		rateLimiterMu.Lock()
+		rateBuckets = map[string]*tokenBucket{}
+		rateLimiterMu.Unlock()
+	}
+	resetRegistries()
+	t.Cleanup(resetRegistries)
+
+	env := &testEnv{
+		t:     t,
+		store: newFakeStore(t),
+		model: &fakeModel{},
+		clock: &fakeClock{now: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), step: time.Millisecond},
+	}
+	executeDgraph = env.store.execute
+	alterDgraphSchema = env.store.alter
+	invokeChatModel = env.model.invoke
+	clock = env.clock.Now
+	return env
+}
+
+// preserve restores *p to its current value when the test ends
+func preserve[T any](t testing.TB, p *T) {
+	saved := *p
+	t.Cleanup(func() { *p = saved })
+}
+
+// withValue sets *p to v for the rest of the test
+func withValue[T any](t testing.TB, p *T, v T) {
+	preserve(t, p)
+	*p = v
+}
+
+// chat runs one Chat turn and fails the test on error
+func (env *testEnv) chat(sessionID string, message string) *ChatResponse {
+	env.t.Helper()
+	resp, err := Chat(sessionID, message)
+	if err != nil {
+		env.t.Fatalf("Chat(%q, %q): %v", sessionID, message, err)
+	}
+	return resp
+}
+
+// chatWith runs one ChatWithOptions turn and fails the test on error
+func (env *testEnv) chatWith(sessionID string, message string, opts ChatOptions) *ChatResponse {
+	env.t.Helper()
+	resp, err := ChatWithOptions(sessionID, message, opts)
+	if err != nil {
+		env.t.Fatalf("ChatWithOptions(%q, %q): %v", sessionID, message, err)
+	}
+	return resp
+}
+
+// history loads a session's stored messages and fails the test on error
+func (env *testEnv) history(sessionID string) []DgraphChatMessage {
+	env.t.Helper()
+	messages, err := loadHistoryFromDgraph(context.Background(), sessionID)
+	if err != nil {
+		env.t.Fatalf("loading history of %s: %v", sessionID, err)
+	}
+	return messages
+}
+
+// fakeClock is a manual clock that also moves forward by step on every reading, so latencies are positive
+type fakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// fakeModel answers model calls from respond when set, otherwise from replies in order,
+// repeating the last one; with neither it answers "ok"
+type fakeModel struct {
+	mu      sync.Mutex
+	respond func(call fakeModelCall) (*openai.ChatModelOutput, error)
+	replies []*openai.ChatModelOutput
+	calls   []fakeModelCall
+}
+
+// fakeModelCall is one model invocation
+type fakeModelCall struct {
+	Model    string // The name the model was resolved by
+	Input    *openai.ChatModelInput
+	Messages []fakeMessage
+}
+
+// fakeMessage is a request message as the model receives it
+type fakeMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func (m *fakeModel) invoke(model *openai.ChatModel, input *openai.ChatModelInput) (*openai.ChatModelOutput, error) {
+	call := fakeModelCall{Model: model.Info().Name, Input: input, Messages: decodeRequestMessages(input.Messages)}
+
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	respond := m.respond
+	var reply *openai.ChatModelOutput
+	if len(m.replies) > 0 {
+		reply = m.replies[0]
+		if len(m.replies) > 1 {
+			m.replies = m.replies[1:]
+		}
+	}
+	m.mu.Unlock()
+
+	if respond != nil {
+		return respond(call)
+	}
+	if reply == nil {
+		reply = textOutput("ok")
+	}
+	copied := *reply
+	copied.Choices = append([]openai.Choice(nil), reply.Choices...)
+	return &copied, nil
+}
+
+// reply queues text answers, one per call
+func (m *fakeModel) reply(contents ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, content := range contents {
+		m.replies = append(m.replies, textOutput(content))
+	}
+}
+
+// callCount returns how many times the model was invoked
+func (m *fakeModel) callCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.calls)
+}
+
+// lastCall returns the most recent invocation
+func (m *fakeModel) lastCall(t testing.TB) fakeModelCall {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.calls) == 0 {
+		t.Fatal("the model was never called")
+	}
+	return m.calls[len(m.calls)-1]
+}
+
+// textOutput is a single-choice completion that stopped naturally
+func textOutput(content string) *openai.ChatModelOutput {
+	return outputWithChoices("stop", content)
+}
+
+// outputWithChoices is a completion with one choice per content, all with the same finish reason
+func outputWithChoices(finishReason string, contents ...string) *openai.ChatModelOutput {
+	output := &openai.ChatModelOutput{
+		Model: "fake",
+		Usage: openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}
+	for i, content := range contents {
+		output.Choices = append(output.Choices, openai.Choice{
+			Index:        i,
+			FinishReason: finishReason,
+			Message:      openai.CompletionMessage{Content: content},
+		})
+	}
+	return output
+}
+
+func decodeRequestMessages(messages []openai.RequestMessage) []fakeMessage {
+	decoded := make([]fakeMessage, 0, len(messages))
+	for _, msg := range messages {
+		var m fakeMessage
+		if raw, err := json.Marshal(msg); err == nil {
+			_ = json.Unmarshal(raw, &m)
+		}
+		decoded = append(decoded, m)
+	}
+	return decoded
+}
+
+// contents returns the content of each message, in order
+func contents(messages []fakeMessage) []string {
+	out := make([]string, len(messages))
+	for i, m := range messages {
+		out[i] = m.Content
+	}
+	return out
+}
+
+// saveLocked seeds messages the way production callers save them, under the session lock
+func saveLocked(sessionID string, owner string, messages []DgraphChatMessage) (*savedMessages, error) {
+	unlock := lockSession(sessionID)
+	defer unlock()
+	return saveNewMessagesToDgraph(context.Background(), sessionID, owner, messages)
+}
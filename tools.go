@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// ToolDefinition describes a function the model may call
+type ToolDefinition struct {
+	Name             string `json:"name"`
+	Description      string `json:"description,omitempty"`
+	ParametersSchema string `json:"parametersSchema,omitempty"` // JSON Schema describing the function arguments
+}
+
+// ToolCall is a function call requested by the model in place of (or alongside) text content
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON-encoded arguments, exactly as produced by the model
+}
+
+// toOpenAITools converts our tool definitions into the SDK's representation
+func toOpenAITools(defs []ToolDefinition) []openai.Tool {
+	if len(defs) == 0 {
+		return nil
+	}
+	tools := make([]openai.Tool, 0, len(defs))
+	for _, d := range defs {
+		tool := openai.NewToolForFunction(d.Name, d.Description)
+		if d.ParametersSchema != "" {
+			tool = tool.WithParametersSchema(d.ParametersSchema)
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// fromOpenAIToolCalls converts the tool calls on a completion into our ToolCall type
+func fromOpenAIToolCalls(calls []openai.ToolCall) []ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	toolCalls := make([]ToolCall, 0, len(calls))
+	for _, c := range calls {
+		toolCalls = append(toolCalls, ToolCall{
+			ID:        c.Id,
+			Name:      c.Function.Name,
+			Arguments: c.Function.Arguments,
+		})
+	}
+	return toolCalls
+}
+
+// toOpenAIToolCalls converts stored tool calls back into the SDK's representation so they can be replayed
+func toOpenAIToolCalls(calls []ToolCall) []openai.ToolCall {
+	sdkCalls := make([]openai.ToolCall, 0, len(calls))
+	for _, c := range calls {
+		sdkCalls = append(sdkCalls, openai.ToolCall{
+			Id:   c.ID,
+			Type: "function",
+			Function: openai.FunctionCall{
+				Name:      c.Name,
+				Arguments: c.Arguments,
+			},
+		})
+	}
+	return sdkCalls
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+func TestChatSurfacesAndStoresToolCalls(t *testing.T) {
+	env := newTestEnv(t)
+	output := outputWithChoices("tool_calls", "")
+	output.Choices[0].Message.ToolCalls = []openai.ToolCall{{
+		Id:       "call_1",
+		Type:     "function",
+		Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"Lisbon"}`},
+	}}
+	env.model.replies = []*openai.ChatModelOutput{output}
+
+	resp := env.chatWith("s1", "weather in Lisbon?", ChatOptions{Tools: []ToolDefinition{{
+		Name:             "get_weather",
+		Description:      "Current weather for a city",
+		ParametersSchema: `{"type":"object","properties":{"city":{"type":"string"}}}`,
+	}}})
+
+	want := []ToolCall{{ID: "call_1", Name: "get_weather", Arguments: `{"city":"Lisbon"}`}}
+	if !reflect.DeepEqual(resp.ToolCalls, want) {
+		t.Errorf("ToolCalls = %+v, want %+v", resp.ToolCalls, want)
+	}
+	tools := env.model.lastCall(t).Input.Tools
+	if len(tools) != 1 || tools[0].Function.Name != "get_weather" {
+		t.Errorf("model input tools = %+v, want get_weather", tools)
+	}
+
+	history := env.history("s1")
+	last := history[len(history)-1]
+	if last.Role != "tool" || !reflect.DeepEqual(last.ToolCalls, want) {
+		t.Errorf("stored turn = role %q, tool calls %+v; want role tool with %+v", last.Role, last.ToolCalls, want)
+	}
+}
+
+func TestStoredToolCallsAreReplayedToTheModel(t *testing.T) {
+	env := newTestEnv(t)
+	output := outputWithChoices("tool_calls", "")
+	output.Choices[0].Message.ToolCalls = []openai.ToolCall{{
+		Id:       "call_1",
+		Type:     "function",
+		Function: openai.FunctionCall{Name: "get_weather", Arguments: `{}`},
+	}}
+	env.model.replies = []*openai.ChatModelOutput{output, textOutput("It is sunny")}
+	opts := ChatOptions{Tools: []ToolDefinition{{Name: "get_weather"}}}
+
+	env.chatWith("s1", "weather?", opts)
+	resp := env.chatWith("s1", "and now?", opts)
+	if resp.Content != "It is sunny" || len(resp.ToolCalls) != 0 {
+		t.Errorf("second turn = %q with tool calls %+v, want plain content", resp.Content, resp.ToolCalls)
+	}
+	if n := len(env.model.lastCall(t).Input.Messages); n != 4 {
+		t.Errorf("second turn sent %d messages, want system, user, tool call and user", n)
+	}
+}
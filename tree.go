@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/dgraph"
+)
+
+// maxSessionTreeDepth bounds how many generations of forks GetSessionTree follows
+const maxSessionTreeDepth = 32
+
+// SessionTreeNode is a session and the sessions forked from it
+type SessionTreeNode struct {
+	SessionID string             `json:"sessionID"`
+	Title     string             `json:"title,omitempty"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Children  []*SessionTreeNode `json:"children,omitempty"` // Forks of this session, oldest first
+}
+
+// linkParentSession records the ChatSession.parentSession edge from a fork to the session it was forked from
+func linkParentSession(sessionID string, parentSessionID string) error {
+	query := `
+        query findSessions($sessionID: string, $parentSessionID: string) {
+            child as var(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession))
+            parent as var(func: eq(ChatSession.sessionID, $parentSessionID)) @filter(type(ChatSession))
+        }
+    `
+	vars := map[string]string{
+		"$sessionID":       sessionID,
+		"$parentSessionID": parentSessionID,
+	}
+	// Setting on an empty uid variable would create a node, so only link when both sessions exist
+	mutation := &dgraph.Mutation{
+		SetNquads: "uid(child) <ChatSession.parentSession> uid(parent) .",
+		Condition: "@if(eq(len(child), 1) AND eq(len(parent), 1))",
+	}
+	if _, err := executeQuery(dgraphConnectionName, &dgraph.Query{Query: query, Variables: vars}, mutation); err != nil {
+		return fmt.Errorf("%w: dgraph.ExecuteQuery failed linking session %s to parent %s: %w", ErrStorageFailure, sessionID, parentSessionID, err)
+	}
+	return nil
+}
+
+// GetSessionTree returns the session and, recursively, every session forked from it.
+// It returns ErrSessionNotFound when the root session doesn't exist.
+func GetSessionTree(rootSessionID string) (*SessionTreeNode, error) {
+	if err := validateSessionID(rootSessionID); err != nil {
+		return nil, err
+	}
+
+	// @recurse follows the reverse parent edge down through every generation of forks
+	query := fmt.Sprintf(`
+        query getSessionTree($sessionID: string) {
+            tree(func: eq(ChatSession.sessionID, $sessionID)) @filter(type(ChatSession)) @recurse(depth: %d, loop: false) {
+                ChatSession.sessionID
+                ChatSession.title
+                ChatSession.createdAt
+                ~ChatSession.parentSession
+            }
+        }
+    `, maxSessionTreeDepth+1)
+	vars := map[string]string{"$sessionID": rootSessionID}
+
+	resp, err := executeQuery(dgraphConnectionName, &dgraph.Query{
+		Query:     query,
+		Variables: vars,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: dgraph.ExecuteQuery failed loading tree of session %s: %w", ErrStorageFailure, rootSessionID, err)
+	}
+
+	var queryResult struct {
+		Tree []sessionTreeResult `json:"tree"`
+	}
+	if err := json.Unmarshal([]byte(resp.Json), &queryResult); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal tree of session %s: %w. JSON: %s", ErrStorageFailure, rootSessionID, err, string(resp.Json))
+	}
+	if len(queryResult.Tree) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, rootSessionID)
+	}
+	return queryResult.Tree[0].toNode(), nil
+}
+
+// sessionTreeResult is one level of the @recurse response, keyed by predicate name since @recurse takes no aliases
+type sessionTreeResult struct {
+	SessionID string              `json:"ChatSession.sessionID"`
+	Title     string              `json:"ChatSession.title"`
+	CreatedAt time.Time           `json:"ChatSession.createdAt"`
+	Children  []sessionTreeResult `json:"~ChatSession.parentSession"`
+}
+
+func (r sessionTreeResult) toNode() *SessionTreeNode {
+	node := &SessionTreeNode{SessionID: r.SessionID, Title: r.Title, CreatedAt: r.CreatedAt}
+	for _, child := range r.Children {
+		node.Children = append(node.Children, child.toNode())
+	}
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		return node.Children[i].CreatedAt.Before(node.Children[j].CreatedAt)
+	})
+	return node
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fork forks sessionID whole and fails the test on error
+func fork(t *testing.T, sessionID string) string {
+	t.Helper()
+	forkID, err := ForkSession(sessionID, "")
+	if err != nil {
+		t.Fatalf("ForkSession(%s): %v", sessionID, err)
+	}
+	return forkID
+}
+
+func TestGetSessionTreeFollowsForksThroughGenerations(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("root", "hello")
+	first := fork(t, "root")
+	env.clock.Advance(time.Minute)
+	second := fork(t, "root")
+	grandchild := fork(t, first)
+
+	tree, err := GetSessionTree("root")
+	if err != nil {
+		t.Fatalf("GetSessionTree: %v", err)
+	}
+
+	if tree.SessionID != "root" || len(tree.Children) != 2 {
+		t.Fatalf("tree = %+v, want root with two forks", tree)
+	}
+	if tree.Children[0].SessionID != first || tree.Children[1].SessionID != second {
+		t.Errorf("children = %s, %s, want %s then %s, oldest first", tree.Children[0].SessionID, tree.Children[1].SessionID, first, second)
+	}
+	if kids := tree.Children[0].Children; len(kids) != 1 || kids[0].SessionID != grandchild || len(kids[0].Children) != 0 {
+		t.Errorf("first fork's children = %+v, want only %s", kids, grandchild)
+	}
+	if len(tree.Children[1].Children) != 0 {
+		t.Errorf("second fork has children %+v, want none", tree.Children[1].Children)
+	}
+}
+
+func TestForkSessionLinksTheParentEdge(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("root", "hello")
+	forkID := fork(t, "root")
+
+	rootUID := env.store.find("ChatSession", "ChatSession.sessionID", "root")[0]
+	forkUID := env.store.find("ChatSession", "ChatSession.sessionID", forkID)[0]
+	if parent, _ := env.store.value(forkUID, "ChatSession.parentSession").([]uint64); len(parent) != 1 || formatUID(parent[0]) != rootUID {
+		t.Errorf("ChatSession.parentSession = %v, want an edge to %s", parent, rootUID)
+	}
+	if parent := env.store.value(rootUID, "ChatSession.parentSession"); parent != nil {
+		t.Errorf("the root has parent %v", parent)
+	}
+}
+
+func TestGetSessionTreeOfAnUnforkedSessionIsALeaf(t *testing.T) {
+	env := newTestEnv(t)
+	env.chat("solo", "hello")
+
+	tree, err := GetSessionTree("solo")
+	if err != nil {
+		t.Fatalf("GetSessionTree: %v", err)
+	}
+	if tree.SessionID != "solo" || tree.Children != nil {
+		t.Errorf("tree = %+v, want a single leaf", tree)
+	}
+}
+
+func TestGetSessionTreeOfAMissingSession(t *testing.T) {
+	newTestEnv(t)
+
+	if _, err := GetSessionTree("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("error = %v, want ErrSessionNotFound", err)
+	}
+}
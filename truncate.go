@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxResponseChars caps the length, in characters (runes), of the assistant content Chat returns and stores.
+// Longer responses are cut and end with responseEllipsis. Zero or a negative value disables the cap.
+var MaxResponseChars = 0
+
+// StoreUntruncatedResponse additionally keeps the full response as ChatMessage.fullContent when it is truncated
+var StoreUntruncatedResponse = false
+
+const responseEllipsis = "…"
+
+// truncateResponse shortens content to at most limit runes, including the ellipsis, and reports whether it did.
+// The cut never splits a multibyte character and backs off so that joiners, variation selectors and
+// combining marks stay attached to the character they modify. A code fence left open by the cut is closed
+// after the ellipsis, so Markdown renderers don't swallow the rest of the page.
+func truncateResponse(content string, limit int) (string, bool) {
+	if limit <= 0 || utf8.RuneCountInString(content) <= limit {
+		return content, false
+	}
+
+	runes := []rune(content)
+	cut := max(limit-utf8.RuneCountInString(responseEllipsis), 0)
+	for cut > 0 && (isClusterContinuation(runes[cut]) || runes[cut-1] == '\u200d') {
+		cut--
+	}
+
+	truncated := strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + responseEllipsis
+	if strings.Count(truncated, "```")%2 == 1 {
+		truncated += "\n```"
+	}
+	return truncated, true
+}
+
+// isClusterContinuation reports whether r only makes sense attached to the rune before it
+func isClusterContinuation(r rune) bool {
+	return r == '\u200d' || // Zero-width joiner
+		(r >= '\ufe00' && r <= '\ufe0f') || // Variation selectors
+		(r >= 0x1f3fb && r <= 0x1f3ff) || // Emoji skin-tone modifiers
+		unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r)
+}
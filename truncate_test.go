@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateResponseCutsAtRuneBoundaries(t *testing.T) {
+	long := strings.Repeat("héllo 🙂 ", 20)
+
+	got, truncated := truncateResponse(long, 10)
+	if !truncated {
+		t.Fatal("a response over the limit was not truncated")
+	}
+	if !utf8.ValidString(got) || utf8.RuneCountInString(got) > 10 || !strings.HasSuffix(got, responseEllipsis) {
+		t.Errorf("truncateResponse = %q, want valid UTF-8 of at most 10 runes ending in %q", got, responseEllipsis)
+	}
+	if want := "héllo 🙂 h"; strings.TrimSuffix(got, responseEllipsis) != want {
+		t.Errorf("kept %q, want %q", strings.TrimSuffix(got, responseEllipsis), want)
+	}
+
+	if got, truncated := truncateResponse("🙂🙂🙂", 3); truncated || got != "🙂🙂🙂" {
+		t.Errorf("truncateResponse at the limit = %q, %v, want it unchanged", got, truncated)
+	}
+	if got, _ := truncateResponse("ab👨‍👩‍👧cd", 5); got != "ab"+responseEllipsis {
+		t.Errorf("truncateResponse split a joined emoji: %q", got)
+	}
+	if got, _ := truncateResponse("```go\nfmt.Println(\"hi\")\n```", 12); got != "```go\nfmt.P"+responseEllipsis+"\n```" {
+		t.Errorf("truncateResponse left a code fence open: %q", got)
+	}
+	if got, truncated := truncateResponse(long, 0); truncated || got != long {
+		t.Error("a zero limit truncated the response")
+	}
+}
+
+func TestChatStoresTheTruncatedResponseAndOptionallyTheFullOne(t *testing.T) {
+	env := newTestEnv(t)
+	MaxResponseChars = 8
+	StoreUntruncatedResponse = true
+	long := strings.Repeat("🙂", 50)
+	env.model.reply(long)
+
+	resp := env.chat("s1", "smile")
+	if !resp.Truncated || resp.Content != strings.Repeat("🙂", 7)+responseEllipsis {
+		t.Errorf("response = %q (truncated %v), want 7 emoji and an ellipsis", resp.Content, resp.Truncated)
+	}
+	assistant := env.history("s1")[2]
+	if !assistant.Truncated || assistant.Content != resp.Content {
+		t.Errorf("stored message = %+v, want the truncated content flagged", assistant)
+	}
+	if full := env.store.value(assistant.UID, "ChatMessage.fullContent"); full != long {
+		t.Errorf("ChatMessage.fullContent = %v, want the untruncated response", full)
+	}
+}
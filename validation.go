@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxUserMessageLength caps the number of characters (runes) accepted in a single user message.
+// Set it to zero or a negative value to disable the limit.
+var MaxUserMessageLength = 32000
+
+// What happens to a user message longer than MaxUserMessageLength
+const (
+	LengthModeReject   = "reject"   // Fail with ErrMessageTooLong
+	LengthModeTruncate = "truncate" // Cut the message to fit, ending it with UserTruncationNote
+)
+
+// UserMessageLengthMode selects how oversized user messages are handled
+var UserMessageLengthMode = LengthModeReject
+
+// UserTruncationNote ends a user message cut in LengthModeTruncate, so the model knows the text is incomplete
+var UserTruncationNote = "\n\n[The rest of this message was cut because it was too long.]"
+
+// validateSessionID rejects blank session identifiers
+func validateSessionID(sessionID string) error {
+	if strings.TrimSpace(sessionID) == "" {
+		return ErrEmptySessionID
+	}
+	return nil
+}
+
+// validateChatInput rejects blank identifiers/messages and handles oversized messages per UserMessageLengthMode.
+// It returns the message to process, which in LengthModeTruncate may be shorter, and whether it was cut.
+func validateChatInput(sessionID string, userMessage string) (string, bool, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return "", false, err
+	}
+	if strings.TrimSpace(userMessage) == "" {
+		return "", false, ErrEmptyMessage
+	}
+	if MaxUserMessageLength > 0 {
+		if n := utf8.RuneCountInString(userMessage); n > MaxUserMessageLength {
+			if UserMessageLengthMode != LengthModeTruncate {
+				return "", false, fmt.Errorf("%w: %d characters (max %d)", ErrMessageTooLong, n, MaxUserMessageLength)
+			}
+			return truncateUserMessage(userMessage, MaxUserMessageLength), true, nil
+		}
+	}
+	return userMessage, false, nil
+}
+
+// truncateUserMessage cuts message to at most limit runes, note included, on the same safe boundaries as responses
+func truncateUserMessage(message string, limit int) string {
+	room := max(limit-utf8.RuneCountInString(UserTruncationNote), 1)
+	cut, _ := truncateResponse(message, room)
+	return cut + UserTruncationNote
+}
+
+// validateUserID rejects a blank userID for the user-scoped functions
+func validateUserID(userID string) error {
+	if strings.TrimSpace(userID) == "" {
+		return ErrEmptyUserID
+	}
+	return nil
+}
+
+// maxCompletions is the upper bound accepted for ChatOptions.N
+const maxCompletions = 8
+
+// maxStopSequences matches the limit the OpenAI-compatible chat API enforces
+const maxStopSequences = 4
+
+// penaltyLimit bounds ChatOptions.PresencePenalty and FrequencyPenalty, as the OpenAI-compatible chat API does
+const penaltyLimit = 2.0
+
+// validateChatOptions rejects option combinations the model can't act on
+func validateChatOptions(opts ChatOptions) error {
+	for i, tool := range opts.Tools {
+		if strings.TrimSpace(tool.Name) == "" {
+			return fmt.Errorf("%w: tool %d has no name", ErrInvalidOptions, i)
+		}
+	}
+	if opts.RelevantMemoryK < 0 {
+		return fmt.Errorf("%w: relevantMemoryK must not be negative", ErrInvalidOptions)
+	}
+	if opts.N < 0 || opts.N > maxCompletions {
+		return fmt.Errorf("%w: n must be between 1 and %d", ErrInvalidOptions, maxCompletions)
+	}
+	if opts.PersistIndex < 0 || opts.PersistIndex >= max(opts.N, 1) {
+		return fmt.Errorf("%w: persistIndex %d is out of range for %d completions", ErrInvalidOptions, opts.PersistIndex, max(opts.N, 1))
+	}
+	if len(opts.Stop) > maxStopSequences {
+		return fmt.Errorf("%w: at most %d stop sequences are allowed, got %d", ErrInvalidOptions, maxStopSequences, len(opts.Stop))
+	}
+	for i, name := range opts.Models {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%w: model %d in chain is empty", ErrInvalidOptions, i)
+		}
+		if len(AllowedModels) > 0 && !slices.Contains(AllowedModels, name) {
+			return fmt.Errorf("%w: model %q is not in AllowedModels", ErrInvalidOptions, name)
+		}
+	}
+	for i, stop := range opts.Stop {
+		if stop == "" {
+			return fmt.Errorf("%w: stop sequence %d is empty", ErrInvalidOptions, i)
+		}
+	}
+	if opts.MaxHistoryMessages < 0 {
+		return fmt.Errorf("%w: maxHistoryMessages must not be negative", ErrInvalidOptions)
+	}
+	for i, ex := range opts.Examples {
+		if strings.TrimSpace(ex.User) == "" || strings.TrimSpace(ex.Assistant) == "" {
+			return fmt.Errorf("%w: example %d needs both a user and an assistant message", ErrInvalidOptions, i)
+		}
+	}
+	if opts.UserID != "" && strings.TrimSpace(opts.UserID) == "" {
+		return fmt.Errorf("%w: userID must not be blank", ErrInvalidOptions)
+	}
+	if opts.PresencePenalty < -penaltyLimit || opts.PresencePenalty > penaltyLimit {
+		return fmt.Errorf("%w: presencePenalty must be between -%.1f and %.1f, got %v", ErrInvalidOptions, penaltyLimit, penaltyLimit, opts.PresencePenalty)
+	}
+	if opts.FrequencyPenalty < -penaltyLimit || opts.FrequencyPenalty > penaltyLimit {
+		return fmt.Errorf("%w: frequencyPenalty must be between -%.1f and %.1f, got %v", ErrInvalidOptions, penaltyLimit, penaltyLimit, opts.FrequencyPenalty)
+	}
+	switch opts.ResponseFormat {
+	case "", ResponseFormatText, ResponseFormatJSON:
+	default:
+		return fmt.Errorf("%w: responseFormat must be %q or %q, got %q", ErrInvalidOptions, ResponseFormatText, ResponseFormatJSON, opts.ResponseFormat)
+	}
+	if opts.ForceLanguage != "" && strings.TrimSpace(opts.ForceLanguage) == "" {
+		return fmt.Errorf("%w: forceLanguage must not be blank", ErrInvalidOptions)
+	}
+	if opts.User != "" && strings.TrimSpace(opts.User) == "" {
+		return fmt.Errorf("%w: user must not be blank", ErrInvalidOptions)
+	}
+	if opts.Source != "" && strings.TrimSpace(opts.Source) == "" {
+		return fmt.Errorf("%w: source must not be blank", ErrInvalidOptions)
+	}
+	for key := range opts.Metadata {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("%w: metadata keys must not be blank", ErrInvalidOptions)
+		}
+	}
+	if err := validateContextDocuments(opts.ContextDocuments); err != nil {
+		return err
+	}
+	for i, msg := range opts.SystemMessages {
+		if strings.TrimSpace(msg) == "" {
+			return fmt.Errorf("%w: system message %d is empty", ErrInvalidOptions, i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChatRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name        string
+		sessionID   string
+		userMessage string
+		want        error
+	}{
+		{"empty session", "", "hello", ErrEmptySessionID},
+		{"blank session", " \t\n", "hello", ErrEmptySessionID},
+		{"empty message", "s1", "", ErrEmptyMessage},
+		{"blank message", "s1", "  \n\t ", ErrEmptyMessage},
+		{"message too long", "s1", strings.Repeat("é", 11), ErrMessageTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			MaxUserMessageLength = 10
+
+			_, err := Chat(tt.sessionID, tt.userMessage)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Chat error = %v, want %v", err, tt.want)
+			}
+			if n := env.store.callCount(); n != 0 {
+				t.Errorf("a rejected turn reached the store %d times", n)
+			}
+			if n := env.model.callCount(); n != 0 {
+				t.Errorf("a rejected turn called the model %d times", n)
+			}
+		})
+	}
+}
+
+func TestChatAcceptsMessageAtTheLengthLimit(t *testing.T) {
+	env := newTestEnv(t)
+	MaxUserMessageLength = 10
+
+	env.chat("s1", strings.Repeat("é", 10)) // Counted in characters, not bytes
+}
+
+func TestMaxUserMessageLengthZeroDisablesTheLimit(t *testing.T) {
+	env := newTestEnv(t)
+	MaxUserMessageLength = 0
+
+	env.chat("s1", strings.Repeat("x", 100000))
+}
+
+func TestOversizedMessageIsRejectedByDefault(t *testing.T) {
+	env := newTestEnv(t)
+	MaxUserMessageLength = 10
+
+	if _, err := Chat("s1", strings.Repeat("x", 11)); !errors.Is(err, ErrMessageTooLong) {
+		t.Fatalf("error = %v, want ErrMessageTooLong", err)
+	}
+	if n := env.model.callCount(); n != 0 || env.store.totalNodes() != 0 {
+		t.Errorf("model called %d times and %d nodes stored for a rejected message", n, env.store.totalNodes())
+	}
+}
+
+func TestOversizedMessageIsTruncatedOnRuneBoundariesWithANote(t *testing.T) {
+	env := newTestEnv(t)
+	MaxUserMessageLength = 20
+	UserMessageLengthMode = LengthModeTruncate
+	UserTruncationNote = " [cut]"
+
+	resp := env.chat("s1", strings.Repeat("héllo wörld ", 5))
+
+	sent := env.model.lastCall(t).Messages
+	got := sent[len(sent)-1].Content
+	if !strings.HasSuffix(got, " [cut]") || !utf8.ValidString(got) || utf8.RuneCountInString(got) > 20 {
+		t.Errorf("message sent = %q, want valid UTF-8 within 20 runes ending with the note", got)
+	}
+	if kept := strings.TrimSuffix(strings.TrimSuffix(got, " [cut]"), responseEllipsis); kept == "" || !strings.HasPrefix("héllo wörld héllo wörld", kept) {
+		t.Errorf("message sent = %q, want a prefix of the original", got)
+	}
+	user := env.history("s1")[1]
+	if user.Content != got || !user.UserTruncated {
+		t.Errorf("stored user message = %+v, want the truncated text with ChatMessage.userTruncated", user)
+	}
+	if len(resp.Warnings) != 1 || !strings.HasPrefix(resp.Warnings[0], WarningUserMessageTruncated) {
+		t.Errorf("Warnings = %q, want a %s warning", resp.Warnings, WarningUserMessageTruncated)
+	}
+}
+
+func TestAMessageWithinTheLimitIsNotMarkedTruncated(t *testing.T) {
+	env := newTestEnv(t)
+	MaxUserMessageLength = 20
+	UserMessageLengthMode = LengthModeTruncate
+
+	env.chat("s1", "short")
+
+	if user := env.history("s1")[1]; user.Content != "short" || user.UserTruncated {
+		t.Errorf("stored user message = %+v, want it untouched", user)
+	}
+}
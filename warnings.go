@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+// Warning codes prefix each ChatResponse.Warnings entry ("code: detail"), so clients can match on them
+const (
+	WarningHistoryUnavailable   = "history_unavailable"    // History failed to load; the turn ran as if the session were new
+	WarningHistoryLimited       = "history_limited"        // Older messages were left out of the prompt by MaxHistoryMessages
+	WarningModelFallback        = "model_fallback"         // A later model in the chain answered because earlier ones were unavailable
+	WarningFallbackResponse     = "fallback_response"      // No model was available and FallbackResponse was returned
+	WarningResponseModerated    = "response_moderated"     // The moderator replaced the model's reply
+	WarningUserMessageTruncated = "user_message_truncated" // The user message was cut to MaxUserMessageLength before processing
+	WarningResponseTruncated    = "response_truncated"     // The reply was cut to MaxResponseChars
+	WarningNotPersisted         = "not_persisted"          // The turn could not be saved and won't appear in history
+	WarningSeedUnsupported      = "seed_unsupported"       // A Seed was requested but the model gave no sign of honoring it
+	WarningDuplicateMessage     = "duplicate_message"      // The message repeated the previous one within DuplicateMessageWindow; no new turn was run
+)
+
+// warning formats a ChatResponse.Warnings entry
+func warning(code string, format string, args ...interface{}) string {
+	return code + ": " + fmt.Sprintf(format, args...)
+}
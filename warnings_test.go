@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hypermodeinc/modus/sdk/go/pkg/models/openai"
+)
+
+// hasWarning reports whether warnings holds an entry with the given code
+func hasWarning(warnings []string, code string) bool {
+	for _, w := range warnings {
+		if strings.HasPrefix(w, code+": ") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestATruncatedResponseIsReportedAsAWarning(t *testing.T) {
+	env := newTestEnv(t)
+	MaxResponseChars = 5
+	env.model.reply("a much longer answer")
+
+	resp := env.chat("s1", "hello")
+
+	if len(resp.Warnings) != 1 || !hasWarning(resp.Warnings, WarningResponseTruncated) {
+		t.Fatalf("Warnings = %q, want one %s warning", resp.Warnings, WarningResponseTruncated)
+	}
+	if !strings.Contains(resp.Warnings[0], "to 5 characters") {
+		t.Errorf("warning = %q, want it to name the limit", resp.Warnings[0])
+	}
+}
+
+func TestATruncatedUserMessageIsReportedAsAWarning(t *testing.T) {
+	env := newTestEnv(t)
+	MaxUserMessageLength = 4
+	UserMessageLengthMode = LengthModeTruncate
+
+	resp := env.chat("s1", "far too long")
+
+	if !hasWarning(resp.Warnings, WarningUserMessageTruncated) {
+		t.Errorf("Warnings = %q, want a %s warning", resp.Warnings, WarningUserMessageTruncated)
+	}
+}
+
+func TestModelAndResponseFallbacksAreReportedAsWarnings(t *testing.T) {
+	env := newTestEnv(t)
+	if err := SetModelChain([]string{"primary", "backup"}); err != nil {
+		t.Fatal(err)
+	}
+	env.model.respond = func(call fakeModelCall) (*openai.ChatModelOutput, error) {
+		if call.Model == "primary" {
+			return nil, errors.New("503 service unavailable")
+		}
+		return textOutput("from backup"), nil
+	}
+	if resp := env.chat("s1", "hello"); !hasWarning(resp.Warnings, WarningModelFallback) {
+		t.Errorf("Warnings = %q, want a %s warning", resp.Warnings, WarningModelFallback)
+	}
+
+	EnableFallback = true
+	env.model.respond = downModel
+	if resp := env.chat("s2", "hello"); !hasWarning(resp.Warnings, WarningFallbackResponse) {
+		t.Errorf("Warnings = %q, want a %s warning", resp.Warnings, WarningFallbackResponse)
+	}
+}
+
+func TestACleanTurnHasNoWarnings(t *testing.T) {
+	env := newTestEnv(t)
+
+	if resp := env.chat("s1", "hello"); resp.Warnings != nil {
+		t.Errorf("Warnings = %q, want none", resp.Warnings)
+	}
+}
+
+func TestTrimmedHistoryReportsTheDroppedCount(t *testing.T) {
+	env := newTestEnv(t)
+	rec := &recordingLogger{}
+	SetLogger(rec)
+	env.model.reply("a1", "a2", "a3", "a4")
+	for _, q := range []string{"q1", "q2", "q3"} {
+		env.chat("s1", q) // A system prompt plus 3 turns: 7 stored messages
+	}
+
+	resp := env.chatWith("s1", "q4", ChatOptions{MaxHistoryMessages: 2})
+
+	const want = WarningHistoryLimited + ": 4 of 7 stored messages were left out of the prompt"
+	if len(resp.Warnings) != 1 || resp.Warnings[0] != want {
+		t.Errorf("Warnings = %q, want %q", resp.Warnings, want)
+	}
+	if !rec.has("DEBUG history trimmed to fit the prompt sessionID s1 dropped 4 stored 7") {
+		t.Errorf("log entries = %q, want a debug line with the dropped count", rec.entries)
+	}
+}
+
+func TestUntrimmedHistoryHasNoTrimmingWarning(t *testing.T) {
+	env := newTestEnv(t)
+	rec := &recordingLogger{}
+	SetLogger(rec)
+	env.chat("s1", "q1")
+
+	resp := env.chatWith("s1", "q2", ChatOptions{MaxHistoryMessages: 10})
+
+	if hasWarning(resp.Warnings, WarningHistoryLimited) || rec.has("DEBUG history trimmed") {
+		t.Errorf("Warnings = %q, logs = %q, want no trimming reported", resp.Warnings, rec.entries)
+	}
+}